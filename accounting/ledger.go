@@ -0,0 +1,599 @@
+// Package accounting integrates the consumption of the containers and cgroups over time, hour by
+// hour, to bill them. The consumption is saved to a directory so that it survives the restarts of
+// the daemon.
+package accounting
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Scalingo/go-netstat"
+
+	"github.com/Scalingo/acadock-monitoring/v2/client"
+	"github.com/Scalingo/acadock-monitoring/v2/collector"
+	"github.com/Scalingo/acadock-monitoring/v2/cpu"
+	"github.com/Scalingo/acadock-monitoring/v2/docker"
+	"github.com/Scalingo/acadock-monitoring/v2/net"
+	"github.com/Scalingo/acadock-monitoring/v2/resources"
+	"github.com/Scalingo/go-utils/errors/v3"
+	"github.com/Scalingo/go-utils/logger"
+)
+
+var _ collector.SnapshotListener = &Ledger{}
+
+// Names of the counters the consumption is computed from
+const (
+	counterCPU     = "cpu"
+	counterNetRx   = "net_rx"
+	counterNetTx   = "net_tx"
+	counterIORead  = "io_read"
+	counterIOWrite = "io_write"
+)
+
+const bytesPerGB = 1024 * 1024 * 1024
+
+const (
+	// stateFile contains the counters and the targets, rewritten by every save
+	stateFile = "state.json"
+	// recordsDir contains a file of records per UTC day, named after the day
+	recordsDir = "records"
+	dayLayout  = "2006-01-02"
+	dayLength  = 24 * time.Hour
+)
+
+// record is the consumption of a target during an hour
+type record struct {
+	Hour   time.Time              `json:"hour"`
+	Target string                 `json:"target"`
+	Usage  client.AccountingUsage `json:"usage"`
+}
+
+// targetInfo is the last known name and labels of a container, a cgroup has none
+type targetInfo struct {
+	Name   string            `json:"name,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// recordKey identifies a record by the Unix time of its hour, the time.Time values of the same
+// instant loaded from the file and computed from a snapshot may differ
+type recordKey struct {
+	hour   int64
+	target string
+}
+
+// counters are the last values of the counters of a target which have been accounted for
+type counters struct {
+	At time.Time `json:"at"`
+	// StartedAt is the start of the container, the counters are reset when it restarts
+	StartedAt time.Time         `json:"started_at,omitzero"`
+	Values    map[string]uint64 `json:"values"`
+}
+
+// state is the content of the state file of the ledger
+type state struct {
+	Counters map[string]counters   `json:"counters"`
+	Targets  map[string]targetInfo `json:"targets"`
+}
+
+// Ledger accounts for the consumption of the targets between every collected snapshot: the CPU
+// time, the network and IO bytes are the growth of their counters, the memory usage is integrated
+// over time. The whole consumption between two snapshots is accounted to the hour of the last one.
+//
+// The counters of a target are reset when it restarts: the consumption is then the value of the
+// counter since the restart. The last values of the counters are saved with the records, the
+// consumption of the containers while the daemon was stopped is accounted when it restarts, except
+// for the memory.
+//
+// The records are kept and saved by UTC day, only the days whose records changed since the previous
+// save are written: the file of a day is no longer written once it is over. The records older than
+// the retention are dropped when the ledger is saved, so that the collections don't walk them.
+type Ledger struct {
+	containers   docker.ContainerRepository
+	dir          string
+	saveInterval time.Duration
+	retention    time.Duration
+
+	mutex *sync.Mutex
+	// records are indexed by the Unix time of their day
+	records  map[int64]map[recordKey]*record
+	counters map[string]counters
+	targets  map[string]targetInfo
+	// lastHours are the Unix times of the last hour recorded for each target
+	lastHours map[string]int64
+	// lastSnapshotAt is the time of the last snapshot, the retention is relative to it
+	lastSnapshotAt time.Time
+	// changedDays are the Unix times of the days whose records changed since the previous save
+	changedDays map[int64]bool
+	// saveMutex prevents concurrent saves from writing the same files
+	saveMutex *sync.Mutex
+}
+
+// NewLedger returns a ledger saved to dir every saveInterval, loading the records saved by a
+// previous run of the daemon. The directory is created if needed. The records older than retention
+// are dropped.
+func NewLedger(ctx context.Context, containers docker.ContainerRepository, dir string, saveInterval, retention time.Duration) (*Ledger, error) {
+	if dir == "" {
+		return nil, errors.New(ctx, "no accounting directory")
+	}
+	ledger := &Ledger{
+		containers:   containers,
+		dir:          dir,
+		saveInterval: saveInterval,
+		retention:    retention,
+		mutex:        &sync.Mutex{},
+		records:      map[int64]map[recordKey]*record{},
+		counters:     map[string]counters{},
+		targets:      map[string]targetInfo{},
+		lastHours:    map[string]int64{},
+		changedDays:  map[int64]bool{},
+		saveMutex:    &sync.Mutex{},
+	}
+	err := os.MkdirAll(filepath.Join(dir, recordsDir), 0o700)
+	if err != nil {
+		return nil, errors.Wrap(ctx, err, "create accounting directory")
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, stateFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(ctx, err, "read accounting state")
+	}
+	if err == nil {
+		var saved state
+		err = json.Unmarshal(content, &saved)
+		if err != nil {
+			return nil, errors.Wrapf(ctx, err, "decode accounting state %s", filepath.Join(dir, stateFile))
+		}
+		if saved.Counters != nil {
+			ledger.counters = saved.Counters
+		}
+		if saved.Targets != nil {
+			ledger.targets = saved.Targets
+		}
+	}
+
+	days, err := ledger.days()
+	if err != nil {
+		return nil, errors.Wrap(ctx, err, "list accounting days")
+	}
+	for _, path := range days {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrap(ctx, err, "read accounting day")
+		}
+		var records []record
+		err = json.Unmarshal(content, &records)
+		if err != nil {
+			return nil, errors.Wrapf(ctx, err, "decode accounting day %s", path)
+		}
+		for _, savedRecord := range records {
+			ledger.add(&savedRecord)
+		}
+	}
+	return ledger, nil
+}
+
+// add indexes a record by day and by target, the mutex must be locked unless the ledger is being
+// created
+func (l *Ledger) add(targetRecord *record) {
+	day := dayOf(targetRecord.Hour)
+	dayRecords, ok := l.records[day]
+	if !ok {
+		dayRecords = map[recordKey]*record{}
+		l.records[day] = dayRecords
+	}
+	hour := targetRecord.Hour.Unix()
+	dayRecords[recordKey{hour: hour, target: targetRecord.Target}] = targetRecord
+	if hour > l.lastHours[targetRecord.Target] {
+		l.lastHours[targetRecord.Target] = hour
+	}
+}
+
+// days returns the paths of the files of the days, indexed by the Unix time of the day
+func (l *Ledger) days() (map[int64]string, error) {
+	entries, err := os.ReadDir(filepath.Join(l.dir, recordsDir))
+	if err != nil {
+		return nil, err
+	}
+	days := map[int64]string{}
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok {
+			continue
+		}
+		at, err := time.Parse(dayLayout, name)
+		if err != nil {
+			continue
+		}
+		days[at.Unix()] = filepath.Join(l.dir, recordsDir, entry.Name())
+	}
+	return days, nil
+}
+
+// dayPath returns the path of the file of the day starting at the Unix time
+func (l *Ledger) dayPath(start int64) string {
+	return filepath.Join(l.dir, recordsDir, time.Unix(start, 0).UTC().Format(dayLayout)+".json")
+}
+
+// dayOf returns the Unix time of the UTC day of an hour
+func dayOf(hour time.Time) int64 {
+	return hour.UTC().Truncate(dayLength).Unix()
+}
+
+// Start forgets the counters of the containers as they stop and saves the ledger every
+// saveInterval, until the context is canceled
+func (l *Ledger) Start(ctx context.Context) {
+	log := logger.Get(ctx)
+
+	go func() {
+		for event := range l.containers.RegisterToContainersStream(ctx) {
+			if event.Action == docker.ContainerActionStop {
+				l.mutex.Lock()
+				delete(l.counters, event.ContainerID)
+				l.mutex.Unlock()
+			}
+		}
+	}()
+
+	tick := time.NewTicker(l.saveInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+		err := l.Save(ctx)
+		if err != nil {
+			log.WithError(err).WithField("dir", l.dir).Error("Fail to save accounting")
+		}
+	}
+}
+
+func (l *Ledger) SnapshotCollected(ctx context.Context, previous *collector.Snapshot, current *collector.Snapshot, _ collector.Gauges) {
+	containersByID := map[string]docker.Container{}
+	containers, err := l.containers.Containers(ctx)
+	if err != nil {
+		// The consumption is still accounted, without the restarts detection and the labels
+		logger.Get(ctx).WithError(err).Info("Fail to list containers to account")
+	}
+	for _, container := range containers {
+		containersByID[container.ID] = container
+	}
+	hour := current.Time.UTC().Truncate(time.Hour)
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.lastSnapshotAt = current.Time
+	for id, sample := range current.Targets {
+		container := containersByID[id]
+		last, known := l.counters[id]
+		// The consumption of a container started since the previous snapshot is the whole value of
+		// its counters, the one of a target already running when it is first seen is unknown
+		restarted := !container.StartedAt.IsZero() &&
+			((known && !last.StartedAt.IsZero() && !container.StartedAt.Equal(last.StartedAt)) ||
+				(!known && previous != nil && container.StartedAt.After(previous.Time)))
+		values := sampleCounters(sample)
+
+		var usage client.AccountingUsage
+		increase := func(name string) uint64 {
+			value, ok := values[name]
+			if !ok {
+				return 0
+			}
+			if restarted {
+				return value
+			}
+			lastValue, ok := last.Values[name]
+			if !ok {
+				// The first value of a counter is the reference of the next ones
+				return 0
+			}
+			if value < lastValue {
+				// The counter has been reset, e.g. the container restarted without the inventory noticing
+				return value
+			}
+			return value - lastValue
+		}
+		usage.CPUSeconds = time.Duration(increase(counterCPU)).Seconds()
+		usage.NetRxBytes = increase(counterNetRx)
+		usage.NetTxBytes = increase(counterNetTx)
+		usage.IOReadBytes = increase(counterIORead)
+		usage.IOWriteBytes = increase(counterIOWrite)
+		usage.MemoryGBHours = memoryGBHours(previous, current, id)
+
+		// A counter missing from the sample, e.g. because its collector failed, keeps its last value
+		// so that its growth is accounted when it is collected again
+		updated := counters{At: current.Time, StartedAt: container.StartedAt, Values: values}
+		for name, value := range last.Values {
+			if _, ok := updated.Values[name]; !ok && !restarted {
+				updated.Values[name] = value
+			}
+		}
+		l.counters[id] = updated
+
+		targetRecord, ok := l.records[dayOf(hour)][recordKey{hour: hour.Unix(), target: id}]
+		if !ok {
+			targetRecord = &record{Hour: hour, Target: id}
+			l.add(targetRecord)
+		}
+		if container.ID != "" {
+			l.targets[id] = targetInfo{Name: container.Name, Labels: container.Labels}
+		}
+		targetRecord.Usage = targetRecord.Usage.Add(usage)
+		l.changedDays[dayOf(hour)] = true
+	}
+}
+
+// sampleCounters returns the values of the counters collected in the sample
+func sampleCounters(sample collector.Sample) map[string]uint64 {
+	values := map[string]uint64{}
+	if cpuUsage, ok := collector.Value[time.Duration](sample, cpu.CollectorName); ok {
+		values[counterCPU] = uint64(cpuUsage)
+	}
+	if stat, ok := collector.Value[netstat.NetworkStat](sample, net.CollectorName); ok {
+		values[counterNetRx] = stat.Received.Bytes
+		values[counterNetTx] = stat.Transmit.Bytes
+	}
+	if io, ok := collector.Value[client.IOUsage](sample, resources.IOCollectorName); ok {
+		values[counterIORead], values[counterIOWrite] = resources.IOBytes(io)
+	}
+	return values
+}
+
+// memoryGBHours integrates the memory usage of a target between both snapshots, with the mean of
+// both values
+func memoryGBHours(previous, current *collector.Snapshot, id string) float64 {
+	previousSample, _ := previous.Sample(id)
+	currentSample, _ := current.Sample(id)
+	previousMemory, ok := collector.Value[client.MemoryUsage](previousSample, resources.MemoryCollectorName)
+	if !ok {
+		return 0
+	}
+	currentMemory, ok := collector.Value[client.MemoryUsage](currentSample, resources.MemoryCollectorName)
+	if !ok {
+		return 0
+	}
+	elapsed := current.Time.Sub(previous.Time).Hours()
+	if elapsed <= 0 {
+		return 0
+	}
+	mean := (float64(previousMemory.MemoryUsage) + float64(currentMemory.MemoryUsage)) / 2
+	return mean / bytesPerGB * elapsed
+}
+
+// expire drops the records and the counters older than the retention, and the targets without any
+// record left. The days which are over are dropped at once, only the records of the day overlapping
+// the limit are walked. The mutex must be locked.
+func (l *Ledger) expire(now time.Time) {
+	limit := now.Add(-l.retention)
+	expired := func(hour time.Time) bool {
+		return hour.Add(time.Hour).Before(limit)
+	}
+	for day, dayRecords := range l.records {
+		start := time.Unix(day, 0)
+		if expired(start.Add(dayLength - time.Hour)) {
+			delete(l.records, day)
+			continue
+		}
+		if !expired(start) {
+			continue
+		}
+		for key, targetRecord := range dayRecords {
+			if expired(targetRecord.Hour) {
+				delete(dayRecords, key)
+				l.changedDays[day] = true
+			}
+		}
+		if len(dayRecords) == 0 {
+			delete(l.records, day)
+		}
+	}
+	for id, targetCounters := range l.counters {
+		if targetCounters.At.Before(limit) {
+			delete(l.counters, id)
+		}
+	}
+	for id, hour := range l.lastHours {
+		if expired(time.Unix(hour, 0)) {
+			delete(l.lastHours, id)
+		}
+	}
+	for id := range l.targets {
+		if _, ok := l.lastHours[id]; !ok {
+			delete(l.targets, id)
+		}
+	}
+}
+
+// Save drops the records older than the retention, writes the state of the ledger and the days
+// whose records changed since the previous save, and deletes the files of the days without any
+// record left. The previous content of a file is only replaced once it has been completely written.
+func (l *Ledger) Save(ctx context.Context) error {
+	l.saveMutex.Lock()
+	defer l.saveMutex.Unlock()
+
+	// The ledger is copied so that it isn't locked while it is encoded and written
+	l.mutex.Lock()
+	if !l.lastSnapshotAt.IsZero() {
+		l.expire(l.lastSnapshotAt)
+	}
+	saved := state{Counters: maps.Clone(l.counters), Targets: maps.Clone(l.targets)}
+	changedDays := l.changedDays
+	l.changedDays = map[int64]bool{}
+	recordedDays := map[int64]bool{}
+	records := map[int64][]record{}
+	for day, dayRecords := range l.records {
+		recordedDays[day] = true
+		if !changedDays[day] {
+			continue
+		}
+		for _, targetRecord := range dayRecords {
+			records[day] = append(records[day], *targetRecord)
+		}
+	}
+	l.mutex.Unlock()
+
+	err := l.save(ctx, saved, records)
+	if err != nil {
+		// The days are written again by the next save
+		l.mutex.Lock()
+		for day := range changedDays {
+			l.changedDays[day] = true
+		}
+		l.mutex.Unlock()
+		return err
+	}
+
+	days, err := l.days()
+	if err != nil {
+		return errors.Wrap(ctx, err, "list accounting days")
+	}
+	for day, path := range days {
+		if recordedDays[day] {
+			continue
+		}
+		err := os.Remove(path)
+		if err != nil {
+			return errors.Wrap(ctx, err, "remove expired accounting day")
+		}
+	}
+	return nil
+}
+
+func (l *Ledger) save(ctx context.Context, saved state, records map[int64][]record) error {
+	content, err := json.Marshal(saved)
+	if err != nil {
+		return errors.Wrap(ctx, err, "encode accounting state")
+	}
+	err = writeFile(ctx, filepath.Join(l.dir, stateFile), content)
+	if err != nil {
+		return errors.Wrap(ctx, err, "write accounting state")
+	}
+
+	for day, dayRecords := range records {
+		slices.SortFunc(dayRecords, func(a, b record) int {
+			if cmp := a.Hour.Compare(b.Hour); cmp != 0 {
+				return cmp
+			}
+			return strings.Compare(a.Target, b.Target)
+		})
+		content, err := json.Marshal(dayRecords)
+		if err != nil {
+			return errors.Wrap(ctx, err, "encode accounting day")
+		}
+		err = writeFile(ctx, l.dayPath(day), content)
+		if err != nil {
+			return errors.Wrap(ctx, err, "write accounting day")
+		}
+	}
+	return nil
+}
+
+// writeFile replaces the content of the file at path once content has been completely written to a
+// temporary file
+func writeFile(ctx context.Context, path string, content []byte) error {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return errors.Wrap(ctx, err, "create temporary file")
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(content)
+	if err != nil {
+		file.Close()
+		return errors.Wrap(ctx, err, "write temporary file")
+	}
+	err = file.Sync()
+	if err != nil {
+		file.Close()
+		return errors.Wrap(ctx, err, "sync temporary file")
+	}
+	err = file.Close()
+	if err != nil {
+		return errors.Wrap(ctx, err, "close temporary file")
+	}
+	err = os.Rename(file.Name(), path)
+	if err != nil {
+		return errors.Wrap(ctx, err, "replace file")
+	}
+	return nil
+}
+
+// Accounting returns the consumption of the targets during the hours overlapping the period from
+// from to to. If selectors are given, only the containers matching them are returned. If groupBy
+// is not empty, the consumption of the containers is also aggregated by value of this label, the
+// containers without this label are not part of any group.
+func (l *Ledger) Accounting(from, to time.Time, selectors docker.LabelSelectors, groupBy string) client.Accounting {
+	from = from.UTC().Truncate(time.Hour)
+	if rounded := to.UTC().Truncate(time.Hour); !rounded.Equal(to) {
+		to = rounded.Add(time.Hour)
+	}
+	to = to.UTC()
+
+	// The name and the labels of a target are the last known ones
+	targets := map[string]*client.TargetAccounting{}
+	l.mutex.Lock()
+	for day, dayRecords := range l.records {
+		start := time.Unix(day, 0)
+		if !start.Add(dayLength).After(from) || !start.Before(to) {
+			continue
+		}
+		for _, targetRecord := range dayRecords {
+			if targetRecord.Hour.Before(from) || !targetRecord.Hour.Before(to) {
+				continue
+			}
+			accounted, ok := targets[targetRecord.Target]
+			if !ok {
+				info := l.targets[targetRecord.Target]
+				accounted = &client.TargetAccounting{Target: targetRecord.Target, Name: info.Name, Labels: info.Labels}
+				targets[targetRecord.Target] = accounted
+			}
+			accounted.Usage = accounted.Usage.Add(targetRecord.Usage)
+		}
+	}
+	l.mutex.Unlock()
+
+	accounting := client.Accounting{From: from, To: to, Targets: []client.TargetAccounting{}}
+	for _, target := range targets {
+		// Only the containers have a name, the selectors never match a cgroup
+		if len(selectors) > 0 && (target.Name == "" || !selectors.Matches(target.Labels)) {
+			continue
+		}
+		accounting.Targets = append(accounting.Targets, *target)
+	}
+	slices.SortFunc(accounting.Targets, func(a, b client.TargetAccounting) int {
+		return strings.Compare(a.Target, b.Target)
+	})
+
+	if groupBy == "" {
+		return accounting
+	}
+	accounting.GroupBy = groupBy
+	accounting.Groups = []client.GroupAccounting{}
+	groups := map[string]int{}
+	for _, target := range accounting.Targets {
+		value, ok := target.Labels[groupBy]
+		if !ok {
+			continue
+		}
+		index, ok := groups[value]
+		if !ok {
+			index = len(accounting.Groups)
+			groups[value] = index
+			accounting.Groups = append(accounting.Groups, client.GroupAccounting{Value: value})
+		}
+		accounting.Groups[index].Targets++
+		accounting.Groups[index].Usage = accounting.Groups[index].Usage.Add(target.Usage)
+	}
+	slices.SortFunc(accounting.Groups, func(a, b client.GroupAccounting) int {
+		return strings.Compare(a.Value, b.Value)
+	})
+	return accounting
+}
@@ -0,0 +1,232 @@
+package accounting
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Scalingo/acadock-monitoring/v2/client"
+	"github.com/Scalingo/acadock-monitoring/v2/collector"
+	"github.com/Scalingo/acadock-monitoring/v2/cpu"
+	"github.com/Scalingo/acadock-monitoring/v2/docker"
+	"github.com/Scalingo/acadock-monitoring/v2/docker/dockermock"
+	"github.com/Scalingo/acadock-monitoring/v2/net"
+	"github.com/Scalingo/acadock-monitoring/v2/resources"
+	"github.com/Scalingo/go-netstat"
+)
+
+const nginx = "system.slice/nginx.service"
+
+// sample returns the sample of a target having used cpuSeconds of CPU time, received rx bytes, read
+// read bytes and using memory bytes
+func sample(cpuSeconds, rx, read, memory uint64) collector.Sample {
+	var stat netstat.NetworkStat
+	stat.Received.Bytes = rx
+	return collector.Sample{
+		cpu.CollectorName:             time.Duration(cpuSeconds) * time.Second,
+		net.CollectorName:             stat,
+		resources.IOCollectorName:     client.IOUsage{Devices: []client.IODeviceUsage{{ReadBytes: read}}},
+		resources.MemoryCollectorName: client.MemoryUsage{MemoryUsage: memory},
+	}
+}
+
+func TestLedger(t *testing.T) {
+	ctx := t.Context()
+	ctrl := gomock.NewController(t)
+	containers := dockermock.NewMockContainerRepository(ctrl)
+	start := time.Date(2026, 3, 1, 10, 10, 0, 0, time.UTC)
+	inventory := []docker.Container{
+		{ID: "1", Name: "web-1", Labels: map[string]string{"app": "web"}, StartedAt: start.Add(-time.Hour)},
+		{ID: "2", Name: "worker-1", Labels: map[string]string{"app": "worker"}, StartedAt: start.Add(-time.Hour)},
+	}
+	containers.EXPECT().Containers(gomock.Any()).DoAndReturn(func(_ any) ([]docker.Container, error) {
+		return inventory, nil
+	}).AnyTimes()
+
+	dir := t.TempDir()
+	ledger, err := NewLedger(ctx, containers, dir, time.Minute, 24*time.Hour)
+	require.NoError(t, err)
+
+	var previous *collector.Snapshot
+	collect := func(at time.Time, targets map[string]collector.Sample) {
+		current := &collector.Snapshot{Time: at, Targets: targets}
+		ledger.SnapshotCollected(ctx, previous, current, nil)
+		previous = current
+	}
+	gb := uint64(bytesPerGB)
+
+	// The first values of the counters are the reference of the next ones
+	collect(start, map[string]collector.Sample{"1": sample(100, 1000, 0, gb), "2": sample(50, 0, 0, 2*gb), nginx: sample(10, 0, 0, 0)})
+	collect(start.Add(10*time.Second), map[string]collector.Sample{"1": sample(102, 1500, 100, gb), "2": sample(51, 0, 0, 2*gb), nginx: sample(11, 0, 0, 0)})
+	collect(start.Add(20*time.Second), map[string]collector.Sample{"1": sample(105, 2500, 300, gb), "2": sample(52, 0, 0, 2*gb), nginx: sample(12, 0, 0, 0)})
+
+	accounting := ledger.Accounting(start.Add(-time.Hour), start.Add(time.Hour), nil, "")
+	assert.Equal(t, time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC), accounting.From)
+	assert.Equal(t, time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC), accounting.To)
+	require.Len(t, accounting.Targets, 3)
+	web := accounting.Targets[0]
+	assert.Equal(t, "1", web.Target)
+	assert.Equal(t, "web-1", web.Name)
+	assert.Equal(t, 5.0, web.Usage.CPUSeconds)
+	assert.Equal(t, uint64(1500), web.Usage.NetRxBytes)
+	assert.Equal(t, uint64(300), web.Usage.IOReadBytes)
+	assert.InDelta(t, 20.0/3600, web.Usage.MemoryGBHours, 0.000001)
+	assert.Equal(t, nginx, accounting.Targets[2].Target)
+	assert.Empty(t, accounting.Targets[2].Name)
+
+	// The web container restarted without the inventory noticing: its counters are reset. Then the
+	// inventory reports its restart, the counters are accounted from zero even if they grew.
+	collect(start.Add(30*time.Second), map[string]collector.Sample{"1": sample(1, 200, 50, gb)})
+	inventory[0].StartedAt = start.Add(35 * time.Second)
+	collect(start.Add(40*time.Second), map[string]collector.Sample{"1": sample(2, 2700, 400, gb)})
+	web = ledger.Accounting(start, start, nil, "").Targets[0]
+	assert.Equal(t, 5.0+1+2, web.Usage.CPUSeconds)
+	assert.Equal(t, uint64(1500+200+2700), web.Usage.NetRxBytes)
+	assert.Equal(t, uint64(300+50+400), web.Usage.IOReadBytes)
+
+	// A container started since the previous snapshot is accounted from zero, a container already
+	// running when it's first seen isn't
+	inventory = append(inventory,
+		docker.Container{ID: "3", Name: "web-2", Labels: map[string]string{"app": "web"}, StartedAt: start.Add(45 * time.Second)},
+		docker.Container{ID: "4", Name: "web-3", Labels: map[string]string{"app": "web"}, StartedAt: start.Add(-time.Hour)},
+	)
+	collect(start.Add(50*time.Second), map[string]collector.Sample{"3": sample(4, 0, 0, 0), "4": sample(1000, 0, 0, 0)})
+	accounting = ledger.Accounting(start, start, nil, "")
+	require.Len(t, accounting.Targets, 5)
+	assert.Equal(t, 4.0, accounting.Targets[2].Usage.CPUSeconds)
+	assert.Equal(t, 0.0, accounting.Targets[3].Usage.CPUSeconds)
+
+	// The consumption can be aggregated by value of a label, the cgroups and the containers without
+	// this label aren't part of any group
+	accounting = ledger.Accounting(start, start, nil, "app")
+	assert.Equal(t, "app", accounting.GroupBy)
+	require.Len(t, accounting.Groups, 2)
+	assert.Equal(t, "web", accounting.Groups[0].Value)
+	assert.Equal(t, 3, accounting.Groups[0].Targets)
+	assert.Equal(t, 8.0+4, accounting.Groups[0].Usage.CPUSeconds)
+	assert.Equal(t, "worker", accounting.Groups[1].Value)
+	assert.Equal(t, 2.0, accounting.Groups[1].Usage.CPUSeconds)
+	assert.InDelta(t, 2*20.0/3600, accounting.Groups[1].Usage.MemoryGBHours, 0.000001)
+
+	selectors, err := docker.ParseLabelSelectors(ctx, []string{"app!=web"})
+	require.NoError(t, err)
+	accounting = ledger.Accounting(start, start, selectors, "")
+	require.Len(t, accounting.Targets, 1)
+	assert.Equal(t, "2", accounting.Targets[0].Target)
+
+	// The hours outside of the period are ignored
+	accounting = ledger.Accounting(start.Add(time.Hour), start.Add(2*time.Hour), nil, "app")
+	assert.Empty(t, accounting.Targets)
+	assert.NotNil(t, accounting.Targets)
+	assert.Empty(t, accounting.Groups)
+
+	// After a restart of the daemon, the consumption since the last saved counters is accounted to
+	// the hour of the first snapshot, except for the memory
+	require.NoError(t, ledger.Save(ctx))
+	ledger, err = NewLedger(ctx, containers, dir, time.Minute, 24*time.Hour)
+	require.NoError(t, err)
+	previous = nil
+	collect(start.Add(time.Hour), map[string]collector.Sample{"1": sample(12, 2700, 400, 10*gb)})
+	accounting = ledger.Accounting(start, start.Add(time.Hour), nil, "")
+	require.Len(t, accounting.Targets, 5)
+	assert.Equal(t, 8.0+10, accounting.Targets[0].Usage.CPUSeconds)
+	assert.InDelta(t, 40.0/3600, accounting.Targets[0].Usage.MemoryGBHours, 0.000001)
+	accounting = ledger.Accounting(start.Add(time.Hour), start.Add(time.Hour), nil, "")
+	require.Len(t, accounting.Targets, 1)
+	assert.Equal(t, 10.0, accounting.Targets[0].Usage.CPUSeconds)
+
+	// The records older than the retention are dropped when the ledger is saved
+	collect(start.Add(25*time.Hour), map[string]collector.Sample{"1": sample(13, 2700, 400, 10*gb)})
+	require.Len(t, ledger.Accounting(start.Add(-time.Hour), start.Add(26*time.Hour), nil, "").Targets, 5)
+	require.NoError(t, ledger.Save(ctx))
+	accounting = ledger.Accounting(start.Add(-time.Hour), start.Add(26*time.Hour), nil, "")
+	require.Len(t, accounting.Targets, 1)
+	assert.Len(t, ledger.targets, 1)
+	assert.Equal(t, 10.0+1, accounting.Targets[0].Usage.CPUSeconds)
+}
+
+func TestNewLedger(t *testing.T) {
+	ctx := t.Context()
+	ctrl := gomock.NewController(t)
+	containers := dockermock.NewMockContainerRepository(ctrl)
+
+	// The ledger is created empty if the directory doesn't exist yet
+	dir := filepath.Join(t.TempDir(), "accounting")
+	ledger, err := NewLedger(ctx, containers, dir, time.Minute, time.Hour)
+	require.NoError(t, err)
+	assert.Empty(t, ledger.records)
+	assert.DirExists(t, filepath.Join(dir, recordsDir))
+
+	_, err = NewLedger(ctx, containers, "", time.Minute, time.Hour)
+	assert.ErrorContains(t, err, "no accounting directory")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, stateFile), []byte("{"), 0o600))
+	_, err = NewLedger(ctx, containers, dir, time.Minute, time.Hour)
+	assert.ErrorContains(t, err, "decode accounting state")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, stateFile), []byte("{}"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, recordsDir, "2026-03-01.json"), []byte("{"), 0o600))
+	_, err = NewLedger(ctx, containers, dir, time.Minute, time.Hour)
+	assert.ErrorContains(t, err, "decode accounting day")
+}
+
+func TestLedger_Save(t *testing.T) {
+	ctx := t.Context()
+	ctrl := gomock.NewController(t)
+	containers := dockermock.NewMockContainerRepository(ctrl)
+	containers.EXPECT().Containers(gomock.Any()).Return([]docker.Container{
+		{ID: "1", Name: "web-1", Labels: map[string]string{"app": "web"}},
+	}, nil).AnyTimes()
+
+	dir := t.TempDir()
+	ledger, err := NewLedger(ctx, containers, dir, time.Minute, 48*time.Hour)
+	require.NoError(t, err)
+	start := time.Date(2026, 3, 1, 23, 0, 0, 0, time.UTC)
+	var previous *collector.Snapshot
+	collect := func(at time.Time, cpuSeconds uint64) {
+		current := &collector.Snapshot{Time: at, Targets: map[string]collector.Sample{"1": sample(cpuSeconds, 0, 0, 0)}}
+		ledger.SnapshotCollected(ctx, previous, current, nil)
+		previous = current
+	}
+	firstDay := filepath.Join(dir, recordsDir, "2026-03-01.json")
+	secondDay := filepath.Join(dir, recordsDir, "2026-03-02.json")
+
+	// The name and the labels of the containers are saved once, with the counters
+	collect(start, 10)
+	collect(start.Add(30*time.Minute), 12)
+	collect(start.Add(90*time.Minute), 15)
+	require.NoError(t, ledger.Save(ctx))
+	content, err := os.ReadFile(filepath.Join(dir, stateFile))
+	require.NoError(t, err)
+	assert.Contains(t, string(content), `"targets":{"1":{"name":"web-1","labels":{"app":"web"}}}`)
+	content, err = os.ReadFile(firstDay)
+	require.NoError(t, err)
+	assert.NotContains(t, string(content), "web-1")
+	assert.FileExists(t, secondDay)
+
+	// The file of a day which is over isn't written anymore
+	require.NoError(t, os.Remove(firstDay))
+	collect(start.Add(2*time.Hour), 16)
+	require.NoError(t, ledger.Save(ctx))
+	assert.NoFileExists(t, firstDay)
+
+	ledger, err = NewLedger(ctx, containers, dir, time.Minute, 48*time.Hour)
+	require.NoError(t, err)
+	// The records of the first day have been removed with its file
+	accounting := ledger.Accounting(start, start.Add(3*time.Hour), nil, "")
+	require.Len(t, accounting.Targets, 1)
+	assert.Equal(t, "web-1", accounting.Targets[0].Name)
+	assert.Equal(t, 3.0+1, accounting.Targets[0].Usage.CPUSeconds)
+
+	// The file of a day is deleted once all its records are expired
+	previous = nil
+	collect(start.Add(74*time.Hour), 20)
+	require.NoError(t, ledger.Save(ctx))
+	assert.NoFileExists(t, secondDay)
+	assert.FileExists(t, filepath.Join(dir, recordsDir, "2026-03-05.json"))
+}
@@ -0,0 +1,303 @@
+// Package alerts evaluates threshold rules against every collected snapshot and notifies the
+// alerts firing and resolved to a webhook.
+package alerts
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Scalingo/acadock-monitoring/v2/client"
+	"github.com/Scalingo/acadock-monitoring/v2/collector"
+	"github.com/Scalingo/acadock-monitoring/v2/config"
+	"github.com/Scalingo/acadock-monitoring/v2/docker"
+	"github.com/Scalingo/acadock-monitoring/v2/forecast"
+	"github.com/Scalingo/acadock-monitoring/v2/gauges"
+	"github.com/Scalingo/acadock-monitoring/v2/resources"
+	"github.com/Scalingo/go-utils/errors/v3"
+	"github.com/Scalingo/go-utils/logger"
+)
+
+var _ collector.SnapshotListener = &Engine{}
+
+// Metrics computed in addition to the gauges
+const (
+	// MemoryPercent is the memory usage of a target in percents of its limit, it is absent if the
+	// memory isn't limited
+	MemoryPercent = "memory_percent"
+	// MemorySecondsUntilLimit is the forecast time until the memory usage of a target reaches its
+	// limit, it is absent if the usage isn't expected to reach it
+	MemorySecondsUntilLimit = "memory_seconds_until_limit"
+)
+
+// Metrics are the names of the metrics the rules can be based on
+var Metrics = []string{
+	gauges.HostCPU, gauges.CPU, gauges.CPUThrottled, gauges.Memory, MemoryPercent, MemorySecondsUntilLimit,
+	gauges.IOReadBps, gauges.IOWriteBps, gauges.NetRxBps, gauges.NetTxBps,
+}
+
+// notificationsQueueSize is the number of notifications waiting for the webhook after which the
+// new ones are dropped, so that a slow receiver doesn't block the collection
+const notificationsQueueSize = 100
+
+type rule struct {
+	config.AlertRule
+	selectors docker.LabelSelectors
+}
+
+func (r rule) matches(value float64) bool {
+	switch r.Comparison {
+	case ">":
+		return value > r.Threshold
+	case ">=":
+		return value >= r.Threshold
+	case "<":
+		return value < r.Threshold
+	case "<=":
+		return value <= r.Threshold
+	}
+	return false
+}
+
+type alertKey struct {
+	rule   string
+	target string
+}
+
+// Engine evaluates the rules against every collected snapshot. An alert is pending as soon as the
+// value of the metric of a target matches the rule, and fires once it has matched it for the
+// duration of the rule. It is resolved when the value doesn't match anymore, when the container
+// doesn't match the selectors anymore or when it stops. A cgroup missing from a snapshot has its
+// alerts resolved. A target whose metric is missing from a snapshot, or a container missing from
+// it, e.g. because its collectors failed, keeps its alerts unchanged. The rules are evaluated
+// against the host and the cgroups even while the containers can't be listed, the alerts of the
+// containers are then kept unchanged.
+type Engine struct {
+	containers docker.ContainerRepository
+	forecast   *forecast.Monitor
+	rules      []rule
+	webhook    *Webhook
+
+	notifications chan client.Alert
+	mutex         *sync.Mutex
+	alerts        map[alertKey]*client.Alert
+}
+
+// NewEngine returns an engine evaluating the rules. The forecast is needed by the rules based on
+// MemorySecondsUntilLimit. The alerts are only listed if webhook is nil.
+func NewEngine(ctx context.Context, containers docker.ContainerRepository, forecast *forecast.Monitor, rules []config.AlertRule, webhook *Webhook) (*Engine, error) {
+	engine := &Engine{
+		containers:    containers,
+		forecast:      forecast,
+		webhook:       webhook,
+		notifications: make(chan client.Alert, notificationsQueueSize),
+		mutex:         &sync.Mutex{},
+		alerts:        map[alertKey]*client.Alert{},
+	}
+	for _, alertRule := range rules {
+		if !slices.Contains(Metrics, alertRule.Metric) {
+			return nil, errors.Newf(ctx, "rule '%s': unknown metric '%s'", alertRule.Name, alertRule.Metric)
+		}
+		if alertRule.Metric == MemorySecondsUntilLimit && forecast == nil {
+			return nil, errors.Newf(ctx, "rule '%s': the memory forecast is not available", alertRule.Name)
+		}
+		selectors, err := docker.ParseLabelSelectors(ctx, alertRule.LabelSelectors)
+		if err != nil {
+			return nil, errors.Wrapf(ctx, err, "rule '%s'", alertRule.Name)
+		}
+		engine.rules = append(engine.rules, rule{AlertRule: alertRule, selectors: selectors})
+	}
+	return engine, nil
+}
+
+// Start delivers the notifications to the webhook until the context is canceled
+func (e *Engine) Start(ctx context.Context) {
+	log := logger.Get(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case alert := <-e.notifications:
+			err := e.webhook.Send(ctx, alert)
+			if err != nil {
+				log.WithError(err).WithField("rule", alert.Rule).WithField("target", alert.Target).Error("Fail to notify alert")
+			}
+		}
+	}
+}
+
+func (e *Engine) SnapshotCollected(ctx context.Context, previous *collector.Snapshot, current *collector.Snapshot, computed collector.Gauges) {
+	if len(e.rules) == 0 {
+		return
+	}
+	log := logger.Get(ctx)
+
+	containers, err := e.containers.Containers(ctx)
+	listed := err == nil
+	if errors.Is(err, docker.ErrInventoryNotSynced) {
+		log.WithError(err).Info("Containers inventory not synchronized, alert rules not evaluated for the containers")
+	} else if err != nil {
+		log.WithError(err).Error("Fail to list containers, alert rules not evaluated for the containers")
+	}
+	containersByID := map[string]docker.Container{}
+	for _, container := range containers {
+		containersByID[container.ID] = container
+	}
+	values := e.values(current, computed)
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	evaluated := map[alertKey]bool{}
+	for _, rule := range e.rules {
+		for target, targetValues := range values {
+			if !listed && isContainer(target) {
+				continue
+			}
+			container, isListed := containersByID[target]
+			if len(rule.selectors) > 0 && (!isListed || !rule.selectors.Matches(container.Labels)) {
+				continue
+			}
+			key := alertKey{rule: rule.Name, target: target}
+			evaluated[key] = true
+			value, ok := targetValues[rule.Metric]
+			if !ok {
+				continue
+			}
+			alert, active := e.alerts[key]
+			if !rule.matches(value) {
+				if active {
+					e.resolve(ctx, key, current.Time)
+				}
+				continue
+			}
+
+			if !active {
+				alert = &client.Alert{
+					Rule:       rule.Name,
+					Metric:     rule.Metric,
+					Comparison: rule.Comparison,
+					Threshold:  rule.Threshold,
+					Target:     target,
+					Name:       container.Name,
+					Labels:     container.Labels,
+					State:      client.AlertStatePending,
+					ActiveAt:   current.Time,
+				}
+				e.alerts[key] = alert
+			}
+			alert.Value = value
+			if alert.State == client.AlertStatePending && current.Time.Sub(alert.ActiveAt) >= rule.For {
+				firedAt := current.Time
+				alert.State = client.AlertStateFiring
+				alert.FiredAt = &firedAt
+				e.notify(ctx, *alert)
+			}
+		}
+	}
+
+	// The alerts of the containers which don't match the selectors anymore and of the cgroups which
+	// disappeared are resolved. The containers missing from the snapshot are resolved once they stop.
+	for key := range e.alerts {
+		if isContainer(key.target) && !listed {
+			continue
+		}
+		_, inSnapshot := values[key.target]
+		if (inSnapshot && !evaluated[key]) || (!inSnapshot && !isContainer(key.target)) {
+			e.resolve(ctx, key, current.Time)
+		}
+	}
+}
+
+// values returns the metrics of the host and of the targets of the current snapshot, a target
+// without any metric is present with an empty map. The gauges computed by the scheduler are shared
+// with the other listeners: the maps of the targets are copied before the memory metrics are added.
+func (e *Engine) values(current *collector.Snapshot, computed collector.Gauges) gauges.Values {
+	values := make(gauges.Values, len(computed))
+	maps.Copy(values, computed)
+	if values[gauges.HostTarget] == nil {
+		values[gauges.HostTarget] = map[string]float64{}
+	}
+	for id, sample := range current.Targets {
+		values[id] = maps.Clone(computed[id])
+		if values[id] == nil {
+			values[id] = map[string]float64{}
+		}
+		memory, ok := collector.Value[client.MemoryUsage](sample, resources.MemoryCollectorName)
+		if !ok {
+			continue
+		}
+		if resources.IsMemoryLimited(memory.MemoryLimit) {
+			values[id][MemoryPercent] = float64(memory.MemoryUsage) / float64(memory.MemoryLimit) * 100
+		}
+		if e.forecast != nil {
+			if seconds, ok := e.forecast.SecondsUntilMemoryLimit(id, memory.MemoryLimit); ok {
+				values[id][MemorySecondsUntilLimit] = float64(seconds)
+			}
+		}
+	}
+	return values
+}
+
+// isContainer returns whether the target is a container rather than the host or a cgroup, which
+// are identified by their path
+func isContainer(target string) bool {
+	return target != gauges.HostTarget && !strings.Contains(target, "/")
+}
+
+// resolve removes an alert, it is notified if it was firing. The mutex must be locked.
+func (e *Engine) resolve(ctx context.Context, key alertKey, at time.Time) {
+	alert := e.alerts[key]
+	delete(e.alerts, key)
+	if alert.State != client.AlertStateFiring {
+		return
+	}
+	alert.State = client.AlertStateResolved
+	alert.ResolvedAt = &at
+	e.notify(ctx, *alert)
+}
+
+// Remove resolves the alerts of a target, it is called once the container stops
+func (e *Engine) Remove(target string) {
+	ctx := context.Background()
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	for key := range e.alerts {
+		if key.target == target {
+			e.resolve(ctx, key, time.Now())
+		}
+	}
+}
+
+// notify queues the alert for the webhook, the alert is dropped if the queue is full
+func (e *Engine) notify(ctx context.Context, alert client.Alert) {
+	if e.webhook == nil {
+		return
+	}
+	select {
+	case e.notifications <- alert:
+	default:
+		logger.Get(ctx).WithField("rule", alert.Rule).WithField("target", alert.Target).Error("Alert notifications queue is full, drop the notification")
+	}
+}
+
+// Alerts returns the pending and firing alerts, sorted by rule and target
+func (e *Engine) Alerts() client.Alerts {
+	e.mutex.Lock()
+	alerts := make(client.Alerts, 0, len(e.alerts))
+	for _, alert := range e.alerts {
+		alerts = append(alerts, *alert)
+	}
+	e.mutex.Unlock()
+
+	slices.SortFunc(alerts, func(a, b client.Alert) int {
+		if cmp := strings.Compare(a.Rule, b.Rule); cmp != 0 {
+			return cmp
+		}
+		return strings.Compare(a.Target, b.Target)
+	})
+	return alerts
+}
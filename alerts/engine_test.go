@@ -0,0 +1,231 @@
+package alerts
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Scalingo/acadock-monitoring/v2/cgroup"
+	"github.com/Scalingo/acadock-monitoring/v2/client"
+	"github.com/Scalingo/acadock-monitoring/v2/collector"
+	"github.com/Scalingo/acadock-monitoring/v2/collector/collectortest"
+	"github.com/Scalingo/acadock-monitoring/v2/config"
+	"github.com/Scalingo/acadock-monitoring/v2/cpu"
+	"github.com/Scalingo/acadock-monitoring/v2/docker"
+	"github.com/Scalingo/acadock-monitoring/v2/docker/dockermock"
+	"github.com/Scalingo/acadock-monitoring/v2/gauges"
+	"github.com/Scalingo/acadock-monitoring/v2/resources"
+)
+
+func TestEngine(t *testing.T) {
+	ctx := t.Context()
+	ctrl := gomock.NewController(t)
+	containers := dockermock.NewMockContainerRepository(ctrl)
+	containers.EXPECT().Containers(gomock.Any()).Return([]docker.Container{
+		{ID: "1", Name: "web-1", Labels: map[string]string{"app": "web"}},
+		{ID: "2", Name: "worker-1", Labels: map[string]string{"app": "worker"}},
+	}, nil).AnyTimes()
+
+	_, err := NewEngine(ctx, containers, nil, []config.AlertRule{{Name: "disk_full", Metric: "disk", Comparison: ">"}}, nil)
+	assert.ErrorContains(t, err, "rule 'disk_full': unknown metric 'disk'")
+	_, err = NewEngine(ctx, containers, nil, []config.AlertRule{{Name: "oom_soon", Metric: MemorySecondsUntilLimit, Comparison: "<"}}, nil)
+	assert.ErrorContains(t, err, "rule 'oom_soon': the memory forecast is not available")
+
+	notifications := make(chan client.Alert, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		var alert client.Alert
+		assert.NoError(t, json.NewDecoder(req.Body).Decode(&alert))
+		notifications <- alert
+	}))
+	defer receiver.Close()
+
+	rules := []config.AlertRule{{
+		Name: "memory_full", Metric: MemoryPercent, Comparison: ">", Threshold: 90, For: 2 * time.Second,
+		LabelSelectors: []string{"app=web"},
+	}}
+	engine, err := NewEngine(ctx, containers, nil, rules, NewWebhook(receiver.URL, 1, time.Millisecond))
+	require.NoError(t, err)
+	go engine.Start(ctx)
+
+	start := time.Now().Truncate(time.Second)
+	steps := []map[string]uint64{
+		{"1": 50, "2": 95},
+		{"1": 95, "2": 95},
+		{"1": 96, "2": 95},
+		{"1": 97, "2": 95},
+		{"1": 50, "2": 95},
+		{"1": 95, "2": 95},
+		{"2": 95},
+		{"1": 96, "2": 95},
+	}
+	// The containers use the percents of the steps of their 1000 bytes memory limit
+	series := collectortest.Series{Start: start, Interval: time.Second, Targets: func(i int) map[string]collector.Sample {
+		targets := map[string]collector.Sample{}
+		for id, percents := range steps[i] {
+			targets[id] = collector.Sample{
+				resources.MemoryCollectorName: client.MemoryUsage{MemoryUsage: 10 * percents, MemoryLimit: 1000},
+			}
+		}
+		return targets
+	}}
+	series.Notify(ctx, engine, len(steps), func(i int) {
+		switch i {
+		case 0:
+			assert.Empty(t, engine.Alerts())
+		case 2:
+			// The container 2 doesn't match the selector of the rule
+			alerts := engine.Alerts()
+			require.Len(t, alerts, 1)
+			assert.Equal(t, "1", alerts[0].Target)
+			assert.Equal(t, "web-1", alerts[0].Name)
+			assert.Equal(t, client.AlertStatePending, alerts[0].State)
+			assert.Equal(t, start.Add(time.Second), alerts[0].ActiveAt)
+			assert.InDelta(t, 96, alerts[0].Value, 0.001)
+			assert.Nil(t, alerts[0].FiredAt)
+		case 3:
+			alerts := engine.Alerts()
+			require.Len(t, alerts, 1)
+			assert.Equal(t, client.AlertStateFiring, alerts[0].State)
+
+			alert := <-notifications
+			assert.Equal(t, client.AlertStateFiring, alert.State)
+			assert.Equal(t, "memory_full", alert.Rule)
+			assert.Equal(t, map[string]string{"app": "web"}, alert.Labels)
+			require.NotNil(t, alert.FiredAt)
+			assert.True(t, start.Add(3*time.Second).Equal(*alert.FiredAt))
+		case 4:
+			assert.Empty(t, engine.Alerts())
+
+			alert := <-notifications
+			assert.Equal(t, client.AlertStateResolved, alert.State)
+			require.NotNil(t, alert.ResolvedAt)
+			assert.True(t, start.Add(4*time.Second).Equal(*alert.ResolvedAt))
+		case 5:
+			assert.Len(t, engine.Alerts(), 1)
+		case 6:
+			// The alert of a container missing from the snapshot, e.g. because its collectors failed,
+			// is kept
+			alerts := engine.Alerts()
+			require.Len(t, alerts, 1)
+			assert.Equal(t, client.AlertStatePending, alerts[0].State)
+			assert.Equal(t, start.Add(5*time.Second), alerts[0].ActiveAt)
+		case 7:
+			alerts := engine.Alerts()
+			require.Len(t, alerts, 1)
+			assert.Equal(t, client.AlertStateFiring, alerts[0].State)
+
+			alert := <-notifications
+			assert.Equal(t, client.AlertStateFiring, alert.State)
+			assert.True(t, start.Add(7*time.Second).Equal(*alert.FiredAt))
+		}
+	})
+
+	// The alerts of a container are resolved once it stops
+	engine.Remove("1")
+	alert := <-notifications
+	assert.Equal(t, client.AlertStateResolved, alert.State)
+	assert.Equal(t, "1", alert.Target)
+	assert.Empty(t, engine.Alerts())
+	assert.Empty(t, notifications)
+}
+
+func TestEngine_CPUThrottled(t *testing.T) {
+	ctx := t.Context()
+	ctrl := gomock.NewController(t)
+	containers := dockermock.NewMockContainerRepository(ctrl)
+	containers.EXPECT().Containers(gomock.Any()).Return([]docker.Container{{ID: "1", Name: "web-1"}}, nil).AnyTimes()
+
+	rules := []config.AlertRule{{Name: "throttled", Metric: gauges.CPUThrottled, Comparison: ">", Threshold: 20}}
+	engine, err := NewEngine(ctx, containers, nil, rules, nil)
+	require.NoError(t, err)
+
+	// 40 of the 100 periods are throttled, then 10
+	throttledPeriods := []uint64{10, 50, 60}
+	series := collectortest.Series{Start: time.Now(), Interval: time.Second, Targets: func(i int) map[string]collector.Sample {
+		return map[string]collector.Sample{"1": {
+			cpu.ThrottlingCollectorName: cgroup.CPUThrottling{Periods: uint64(100 * (i + 1)), ThrottledPeriods: throttledPeriods[i]},
+		}}
+	}}
+	series.Notify(ctx, engine, len(throttledPeriods), func(i int) {
+		switch i {
+		case 1:
+			alerts := engine.Alerts()
+			require.Len(t, alerts, 1)
+			assert.Equal(t, client.AlertStateFiring, alerts[0].State)
+			assert.InDelta(t, 40, alerts[0].Value, 0.001)
+		case 2:
+			assert.Empty(t, engine.Alerts())
+		}
+	})
+}
+
+func TestEngine_Cgroups(t *testing.T) {
+	ctx := t.Context()
+	ctrl := gomock.NewController(t)
+
+	const nginx = "/system.slice/nginx.service"
+	steps := []struct {
+		synced bool
+		memory map[string]uint64
+	}{
+		{synced: false, memory: map[string]uint64{"1": 95, nginx: 95}},
+		{synced: false, memory: map[string]uint64{"1": 95, nginx: 95}},
+		{synced: true, memory: map[string]uint64{"1": 95, nginx: 95}},
+		{synced: false, memory: map[string]uint64{"1": 50}},
+	}
+	step := 0
+	containers := dockermock.NewMockContainerRepository(ctrl)
+	containers.EXPECT().Containers(gomock.Any()).DoAndReturn(func(_ any) ([]docker.Container, error) {
+		if !steps[step].synced {
+			return nil, docker.ErrInventoryNotSynced
+		}
+		return []docker.Container{{ID: "1", Name: "web-1"}}, nil
+	}).AnyTimes()
+
+	rules := []config.AlertRule{
+		{Name: "host_busy", Metric: gauges.HostCPU, Comparison: ">", Threshold: 0.4},
+		{Name: "memory_full", Metric: MemoryPercent, Comparison: ">", Threshold: 90},
+	}
+	engine, err := NewEngine(ctx, containers, nil, rules, nil)
+	require.NoError(t, err)
+
+	// The targets use the percents of the steps of their 1000 bytes memory limit
+	series := collectortest.Series{Start: time.Now(), Interval: time.Second, Targets: func(i int) map[string]collector.Sample {
+		step = i
+		targets := map[string]collector.Sample{}
+		for id, percents := range steps[i].memory {
+			targets[id] = collector.Sample{
+				resources.MemoryCollectorName: client.MemoryUsage{MemoryUsage: 10 * percents, MemoryLimit: 1000},
+			}
+		}
+		return targets
+	}}
+	targets := func() []string {
+		var targets []string
+		for _, alert := range engine.Alerts() {
+			targets = append(targets, alert.Rule+":"+alert.Target)
+		}
+		return targets
+	}
+	series.Notify(ctx, engine, len(steps), func(i int) {
+		switch i {
+		case 0:
+			// The rules are evaluated against the cgroups while the inventory isn't synchronized
+			assert.Equal(t, []string{"memory_full:" + nginx}, targets())
+		case 1:
+			assert.Equal(t, []string{"host_busy:host", "memory_full:" + nginx}, targets())
+		case 2:
+			assert.Equal(t, []string{"host_busy:host", "memory_full:" + nginx, "memory_full:1"}, targets())
+		case 3:
+			// The alerts of a cgroup which disappeared are resolved, the ones of the containers are kept
+			// while the containers can't be listed
+			assert.Equal(t, []string{"host_busy:host", "memory_full:1"}, targets())
+		}
+	})
+}
@@ -0,0 +1,77 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/Scalingo/acadock-monitoring/v2/client"
+	"github.com/Scalingo/go-utils/errors/v3"
+)
+
+// Webhook posts the firing and resolved alerts to a URL
+type Webhook struct {
+	url        string
+	attempts   int
+	retryDelay time.Duration
+	httpClient *http.Client
+}
+
+// NewWebhook returns a webhook attempting attempts times to deliver an alert, the delay between the
+// attempts starts at retryDelay and doubles after each of them
+func NewWebhook(url string, attempts int, retryDelay time.Duration) *Webhook {
+	return &Webhook{
+		url:        url,
+		attempts:   attempts,
+		retryDelay: retryDelay,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Send posts the alert as JSON. The request is retried if the receiver is unreachable or responds
+// with a 429 or 5xx status, it returns the error of the last attempt.
+func (w *Webhook) Send(ctx context.Context, alert client.Alert) error {
+	payload, err := json.Marshal(alert)
+	if err != nil {
+		return errors.Wrap(ctx, err, "encode alert")
+	}
+
+	delay := w.retryDelay
+	for attempt := 1; ; attempt++ {
+		retry, err := w.post(ctx, payload)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= w.attempts {
+			return errors.Wrapf(ctx, err, "deliver alert after %d attempts", attempt)
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Wrap(ctx, ctx.Err(), "deliver alert")
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// post sends the payload once, it returns whether a failed request should be retried
+func (w *Webhook) post(ctx context.Context, payload []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(payload))
+	if err != nil {
+		return false, errors.Wrap(ctx, err, "create webhook request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := w.httpClient.Do(req)
+	if err != nil {
+		return true, errors.Wrap(ctx, err, "post to webhook")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return false, nil
+	}
+	retry := res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500
+	return retry, errors.Newf(ctx, "webhook responded with status %d", res.StatusCode)
+}
@@ -0,0 +1,66 @@
+package alerts
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Scalingo/acadock-monitoring/v2/client"
+)
+
+func TestWebhook_Send(t *testing.T) {
+	ctx := t.Context()
+	alert := client.Alert{Rule: "memory_full", Target: "1", State: client.AlertStateFiring, Value: 95}
+
+	t.Run("retries until the receiver accepts the alert", func(t *testing.T) {
+		var requests atomic.Int32
+		receiver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			if requests.Add(1) < 3 {
+				res.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+			var received client.Alert
+			assert.NoError(t, json.NewDecoder(req.Body).Decode(&received))
+			assert.Equal(t, alert, received)
+		}))
+		defer receiver.Close()
+
+		err := NewWebhook(receiver.URL, 3, time.Millisecond).Send(ctx, alert)
+		require.NoError(t, err)
+		assert.Equal(t, int32(3), requests.Load())
+	})
+
+	t.Run("gives up after the last attempt", func(t *testing.T) {
+		var requests atomic.Int32
+		receiver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			requests.Add(1)
+			res.WriteHeader(http.StatusBadGateway)
+		}))
+		defer receiver.Close()
+
+		err := NewWebhook(receiver.URL, 2, time.Millisecond).Send(ctx, alert)
+		assert.ErrorContains(t, err, "deliver alert after 2 attempts")
+		assert.ErrorContains(t, err, "webhook responded with status 502")
+		assert.Equal(t, int32(2), requests.Load())
+	})
+
+	t.Run("doesn't retry a rejected alert", func(t *testing.T) {
+		var requests atomic.Int32
+		receiver := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			requests.Add(1)
+			res.WriteHeader(http.StatusBadRequest)
+		}))
+		defer receiver.Close()
+
+		err := NewWebhook(receiver.URL, 3, time.Millisecond).Send(ctx, alert)
+		assert.ErrorContains(t, err, "deliver alert after 1 attempts")
+		assert.Equal(t, int32(1), requests.Load())
+	})
+}
@@ -0,0 +1,65 @@
+// Package anomalies detects the targets whose CPU or network usage suddenly deviates from their
+// baseline.
+package anomalies
+
+import (
+	"context"
+
+	"github.com/Scalingo/acadock-monitoring/v2/collector"
+	"github.com/Scalingo/acadock-monitoring/v2/filters"
+	"github.com/Scalingo/acadock-monitoring/v2/gauges"
+	"github.com/Scalingo/go-utils/errors/v3"
+)
+
+var _ collector.SnapshotListener = &Monitor{}
+
+// minDeviations are the smallest deviations from the baseline considered as anomalous, by gauge. An
+// idle container has a baseline without variance, its slightest activity must not be reported.
+var minDeviations = map[string]float64{
+	gauges.CPU:      5,
+	gauges.NetRxBps: 100 * 1024,
+	gauges.NetTxBps: 100 * 1024,
+}
+
+// Monitor compares the gauges of every collected snapshot to the baseline of the targets
+type Monitor struct {
+	detector *filters.AnomalyDetector
+}
+
+// NewMonitor returns a monitor of the baselines smoothed with alpha. A value deviating from its
+// baseline by more than threshold standard deviations, once warmup values have been collected, is
+// anomalous. After rebaselineAfter consecutive anomalous values, the baseline is rebuilt from them.
+func NewMonitor(ctx context.Context, alpha, threshold float64, warmup, rebaselineAfter int) (*Monitor, error) {
+	configs := map[string]filters.BaselineConfig{}
+	for gauge, minDeviation := range minDeviations {
+		configs[gauge] = filters.BaselineConfig{
+			Alpha: alpha, Threshold: threshold, Warmup: warmup, MinDeviation: minDeviation, RebaselineAfter: rebaselineAfter,
+		}
+	}
+	detector, err := filters.NewAnomalyDetector(configs)
+	if err != nil {
+		return nil, errors.Wrap(ctx, err, "create anomaly detector")
+	}
+	return &Monitor{detector: detector}, nil
+}
+
+// Remove destroys the baselines of a target
+func (m *Monitor) Remove(target string) {
+	m.detector.Remove(target)
+}
+
+// SnapshotCollected compares the gauges to the baselines. The anomaly of a gauge which isn't
+// computed for the snapshot, e.g. because its collector failed, ends.
+func (m *Monitor) SnapshotCollected(ctx context.Context, previous *collector.Snapshot, current *collector.Snapshot, values collector.Gauges) {
+	for target, targetValues := range values {
+		for gauge, value := range targetValues {
+			m.detector.Add(target, gauge, current.Time, value)
+		}
+	}
+	m.detector.ClearAbsent(values)
+}
+
+// Anomalies returns the current anomalies, indexed by target then by gauge
+func (m *Monitor) Anomalies() map[string]map[string]filters.Anomaly {
+	return m.detector.Anomalies()
+}
@@ -0,0 +1,60 @@
+package anomalies
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Scalingo/acadock-monitoring/v2/collector"
+	"github.com/Scalingo/acadock-monitoring/v2/collector/collectortest"
+	"github.com/Scalingo/acadock-monitoring/v2/cpu"
+	"github.com/Scalingo/acadock-monitoring/v2/gauges"
+)
+
+func TestMonitor(t *testing.T) {
+	ctx := t.Context()
+
+	_, err := NewMonitor(ctx, 0, 3, 2, 5)
+	assert.ErrorContains(t, err, "alpha should be in ]0, 1]")
+
+	monitor, err := NewMonitor(ctx, 0.5, 3, 3, 5)
+	require.NoError(t, err)
+
+	// The container uses 100ms of CPU time per second, then 1s from the 6th second, its CPU usage
+	// isn't collected anymore on the 8th second
+	start := time.Now()
+	series := collectortest.Series{Start: start, Interval: time.Second, Targets: func(i int) map[string]collector.Sample {
+		if i == 8 {
+			return map[string]collector.Sample{"1": {}}
+		}
+		cpuTime := time.Duration(min(i+1, 6)) * 100 * time.Millisecond
+		if i >= 6 {
+			cpuTime += time.Duration(i-5) * time.Second
+		}
+		return map[string]collector.Sample{"1": {cpu.CollectorName: cpuTime}}
+	}}
+	series.Notify(ctx, monitor, 9, func(i int) {
+		switch i {
+		case 5:
+			assert.Empty(t, monitor.Anomalies())
+		case 7:
+			anomalies := monitor.Anomalies()
+			require.Contains(t, anomalies, "1")
+			require.Contains(t, anomalies["1"], gauges.CPU)
+			anomaly := anomalies["1"][gauges.CPU]
+			assert.Equal(t, start.Add(6*time.Second), anomaly.Since)
+			assert.Greater(t, anomaly.Value, anomaly.Mean)
+			assert.NotContains(t, anomalies, gauges.HostTarget)
+		case 8:
+			// The anomaly of a gauge which isn't computed anymore ends
+			assert.Empty(t, monitor.Anomalies())
+		}
+	})
+
+	series.Notify(ctx, monitor, 8, nil)
+	assert.NotEmpty(t, monitor.Anomalies())
+	monitor.Remove("1")
+	assert.Empty(t, monitor.Anomalies())
+}
@@ -35,6 +35,21 @@ func (m *MockStatsReader) EXPECT() *MockStatsReaderMockRecorder {
 	return m.recorder
 }
 
+// GetCgroupStats mocks base method.
+func (m *MockStatsReader) GetCgroupStats(arg0 context.Context, arg1 string) (cgroup.Stats, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCgroupStats", arg0, arg1)
+	ret0, _ := ret[0].(cgroup.Stats)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCgroupStats indicates an expected call of GetCgroupStats.
+func (mr *MockStatsReaderMockRecorder) GetCgroupStats(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCgroupStats", reflect.TypeOf((*MockStatsReader)(nil).GetCgroupStats), arg0, arg1)
+}
+
 // GetStats mocks base method.
 func (m *MockStatsReader) GetStats(arg0 context.Context, arg1 string) (cgroup.Stats, error) {
 	m.ctrl.T.Helper()
@@ -0,0 +1,82 @@
+package cgroup
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// defaultCPUShares are the cgroup v1 shares of a cgroup whose CPU weight isn't configured
+	defaultCPUShares = 1024
+	// defaultCPUWeight is the cgroup v2 weight of a cgroup whose CPU shares aren't configured
+	defaultCPUWeight = 100
+)
+
+// CPULimit is the CPU time a cgroup may use
+type CPULimit struct {
+	// Quota is the number of CPUs the cgroup may use, 0 if it isn't limited
+	Quota float64
+	// Shares is the relative weight of the cgroup when the CPUs are contended, in cgroup v1 shares.
+	// The cgroup v2 weight is converted back to the shares it has been computed from by runc, the
+	// default weight of 100 is 1024 shares.
+	Shares uint64
+}
+
+// readCPULimitV1 reads the CPU limit of the cgroup at path, relative to the root of the cgroup v1
+// hierarchy. A file which can't be read is considered as not configured.
+func readCPULimitV1(root, path string) CPULimit {
+	limit := CPULimit{Shares: defaultCPUShares}
+	dir := filepath.Join(root, "cpu", path)
+	quota, quotaErr := readIntFile(filepath.Join(dir, "cpu.cfs_quota_us"))
+	period, periodErr := readIntFile(filepath.Join(dir, "cpu.cfs_period_us"))
+	// The quota is -1 if the cgroup isn't limited
+	if quotaErr == nil && periodErr == nil && quota > 0 && period > 0 {
+		limit.Quota = float64(quota) / float64(period)
+	}
+	shares, err := readIntFile(filepath.Join(dir, "cpu.shares"))
+	if err == nil && shares > 0 {
+		limit.Shares = uint64(shares)
+	}
+	return limit
+}
+
+// readCPULimitV2 reads the CPU limit of the cgroup at path, relative to the root of the cgroup v2
+// hierarchy. A file which can't be read is considered as not configured.
+func readCPULimitV2(root, path string) CPULimit {
+	limit := CPULimit{Shares: defaultCPUShares}
+	dir := filepath.Join(root, path)
+	// cpu.max contains "$MAX $PERIOD", $MAX is "max" if the cgroup isn't limited
+	content, err := os.ReadFile(filepath.Join(dir, "cpu.max"))
+	if err == nil {
+		fields := strings.Fields(string(content))
+		if len(fields) == 2 {
+			quota, quotaErr := strconv.ParseInt(fields[0], 10, 64)
+			period, periodErr := strconv.ParseInt(fields[1], 10, 64)
+			if quotaErr == nil && periodErr == nil && quota > 0 && period > 0 {
+				limit.Quota = float64(quota) / float64(period)
+			}
+		}
+	}
+	weight, err := readIntFile(filepath.Join(dir, "cpu.weight"))
+	if err == nil && weight > 0 && weight != defaultCPUWeight {
+		limit.Shares = weightToShares(uint64(weight))
+	}
+	return limit
+}
+
+// weightToShares is the inverse of the conversion of the shares to a weight by runc:
+// weight = 1 + ((shares-2)*9999)/262142. The conversion loses precision, e.g. 512 shares are a
+// weight of 20 which is converted back to 500 shares.
+func weightToShares(weight uint64) uint64 {
+	return 2 + ((weight-1)*262142)/9999
+}
+
+func readIntFile(path string) (int64, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(content)), 10, 64)
+}
@@ -0,0 +1,48 @@
+package cgroup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeCgroupFile(t *testing.T, path, content string) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+}
+
+func TestReadCPULimitV1(t *testing.T) {
+	root := t.TempDir()
+	writeCgroupFile(t, filepath.Join(root, "cpu", "docker", "1", "cpu.cfs_quota_us"), "50000\n")
+	writeCgroupFile(t, filepath.Join(root, "cpu", "docker", "1", "cpu.cfs_period_us"), "100000\n")
+	writeCgroupFile(t, filepath.Join(root, "cpu", "docker", "1", "cpu.shares"), "512\n")
+	writeCgroupFile(t, filepath.Join(root, "cpu", "docker", "2", "cpu.cfs_quota_us"), "-1\n")
+	writeCgroupFile(t, filepath.Join(root, "cpu", "docker", "2", "cpu.cfs_period_us"), "100000\n")
+
+	assert.Equal(t, CPULimit{Quota: 0.5, Shares: 512}, readCPULimitV1(root, "docker/1"))
+	assert.Equal(t, CPULimit{Shares: 1024}, readCPULimitV1(root, "docker/2"))
+	// The cpu subsystem isn't mounted
+	assert.Equal(t, CPULimit{Shares: 1024}, readCPULimitV1(root, "docker/3"))
+}
+
+func TestReadCPULimitV2(t *testing.T) {
+	root := t.TempDir()
+	writeCgroupFile(t, filepath.Join(root, "system.slice", "docker-1.scope", "cpu.max"), "150000 100000\n")
+	writeCgroupFile(t, filepath.Join(root, "system.slice", "docker-1.scope", "cpu.weight"), "20\n")
+	writeCgroupFile(t, filepath.Join(root, "system.slice", "docker-2.scope", "cpu.max"), "max 100000\n")
+	writeCgroupFile(t, filepath.Join(root, "system.slice", "docker-2.scope", "cpu.weight"), "100\n")
+
+	// runc converts 512 shares to a weight of 20
+	assert.Equal(t, CPULimit{Quota: 1.5, Shares: 500}, readCPULimitV2(root, "/system.slice/docker-1.scope"))
+	assert.Equal(t, CPULimit{Shares: 1024}, readCPULimitV2(root, "/system.slice/docker-2.scope"))
+	assert.Equal(t, CPULimit{Shares: 1024}, readCPULimitV2(root, "/system.slice/docker-3.scope"))
+}
+
+func TestWeightToShares(t *testing.T) {
+	assert.Equal(t, uint64(2), weightToShares(1))
+	assert.Equal(t, uint64(262144), weightToShares(10000))
+	assert.Equal(t, uint64(998), weightToShares(39))
+}
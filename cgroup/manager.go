@@ -3,6 +3,9 @@ package cgroup
 import (
 	"context"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/Scalingo/acadock-monitoring/v2/config"
 
@@ -17,24 +20,29 @@ type Manager struct {
 	cgroupV2Manager *cgroup2.Manager
 	v2              bool
 	systemd         bool
+	// path is the path of the cgroup relative to the root of the hierarchy
+	path string
 }
 
 func NewManager(ctx context.Context, containerID string) (*Manager, error) {
 	var err error
 	manager := &Manager{
 		v2:      config.IsUsingCgroupV2,
-		systemd: config.ENV["CGROUP_SOURCE"] == "systemd" || config.IsUsingCgroupV2,
+		systemd: Driver() == "systemd",
 	}
 
 	if manager.v2 {
-		manager.cgroupV2Manager, err = cgroup2.LoadSystemd("/system.slice", fmt.Sprintf("docker-%s.scope", containerID))
+		manager.path = fmt.Sprintf("/system.slice/docker-%s.scope", containerID)
+		manager.cgroupV2Manager, err = cgroup2.Load(manager.path, cgroup2.WithMountpoint(config.ENV["CGROUP_DIR"]))
 	} else if manager.systemd {
+		manager.path = fmt.Sprintf("/system.slice/docker-%s.scope", containerID)
 		manager.cgroupV1Manager, err = cgroup1.Load(
 			cgroup1.Slice("system.slice", fmt.Sprintf("docker-%s.scope", containerID)),
-			cgroup1.WithHierarchy(cgroup1.Systemd),
+			cgroup1.WithHierarchy(v1Hierarchy),
 		)
 	} else {
-		manager.cgroupV1Manager, err = cgroup1.Load(cgroup1.StaticPath("docker/" + containerID))
+		manager.path = "docker/" + containerID
+		manager.cgroupV1Manager, err = cgroup1.Load(cgroup1.StaticPath(manager.path), cgroup1.WithHierarchy(v1Hierarchy))
 	}
 	if err != nil {
 		return nil, errors.Wrapf(ctx, err, "load cgroup, systemd: %v, v2: %v", manager.systemd, manager.v2)
@@ -43,6 +51,61 @@ func NewManager(ctx context.Context, containerID string) (*Manager, error) {
 	return manager, nil
 }
 
+// NewManagerForPath loads the cgroup located at the given path, relative to the root of the cgroup
+// hierarchy. It is used to monitor cgroups which are not created by Docker.
+func NewManagerForPath(ctx context.Context, path string) (*Manager, error) {
+	var err error
+	manager := &Manager{
+		v2:      config.IsUsingCgroupV2,
+		systemd: Driver() == "systemd",
+		path:    path,
+	}
+
+	if manager.v2 {
+		manager.cgroupV2Manager, err = cgroup2.Load(path, cgroup2.WithMountpoint(config.ENV["CGROUP_DIR"]))
+	} else {
+		manager.cgroupV1Manager, err = cgroup1.Load(cgroup1.StaticPath(path), cgroup1.WithHierarchy(v1Hierarchy))
+	}
+	if err != nil {
+		return nil, errors.Wrapf(ctx, err, "load cgroup %s, systemd: %v, v2: %v", path, manager.systemd, manager.v2)
+	}
+
+	return manager, nil
+}
+
+// v1Hierarchy returns the cgroup v1 subsystems read by acadock, mounted in CGROUP_DIR. The
+// containerd default hierarchies look for the mountpoint in /proc/self/mountinfo instead.
+func v1Hierarchy() ([]cgroup1.Subsystem, error) {
+	root := config.ENV["CGROUP_DIR"]
+	subsystems := []cgroup1.Subsystem{
+		cgroup1.NewCpu(root),
+		cgroup1.NewCpuacct(root),
+		cgroup1.NewMemory(root),
+		cgroup1.NewBlkio(root),
+		cgroup1.NewPids(root),
+	}
+	// The subsystems which are not mounted are ignored
+	enabled := make([]cgroup1.Subsystem, 0, len(subsystems))
+	for _, subsystem := range subsystems {
+		_, err := os.Lstat(filepath.Join(root, string(subsystem.Name())))
+		if err == nil {
+			enabled = append(enabled, subsystem)
+		}
+	}
+	return enabled, nil
+}
+
+// CgroupPath returns the path of a monitored cgroup relative to the root of the cgroup hierarchy. A
+// name without any slash is considered to be a systemd unit of the system slice (e.g.
+// "docker.service").
+func CgroupPath(name string) string {
+	name = strings.Trim(name, "/")
+	if !strings.Contains(name, "/") {
+		return "/system.slice/" + name
+	}
+	return "/" + name
+}
+
 func (m *Manager) IsV2() bool {
 	return m.v2
 }
@@ -55,6 +118,14 @@ func (m *Manager) V2Manager() *cgroup2.Manager {
 	return m.cgroupV2Manager
 }
 
+// CPULimit returns the CPU quota and shares of the cgroup
+func (m *Manager) CPULimit() CPULimit {
+	if m.v2 {
+		return readCPULimitV2(config.ENV["CGROUP_DIR"], m.path)
+	}
+	return readCPULimitV1(config.ENV["CGROUP_DIR"], m.path)
+}
+
 func (m *Manager) Pids(ctx context.Context) ([]uint64, error) {
 	if m.v2 {
 		return m.cgroupV2Manager.Procs(false)
@@ -69,3 +140,20 @@ func (m *Manager) Pids(ctx context.Context) ([]uint64, error) {
 	}
 	return pids, nil
 }
+
+// Version returns the version of the cgroup hierarchy of the host: 1 or 2
+func Version() int {
+	if config.IsUsingCgroupV2 {
+		return 2
+	}
+	return 1
+}
+
+// Driver returns the cgroup driver used to find the cgroup of the containers: "systemd" or
+// "cgroupfs"
+func Driver() string {
+	if config.ENV["CGROUP_SOURCE"] == "systemd" || config.IsUsingCgroupV2 {
+		return "systemd"
+	}
+	return "cgroupfs"
+}
@@ -0,0 +1,99 @@
+package cgroup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Scalingo/acadock-monitoring/v2/config"
+	"github.com/Scalingo/acadock-monitoring/v2/procfs"
+)
+
+func TestCgroupPath(t *testing.T) {
+	examples := map[string]string{
+		"docker.service":              "/system.slice/docker.service",
+		"/docker.service":             "/system.slice/docker.service",
+		"system.slice/nginx.service":  "/system.slice/nginx.service",
+		"/system.slice/nginx.service": "/system.slice/nginx.service",
+		"user.slice/user-1000.slice/": "/user.slice/user-1000.slice",
+	}
+
+	for name, expected := range examples {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, expected, CgroupPath(name))
+		})
+	}
+}
+
+// writeCgroupFiles creates the files of a cgroup fixture, the keys are relative to dir
+func writeCgroupFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+}
+
+func withCgroupDir(t *testing.T, dir string, v2 bool) {
+	previousDir, previousV2 := config.ENV["CGROUP_DIR"], config.IsUsingCgroupV2
+	t.Cleanup(func() {
+		config.ENV["CGROUP_DIR"], config.IsUsingCgroupV2 = previousDir, previousV2
+	})
+	config.ENV["CGROUP_DIR"], config.IsUsingCgroupV2 = dir, v2
+}
+
+func TestStatsReader_CgroupDir(t *testing.T) {
+	t.Run("v2", func(t *testing.T) {
+		dir := t.TempDir()
+		withCgroupDir(t, dir, true)
+		writeCgroupFiles(t, filepath.Join(dir, "system.slice", "docker-1.scope"), map[string]string{
+			"cpu.stat":            "usage_usec 2000000\nuser_usec 1500000\nsystem_usec 500000\n",
+			"memory.current":      "1048576\n",
+			"memory.max":          "4194304\n",
+			"memory.stat":         "anon 524288\nfile 524288\n",
+			"memory.swap.current": "0\n",
+			"memory.swap.max":     "max\n",
+		})
+
+		stats, err := NewStatsReader(procfs.NoMountInfos{}).GetStats(t.Context(), "1")
+		require.NoError(t, err)
+		assert.Equal(t, 2*time.Second, stats.CPUUsage)
+		assert.Equal(t, uint64(1048576), stats.MemoryUsage)
+		assert.Equal(t, uint64(4194304), stats.MemoryLimit)
+	})
+
+	t.Run("v1", func(t *testing.T) {
+		dir := t.TempDir()
+		withCgroupDir(t, dir, false)
+		files := map[string]string{
+			"cpuacct/system.slice/nginx.service/cpuacct.usage":        "3000000000\n",
+			"cpuacct/system.slice/nginx.service/cpuacct.usage_percpu": "1000000000 2000000000\n",
+			"cpuacct/system.slice/nginx.service/cpuacct.stat":         "user 250\nsystem 50\n",
+			"memory/system.slice/nginx.service/memory.stat":           "cache 0\nrss 2097152\n",
+			"memory/system.slice/nginx.service/memory.oom_control":    "oom_kill_disable 0\nunder_oom 0\n",
+		}
+		for _, module := range []string{"memory", "memory.memsw", "memory.kmem", "memory.kmem.tcp"} {
+			files["memory/system.slice/nginx.service/"+module+".usage_in_bytes"] = "2097152\n"
+			files["memory/system.slice/nginx.service/"+module+".max_usage_in_bytes"] = "2097152\n"
+			files["memory/system.slice/nginx.service/"+module+".limit_in_bytes"] = "8388608\n"
+			files["memory/system.slice/nginx.service/"+module+".failcnt"] = "0\n"
+		}
+		writeCgroupFiles(t, dir, files)
+
+		stats, err := NewStatsReader(procfs.NoMountInfos{}).GetCgroupStats(t.Context(), "/system.slice/nginx.service")
+		require.NoError(t, err)
+		assert.Equal(t, 3*time.Second, stats.CPUUsage)
+		assert.Equal(t, uint64(2097152), stats.MemoryUsage)
+		assert.Equal(t, uint64(8388608), stats.MemoryLimit)
+	})
+
+	t.Run("missing cgroup", func(t *testing.T) {
+		withCgroupDir(t, t.TempDir(), false)
+		_, err := NewStatsReader(procfs.NoMountInfos{}).GetCgroupStats(t.Context(), "/system.slice/nginx.service")
+		assert.Error(t, err)
+	})
+}
@@ -20,6 +20,7 @@ type StatsReaderImpl struct {
 
 type StatsReader interface {
 	GetStats(ctx context.Context, containerID string) (Stats, error)
+	GetCgroupStats(ctx context.Context, path string) (Stats, error)
 }
 
 type Stats struct {
@@ -31,6 +32,19 @@ type Stats struct {
 	SwapMaxUsage   uint64
 	SwapLimit      uint64
 	IOUsage        IOUsage
+	CPULimit       CPULimit
+	CPUThrottling  CPUThrottling
+}
+
+// CPUThrottling are the cumulated counters of the CFS bandwidth control of a cgroup, they stay at
+// 0 if its CPU time isn't limited
+type CPUThrottling struct {
+	// Periods is the number of enforcement periods during which the cgroup was runnable
+	Periods uint64
+	// ThrottledPeriods is the number of periods during which the cgroup exhausted its quota
+	ThrottledPeriods uint64
+	// ThrottledTime is the time during which the cgroup was throttled
+	ThrottledTime time.Duration
 }
 
 type IOUsage struct {
@@ -73,6 +87,21 @@ func (r *StatsReaderImpl) GetStats(ctx context.Context, containerID string) (Sta
 	if err != nil {
 		return Stats{}, NewStatsReaderError(errors.Wrap(ctx, err, "create cgroup manager"))
 	}
+	return r.getStats(ctx, manager)
+}
+
+// GetCgroupStats reads the stats of an arbitrary cgroup, for instance the one of a systemd service.
+// The path is relative to the root of the cgroup hierarchy.
+func (r *StatsReaderImpl) GetCgroupStats(ctx context.Context, path string) (Stats, error) {
+	manager, err := NewManagerForPath(ctx, path)
+	if err != nil {
+		return Stats{}, NewStatsReaderError(errors.Wrap(ctx, err, "create cgroup manager"))
+	}
+	return r.getStats(ctx, manager)
+}
+
+func (r *StatsReaderImpl) getStats(ctx context.Context, manager *Manager) (Stats, error) {
+	var err error
 	var stats Stats
 	if manager.IsV2() {
 		stats, err = r.getCgroupV2Stats(ctx, manager)
@@ -82,6 +111,7 @@ func (r *StatsReaderImpl) GetStats(ctx context.Context, containerID string) (Sta
 	if err != nil {
 		return Stats{}, NewStatsReaderError(errors.Wrap(ctx, err, "get cgroup stats"))
 	}
+	stats.CPULimit = manager.CPULimit()
 	return stats, nil
 }
 
@@ -92,12 +122,17 @@ func (r *StatsReaderImpl) getCgroupV2Stats(ctx context.Context, manager *Manager
 	}
 
 	return Stats{
-		CPUUsage:    time.Duration(stats.CPU.UsageUsec) * time.Microsecond,
+		CPUUsage:    time.Duration(stats.GetCPU().GetUsageUsec()) * time.Microsecond,
 		MemoryUsage: stats.Memory.Usage,
 		MemoryLimit: stats.Memory.UsageLimit,
 		SwapUsage:   stats.Memory.SwapUsage,
 		SwapLimit:   stats.Memory.SwapLimit,
 		IOUsage:     cgroupV2IOUsage(stats.Io, r.mountInfos),
+		CPUThrottling: CPUThrottling{
+			Periods:          stats.GetCPU().GetNrPeriods(),
+			ThrottledPeriods: stats.GetCPU().GetNrThrottled(),
+			ThrottledTime:    time.Duration(stats.GetCPU().GetThrottledUsec()) * time.Microsecond,
+		},
 	}, nil
 }
 
@@ -114,6 +149,7 @@ func cgroupV1Stats(stats *statsV1.Metrics, mountInfos procfs.MountInfos) Stats {
 	cpuUsage := stats.GetCPU().GetUsage()
 	memoryUsage := stats.GetMemory().GetUsage()
 	memorySwap := stats.GetMemory().GetSwap()
+	throttling := stats.GetCPU().GetThrottling()
 
 	return Stats{
 		CPUUsage:       time.Duration(cpuUsage.GetTotal()) * time.Nanosecond,
@@ -126,6 +162,11 @@ func cgroupV1Stats(stats *statsV1.Metrics, mountInfos procfs.MountInfos) Stats {
 		SwapMaxUsage: cgroupV1SwapMetric(memorySwap.GetMax(), memoryUsage.GetMax()),
 		SwapLimit:    cgroupV1SwapMetric(memorySwap.GetLimit(), memoryUsage.GetLimit()),
 		IOUsage:      cgroupV1IOUsage(stats.GetBlkio(), mountInfos),
+		CPUThrottling: CPUThrottling{
+			Periods:          throttling.GetPeriods(),
+			ThrottledPeriods: throttling.GetThrottledPeriods(),
+			ThrottledTime:    time.Duration(throttling.GetThrottledTime()) * time.Nanosecond,
+		},
 	}
 }
 
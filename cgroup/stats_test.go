@@ -26,7 +26,10 @@ func deviceKey(major uint64, minor uint64) string {
 
 func TestCgroupV1StatsMapsStats(t *testing.T) {
 	stats := cgroupV1Stats(&statsV1.Metrics{
-		CPU: &statsV1.CPUStat{Usage: &statsV1.CPUUsage{Total: 42}},
+		CPU: &statsV1.CPUStat{
+			Usage:      &statsV1.CPUUsage{Total: 42},
+			Throttling: &statsV1.Throttle{Periods: 100, ThrottledPeriods: 25, ThrottledTime: 3000},
+		},
 		Memory: &statsV1.MemoryStat{
 			Usage: &statsV1.MemoryEntry{Usage: 10, Max: 20, Limit: 30},
 			Swap:  &statsV1.MemoryEntry{Usage: 15, Max: 27, Limit: 41},
@@ -42,6 +45,7 @@ func TestCgroupV1StatsMapsStats(t *testing.T) {
 		SwapMaxUsage:   7,
 		SwapLimit:      11,
 		IOUsage:        IOUsage{},
+		CPUThrottling:  CPUThrottling{Periods: 100, ThrottledPeriods: 25, ThrottledTime: 3 * time.Microsecond},
 	}, stats)
 }
 
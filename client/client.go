@@ -6,6 +6,9 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Scalingo/go-netstat"
 	"github.com/Scalingo/go-utils/errors/v3"
@@ -20,20 +23,37 @@ type MemoryUsage struct {
 	SwapLimit      uint64 `json:"swap_limit"`
 	MaxMemoryUsage uint64 `json:"max_memory_usage"`
 	MaxSwapUsage   uint64 `json:"max_swap_usage"`
+	// Smoothed is the exponentially smoothed memory usage, omitted until enough values have been
+	// collected or if the smoothing of the memory is disabled
+	Smoothed *uint64 `json:"smoothed,omitempty"`
+	// GrowthRate is the forecast growth of the memory usage in bytes per second, omitted until two
+	// usages have been collected
+	GrowthRate *float64 `json:"growth_rate,omitempty"`
+	// SecondsUntilLimit is the forecast time between the last collection and the memory usage
+	// reaching the limit, omitted if the usage doesn't grow or if the memory is unlimited
+	SecondsUntilLimit *int64 `json:"seconds_until_limit,omitempty"`
 }
 
 type CpuUsage struct {
 	UsageInPercents int `json:"usage_in_percents"`
+	// Smoothed is the exponentially smoothed usage in percents
+	Smoothed *float64 `json:"smoothed,omitempty"`
 }
 
 type HostUsage struct {
-	CPU    HostCpuUsage    `json:"cpu"`
-	Memory HostMemoryUsage `json:"memory"`
+	CPU    *HostCpuUsage    `json:"cpu,omitempty"`
+	Memory *HostMemoryUsage `json:"memory,omitempty"`
+	// Disabled lists the collectors which are disabled, their blocks are omitted
+	Disabled []string `json:"disabled,omitempty"`
 }
 type HostCpuUsage struct {
 	Usage                            float64 `json:"usage"`
 	Amount                           int     `json:"amount"`
 	QueueLengthExponentiallySmoothed float64 `json:"queue_length_exponentially_smoothed"`
+	// Committed is the sum of the CPU quotas of the containers, in CPUs
+	Committed float64 `json:"committed"`
+	// Smoothed is the exponentially smoothed usage
+	Smoothed *float64 `json:"smoothed,omitempty"`
 }
 
 type HostMemoryUsage struct {
@@ -48,10 +68,91 @@ type HostMemoryUsage struct {
 	MaxSwapUsage    uint64 `json:"max_swap_usage"`
 }
 
+// CPULimit is the CPU time a container may use
+type CPULimit struct {
+	// Quota is the number of CPUs the container may use, 0 if it isn't limited
+	Quota float64 `json:"quota"`
+	// Shares is the relative weight of the container when the CPUs are contended, 1024 by default
+	Shares uint64 `json:"shares"`
+}
+
+// HostCapacity compares the limits of the containers to the capacity of the host
+type HostCapacity struct {
+	Memory ResourceCapacity `json:"memory"`
+	Swap   ResourceCapacity `json:"swap"`
+	CPU    CPUCapacity      `json:"cpu"`
+	// Fits is whether a container of the requested size can be placed on the host without
+	// overcommitting it, omitted if no size is requested
+	Fits *bool `json:"fits,omitempty"`
+}
+
+// ResourceCapacity is in bytes for the memory and the swap, in CPUs for the CPU
+type ResourceCapacity struct {
+	// Total is the capacity of the host
+	Total float64 `json:"total"`
+	// Committed is the sum of the limits of the containers
+	Committed float64 `json:"committed"`
+	// OvercommitRatio is Committed divided by Total, the host is overcommitted above 1
+	OvercommitRatio float64 `json:"overcommit_ratio"`
+	// Free is the capacity left once the limits of the containers are reserved
+	Free float64 `json:"free"`
+	// Unlimited is the number of containers without limit, they are not part of Committed
+	Unlimited int `json:"unlimited"`
+	// Requested is the size of the container to place and Fits whether it fits in Free
+	Requested *float64 `json:"requested,omitempty"`
+	Fits      *bool    `json:"fits,omitempty"`
+}
+
+type CPUCapacity struct {
+	ResourceCapacity
+	// Shares is the sum of the CPU shares of the containers and SharesRatio its ratio to 1024 shares
+	// per CPU of the host
+	Shares      uint64  `json:"shares"`
+	SharesRatio float64 `json:"shares_ratio"`
+}
+
+// HostTop ranks the containers by their consumption of a resource over a window
+type HostTop struct {
+	// Resource is cpu (percents of a CPU), memory (bytes), io or net (bytes per second)
+	Resource string `json:"resource"`
+	Window   string `json:"window"`
+	// Total is the consumption of all the containers
+	Total float64 `json:"total"`
+	// Host is the consumption of the host, containers included, and Capacity its capacity. They are
+	// omitted for the io and net resources.
+	Host       *float64           `json:"host,omitempty"`
+	Capacity   *float64           `json:"capacity,omitempty"`
+	Containers []HostTopContainer `json:"containers"`
+}
+
+type HostTopContainer struct {
+	ContainerID string            `json:"container_id"`
+	Name        string            `json:"name,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	// Value is the mean consumption over the window
+	Value float64 `json:"value"`
+	// Share is the percentage of the consumption of the host, of the consumption of all the
+	// containers for the io and net resources
+	Share float64 `json:"share"`
+	// CapacityPercent is the percentage of the capacity of the host
+	CapacityPercent *float64 `json:"capacity_percent,omitempty"`
+	// PreviousValue is the mean consumption over the window preceding the last one, and Change the
+	// evolution since then in percents. They are omitted if the container wasn't collected then.
+	PreviousValue *float64 `json:"previous_value,omitempty"`
+	Change        *float64 `json:"change,omitempty"`
+}
+
 type NetUsage struct {
 	netstat.NetworkStat
 	RxBps int64 `json:"rx_bps"`
 	TxBps int64 `json:"tx_bps"`
+	// Smoothed are the exponentially smoothed rates
+	Smoothed *SmoothedNetUsage `json:"smoothed,omitempty"`
+}
+
+type SmoothedNetUsage struct {
+	RxBps int64 `json:"rx_bps"`
+	TxBps int64 `json:"tx_bps"`
 }
 
 type IOUsage struct {
@@ -72,12 +173,23 @@ type IODeviceUsage struct {
 
 type AcadockClient interface {
 	AllContainersUsage(ctx context.Context) (ContainersUsage, error)
+	ContainersUsage(ctx context.Context, opts ContainersUsageOpts) (ContainersUsage, error)
+	GroupsUsage(ctx context.Context, opts GroupsUsageOpts) (GroupsUsage, error)
 	Memory(ctx context.Context, dockerId string) (*MemoryUsage, error)
 	IOUsage(ctx context.Context, dockerId string) (*IOUsage, error)
 	CpuUsage(ctx context.Context, dockerId string) (*CpuUsage, error)
 	NetUsage(ctx context.Context, dockerId string) (*NetUsage, error)
 	Usage(ctx context.Context, dockerId string, net bool) (*Usage, error)
 	HostUsage(ctx context.Context, opts HostUsageOpts) (HostUsage, error)
+	CgroupUsage(ctx context.Context, name string) (*Usage, error)
+	AllCgroupsUsage(ctx context.Context) (CgroupsUsage, error)
+	Status(ctx context.Context) (Status, error)
+	Anomalies(ctx context.Context, opts AnomaliesOpts) (Anomalies, error)
+	Alerts(ctx context.Context) (Alerts, error)
+	HostTop(ctx context.Context, opts HostTopOpts) (HostTop, error)
+	HostCapacity(ctx context.Context, opts HostCapacityOpts) (HostCapacity, error)
+	Accounting(ctx context.Context, opts AccountingOpts) (Accounting, error)
+	History(ctx context.Context, opts HistoryOpts) (History, error)
 }
 
 type Client struct {
@@ -89,11 +201,43 @@ type Client struct {
 type ClientOpts func(*Client) *Client
 
 type Usage struct {
-	Memory *MemoryUsage      `json:"memory"`
-	Cpu    *CpuUsage         `json:"cpu"`
-	IO     *IOUsage          `json:"io"`
+	Memory *MemoryUsage      `json:"memory,omitempty"`
+	Cpu    *CpuUsage         `json:"cpu,omitempty"`
+	IO     *IOUsage          `json:"io,omitempty"`
 	Net    *NetUsage         `json:"net,omitempty"`
 	Labels map[string]string `json:"labels,omitempty"`
+	// State is the Docker state of the container: running, paused or restarting
+	State        string `json:"state,omitempty"`
+	RestartCount int    `json:"restart_count,omitempty"`
+	// Disabled lists the collectors which are disabled, their blocks are omitted
+	Disabled []string `json:"disabled,omitempty"`
+	// Window are the statistics over the window requested with ?window=
+	Window *WindowUsage `json:"window,omitempty"`
+}
+
+// WindowUsage are the statistics of the usages of a target over a window, the statistics of a
+// metric are omitted if no value has been collected during the window
+type WindowUsage struct {
+	// Length is the length of the window, e.g. "5m0s"
+	Length string `json:"length"`
+	// CPU is the CPU usage in percents
+	CPU        *WindowStats `json:"cpu,omitempty"`
+	Memory     *WindowStats `json:"memory,omitempty"`
+	IOReadBps  *WindowStats `json:"io_read_bps,omitempty"`
+	IOWriteBps *WindowStats `json:"io_write_bps,omitempty"`
+	NetRxBps   *WindowStats `json:"net_rx_bps,omitempty"`
+	NetTxBps   *WindowStats `json:"net_tx_bps,omitempty"`
+}
+
+type WindowStats struct {
+	// Count is the number of values collected during the window
+	Count int     `json:"count"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Mean  float64 `json:"mean"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P99   float64 `json:"p99"`
 }
 
 type ContainersUsage map[string]Usage
@@ -102,6 +246,199 @@ func NewContainersUsage() ContainersUsage {
 	return ContainersUsage(make(map[string]Usage))
 }
 
+// GroupUsage is the aggregated usage of the containers sharing the same value of a label
+type GroupUsage struct {
+	Sum     GroupMetrics    `json:"sum"`
+	Max     GroupMetrics    `json:"max"`
+	Members ContainersUsage `json:"members"`
+}
+
+type GroupMetrics struct {
+	CPUUsageInPercents int    `json:"cpu_usage_in_percents"`
+	MemoryUsage        uint64 `json:"memory_usage"`
+	MemoryLimit        uint64 `json:"memory_limit"`
+	SwapUsage          uint64 `json:"swap_usage"`
+	SwapLimit          uint64 `json:"swap_limit"`
+	IOReadBytes        uint64 `json:"io_read_bytes"`
+	IOWriteBytes       uint64 `json:"io_write_bytes"`
+	IOReadIOs          uint64 `json:"io_read_ios"`
+	IOWriteIOs         uint64 `json:"io_write_ios"`
+	NetRxBytes         uint64 `json:"net_rx_bytes"`
+	NetTxBytes         uint64 `json:"net_tx_bytes"`
+	NetRxBps           int64  `json:"net_rx_bps"`
+	NetTxBps           int64  `json:"net_tx_bps"`
+}
+
+// GroupsUsage is indexed by the value of the label used to group the containers
+type GroupsUsage map[string]GroupUsage
+
+// CgroupsUsage is the usage of the cgroups monitored in addition to the containers, indexed by the
+// name configured in MONITORED_CGROUPS.
+type CgroupsUsage map[string]Usage
+
+// Status describes the state of the agent and of its collectors
+type Status struct {
+	Version       string            `json:"version"`
+	StartedAt     time.Time         `json:"started_at"`
+	UptimeSeconds int64             `json:"uptime_seconds"`
+	Ready         bool              `json:"ready"`
+	Docker        DockerStatus      `json:"docker"`
+	Cgroup        CgroupStatus      `json:"cgroup"`
+	LastCollectAt *time.Time        `json:"last_collect_at,omitempty"`
+	Collectors    []CollectorStatus `json:"collectors"`
+}
+
+// Anomaly lists the metrics of a container deviating from their baseline
+type Anomaly struct {
+	ContainerID string            `json:"container_id"`
+	Name        string            `json:"name,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	// Since is the start of the oldest anomaly of the metrics
+	Since   time.Time       `json:"since"`
+	Metrics []MetricAnomaly `json:"metrics"`
+}
+
+type MetricAnomaly struct {
+	// Metric is cpu (usage in percents), net_rx_bps or net_tx_bps
+	Metric string    `json:"metric"`
+	Since  time.Time `json:"since"`
+	// Value is the last anomalous value
+	Value float64 `json:"value"`
+	// Mean and StdDev describe the baseline of the metric
+	Mean   float64 `json:"mean"`
+	StdDev float64 `json:"stddev"`
+}
+
+// Anomalies are sorted by start of the anomaly
+type Anomalies []Anomaly
+
+// AlertState is pending until the condition of the rule has been true for its duration, then
+// firing. Resolved alerts are notified but not listed.
+type AlertState string
+
+const (
+	AlertStatePending  AlertState = "pending"
+	AlertStateFiring   AlertState = "firing"
+	AlertStateResolved AlertState = "resolved"
+)
+
+// Alert is an active alert, it is also the payload of the webhook notifications
+type Alert struct {
+	Rule       string  `json:"rule"`
+	Metric     string  `json:"metric"`
+	Comparison string  `json:"comparison"`
+	Threshold  float64 `json:"threshold"`
+	// Target is the ID of a container, the name of a cgroup or "host"
+	Target string            `json:"target"`
+	Name   string            `json:"name,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+	State  AlertState        `json:"state"`
+	// Value is the last value of the metric
+	Value float64 `json:"value"`
+	// ActiveAt is the time of the first value matching the condition
+	ActiveAt   time.Time  `json:"active_at"`
+	FiredAt    *time.Time `json:"fired_at,omitempty"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+}
+
+// Alerts are sorted by rule and target
+type Alerts []Alert
+
+// Accounting is the cumulative consumption of the containers and cgroups over a period, with an
+// hourly granularity
+type Accounting struct {
+	// From and To are the bounds of the period, rounded down to the hour
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	// Targets are sorted by target
+	Targets []TargetAccounting `json:"targets"`
+	// GroupBy is the label whose values the consumption of the containers is aggregated by in Groups
+	GroupBy string            `json:"group_by,omitempty"`
+	Groups  []GroupAccounting `json:"groups,omitempty"`
+}
+
+type TargetAccounting struct {
+	// Target is the ID of a container or the path of a cgroup
+	Target string            `json:"target"`
+	Name   string            `json:"name,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Usage  AccountingUsage   `json:"usage"`
+}
+
+// GroupAccounting is the consumption of the containers sharing the same value of a label
+type GroupAccounting struct {
+	Value   string          `json:"value"`
+	Targets int             `json:"targets"`
+	Usage   AccountingUsage `json:"usage"`
+}
+
+// AccountingUsage is a cumulative consumption
+type AccountingUsage struct {
+	CPUSeconds float64 `json:"cpu_seconds"`
+	// MemoryGBHours is the memory usage integrated over time, in GiB-hours
+	MemoryGBHours float64 `json:"memory_gb_hours"`
+	NetRxBytes    uint64  `json:"net_rx_bytes"`
+	NetTxBytes    uint64  `json:"net_tx_bytes"`
+	IOReadBytes   uint64  `json:"io_read_bytes"`
+	IOWriteBytes  uint64  `json:"io_write_bytes"`
+}
+
+// Add returns the sum of both consumptions
+func (u AccountingUsage) Add(other AccountingUsage) AccountingUsage {
+	return AccountingUsage{
+		CPUSeconds:    u.CPUSeconds + other.CPUSeconds,
+		MemoryGBHours: u.MemoryGBHours + other.MemoryGBHours,
+		NetRxBytes:    u.NetRxBytes + other.NetRxBytes,
+		NetTxBytes:    u.NetTxBytes + other.NetTxBytes,
+		IOReadBytes:   u.IOReadBytes + other.IOReadBytes,
+		IOWriteBytes:  u.IOWriteBytes + other.IOWriteBytes,
+	}
+}
+
+// History is the history of the metrics of a target over a period
+type History struct {
+	// Target is the ID of a container, the path of a cgroup or "host"
+	Target string    `json:"target"`
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	// Metrics are indexed by name: host_cpu, cpu, memory, io_read_bps, io_write_bps, net_rx_bps and
+	// net_tx_bps
+	Metrics map[string][]HistoryPoint `json:"metrics"`
+}
+
+// HistoryPoint is the value of a metric at a given time, or its mean over the downsampling
+// resolution starting at this time once older than the raw retention
+type HistoryPoint struct {
+	Time  time.Time `json:"time"`
+	Value float64   `json:"value"`
+}
+
+type DockerStatus struct {
+	Connected bool `json:"connected"`
+	// Synced is true once the containers inventory has been synchronized with Docker
+	Synced      bool       `json:"synced"`
+	Containers  int        `json:"containers"`
+	LastEventAt *time.Time `json:"last_event_at,omitempty"`
+	LastSyncAt  *time.Time `json:"last_sync_at,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+type CgroupStatus struct {
+	Version int    `json:"version"`
+	Driver  string `json:"driver"`
+}
+
+type CollectorStatus struct {
+	Name    string `json:"name"`
+	Scope   string `json:"scope"`
+	Enabled bool   `json:"enabled"`
+	// MonitoredTargets is the number of containers and cgroups sampled during the last collection
+	MonitoredTargets int        `json:"monitored_targets"`
+	LastError        string     `json:"last_error,omitempty"`
+	LastErrorAt      *time.Time `json:"last_error_at,omitempty"`
+}
+
 func WithAuthentication(user, pass string) ClientOpts {
 	return func(c *Client) *Client {
 		c.Username = user
@@ -178,23 +515,216 @@ func (c *Client) AllContainersUsage(ctx context.Context) (ContainersUsage, error
 	return usage, nil
 }
 
+func (c *Client) CgroupUsage(ctx context.Context, name string) (*Usage, error) {
+	usage := &Usage{}
+	err := c.getPathWithQuery(ctx, "/cgroups/"+strings.Trim(name, "/")+"/usage", "", usage)
+	if err != nil {
+		return nil, errors.Wrap(ctx, err, "get cgroup usage")
+	}
+	return usage, nil
+}
+
+func (c *Client) AllCgroupsUsage(ctx context.Context) (CgroupsUsage, error) {
+	var usage CgroupsUsage
+	err := c.getPathWithQuery(ctx, "/cgroups/usage", "", &usage)
+	if err != nil {
+		return nil, errors.Wrap(ctx, err, "get all cgroups usage")
+	}
+	return usage, nil
+}
+
+func (c *Client) Status(ctx context.Context) (Status, error) {
+	var status Status
+	err := c.getPathWithQuery(ctx, "/status", "", &status)
+	if err != nil {
+		return status, errors.Wrap(ctx, err, "get status")
+	}
+	return status, nil
+}
+
+type AnomaliesOpts struct {
+	LabelSelectors []string
+}
+
+func (c *Client) Anomalies(ctx context.Context, opts AnomaliesOpts) (Anomalies, error) {
+	query := url.Values{"label": opts.LabelSelectors}
+	var anomalies Anomalies
+	err := c.getPathWithQuery(ctx, "/anomalies", query.Encode(), &anomalies)
+	if err != nil {
+		return nil, errors.Wrap(ctx, err, "get anomalies")
+	}
+	return anomalies, nil
+}
+
+func (c *Client) Alerts(ctx context.Context) (Alerts, error) {
+	var alerts Alerts
+	err := c.getPathWithQuery(ctx, "/alerts", "", &alerts)
+	if err != nil {
+		return nil, errors.Wrap(ctx, err, "get alerts")
+	}
+	return alerts, nil
+}
+
+type ContainersUsageOpts struct {
+	// LabelSelectors only keeps the containers matching all the selectors: "key", "!key",
+	// "key=value" or "key!=value"
+	LabelSelectors []string
+	// Window requests the statistics of the usages over this window, it must be one of the
+	// STATS_WINDOWS of the agent
+	Window time.Duration
+}
+
+func (c *Client) ContainersUsage(ctx context.Context, opts ContainersUsageOpts) (ContainersUsage, error) {
+	query := url.Values{"label": opts.LabelSelectors}
+	if opts.Window != 0 {
+		query.Set("window", opts.Window.String())
+	}
+	var usage ContainersUsage
+	err := c.getPathWithQuery(ctx, "/containers/usage", query.Encode(), &usage)
+	if err != nil {
+		return nil, errors.Wrap(ctx, err, "get containers usage")
+	}
+	return usage, nil
+}
+
+type GroupsUsageOpts struct {
+	// By is the label used to group the containers
+	By             string
+	LabelSelectors []string
+}
+
+func (c *Client) GroupsUsage(ctx context.Context, opts GroupsUsageOpts) (GroupsUsage, error) {
+	query := url.Values{"by": {opts.By}, "label": opts.LabelSelectors}
+	var usage GroupsUsage
+	err := c.getPathWithQuery(ctx, "/groups/usage", query.Encode(), &usage)
+	if err != nil {
+		return nil, errors.Wrap(ctx, err, "get groups usage")
+	}
+	return usage, nil
+}
+
 type HostUsageOpts struct {
+	// Deprecated: use LabelSelectors instead
 	IncludeContainerIfLabel string
+	LabelSelectors          []string
 }
 
 func (c *Client) HostUsage(ctx context.Context, opts HostUsageOpts) (HostUsage, error) {
-	query := ""
+	query := url.Values{"label": opts.LabelSelectors}
 	if opts.IncludeContainerIfLabel != "" {
-		query = fmt.Sprintf("include_container_if_label=%s", opts.IncludeContainerIfLabel)
+		query.Set("include_container_if_label", opts.IncludeContainerIfLabel)
 	}
 	var res HostUsage
-	err := c.getPathWithQuery(ctx, "/host/usage", query, &res)
+	err := c.getPathWithQuery(ctx, "/host/usage", query.Encode(), &res)
 	if err != nil {
 		return res, errors.Wrap(ctx, err, "get host usage")
 	}
 	return res, nil
 }
 
+type HostTopOpts struct {
+	// Resource is one of cpu, memory, io and net
+	Resource string
+	// N is the number of containers returned, 10 if it is zero
+	N int
+	// Window is one of the STATS_WINDOWS of the agent, the shortest one if it is zero
+	Window         time.Duration
+	LabelSelectors []string
+}
+
+func (c *Client) HostTop(ctx context.Context, opts HostTopOpts) (HostTop, error) {
+	query := url.Values{"resource": {opts.Resource}, "label": opts.LabelSelectors}
+	if opts.N != 0 {
+		query.Set("n", strconv.Itoa(opts.N))
+	}
+	if opts.Window != 0 {
+		query.Set("window", opts.Window.String())
+	}
+	var top HostTop
+	err := c.getPathWithQuery(ctx, "/host/top", query.Encode(), &top)
+	if err != nil {
+		return top, errors.Wrap(ctx, err, "get host top")
+	}
+	return top, nil
+}
+
+type HostCapacityOpts struct {
+	// Memory and CPU are the size of a container to place, in bytes and in CPUs. The placement isn't
+	// checked if both are zero.
+	Memory uint64
+	CPU    float64
+}
+
+func (c *Client) HostCapacity(ctx context.Context, opts HostCapacityOpts) (HostCapacity, error) {
+	query := url.Values{}
+	if opts.Memory != 0 {
+		query.Set("memory", strconv.FormatUint(opts.Memory, 10))
+	}
+	if opts.CPU != 0 {
+		query.Set("cpu", strconv.FormatFloat(opts.CPU, 'f', -1, 64))
+	}
+	var capacity HostCapacity
+	err := c.getPathWithQuery(ctx, "/host/capacity", query.Encode(), &capacity)
+	if err != nil {
+		return capacity, errors.Wrap(ctx, err, "get host capacity")
+	}
+	return capacity, nil
+}
+
+type AccountingOpts struct {
+	// From and To default to the last 24 hours
+	From time.Time
+	To   time.Time
+	// GroupBy is the label to aggregate the consumption of the containers by
+	GroupBy        string
+	LabelSelectors []string
+}
+
+func (c *Client) Accounting(ctx context.Context, opts AccountingOpts) (Accounting, error) {
+	query := url.Values{"label": opts.LabelSelectors}
+	if !opts.From.IsZero() {
+		query.Set("from", opts.From.Format(time.RFC3339))
+	}
+	if !opts.To.IsZero() {
+		query.Set("to", opts.To.Format(time.RFC3339))
+	}
+	if opts.GroupBy != "" {
+		query.Set("group_by", opts.GroupBy)
+	}
+	var accounting Accounting
+	err := c.getPathWithQuery(ctx, "/accounting", query.Encode(), &accounting)
+	if err != nil {
+		return accounting, errors.Wrap(ctx, err, "get accounting")
+	}
+	return accounting, nil
+}
+
+type HistoryOpts struct {
+	// Target is a container reference (ID, name or unique ID prefix), a monitored cgroup or "host"
+	Target string
+	// Metrics are the names of the metrics to return, all of them if it is empty
+	Metrics []string
+	// From and To default to the last hour
+	From time.Time
+	To   time.Time
+}
+
+func (c *Client) History(ctx context.Context, opts HistoryOpts) (History, error) {
+	query := url.Values{"target": {opts.Target}, "metric": opts.Metrics}
+	if !opts.From.IsZero() {
+		query.Set("from", opts.From.Format(time.RFC3339))
+	}
+	if !opts.To.IsZero() {
+		query.Set("to", opts.To.Format(time.RFC3339))
+	}
+	var history History
+	err := c.getPathWithQuery(ctx, "/history", query.Encode(), &history)
+	if err != nil {
+		return history, errors.Wrap(ctx, err, "get history")
+	}
+	return history, nil
+}
+
 func (c *Client) getResource(ctx context.Context, dockerId, resourceType string, data interface{}) error {
 	return c.getResourceWithQuery(ctx, dockerId, resourceType, "", data)
 }
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/pprof"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/urfave/negroni/v3"
+
+	"github.com/Scalingo/acadock-monitoring/v2/accounting"
+	"github.com/Scalingo/acadock-monitoring/v2/alerts"
+	"github.com/Scalingo/acadock-monitoring/v2/anomalies"
+	"github.com/Scalingo/acadock-monitoring/v2/cgroup"
+	"github.com/Scalingo/acadock-monitoring/v2/collector"
+	"github.com/Scalingo/acadock-monitoring/v2/config"
+	"github.com/Scalingo/acadock-monitoring/v2/cpu"
+	"github.com/Scalingo/acadock-monitoring/v2/docker"
+	"github.com/Scalingo/acadock-monitoring/v2/filters"
+	"github.com/Scalingo/acadock-monitoring/v2/forecast"
+	"github.com/Scalingo/acadock-monitoring/v2/gauges"
+	"github.com/Scalingo/acadock-monitoring/v2/history"
+	"github.com/Scalingo/acadock-monitoring/v2/net"
+	"github.com/Scalingo/acadock-monitoring/v2/procfs"
+	"github.com/Scalingo/acadock-monitoring/v2/recording"
+	"github.com/Scalingo/acadock-monitoring/v2/resources"
+	"github.com/Scalingo/acadock-monitoring/v2/smoothing"
+	"github.com/Scalingo/acadock-monitoring/v2/statsd"
+	"github.com/Scalingo/acadock-monitoring/v2/webserver"
+	"github.com/Scalingo/acadock-monitoring/v2/windows"
+	"github.com/Scalingo/go-handlers"
+	"github.com/Scalingo/go-utils/errors/v3"
+	"github.com/Scalingo/go-utils/logger"
+)
+
+// app is the daemon wired from the configuration: the readers of the host files, the containers
+// inventory, the collectors and the HTTP API. Nothing runs until Start is called.
+type app struct {
+	containerRepository containerInventory
+	netInterfaces       containerInterfaces
+	collectors          *collector.Registry
+	scheduler           *collector.Scheduler
+	handler             http.Handler
+
+	// background are the goroutines started by Start
+	background []func(ctx context.Context)
+	// startNetInterfaces looks for the network interfaces of the containers, it is nil when
+	// replaying an archive
+	startNetInterfaces func(ctx context.Context)
+	// player replaces the scheduler loop when replaying an archive
+	player     *recording.Player
+	recorder   *recording.Recorder
+	accounting *accounting.Ledger
+}
+
+// containerInventory is the containers inventory, kept up to date with Docker or replayed
+type containerInventory interface {
+	docker.ContainerRepository
+	Subscribers() int
+}
+
+// containerInterfaces are the network interfaces of the containers, looked for in their namespace
+// or replayed
+type containerInterfaces interface {
+	net.NetInterfaces
+	Len() int
+}
+
+type appOptions struct {
+	version   string
+	startedAt time.Time
+	// profile exposes the pprof handlers
+	profile bool
+	// record is the path of the archive the inputs are recorded to, until it is larger than
+	// recordMaxSize bytes or covers recordMaxDuration
+	record            string
+	recordMaxSize     int64
+	recordMaxDuration time.Duration
+	// replay is the path of the archive replayed instead of reading the inputs on the host
+	replay string
+}
+
+func newApp(ctx context.Context, opts appOptions) (*app, error) {
+	log := logger.Get(ctx)
+	a := &app{}
+
+	var procFS procfs.FS = procfs.NewFileSystem(ctx, config.ENV["PROC_DIR"])
+	var sysconf procfs.Sysconf = procfs.NewSysconf()
+	if opts.replay != "" {
+		player, err := recording.NewPlayer(ctx, opts.replay)
+		if err != nil {
+			return nil, errors.Wrap(ctx, err, "create archive player")
+		}
+		log.WithField("archive", opts.replay).Info("Replay archive")
+		a.player = player
+		procFS = player
+		sysconf = player
+	}
+	if opts.record != "" {
+		log.WithField("archive", opts.record).Info("Record inputs")
+		a.recorder = recording.NewRecorder(opts.record, sysconf, opts.recordMaxSize, opts.recordMaxDuration)
+		procFS = a.recorder.FS(procFS)
+	}
+	hostCPU := procfs.NewCPUStatReader(procFS, sysconf)
+	hostMemory := procfs.NewMemInfoReader(procFS)
+	hostLoadAvg := procfs.NewLoadAvgReader(procFS)
+	var queueLength filters.MetricsReader
+	if config.QueueLengthMonitoring {
+		smoothedQueueLength, err := filters.NewExponentialSmoothing(procfs.FilterWrap(hostLoadAvg),
+			filters.WithQueueLength(config.QueueLengthElementsNeeded),
+			filters.WithAverageConfig(config.QueueLengthPointsPerSample, config.QueueLengthSamplingInterval),
+		)
+		if err != nil {
+			return nil, errors.Wrap(ctx, err, "create queue length smoothing")
+		}
+		a.background = append(a.background, smoothedQueueLength.Start)
+		queueLength = smoothedQueueLength
+	}
+
+	var mountInfos procfs.MountInfos = procfs.NoMountInfos{}
+	diagnostics := webserver.Diagnostics{Version: opts.version, StartedAt: opts.startedAt}
+	var cgroupStatsReader cgroup.StatsReader
+	if a.player != nil {
+		// The mountpoints of the devices are part of the recorded cgroup stats
+		a.containerRepository = a.player
+		a.netInterfaces = a.player
+		cgroupStatsReader = a.player
+	} else {
+		containerRepository, err := docker.NewContainerRepository(ctx)
+		if err != nil {
+			return nil, errors.Wrap(ctx, err, "create containers repository")
+		}
+		a.containerRepository = containerRepository
+		if config.MountInfoMonitoring {
+			mountInfoPID := 0
+			if config.ENV["PROC_MOUNTINFO_PID"] != "" {
+				mountInfoPID, err = strconv.Atoi(config.ENV["PROC_MOUNTINFO_PID"])
+				if err != nil {
+					return nil, errors.Wrap(ctx, err, "parse PROC_MOUNTINFO_PID")
+				}
+			}
+			mountInfoReader, err := procfs.NewMountInfoReader(ctx, config.ENV["PROC_DIR"], config.ENV["SYS_DIR"], mountInfoPID)
+			if err != nil {
+				return nil, errors.Wrap(ctx, err, "create mount infos reader")
+			}
+			a.background = append(a.background, mountInfoReader.Start)
+			mountInfos = mountInfoReader
+			diagnostics.MountInfos = mountInfoReader
+		}
+		cgroupStatsReader = cgroup.NewStatsReader(mountInfos)
+		a.background = append(a.background, containerRepository.StartListeningToNewContainers)
+
+		netInterfaces := net.NewInterfaces(containerRepository)
+		a.netInterfaces = netInterfaces
+		a.startNetInterfaces = netInterfaces.Start
+	}
+
+	// The recorder copies the inputs read by the scheduler
+	var collectedContainers docker.ContainerRepository = a.containerRepository
+	var collectedInterfaces net.NetInterfaces = a.netInterfaces
+	if a.recorder != nil {
+		collectedContainers = a.recorder.Containers(collectedContainers)
+		collectedInterfaces = a.recorder.Interfaces(collectedInterfaces)
+		cgroupStatsReader = a.recorder.StatsReader(cgroupStatsReader)
+	}
+
+	a.collectors = collector.NewRegistry(disabledCollectors(config.Current()))
+	a.collectors.Register(cpu.NewHostCollector(hostCPU))
+	a.collectors.Register(cpu.NewCollector())
+	a.collectors.Register(cpu.NewLimitCollector())
+	a.collectors.Register(cpu.NewThrottlingCollector())
+	a.collectors.Register(resources.NewMemoryCollector())
+	a.collectors.Register(resources.NewIOCollector())
+	a.collectors.Register(net.NewCollector(collectedInterfaces, procfs.NewNetDevReader(procFS)))
+	a.scheduler = collector.NewScheduler(collectedContainers, config.MonitoredCgroups, cgroupStatsReader, a.collectors, sysconf, gauges.Compute)
+	if a.recorder != nil {
+		a.scheduler.AddListener(a.recorder)
+		a.background = append(a.background, a.recorder.Start)
+	}
+	diagnostics.Collector = a.scheduler
+	cpuMonitor := cpu.NewCPUUsageMonitor(a.scheduler)
+	netMonitor := net.NewNetMonitor(a.scheduler)
+	resourcesGetter := resources.NewUsageGetter(a.scheduler)
+
+	smoothingMonitor, err := smoothing.NewMonitor(ctx, config.Smoothing)
+	if err != nil {
+		return nil, errors.Wrap(ctx, err, "create smoothing monitor")
+	}
+	a.scheduler.AddListener(smoothingMonitor)
+	windowsMonitor := windows.NewMonitor(config.StatsWindows)
+	a.scheduler.AddListener(windowsMonitor)
+	forecastMonitor, err := forecast.NewMonitor(ctx, config.MemoryForecastAlpha, config.MemoryForecastBeta)
+	if err != nil {
+		return nil, errors.Wrap(ctx, err, "create forecast monitor")
+	}
+	a.scheduler.AddListener(forecastMonitor)
+	anomaliesMonitor, err := anomalies.NewMonitor(ctx, config.AnomalyAlpha, config.AnomalyThreshold, config.AnomalyWarmup, config.AnomalyRebaselineAfter)
+	if err != nil {
+		return nil, errors.Wrap(ctx, err, "create anomalies monitor")
+	}
+	a.scheduler.AddListener(anomaliesMonitor)
+	var webhook *alerts.Webhook
+	if config.AlertWebhookURL != "" {
+		webhook = alerts.NewWebhook(config.AlertWebhookURL, config.AlertWebhookAttempts, config.AlertWebhookRetryDelay)
+	}
+	// The alerts engine is notified after the forecast monitor, the rules are evaluated against the
+	// up to date forecasts
+	alertsEngine, err := alerts.NewEngine(ctx, a.containerRepository, forecastMonitor, config.AlertRules, webhook)
+	if err != nil {
+		return nil, errors.Wrap(ctx, err, "create alerts engine")
+	}
+	a.scheduler.AddListener(alertsEngine)
+	if webhook != nil {
+		a.background = append(a.background, alertsEngine.Start)
+	}
+	// The state kept for a container by the monitors and its alerts are destroyed when it stops
+	pruner := filters.NewContainersPruner(a.containerRepository, smoothingMonitor, windowsMonitor, forecastMonitor, anomaliesMonitor, alertsEngine)
+	a.background = append(a.background, pruner.Start)
+
+	a.accounting, err = accounting.NewLedger(ctx, a.containerRepository, config.AccountingDir, config.AccountingSaveInterval, config.AccountingRetention)
+	if err != nil {
+		return nil, errors.Wrap(ctx, err, "create accounting ledger")
+	}
+	a.scheduler.AddListener(a.accounting)
+	a.background = append(a.background, a.accounting.Start)
+	var historyStore *history.Store
+	if config.HistoryDir != "" {
+		historyStore, err = history.NewStore(ctx, config.HistoryDir, config.HistoryResolution, config.HistoryRawRetention, config.HistoryRetention)
+		if err != nil {
+			return nil, errors.Wrap(ctx, err, "create history store")
+		}
+		a.scheduler.AddListener(historyStore)
+		a.background = append(a.background, historyStore.Start)
+	}
+	if config.StatsDAddress != "" {
+		exporter := statsd.NewExporter(a.containerRepository, config.StatsDAddress, config.StatsDPrefix, config.StatsDDialect, config.StatsDLabels, config.StatsDInterval)
+		a.scheduler.AddListener(exporter)
+		a.background = append(a.background, exporter.Start)
+	}
+
+	controller := webserver.NewController(webserver.ControllerDeps{
+		Containers:   a.containerRepository,
+		Resources:    resourcesGetter,
+		CPU:          cpuMonitor,
+		Net:          netMonitor,
+		Queue:        queueLength,
+		Smoothed:     smoothingMonitor,
+		Windows:      windowsMonitor,
+		Forecast:     forecastMonitor,
+		Anomalies:    anomaliesMonitor,
+		Alerts:       alertsEngine,
+		Accounting:   a.accounting,
+		History:      historyStore,
+		ProcfsMemory: hostMemory,
+		Cgroups:      config.MonitoredCgroups,
+		Collectors:   a.collectors,
+		Diagnostics:  diagnostics,
+	})
+
+	globalRouter := mux.NewRouter()
+
+	// The probes are not authenticated so that they can be used by any orchestrator
+	probesRouter := handlers.NewRouter(log)
+	probesRouter.Use(handlers.ErrorMiddleware)
+	probesRouter.HandleFunc("/health", controller.HealthHandler).Methods("GET")
+	probesRouter.HandleFunc("/ready", controller.ReadyHandler).Methods("GET")
+	globalRouter.Handle("/health", probesRouter)
+	globalRouter.Handle("/ready", probesRouter)
+
+	r := handlers.NewRouter(log)
+	r.Use(webserver.MetricsMiddleware)
+	r.Use(webserver.AuthMiddleware)
+	r.Use(handlers.ErrorMiddleware)
+
+	r.HandleFunc("/containers/{ref}/mem", controller.ContainerMemUsageHandler).Methods("GET")
+	r.HandleFunc("/containers/{ref}/io", controller.ContainerIOUsageHandler).Methods("GET")
+	r.HandleFunc("/containers/{ref}/cpu", controller.ContainerCPUUsageHandler).Methods("GET")
+	r.HandleFunc("/containers/{ref}/net", controller.ContainerNetUsageHandler).Methods("GET")
+	r.HandleFunc("/containers/{ref}/usage", controller.ContainerUsageHandler).Methods("GET")
+	r.HandleFunc("/containers/usage", controller.ContainersUsageHandler).Methods("GET")
+	r.HandleFunc("/groups/usage", controller.GroupsUsageHandler).Methods("GET")
+	r.HandleFunc("/host/usage", controller.HostResourcesHandler).Methods("GET")
+	r.HandleFunc("/host/top", controller.HostTopHandler).Methods("GET")
+	r.HandleFunc("/host/capacity", controller.HostCapacityHandler).Methods("GET")
+	r.HandleFunc("/cgroups/usage", controller.CgroupsUsageHandler).Methods("GET")
+	r.HandleFunc("/cgroups/{path:.+}/usage", controller.CgroupUsageHandler).Methods("GET")
+	r.HandleFunc("/anomalies", controller.AnomaliesHandler).Methods("GET")
+	r.HandleFunc("/alerts", controller.AlertsHandler).Methods("GET")
+	r.HandleFunc("/accounting", controller.AccountingHandler).Methods("GET")
+	r.HandleFunc("/history", controller.HistoryHandler).Methods("GET")
+	r.HandleFunc("/status", controller.StatusHandler).Methods("GET")
+	r.HandleFunc("/metrics", controller.MetricsHandler).Methods("GET")
+
+	if opts.profile {
+		pprofRouter := mux.NewRouter()
+		log.Info("Enable profiling")
+		pprofRouter.HandleFunc("/debug/pprof", pprof.Index).Methods("GET")
+		pprofRouter.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline).Methods("GET")
+		pprofRouter.HandleFunc("/debug/pprof/profile", pprof.Profile).Methods("GET")
+		pprofRouter.HandleFunc("/debug/pprof/symbol", pprof.Symbol).Methods("GET")
+		pprofRouter.HandleFunc("/debug/pprof/symbol", pprof.Symbol).Methods("POST")
+		pprofRouter.Handle("/debug/pprof/block", pprof.Handler("block")).Methods("GET")
+		pprofRouter.Handle("/debug/pprof/heap", pprof.Handler("heap")).Methods("GET")
+		pprofRouter.Handle("/debug/pprof/goroutine", pprof.Handler("goroutine")).Methods("GET")
+		pprofRouter.Handle("/debug/pprof/threadcreate", pprof.Handler("threadcreate")).Methods("GET")
+
+		globalRouter.Handle("/debug/pprof/{prop:.*}", pprofRouter)
+	}
+
+	r.HandleFunc("/{any:.*}", func(res http.ResponseWriter, req *http.Request, params map[string]string) error {
+		res.WriteHeader(404)
+		_, _ = res.Write([]byte(`{"error": "not found"}`))
+		return nil
+	})
+
+	globalRouter.Handle("/{any:.+}", r)
+
+	n := negroni.New(negroni.NewRecovery(), &JSONContentTypeMiddleware{})
+	n.UseHandler(globalRouter)
+	a.handler = n
+
+	return a, nil
+}
+
+// Start runs the background goroutines of the daemon until the context is canceled
+func (a *app) Start(ctx context.Context) {
+	for _, run := range a.background {
+		go run(ctx)
+	}
+
+	// Looking for the network interface of the containers requires to enter their namespace, it is
+	// only started once the net collector is enabled
+	startNetInterfaces := sync.OnceFunc(func() {
+		if a.startNetInterfaces != nil {
+			go a.startNetInterfaces(ctx)
+		}
+	})
+	if a.collectors.IsEnabled(net.CollectorName) {
+		startNetInterfaces()
+	}
+	go reloadOnSignal(ctx, a.collectors, startNetInterfaces)
+	if a.player != nil {
+		go a.player.Play(ctx, a.scheduler.CollectAt)
+	} else {
+		go a.scheduler.Start(ctx)
+	}
+}
+
+// Stop saves the state which must survive a restart of the daemon
+func (a *app) Stop(ctx context.Context) {
+	err := a.accounting.Save(ctx)
+	if err != nil {
+		logger.Get(ctx).WithError(err).Error("Fail to save accounting")
+	}
+}
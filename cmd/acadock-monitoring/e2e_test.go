@@ -0,0 +1,390 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Scalingo/acadock-monitoring/v2/client"
+	"github.com/Scalingo/acadock-monitoring/v2/config"
+	"github.com/Scalingo/acadock-monitoring/v2/recording"
+	"github.com/Scalingo/go-utils/logger"
+)
+
+const (
+	webID    = "a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1a1"
+	workerID = "b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2b2"
+)
+
+// fixtures are the fake host files of a test, copied from testdata so that the counters can be
+// updated between two collections
+type fixtures struct {
+	procDir   string
+	cgroupDir string
+	// containerCPUFile returns the file containing the cumulated CPU time of a container, and its
+	// content for the given number of seconds
+	containerCPUFile func(id string, seconds int) (string, string)
+}
+
+func newFixtures(t *testing.T, cgroupVersion string) fixtures {
+	dir := t.TempDir()
+	f := fixtures{
+		procDir:   filepath.Join(dir, "proc"),
+		cgroupDir: filepath.Join(dir, "cgroup"),
+	}
+	require.NoError(t, os.CopyFS(f.procDir, os.DirFS("testdata/proc")))
+	require.NoError(t, os.CopyFS(f.cgroupDir, os.DirFS(filepath.Join("testdata", "cgroup-"+cgroupVersion))))
+
+	if cgroupVersion == "v2" {
+		f.containerCPUFile = func(id string, seconds int) (string, string) {
+			return filepath.Join("system.slice", "docker-"+id+".scope", "cpu.stat"),
+				"usage_usec " + strconv.Itoa(seconds*1000000) + "\nuser_usec 0\nsystem_usec 0\n"
+		}
+	} else {
+		f.containerCPUFile = func(id string, seconds int) (string, string) {
+			return filepath.Join("cpuacct", "docker", id, "cpuacct.usage"), strconv.Itoa(seconds*1000000000) + "\n"
+		}
+	}
+	return f
+}
+
+// advance updates the CPU counters: the host spends busy seconds working and idle seconds idling,
+// each container has used the given number of CPU seconds since its start
+func (f fixtures) advance(t *testing.T, busy, idle int, containers map[string]int) {
+	stat := "cpu  " + strconv.Itoa(10000+busy*100) + " 0 2000 " + strconv.Itoa(80000+idle*100) + " 0 0 0 0 0 0\nctxt 14619208\nbtime 1598000103\n"
+	require.NoError(t, os.WriteFile(filepath.Join(f.procDir, "stat"), []byte(stat), 0o644))
+	for id, seconds := range containers {
+		name, content := f.containerCPUFile(id, seconds)
+		require.NoError(t, os.WriteFile(filepath.Join(f.cgroupDir, name), []byte(content), 0o644))
+	}
+}
+
+// startApp runs the daemon wired by main against the fixtures and the fake Docker API
+func startApp(t *testing.T, f fixtures, docker *fakeDocker, opts appOptions) *app {
+	previous := maps.Clone(config.ENV)
+	t.Cleanup(func() {
+		require.NoError(t, config.Load(previous))
+	})
+	require.NoError(t, config.Load(map[string]string{
+		"PROC_DIR":             f.procDir,
+		"SYS_DIR":              t.TempDir(),
+		"CGROUP_DIR":           f.cgroupDir,
+		"CGROUP_SOURCE":        "docker",
+		"DOCKER_URL":           docker.URL,
+		"REFRESH_TIME":         "1h",
+		"NET_MONITORING":       "false",
+		"MOUNTINFO_MONITORING": "false",
+		"SMOOTHING":            "host_cpu:1:1,cpu:1:1,memory:1:2",
+		"ALERT_RULES":          "memory_quarter:memory_percent>=25:0s:app=web",
+		"ACCOUNTING_DIR":       filepath.Join(t.TempDir(), "accounting"),
+		"HISTORY_DIR":          t.TempDir(),
+	}))
+
+	ctx := logger.ToCtx(t.Context(), logger.Default())
+	opts.version, opts.startedAt = "test", time.Now()
+	a, err := newApp(ctx, opts)
+	require.NoError(t, err)
+	a.Start(ctx)
+
+	require.Eventually(t, func() bool {
+		return get(t, a, "/ready").Code == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond, "the daemon is never ready")
+	return a
+}
+
+func get(t *testing.T, a *app, path string) *httptest.ResponseRecorder {
+	res := httptest.NewRecorder()
+	a.handler.ServeHTTP(res, httptest.NewRequest(http.MethodGet, path, nil))
+	return res
+}
+
+func getJSON(t *testing.T, a *app, path string, payload any) {
+	t.Helper()
+	res := get(t, a, path)
+	require.Equal(t, http.StatusOK, res.Code, res.Body.String())
+	require.NoError(t, json.NewDecoder(res.Body).Decode(payload))
+}
+
+func TestEndToEnd(t *testing.T) {
+	for _, cgroupVersion := range []string{"v1", "v2"} {
+		t.Run("cgroup "+cgroupVersion, func(t *testing.T) {
+			testEndToEnd(t, cgroupVersion)
+		})
+	}
+}
+
+// testEndToEnd queries every endpoint of a daemon collecting the fixtures of the cgroup version.
+// The subtests share the daemon, they run in order as the containers start and the counters advance.
+func testEndToEnd(t *testing.T, cgroupVersion string) {
+	f := newFixtures(t, cgroupVersion)
+	docker := newFakeDocker(t)
+	docker.Run(webID, "web-1", map[string]string{"app": "web"})
+	a := startApp(t, f, docker, appOptions{})
+	ctx := t.Context()
+
+	// The host spends 1s working and 3s idling, the container uses 1s of CPU time
+	f.advance(t, 0, 0, map[string]int{webID: 2})
+	a.scheduler.Collect(ctx)
+	f.advance(t, 1, 3, map[string]int{webID: 3})
+	a.scheduler.Collect(ctx)
+
+	t.Run("container usage", func(t *testing.T) {
+		var usage client.Usage
+		getJSON(t, a, "/containers/web-1/usage", &usage)
+		require.NotNil(t, usage.Cpu)
+		assert.Equal(t, 25*runtime.NumCPU(), usage.Cpu.UsageInPercents)
+		require.NotNil(t, usage.Memory)
+		assert.Equal(t, uint64(1048576), usage.Memory.MemoryUsage)
+		assert.Equal(t, uint64(4194304), usage.Memory.MemoryLimit)
+		require.NotNil(t, usage.Memory.Smoothed)
+		assert.Equal(t, uint64(1048576), *usage.Memory.Smoothed)
+		// The memory usage is stable, it never reaches the limit
+		require.NotNil(t, usage.Memory.GrowthRate)
+		assert.Zero(t, *usage.Memory.GrowthRate)
+		assert.Nil(t, usage.Memory.SecondsUntilLimit)
+		require.NotNil(t, usage.Cpu.Smoothed)
+		assert.InDelta(t, float64(25*runtime.NumCPU()), *usage.Cpu.Smoothed, 0.001)
+		assert.Equal(t, "running", usage.State)
+		assert.Contains(t, usage.Disabled, "net")
+	})
+
+	t.Run("host usage", func(t *testing.T) {
+		var host client.HostUsage
+		getJSON(t, a, "/host/usage", &host)
+		require.NotNil(t, host.CPU)
+		require.NotNil(t, host.Memory)
+		assert.InDelta(t, 0.25, host.CPU.Usage, 0.001)
+		require.NotNil(t, host.CPU.Smoothed)
+		assert.InDelta(t, 0.25, *host.CPU.Smoothed, 0.001)
+		assert.Equal(t, uint64(31697), host.Memory.Total)
+		assert.Equal(t, uint64(1048576), host.Memory.MemoryUsage)
+		assert.Equal(t, 0.5, host.CPU.Committed)
+	})
+
+	// A container started through the events stream is collected
+	docker.Start(workerID, "worker-1", map[string]string{"app": "worker"})
+	require.Eventually(t, func() bool {
+		_, err := a.containerRepository.Container(ctx, "worker-1")
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	t.Run("container not collected yet", func(t *testing.T) {
+		// The container isn't collected until the next collection
+		res := get(t, a, "/containers/worker-1/mem")
+		assert.Equal(t, http.StatusServiceUnavailable, res.Code)
+		assert.NotEmpty(t, res.Header().Get("Retry-After"))
+	})
+
+	a.scheduler.Collect(ctx)
+	f.advance(t, 2, 6, map[string]int{webID: 3, workerID: 4})
+	a.scheduler.Collect(ctx)
+
+	t.Run("containers usage", func(t *testing.T) {
+		var containers client.ContainersUsage
+		getJSON(t, a, "/containers/usage", &containers)
+		require.Contains(t, containers, webID)
+		require.Contains(t, containers, workerID)
+		assert.Equal(t, 0, containers[webID].Cpu.UsageInPercents)
+		assert.Equal(t, 50*runtime.NumCPU(), containers[workerID].Cpu.UsageInPercents)
+		// The worker series are created at its first collection, the memory needs two of them
+		assert.NotNil(t, containers[workerID].Cpu.Smoothed)
+		assert.NotNil(t, containers[workerID].Memory.Smoothed)
+		assert.Equal(t, map[string]string{"app": "worker"}, containers[workerID].Labels)
+		assert.Nil(t, containers[webID].Window)
+
+		var webContainers client.ContainersUsage
+		getJSON(t, a, "/containers/usage?label=app=web", &webContainers)
+		assert.Len(t, webContainers, 1)
+	})
+
+	t.Run("containers usage over a window", func(t *testing.T) {
+		// The web container has been collected 4 times, its CPU usage is computed from 3 of them
+		var windowed client.ContainersUsage
+		getJSON(t, a, "/containers/usage?label=app=web&window=1m", &windowed)
+		require.NotNil(t, windowed[webID].Window)
+		assert.Equal(t, "1m0s", windowed[webID].Window.Length)
+		require.NotNil(t, windowed[webID].Window.Memory)
+		assert.Equal(t, 4, windowed[webID].Window.Memory.Count)
+		assert.Equal(t, 1048576.0, windowed[webID].Window.Memory.Mean)
+		require.NotNil(t, windowed[webID].Window.CPU)
+		assert.Equal(t, 3, windowed[webID].Window.CPU.Count)
+		assert.Equal(t, float64(25*runtime.NumCPU()), windowed[webID].Window.CPU.Max)
+		assert.Equal(t, http.StatusBadRequest, get(t, a, "/containers/usage?window=2m").Code)
+	})
+
+	t.Run("host top", func(t *testing.T) {
+		// The worker uses half of the host CPU time since its start
+		var top client.HostTop
+		getJSON(t, a, "/host/top?resource=cpu&n=1", &top)
+		assert.Equal(t, "1m0s", top.Window)
+		require.NotNil(t, top.Capacity)
+		assert.Equal(t, float64(100*runtime.NumCPU()), *top.Capacity)
+		require.Len(t, top.Containers, 1)
+		assert.Equal(t, workerID, top.Containers[0].ContainerID)
+		assert.InDelta(t, float64(50*runtime.NumCPU()), top.Containers[0].Value, 0.001)
+		// The web container CPU usage was 25%, 0% and 0% of a CPU
+		assert.InDelta(t, float64(50*runtime.NumCPU())+float64(25*runtime.NumCPU())/3, top.Total, 0.001)
+		// The share is relative to the mean consumption of the host over the window, which the fake
+		// host CPU counters don't keep consistent with the containers ones
+		require.NotNil(t, top.Host)
+		assert.InDelta(t, 0.125*float64(100*runtime.NumCPU()), *top.Host, 0.001)
+		assert.InDelta(t, top.Containers[0].Value / *top.Host * 100, top.Containers[0].Share, 0.001)
+		require.NotNil(t, top.Containers[0].CapacityPercent)
+		assert.InDelta(t, 50, *top.Containers[0].CapacityPercent, 0.001)
+		// All the collections happened during the last minute
+		assert.Nil(t, top.Containers[0].PreviousValue)
+		assert.Equal(t, http.StatusBadRequest, get(t, a, "/host/top?resource=disk").Code)
+	})
+
+	t.Run("host capacity", func(t *testing.T) {
+		// The web container is limited to half a CPU with 512 shares, the worker CPU isn't limited,
+		// both are limited to 4MiB of memory
+		var capacity client.HostCapacity
+		getJSON(t, a, "/host/capacity?memory=512M&cpu=0.5", &capacity)
+		assert.Equal(t, float64(32457876*1024), capacity.Memory.Total)
+		assert.Equal(t, float64(2*4194304), capacity.Memory.Committed)
+		assert.InDelta(t, float64(2*4194304)/float64(32457876*1024), capacity.Memory.OvercommitRatio, 0.000001)
+		require.NotNil(t, capacity.Memory.Fits)
+		assert.True(t, *capacity.Memory.Fits)
+		assert.Equal(t, float64(runtime.NumCPU()), capacity.CPU.Total)
+		assert.Equal(t, 0.5, capacity.CPU.Committed)
+		assert.Equal(t, 1, capacity.CPU.Unlimited)
+		webShares := uint64(512)
+		if cgroupVersion == "v2" {
+			// runc converts the 512 shares to a weight of 20, which is 500 shares
+			webShares = 500
+		}
+		assert.Equal(t, webShares+1024, capacity.CPU.Shares)
+		assert.Equal(t, float64(runtime.NumCPU())-0.5, capacity.CPU.Free)
+		require.NotNil(t, capacity.Fits)
+		assert.True(t, *capacity.Fits)
+
+		var tooLarge client.HostCapacity
+		getJSON(t, a, fmt.Sprintf("/host/capacity?cpu=%d", runtime.NumCPU()), &tooLarge)
+		require.NotNil(t, tooLarge.Fits)
+		assert.False(t, *tooLarge.Fits)
+		assert.Nil(t, tooLarge.Memory.Fits)
+		assert.Equal(t, http.StatusBadRequest, get(t, a, "/host/capacity?memory=lots").Code)
+	})
+
+	t.Run("anomalies", func(t *testing.T) {
+		// The steady usages are not anomalous
+		var anomalies client.Anomalies
+		getJSON(t, a, "/anomalies", &anomalies)
+		assert.Empty(t, anomalies)
+		assert.NotNil(t, anomalies)
+	})
+
+	t.Run("alerts", func(t *testing.T) {
+		// The web container uses a quarter of its memory limit
+		var alerts client.Alerts
+		getJSON(t, a, "/alerts", &alerts)
+		require.Len(t, alerts, 1)
+		assert.Equal(t, "memory_quarter", alerts[0].Rule)
+		assert.Equal(t, webID, alerts[0].Target)
+		assert.Equal(t, client.AlertStateFiring, alerts[0].State)
+		assert.InDelta(t, 25, alerts[0].Value, 0.001)
+	})
+
+	t.Run("accounting", func(t *testing.T) {
+		// The worker has been started since the previous collection, its whole CPU time is accounted
+		var accounting client.Accounting
+		getJSON(t, a, "/accounting?group_by=app", &accounting)
+		assert.Len(t, accounting.Targets, 2)
+		require.Len(t, accounting.Groups, 2)
+		assert.Equal(t, "web", accounting.Groups[0].Value)
+		assert.Positive(t, accounting.Groups[0].Usage.MemoryGBHours)
+		assert.Equal(t, client.GroupAccounting{Value: "worker", Targets: 1, Usage: client.AccountingUsage{CPUSeconds: 4, MemoryGBHours: accounting.Groups[1].Usage.MemoryGBHours}}, accounting.Groups[1])
+		assert.Equal(t, http.StatusBadRequest, get(t, a, "/accounting?from=yesterday").Code)
+	})
+
+	// The accounting is saved when the daemon stops
+	a.Stop(ctx)
+	assert.FileExists(t, filepath.Join(config.AccountingDir, "state.json"))
+
+	t.Run("history", func(t *testing.T) {
+		// The gauges of the 4 collections of the web container are written to the history in the
+		// background
+		require.Eventually(t, func() bool {
+			var history client.History
+			getJSON(t, a, "/history?target=web-1&metric=memory", &history)
+			return len(history.Metrics["memory"]) == 4
+		}, 5*time.Second, 10*time.Millisecond)
+		var history client.History
+		getJSON(t, a, "/history?target=host", &history)
+		assert.Equal(t, "host", history.Target)
+		// The host worked a quarter of the time when the fixtures advanced between the collections
+		require.Len(t, history.Metrics["host_cpu"], 4)
+		assert.InDelta(t, 0.25, history.Metrics["host_cpu"][1].Value, 0.001)
+		assert.InDelta(t, 0.25, history.Metrics["host_cpu"][3].Value, 0.001)
+		assert.Equal(t, http.StatusBadRequest, get(t, a, "/history?target=web-1&metric=disk").Code)
+	})
+
+	t.Run("dead container", func(t *testing.T) {
+		// A container dying is removed from the inventory
+		docker.Die(webID)
+		require.Eventually(t, func() bool {
+			return get(t, a, "/containers/web-1/usage").Code == http.StatusNotFound
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+}
+
+func TestEndToEnd_RecordReplay(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "acadock.rec.gz")
+	f := newFixtures(t, "v2")
+	var recorded []client.ContainersUsage
+
+	t.Run("record", func(t *testing.T) {
+		docker := newFakeDocker(t)
+		docker.Run(webID, "web-1", map[string]string{"app": "web"})
+		a := startApp(t, f, docker, appOptions{record: archive})
+		ctx := t.Context()
+
+		// The inputs of the collection done at startup are recorded too, the next ones are a minute
+		// apart so that the replay doesn't move to the next snapshot by itself during the test
+		start := time.Now()
+		steps := []map[string]int{{webID: 2}, {webID: 3}, {webID: 5}}
+		for i, containers := range steps {
+			f.advance(t, i, 3*i, containers)
+			a.scheduler.CollectAt(ctx, start.Add(time.Duration(i+1)*time.Minute))
+
+			var usage client.ContainersUsage
+			getJSON(t, a, "/containers/usage", &usage)
+			recorded = append(recorded, usage)
+		}
+		require.Eventually(t, func() bool {
+			snapshots, err := recording.ReadArchive(ctx, archive)
+			return err == nil && len(snapshots) == len(steps)+1
+		}, 5*time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("replay", func(t *testing.T) {
+		// The host files are not read anymore
+		require.NoError(t, os.RemoveAll(f.procDir))
+		require.NoError(t, os.RemoveAll(f.cgroupDir))
+
+		a := startApp(t, f, newFakeDocker(t), appOptions{replay: archive})
+		ctx := t.Context()
+
+		// The snapshot recorded at startup has been collected when the replay started
+		for i, expected := range recorded {
+			require.True(t, a.player.Next())
+			a.scheduler.CollectAt(ctx, a.player.Snapshot().Time)
+			var usage client.ContainersUsage
+			getJSON(t, a, "/containers/usage", &usage)
+			assert.Equal(t, expected, usage, "snapshot %d", i)
+		}
+		assert.False(t, a.player.Next())
+	})
+}
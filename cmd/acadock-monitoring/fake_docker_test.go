@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/moby/moby/api/types/container"
+	dockerevents "github.com/moby/moby/api/types/events"
+	dockerclient "github.com/moby/moby/client"
+)
+
+// fakeDocker is an in-process Docker API serving the endpoints used by the containers inventory:
+// the containers list, the inspection of a container and the events stream
+type fakeDocker struct {
+	*httptest.Server
+
+	mutex      *sync.Mutex
+	containers map[string]container.InspectResponse
+	events     chan dockerevents.Message
+}
+
+func newFakeDocker(t *testing.T) *fakeDocker {
+	docker := &fakeDocker{
+		mutex:      &sync.Mutex{},
+		containers: map[string]container.InspectResponse{},
+		events:     make(chan dockerevents.Message, 100),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/_ping", func(res http.ResponseWriter, req *http.Request) {
+		res.Header().Set("Api-Version", dockerclient.MaxAPIVersion)
+		res.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("GET /{version}/containers/json", docker.listContainers)
+	mux.HandleFunc("GET /{version}/containers/{id}/json", docker.inspectContainer)
+	mux.HandleFunc("GET /{version}/events", docker.streamEvents)
+	docker.Server = httptest.NewServer(mux)
+	t.Cleanup(docker.Close)
+	return docker
+}
+
+// Run adds a running container without any event, as if it was started before acadock
+func (d *fakeDocker) Run(id, name string, labels map[string]string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.containers[id] = container.InspectResponse{
+		ID:   id,
+		Name: "/" + name,
+		State: &container.State{
+			Status:    container.StateRunning,
+			StartedAt: time.Now().Format(time.RFC3339Nano),
+		},
+		Config: &container.Config{Image: "scalingo/" + name, Labels: labels},
+	}
+}
+
+// Start runs a container and sends its start event
+func (d *fakeDocker) Start(id, name string, labels map[string]string) {
+	d.Run(id, name, labels)
+	d.send(id, dockerevents.ActionStart)
+}
+
+// Die stops a container and sends its die event
+func (d *fakeDocker) Die(id string) {
+	d.mutex.Lock()
+	delete(d.containers, id)
+	d.mutex.Unlock()
+	d.send(id, dockerevents.ActionDie)
+}
+
+func (d *fakeDocker) send(id string, action dockerevents.Action) {
+	d.events <- dockerevents.Message{
+		Type:     dockerevents.ContainerEventType,
+		Action:   action,
+		Actor:    dockerevents.Actor{ID: id},
+		TimeNano: time.Now().UnixNano(),
+	}
+}
+
+func (d *fakeDocker) listContainers(res http.ResponseWriter, req *http.Request) {
+	d.mutex.Lock()
+	list := make([]container.Summary, 0, len(d.containers))
+	for _, inspect := range d.containers {
+		list = append(list, container.Summary{
+			ID:     inspect.ID,
+			Names:  []string{inspect.Name},
+			Image:  inspect.Config.Image,
+			Labels: inspect.Config.Labels,
+			State:  inspect.State.Status,
+		})
+	}
+	d.mutex.Unlock()
+
+	writeJSON(res, http.StatusOK, list)
+}
+
+func (d *fakeDocker) inspectContainer(res http.ResponseWriter, req *http.Request) {
+	d.mutex.Lock()
+	inspect, ok := d.containers[req.PathValue("id")]
+	d.mutex.Unlock()
+	if !ok {
+		writeJSON(res, http.StatusNotFound, map[string]string{"message": "No such container: " + req.PathValue("id")})
+		return
+	}
+	writeJSON(res, http.StatusOK, inspect)
+}
+
+func (d *fakeDocker) streamEvents(res http.ResponseWriter, req *http.Request) {
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+	res.(http.Flusher).Flush()
+
+	encoder := json.NewEncoder(res)
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case event := <-d.events:
+			err := encoder.Encode(event)
+			if err != nil {
+				return
+			}
+			res.(http.Flusher).Flush()
+		}
+	}
+}
+
+func writeJSON(res http.ResponseWriter, status int, payload any) {
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	_ = json.NewEncoder(res).Encode(payload)
+}
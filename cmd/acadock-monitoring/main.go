@@ -4,27 +4,24 @@ import (
 	"context"
 	"flag"
 	"net/http"
-	"net/http/pprof"
 	"os"
-	"strconv"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
 
-	"github.com/gorilla/mux"
-	"github.com/urfave/negroni/v3"
-
-	"github.com/Scalingo/acadock-monitoring/v2/cgroup"
+	"github.com/Scalingo/acadock-monitoring/v2/collector"
 	"github.com/Scalingo/acadock-monitoring/v2/config"
-	"github.com/Scalingo/acadock-monitoring/v2/cpu"
-	"github.com/Scalingo/acadock-monitoring/v2/docker"
-	"github.com/Scalingo/acadock-monitoring/v2/filters"
+	"github.com/Scalingo/acadock-monitoring/v2/metrics"
 	"github.com/Scalingo/acadock-monitoring/v2/net"
-	"github.com/Scalingo/acadock-monitoring/v2/procfs"
 	"github.com/Scalingo/acadock-monitoring/v2/resources"
-	"github.com/Scalingo/acadock-monitoring/v2/webserver"
-	"github.com/Scalingo/go-handlers"
 	"github.com/Scalingo/go-utils/graceful"
 	"github.com/Scalingo/go-utils/logger"
 )
 
+// version is set at build time
+var version = "dev"
+
 type JSONContentTypeMiddleware struct{}
 
 func (m *JSONContentTypeMiddleware) ServeHTTP(res http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
@@ -33,99 +30,104 @@ func (m *JSONContentTypeMiddleware) ServeHTTP(res http.ResponseWriter, req *http
 }
 
 func main() {
+	err := config.LoadEnvironment()
+	if err != nil {
+		logger.Default().WithError(err).Fatal("Invalid configuration")
+	}
 	if config.Debug {
 		os.Setenv("LOGGER_LEVEL", "debug")
 	}
 
+	startedAt := time.Now()
 	log := logger.Default()
 	ctx := logger.ToCtx(context.Background(), log)
 
 	doProfile := flag.Bool("profile", false, "profile app")
+	record := flag.String("record", "", "record the inputs to this archive")
+	recordMaxSize := flag.Int64("record-max-size", 1024, "stop recording once the archive is larger than this size in MB, 0 for no limit")
+	recordMaxDuration := flag.Duration("record-max-duration", 24*time.Hour, "stop recording once the archive covers this duration, 0 for no limit")
+	replay := flag.String("replay", "", "serve the API from the inputs recorded in this archive")
 	flag.Parse()
+	if *record != "" && *replay != "" {
+		log.Fatalln("-record and -replay can't be used together")
+	}
 
-	hostCPU := procfs.NewCPUStatReader(ctx)
-	hostMemory := procfs.NewMemInfoReader(ctx)
-	hostLoadAvg := procfs.NewLoadAvgReader(ctx)
-	queueLength, err := filters.NewExponentialSmoothing(procfs.FilterWrap(hostLoadAvg),
-		filters.WithQueueLength(config.QueueLengthElementsNeeded),
-		filters.WithAverageConfig(config.QueueLengthPointsPerSample, config.QueueLengthSamplingInterval),
-	)
+	a, err := newApp(ctx, appOptions{
+		version: version, startedAt: startedAt, profile: *doProfile,
+		record: *record, recordMaxSize: *recordMaxSize * 1024 * 1024, recordMaxDuration: *recordMaxDuration,
+		replay: *replay,
+	})
 	if err != nil {
 		log.Fatalln(err)
 	}
-	go queueLength.Start(ctx)
+	a.Start(ctx)
 
-	containerRepository := docker.NewContainerRepository()
-	mountInfoPID := 0
-	if config.ENV["PROC_MOUNTINFO_PID"] != "" {
-		mountInfoPID, err = strconv.Atoi(config.ENV["PROC_MOUNTINFO_PID"])
-		if err != nil {
-			log.Fatalln(err)
+	metrics.NewGaugeFunc("acadock_snapshot_targets", "Number of targets in the last snapshot", func() float64 {
+		_, current := a.scheduler.Snapshots()
+		if current == nil {
+			return 0
 		}
-	}
-	mountInfos, err := procfs.NewMountInfoReader(ctx, config.ENV["PROC_DIR"], mountInfoPID)
+		return float64(len(current.Targets))
+	})
+	metrics.NewGaugeFunc("acadock_net_interfaces", "Number of containers whose network interface is known", func() float64 {
+		return float64(a.netInterfaces.Len())
+	})
+	metrics.NewGaugeFunc("acadock_inventory_containers", "Number of containers in the inventory", func() float64 {
+		containers, _ := a.containerRepository.Containers(ctx)
+		return float64(len(containers))
+	})
+	metrics.NewGaugeFunc("acadock_containers_stream_subscribers", "Number of subscribers of the containers events stream", func() float64 {
+		return float64(a.containerRepository.Subscribers())
+	})
+
+	s := graceful.NewService()
+
+	err = s.ListenAndServe(ctx, "tcp", ":"+config.ENV["PORT"], a.handler)
 	if err != nil {
-		log.Fatalln(err)
+		log.WithError(err).Error("Fail to stop http server")
 	}
-	go mountInfos.Start(ctx)
-	cgroupStatsReader := cgroup.NewStatsReader(mountInfos)
-	go containerRepository.StartListeningToNewContainers(ctx)
-	cpuMonitor := cpu.NewCPUUsageMonitor(containerRepository, hostCPU, cgroupStatsReader)
-	go cpuMonitor.Start(ctx)
-	netMonitor := net.NewNetMonitor(ctx, containerRepository)
-	go netMonitor.Start()
-	resourcesGetter := resources.NewUsageGetter(cgroupStatsReader)
-
-	controller := webserver.NewController(resourcesGetter, cpuMonitor, netMonitor, queueLength, hostMemory)
-
-	globalRouter := mux.NewRouter()
-	r := handlers.NewRouter(log)
-	if config.ENV["HTTP_USERNAME"] != "" && config.ENV["HTTP_PASSWORD"] != "" {
-		r.Use(handlers.AuthMiddleware(func(user, password string) bool {
-			return user == config.ENV["HTTP_USERNAME"] && password == config.ENV["HTTP_PASSWORD"]
-		}))
+	a.Stop(ctx)
+}
+
+func disabledCollectors(settings config.Settings) []string {
+	disabled := slices.Clone(settings.DisabledCollectors)
+	if !settings.NetMonitoring {
+		disabled = append(disabled, net.CollectorName)
 	}
-	r.Use(handlers.ErrorMiddleware)
-
-	r.HandleFunc("/containers/{id}/mem", controller.ContainerMemUsageHandler).Methods("GET")
-	r.HandleFunc("/containers/{id}/io", controller.ContainerIOUsageHandler).Methods("GET")
-	r.HandleFunc("/containers/{id}/cpu", controller.ContainerCPUUsageHandler).Methods("GET")
-	r.HandleFunc("/containers/{id}/net", controller.ContainerNetUsageHandler).Methods("GET")
-	r.HandleFunc("/containers/{id}/usage", controller.ContainerUsageHandler).Methods("GET")
-	r.HandleFunc("/containers/usage", controller.ContainersUsageHandler).Methods("GET")
-	r.HandleFunc("/host/usage", controller.HostResourcesHandler).Methods("GET")
-
-	if *doProfile {
-		pprofRouter := mux.NewRouter()
-		log.Info("Enable profiling")
-		pprofRouter.HandleFunc("/debug/pprof", pprof.Index).Methods("GET")
-		pprofRouter.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline).Methods("GET")
-		pprofRouter.HandleFunc("/debug/pprof/profile", pprof.Profile).Methods("GET")
-		pprofRouter.HandleFunc("/debug/pprof/symbol", pprof.Symbol).Methods("GET")
-		pprofRouter.HandleFunc("/debug/pprof/symbol", pprof.Symbol).Methods("POST")
-		pprofRouter.Handle("/debug/pprof/block", pprof.Handler("block")).Methods("GET")
-		pprofRouter.Handle("/debug/pprof/heap", pprof.Handler("heap")).Methods("GET")
-		pprofRouter.Handle("/debug/pprof/goroutine", pprof.Handler("goroutine")).Methods("GET")
-		pprofRouter.Handle("/debug/pprof/threadcreate", pprof.Handler("threadcreate")).Methods("GET")
-
-		globalRouter.Handle("/debug/pprof/{prop:.*}", pprofRouter)
+	if !settings.IOMonitoring {
+		disabled = append(disabled, resources.IOCollectorName)
 	}
+	return disabled
+}
 
-	r.HandleFunc("/{any:.*}", func(res http.ResponseWriter, req *http.Request, params map[string]string) error {
-		res.WriteHeader(404)
-		_, _ = res.Write([]byte(`{"error": "not found"}`))
-		return nil
-	})
-
-	globalRouter.Handle("/{any:.+}", r)
-
-	n := negroni.New(negroni.NewRecovery(), &JSONContentTypeMiddleware{})
-	n.UseHandler(globalRouter)
+// reloadOnSignal reloads the configuration when the process receives SIGUSR1. SIGHUP is already
+// used by the graceful service to restart the process.
+func reloadOnSignal(ctx context.Context, collectors *collector.Registry, startNetInterfaces func()) {
+	log := logger.Get(ctx)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1)
+	defer signal.Stop(signals)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-signals:
+		}
 
-	s := graceful.NewService()
+		restartRequired, err := config.Reload()
+		if err != nil {
+			log.WithError(err).Error("Fail to reload the configuration, the current one is kept")
+			continue
+		}
+		if len(restartRequired) > 0 {
+			log.WithField("settings", restartRequired).Warn("Settings changed which are only applied after a restart")
+		}
 
-	err = s.ListenAndServe(ctx, "tcp", ":"+config.ENV["PORT"], n)
-	if err != nil {
-		log.WithError(err).Error("Fail to stop http server")
+		collectors.SetDisabled(disabledCollectors(config.Current()))
+		if collectors.IsEnabled(net.CollectorName) {
+			startNetInterfaces()
+		}
+		log.Info("Configuration reloaded")
 	}
 }
@@ -0,0 +1,113 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// Scope defines what a collector samples
+type Scope string
+
+const (
+	// ScopeHost collectors are called once per iteration
+	ScopeHost Scope = "host"
+	// ScopeContainer collectors are called once per iteration for every target: the Docker
+	// containers and the cgroups configured in MONITORED_CGROUPS
+	ScopeContainer Scope = "container"
+)
+
+// Collector is a source of metrics. The value returned by Collect is stored in the snapshot under
+// the name of the collector and its readers get it back with Value.
+type Collector interface {
+	// Name identifies the collector in the registry, in the snapshots and in the configuration
+	Name() string
+	Scope() Scope
+	// Collect returns the value of the metric. The target is nil for ScopeHost collectors. A nil
+	// value without error means there is nothing to collect, for instance for a target to which the
+	// metric doesn't apply.
+	Collect(ctx context.Context, target *Target) (any, error)
+}
+
+// Preparer is implemented by the collectors which need to do some work once per iteration before
+// the targets are collected, for instance reading a file shared by all the targets.
+type Preparer interface {
+	Prepare(ctx context.Context) error
+}
+
+// Registry holds the collectors called by the scheduler
+type Registry struct {
+	disabled   map[string]bool
+	mutex      *sync.RWMutex
+	collectors []Collector
+}
+
+// NewRegistry returns a registry in which the collectors named in disabled are registered but not
+// enabled.
+func NewRegistry(disabled []string) *Registry {
+	r := &Registry{
+		mutex: &sync.RWMutex{},
+	}
+	r.SetDisabled(disabled)
+	return r
+}
+
+// SetDisabled replaces the list of the disabled collectors, it is taken into account from the next
+// collection
+func (r *Registry) SetDisabled(disabled []string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.disabled = map[string]bool{}
+	for _, name := range disabled {
+		r.disabled[name] = true
+	}
+}
+
+// Register adds a collector to the registry. It panics if a collector with the same name is
+// already registered.
+func (r *Registry) Register(c Collector) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, registered := range r.collectors {
+		if registered.Name() == c.Name() {
+			panic(fmt.Sprintf("collector %s registered twice", c.Name()))
+		}
+	}
+	r.collectors = append(r.collectors, c)
+}
+
+// IsEnabled returns true if the collector is registered and not disabled
+func (r *Registry) IsEnabled(name string) bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if r.disabled[name] {
+		return false
+	}
+	for _, c := range r.collectors {
+		if c.Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// All returns all the registered collectors, enabled or not, in registration order
+func (r *Registry) All() []Collector {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return slices.Clone(r.collectors)
+}
+
+// Collectors returns the enabled collectors of the given scope, in registration order
+func (r *Registry) Collectors(scope Scope) []Collector {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	collectors := make([]Collector, 0, len(r.collectors))
+	for _, c := range r.collectors {
+		if c.Scope() == scope && !r.disabled[c.Name()] {
+			collectors = append(collectors, c)
+		}
+	}
+	return collectors
+}
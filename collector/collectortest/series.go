@@ -0,0 +1,46 @@
+// Package collectortest provides series of snapshots to test the listeners of the scheduler.
+package collectortest
+
+import (
+	"context"
+	"time"
+
+	"github.com/Scalingo/acadock-monitoring/v2/collector"
+	"github.com/Scalingo/acadock-monitoring/v2/cpu"
+	"github.com/Scalingo/acadock-monitoring/v2/gauges"
+	"github.com/Scalingo/acadock-monitoring/v2/procfs"
+)
+
+// Series are snapshots collected every Interval from Start. The host spends half of its time
+// working.
+type Series struct {
+	Start    time.Time
+	Interval time.Duration
+	// Targets returns the samples of the targets of the i-th snapshot
+	Targets func(i int) map[string]collector.Sample
+}
+
+// Snapshot returns the i-th snapshot of the series
+func (s Series) Snapshot(i int) *collector.Snapshot {
+	elapsed := time.Duration(i) * s.Interval
+	return &collector.Snapshot{
+		Time:    s.Start.Add(elapsed),
+		Host:    collector.Sample{cpu.HostCollectorName: procfs.SingleCPUStat{User: elapsed, IDLE: elapsed}},
+		Targets: s.Targets(i),
+	}
+}
+
+// Notify notifies the listener of the count first snapshots, each one with its predecessor and its
+// gauges as the scheduler does. If after isn't nil, it is called with the index of every snapshot once the
+// listener has been notified of it.
+func (s Series) Notify(ctx context.Context, listener collector.SnapshotListener, count int, after func(i int)) {
+	var previous *collector.Snapshot
+	for i := range count {
+		current := s.Snapshot(i)
+		listener.SnapshotCollected(ctx, previous, current, gauges.Compute(previous, current))
+		previous = current
+		if after != nil {
+			after(i)
+		}
+	}
+}
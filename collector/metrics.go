@@ -0,0 +1,24 @@
+package collector
+
+import (
+	"github.com/Scalingo/acadock-monitoring/v2/metrics"
+)
+
+var (
+	collectionDuration = metrics.NewHistogram(
+		"acadock_collection_duration_seconds", "Duration of a collection of the host and all the targets",
+		metrics.DefaultBuckets,
+	)
+	collectorDuration = metrics.NewHistogram(
+		"acadock_collector_duration_seconds", "Duration of a call to a collector for the host or a target",
+		metrics.DefaultBuckets, "collector",
+	)
+	collectorErrors = metrics.NewCounter(
+		"acadock_collector_errors_total", "Number of errors returned by the collectors",
+		"collector",
+	)
+	cgroupStatsReadDuration = metrics.NewHistogram(
+		"acadock_cgroup_stats_read_duration_seconds", "Duration of the read of the cgroup stats of a target, by kind of target: container or cgroup",
+		metrics.DefaultBuckets, "kind",
+	)
+)
@@ -0,0 +1,291 @@
+package collector
+
+import (
+	"context"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/Scalingo/acadock-monitoring/v2/cgroup"
+	"github.com/Scalingo/acadock-monitoring/v2/config"
+	"github.com/Scalingo/acadock-monitoring/v2/docker"
+	"github.com/Scalingo/acadock-monitoring/v2/procfs"
+	"github.com/Scalingo/go-utils/logger"
+)
+
+var (
+	_ SnapshotReader = &Scheduler{}
+	_ StatusReader   = &Scheduler{}
+)
+
+// Status describes the last iterations of the scheduler
+type Status struct {
+	// LastCollectAt is the start time of the last iteration, zero until the first one is done
+	LastCollectAt       time.Time
+	LastCollectDuration time.Duration
+	// Collectors is indexed by collector name
+	Collectors map[string]CollectorStatus
+}
+
+type CollectorStatus struct {
+	// Targets is the number of targets sampled by the collector during the last iteration
+	Targets     int
+	LastError   error
+	LastErrorAt time.Time
+}
+
+type StatusReader interface {
+	Status() Status
+}
+
+// SnapshotListener is notified of every snapshot published by the scheduler and of the gauges
+// computed from it, e.g. to compute values over a longer period than the two last snapshots
+type SnapshotListener interface {
+	SnapshotCollected(ctx context.Context, previous *Snapshot, current *Snapshot, gauges Gauges)
+}
+
+// Scheduler is the single collection loop of acadock: at every interval, it calls every enabled
+// collector of the registry once for the host and once per target, and publishes the result as a
+// new snapshot.
+type Scheduler struct {
+	containerRepository docker.ContainerRepository
+	cgroups             []string
+	cgroupStatsReader   cgroup.StatsReader
+	registry            *Registry
+	sysconf             procfs.Sysconf
+	gauges              GaugesFunc
+	listeners           []SnapshotListener
+
+	snapshotsMutex *sync.RWMutex
+	previous       *Snapshot
+	current        *Snapshot
+
+	statusMutex *sync.Mutex
+	status      Status
+}
+
+// NewScheduler returns a scheduler computing the gauges of every snapshot with gauges, once for
+// all its listeners
+func NewScheduler(containerRepository docker.ContainerRepository, cgroups []string, cgroupStatsReader cgroup.StatsReader, registry *Registry, sysconf procfs.Sysconf, gauges GaugesFunc) *Scheduler {
+	return &Scheduler{
+		containerRepository: containerRepository,
+		cgroups:             cgroups,
+		cgroupStatsReader:   cgroupStatsReader,
+		registry:            registry,
+		sysconf:             sysconf,
+		gauges:              gauges,
+		snapshotsMutex:      &sync.RWMutex{},
+		statusMutex:         &sync.Mutex{},
+		status:              Status{Collectors: map[string]CollectorStatus{}},
+	}
+}
+
+// AddListener registers a listener notified after every collection. It must be called before the
+// scheduler is started.
+func (s *Scheduler) AddListener(listener SnapshotListener) {
+	s.listeners = append(s.listeners, listener)
+}
+
+func (s *Scheduler) Start(ctx context.Context) {
+	log := logger.Get(ctx)
+
+	interval := config.Current().RefreshTime
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		s.Collect(ctx)
+
+		// The refresh time may have been changed by a configuration reload
+		if refreshTime := config.Current().RefreshTime; refreshTime != interval {
+			interval = refreshTime
+			tick.Reset(interval)
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Info("Collector stopped - Context done")
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+func (s *Scheduler) Status() Status {
+	s.statusMutex.Lock()
+	defer s.statusMutex.Unlock()
+
+	status := s.status
+	status.Collectors = maps.Clone(s.status.Collectors)
+	return status
+}
+
+func (s *Scheduler) Snapshots() (*Snapshot, *Snapshot) {
+	s.snapshotsMutex.RLock()
+	defer s.snapshotsMutex.RUnlock()
+	return s.previous, s.current
+}
+
+// Collect collects a snapshot of the current time
+func (s *Scheduler) Collect(ctx context.Context) {
+	s.CollectAt(ctx, time.Now())
+}
+
+// CollectAt calls the collectors for the host and all the targets, then publishes the snapshot
+// stamped with at, which is the time the inputs have been recorded at when replaying an archive. A
+// collector failing is absent from the sample, a target for which all the collectors failed is
+// absent from the snapshot.
+func (s *Scheduler) CollectAt(ctx context.Context, at time.Time) {
+	log := logger.Get(ctx)
+	start := time.Now()
+
+	hostCollectors := s.registry.Collectors(ScopeHost)
+	containerCollectors := s.registry.Collectors(ScopeContainer)
+	iteration := newIterationStatus()
+	for _, c := range append(hostCollectors, containerCollectors...) {
+		iteration.collectors[c.Name()] = CollectorStatus{}
+		preparer, ok := c.(Preparer)
+		if !ok {
+			continue
+		}
+		err := preparer.Prepare(ctx)
+		if err != nil {
+			log.WithError(err).WithField("collector", c.Name()).Info("Fail to prepare collector")
+			iteration.failed(c.Name(), err)
+			collectorErrors.Inc(c.Name())
+		}
+	}
+
+	snapshot := &Snapshot{
+		Time:   at,
+		NumCPU: s.sysconf.NumCPU(),
+	}
+	snapshot.Host, _ = s.collect(ctx, iteration, hostCollectors, nil)
+
+	targets := s.targets(ctx)
+	snapshot.Targets = make(map[string]Sample, len(targets))
+	for _, target := range targets {
+		sample, ok := s.collect(ctx, iteration, containerCollectors, target)
+		if !ok {
+			continue
+		}
+		snapshot.Targets[target.ID] = sample
+	}
+
+	s.snapshotsMutex.Lock()
+	previous := s.current
+	s.previous = previous
+	s.current = snapshot
+	s.snapshotsMutex.Unlock()
+
+	if len(s.listeners) > 0 {
+		gauges := s.gauges(previous, snapshot)
+		for _, listener := range s.listeners {
+			listener.SnapshotCollected(ctx, previous, snapshot, gauges)
+		}
+	}
+
+	s.updateStatus(start, iteration)
+	collectionDuration.Observe(time.Since(start).Seconds())
+
+	log.WithField("targets", len(snapshot.Targets)).Debugf("Metrics collected in %s", time.Since(start))
+}
+
+// collect calls the collectors and returns the sample, and false if all the collectors failed
+func (s *Scheduler) collect(ctx context.Context, iteration iterationStatus, collectors []Collector, target *Target) (Sample, bool) {
+	log := logger.Get(ctx)
+	sample := make(Sample, len(collectors))
+	failures := 0
+	for _, c := range collectors {
+		collectStart := time.Now()
+		value, err := c.Collect(ctx, target)
+		collectorDuration.Observe(time.Since(collectStart).Seconds(), c.Name())
+		if err != nil {
+			collectorErrors.Inc(c.Name())
+			// No Error logging to prevent spamming, the target may have been stopped in the meantime
+			entry := log.WithError(err).WithField("collector", c.Name())
+			if target != nil {
+				entry = entry.WithField("target", target.ID)
+			}
+			entry.Info("Fail to collect metrics")
+			iteration.failed(c.Name(), err)
+			failures++
+			continue
+		}
+		if value != nil {
+			sample[c.Name()] = value
+			iteration.collected(c.Name())
+		}
+	}
+	return sample, len(collectors) == 0 || failures < len(collectors)
+}
+
+// updateStatus replaces the status of the collectors with the one of the iteration. The last error
+// of a collector is kept until a new one happens.
+func (s *Scheduler) updateStatus(start time.Time, iteration iterationStatus) {
+	s.statusMutex.Lock()
+	defer s.statusMutex.Unlock()
+
+	for name, status := range iteration.collectors {
+		previous := s.status.Collectors[name]
+		if status.LastError == nil {
+			status.LastError = previous.LastError
+			status.LastErrorAt = previous.LastErrorAt
+		}
+		iteration.collectors[name] = status
+	}
+	s.status = Status{
+		LastCollectAt:       start,
+		LastCollectDuration: time.Since(start),
+		Collectors:          iteration.collectors,
+	}
+}
+
+// iterationStatus accumulates the status of the collectors during an iteration
+type iterationStatus struct {
+	collectors map[string]CollectorStatus
+}
+
+func newIterationStatus() iterationStatus {
+	return iterationStatus{collectors: map[string]CollectorStatus{}}
+}
+
+func (i iterationStatus) collected(name string) {
+	status := i.collectors[name]
+	status.Targets++
+	i.collectors[name] = status
+}
+
+func (i iterationStatus) failed(name string, err error) {
+	status := i.collectors[name]
+	status.LastError = err
+	status.LastErrorAt = time.Now()
+	i.collectors[name] = status
+}
+
+// targets returns the running containers matching MONITORED_CONTAINERS_LABELS and the configured
+// cgroups. As long as the containers inventory is not synchronized, only the cgroups are collected.
+func (s *Scheduler) targets(ctx context.Context) []*Target {
+	log := logger.Get(ctx)
+
+	containers, err := s.containerRepository.Containers(ctx)
+	if err != nil {
+		log.WithError(err).Info("Fail to list containers to collect")
+	}
+	// The selectors are validated when the configuration is loaded
+	selectors, err := docker.ParseLabelSelectors(ctx, config.Current().MonitoredContainersLabels)
+	if err != nil {
+		log.WithError(err).Error("Invalid monitored containers labels")
+	}
+
+	targets := make([]*Target, 0, len(containers)+len(s.cgroups))
+	for _, container := range containers {
+		if !selectors.Matches(container.Labels) {
+			continue
+		}
+		targets = append(targets, NewContainerTarget(container.ID, s.cgroupStatsReader))
+	}
+	for _, name := range s.cgroups {
+		targets = append(targets, NewCgroupTarget(cgroup.CgroupPath(name), s.cgroupStatsReader))
+	}
+	return targets
+}
@@ -0,0 +1,213 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Scalingo/acadock-monitoring/v2/cgroup"
+	"github.com/Scalingo/acadock-monitoring/v2/cgroup/cgroupmock"
+	"github.com/Scalingo/acadock-monitoring/v2/docker"
+	"github.com/Scalingo/acadock-monitoring/v2/docker/dockermock"
+	"github.com/Scalingo/acadock-monitoring/v2/procfs"
+)
+
+type collectorFunc struct {
+	name    string
+	scope   Scope
+	collect func(ctx context.Context, target *Target) (any, error)
+}
+
+func (c collectorFunc) Name() string {
+	return c.name
+}
+
+func (c collectorFunc) Scope() Scope {
+	return c.scope
+}
+
+func (c collectorFunc) Collect(ctx context.Context, target *Target) (any, error) {
+	return c.collect(ctx, target)
+}
+
+func cgroupStatsCollector(name string, value func(cgroup.Stats) any) collectorFunc {
+	return collectorFunc{name: name, scope: ScopeContainer, collect: func(ctx context.Context, target *Target) (any, error) {
+		stats, err := target.CgroupStats(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return value(stats), nil
+	}}
+}
+
+func TestScheduler_Collect(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	cgroupStatsReader := cgroupmock.NewMockStatsReader(ctrl)
+	containerRepository := dockermock.NewMockContainerRepository(ctrl)
+
+	containerRepository.EXPECT().Containers(gomock.Any()).Return([]docker.Container{{ID: "1"}, {ID: "2"}}, nil).Times(2)
+	// Each target cgroup is read exactly once per collection, whatever the number of collectors
+	cgroupStatsReader.EXPECT().GetStats(gomock.Any(), "1").Return(cgroup.Stats{CPUUsage: time.Second, MemoryUsage: 10}, nil).Times(2)
+	cgroupStatsReader.EXPECT().GetStats(gomock.Any(), "2").Return(cgroup.Stats{}, cgroup.NewStatsReaderError(errors.New("cgroup deleted"))).Times(2)
+	cgroupStatsReader.EXPECT().GetCgroupStats(gomock.Any(), "/system.slice/docker.service").Return(cgroup.Stats{MemoryUsage: 20}, nil).Times(2)
+
+	registry := NewRegistry([]string{"disabled"})
+	registry.Register(collectorFunc{name: "host", scope: ScopeHost, collect: func(_ context.Context, target *Target) (any, error) {
+		assert.Nil(t, target)
+		return 42, nil
+	}})
+	registry.Register(cgroupStatsCollector("cpu", func(stats cgroup.Stats) any { return stats.CPUUsage }))
+	registry.Register(cgroupStatsCollector("memory", func(stats cgroup.Stats) any { return stats.MemoryUsage }))
+	registry.Register(collectorFunc{name: "containers_only", scope: ScopeContainer, collect: func(_ context.Context, target *Target) (any, error) {
+		if target.ContainerID == "" {
+			return nil, nil
+		}
+		return target.ContainerID, nil
+	}})
+	registry.Register(collectorFunc{name: "disabled", scope: ScopeContainer, collect: func(context.Context, *Target) (any, error) {
+		t.Fatal("disabled collectors must not be called")
+		return nil, nil
+	}})
+
+	scheduler := NewScheduler(containerRepository, []string{"docker.service"}, cgroupStatsReader, registry, procfs.NewSysconf(), nil)
+
+	previous, current := scheduler.Snapshots()
+	assert.Nil(t, previous)
+	assert.Nil(t, current)
+
+	scheduler.Collect(t.Context())
+	_, first := scheduler.Snapshots()
+	require.NotNil(t, first)
+
+	scheduler.Collect(t.Context())
+	previous, current = scheduler.Snapshots()
+	assert.Same(t, first, previous)
+
+	assert.Equal(t, Sample{"host": 42}, current.HostSample())
+	require.Len(t, current.Targets, 3)
+	assert.Equal(t, Sample{"cpu": time.Second, "memory": uint64(10), "containers_only": "1"}, current.Targets["1"])
+	assert.Equal(t, Sample{"containers_only": "2"}, current.Targets["2"])
+	assert.Equal(t, Sample{"cpu": time.Duration(0), "memory": uint64(20)}, current.Targets["/system.slice/docker.service"])
+
+	memory, ok := Value[uint64](current.Targets["1"], "memory")
+	assert.True(t, ok)
+	assert.Equal(t, uint64(10), memory)
+	_, ok = Value[uint64](current.Targets["2"], "memory")
+	assert.False(t, ok)
+
+	status := scheduler.Status()
+	assert.False(t, status.LastCollectAt.Before(current.Time))
+	assert.Equal(t, runtime.NumCPU(), current.NumCPU)
+	assert.Equal(t, 1, status.Collectors["host"].Targets)
+	assert.NoError(t, status.Collectors["host"].LastError)
+	assert.Equal(t, 2, status.Collectors["memory"].Targets)
+	assert.EqualError(t, status.Collectors["memory"].LastError, "cgroup deleted")
+	assert.Equal(t, 2, status.Collectors["containers_only"].Targets)
+	assert.NotContains(t, status.Collectors, "disabled")
+}
+
+func TestScheduler_Collect_TargetFailure(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	cgroupStatsReader := cgroupmock.NewMockStatsReader(ctrl)
+	containerRepository := dockermock.NewMockContainerRepository(ctrl)
+
+	containerRepository.EXPECT().Containers(gomock.Any()).Return([]docker.Container{{ID: "1"}}, nil)
+	cgroupStatsReader.EXPECT().GetStats(gomock.Any(), "1").Return(cgroup.Stats{}, cgroup.NewStatsReaderError(errors.New("cgroup deleted")))
+
+	registry := NewRegistry(nil)
+	registry.Register(cgroupStatsCollector("cpu", func(stats cgroup.Stats) any { return stats.CPUUsage }))
+
+	scheduler := NewScheduler(containerRepository, nil, cgroupStatsReader, registry, procfs.NewSysconf(), nil)
+	errorsBefore := collectorErrors.Value("cpu")
+	scheduler.Collect(t.Context())
+
+	_, current := scheduler.Snapshots()
+	_, ok := current.Sample("1")
+	assert.False(t, ok)
+	assert.Equal(t, errorsBefore+1, collectorErrors.Value("cpu"))
+}
+
+type listenerFunc func(ctx context.Context, previous *Snapshot, current *Snapshot, gauges Gauges)
+
+func (f listenerFunc) SnapshotCollected(ctx context.Context, previous *Snapshot, current *Snapshot, gauges Gauges) {
+	f(ctx, previous, current, gauges)
+}
+
+func TestScheduler_Collect_Listeners(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	containerRepository := dockermock.NewMockContainerRepository(ctrl)
+	containerRepository.EXPECT().Containers(gomock.Any()).Return(nil, nil).Times(2)
+
+	registry := NewRegistry(nil)
+	registry.Register(collectorFunc{name: "host", scope: ScopeHost, collect: func(context.Context, *Target) (any, error) {
+		return 42, nil
+	}})
+	computed := 0
+	scheduler := NewScheduler(containerRepository, nil, cgroupmock.NewMockStatsReader(ctrl), registry, procfs.NewSysconf(), func(_, _ *Snapshot) Gauges {
+		computed++
+		return Gauges{"host": {"load": float64(computed)}}
+	})
+
+	var notified [][2]*Snapshot
+	var notifiedGauges []Gauges
+	scheduler.AddListener(listenerFunc(func(_ context.Context, _ *Snapshot, _ *Snapshot, gauges Gauges) {
+		notifiedGauges = append(notifiedGauges, gauges)
+	}))
+	scheduler.AddListener(listenerFunc(func(_ context.Context, previous *Snapshot, current *Snapshot, gauges Gauges) {
+		// The gauges are computed once and shared by all the listeners
+		assert.Equal(t, notifiedGauges[len(notifiedGauges)-1], gauges)
+		// The snapshot is published before the listeners are notified
+		previousPublished, currentPublished := scheduler.Snapshots()
+		assert.Same(t, previousPublished, previous)
+		assert.Same(t, currentPublished, current)
+		notified = append(notified, [2]*Snapshot{previous, current})
+	}))
+
+	scheduler.Collect(t.Context())
+	scheduler.Collect(t.Context())
+	require.Len(t, notified, 2)
+	assert.Nil(t, notified[0][0])
+	assert.Same(t, notified[0][1], notified[1][0])
+	assert.Equal(t, Sample{"host": 42}, notified[1][1].HostSample())
+	assert.Equal(t, 2, computed)
+	assert.Equal(t, []Gauges{{"host": {"load": 1}}, {"host": {"load": 2}}}, notifiedGauges)
+}
+
+func TestRegistry(t *testing.T) {
+	noop := func(context.Context, *Target) (any, error) { return nil, nil }
+	registry := NewRegistry([]string{"net"})
+	registry.Register(collectorFunc{name: "host_cpu", scope: ScopeHost, collect: noop})
+	registry.Register(collectorFunc{name: "cpu", scope: ScopeContainer, collect: noop})
+	registry.Register(collectorFunc{name: "net", scope: ScopeContainer, collect: noop})
+
+	assert.True(t, registry.IsEnabled("cpu"))
+	assert.False(t, registry.IsEnabled("net"))
+	assert.False(t, registry.IsEnabled("unknown"))
+
+	containerCollectors := registry.Collectors(ScopeContainer)
+	require.Len(t, containerCollectors, 1)
+	assert.Equal(t, "cpu", containerCollectors[0].Name())
+	hostCollectors := registry.Collectors(ScopeHost)
+	require.Len(t, hostCollectors, 1)
+	assert.Equal(t, "host_cpu", hostCollectors[0].Name())
+
+	registry.SetDisabled([]string{"cpu"})
+	assert.True(t, registry.IsEnabled("net"))
+	assert.False(t, registry.IsEnabled("cpu"))
+	containerCollectors = registry.Collectors(ScopeContainer)
+	require.Len(t, containerCollectors, 1)
+	assert.Equal(t, "net", containerCollectors[0].Name())
+
+	assert.Panics(t, func() {
+		registry.Register(collectorFunc{name: "cpu", scope: ScopeContainer, collect: noop})
+	})
+}
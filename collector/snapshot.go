@@ -0,0 +1,102 @@
+package collector
+
+import (
+	"context"
+	"time"
+
+	"github.com/Scalingo/acadock-monitoring/v2/cgroup"
+)
+
+// Target is a cgroup monitored by the collector: either a Docker container or one of the cgroups
+// configured in MONITORED_CGROUPS.
+type Target struct {
+	// ID identifies the target in the snapshots: the container ID or the cgroup path
+	ID          string
+	ContainerID string
+	CgroupPath  string
+
+	statsReader cgroup.StatsReader
+	statsRead   bool
+	stats       cgroup.Stats
+	statsErr    error
+}
+
+func NewContainerTarget(containerID string, statsReader cgroup.StatsReader) *Target {
+	return &Target{ID: containerID, ContainerID: containerID, statsReader: statsReader}
+}
+
+func NewCgroupTarget(path string, statsReader cgroup.StatsReader) *Target {
+	return &Target{ID: path, CgroupPath: path, statsReader: statsReader}
+}
+
+// CgroupStats reads the cgroup stats of the target. The cgroup is read once per iteration whatever
+// the number of collectors using it.
+func (t *Target) CgroupStats(ctx context.Context) (cgroup.Stats, error) {
+	if t.statsRead {
+		return t.stats, t.statsErr
+	}
+	start := time.Now()
+	if t.ContainerID != "" {
+		t.stats, t.statsErr = t.statsReader.GetStats(ctx, t.ContainerID)
+		cgroupStatsReadDuration.Observe(time.Since(start).Seconds(), "container")
+	} else {
+		t.stats, t.statsErr = t.statsReader.GetCgroupStats(ctx, t.CgroupPath)
+		cgroupStatsReadDuration.Observe(time.Since(start).Seconds(), "cgroup")
+	}
+	t.statsRead = true
+	return t.stats, t.statsErr
+}
+
+// Sample contains the values collected for the host or for a target, indexed by collector name
+type Sample map[string]any
+
+// Value returns the value collected by the collector named name and whether it is part of the
+// sample. It is safe to call on a nil sample.
+func Value[T any](sample Sample, name string) (T, bool) {
+	value, ok := sample[name].(T)
+	return value, ok
+}
+
+// Snapshot is a sample of the host and of all the targets, collected during the same iteration of
+// the collector. A snapshot is immutable once published: it must not be modified by its readers.
+type Snapshot struct {
+	Time time.Time
+	// NumCPU is the number of CPUs of the host when the snapshot has been collected
+	NumCPU  int
+	Host    Sample
+	Targets map[string]Sample
+}
+
+// Gauges are the instantaneous values of the metrics of the host and of the targets computed from
+// the two last snapshots, indexed by target then by gauge name. They are shared by the listeners of
+// the scheduler: they must not be modified.
+type Gauges map[string]map[string]float64
+
+// GaugesFunc computes the gauges of the current snapshot
+type GaugesFunc func(previous, current *Snapshot) Gauges
+
+// SnapshotReader gives access to the last two snapshots. Usages based on counters (CPU, network
+// rates) are computed from the difference between both.
+type SnapshotReader interface {
+	// Snapshots returns the previous and the current snapshots, any of them is nil until it has
+	// been collected.
+	Snapshots() (previous *Snapshot, current *Snapshot)
+}
+
+// HostSample returns the host sample. It is safe to call on a nil snapshot.
+func (s *Snapshot) HostSample() Sample {
+	if s == nil {
+		return nil
+	}
+	return s.Host
+}
+
+// Sample returns the sample of a target and whether it is part of the snapshot. It is safe to call
+// on a nil snapshot.
+func (s *Snapshot) Sample(id string) (Sample, bool) {
+	if s == nil {
+		return nil, false
+	}
+	sample, ok := s.Targets[id]
+	return sample, ok
+}
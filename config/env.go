@@ -1,79 +1,208 @@
 package config
 
 import (
+	"maps"
 	"os"
-	"strconv"
+	"path/filepath"
 	"time"
-
-	"github.com/containerd/cgroups/v3"
 )
 
+// ENV contains the raw value of all the settings, from the defaults below, the configuration file
+// and the environment. The settings which can be reloaded must be read with Current.
 var ENV = map[string]string{
+	"CONFIG_FILE":                    "",
 	"DOCKER_URL":                     "http://127.0.0.1:4243",
 	"PORT":                           "4244",
 	"REFRESH_TIME":                   "20s",
 	"CGROUP_SOURCE":                  "docker",
 	"CGROUP_DIR":                     "/sys/fs/cgroup",
 	"PROC_DIR":                       "/proc",
+	"SYS_DIR":                        "/sys",
 	"PROC_MOUNTINFO_PID":             "",
 	"RUNNER_DIR":                     "/usr/bin",
 	"DEBUG":                          "false",
 	"NET_MONITORING":                 "true",
+	"IO_MONITORING":                  "true",
+	"QUEUE_LENGTH_MONITORING":        "true",
+	"MOUNTINFO_MONITORING":           "true",
 	"QUEUE_LENGTH_SAMPLING_INTERVAL": "5s",
 	"QUEUE_LENGTH_POINTS_PER_SAMPLE": "5",
 	"QUEUE_LENGTH_ELEMENTS_NEEDED":   "6",
 	"HTTP_USERNAME":                  "",
 	"HTTP_PASSWORD":                  "",
+	"MONITORED_CGROUPS":              "",
+	"MONITORED_CONTAINERS_LABELS":    "",
+	"CONTAINERS_RESYNC_INTERVAL":     "1m",
+	"DISABLED_COLLECTORS":            "",
+	"SMOOTHING":                      "host_cpu:1:6,cpu:1:6,memory:1:6,net:1:6",
+	"STATS_WINDOWS":                  "1m,5m,15m",
+	"MEMORY_FORECAST_ALPHA":          "0.5",
+	"MEMORY_FORECAST_BETA":           "0.3",
+	"ANOMALY_ALPHA":                  "0.1",
+	"ANOMALY_THRESHOLD":              "3",
+	"ANOMALY_WARMUP":                 "10",
+	"ANOMALY_REBASELINE_AFTER":       "30",
+	"ALERT_RULES":                    "",
+	"ALERT_WEBHOOK_URL":              "",
+	"ALERT_WEBHOOK_ATTEMPTS":         "3",
+	"ALERT_WEBHOOK_RETRY_DELAY":      "5s",
+	"ACCOUNTING_DIR":                 "/var/lib/acadock-monitoring/accounting",
+	"ACCOUNTING_SAVE_INTERVAL":       "1m",
+	"ACCOUNTING_RETENTION":           "2160h",
+	"HISTORY_DIR":                    "",
+	"HISTORY_RESOLUTION":             "5m",
+	"HISTORY_RAW_RETENTION":          "24h",
+	"HISTORY_RETENTION":              "168h",
+	"STATSD_ADDRESS":                 "",
+	"STATSD_PREFIX":                  "acadock",
+	"STATSD_DIALECT":                 "dogstatsd",
+	"STATSD_LABELS":                  "",
+	"STATSD_INTERVAL":                "10s",
 }
 
+// defaults is the value of the settings which are neither in the configuration file nor in the
+// environment
+var defaults = maps.Clone(ENV)
+
 var (
-	RefreshTime                 time.Duration
 	Debug                       bool
+	QueueLengthMonitoring       bool
+	MountInfoMonitoring         bool
 	QueueLengthSamplingInterval time.Duration
 	QueueLengthPointsPerSample  int
 	QueueLengthElementsNeeded   int
 	IsUsingCgroupV2             bool
+	// MonitoredCgroups is the list of cgroups monitored in addition to the Docker containers. Each
+	// entry is either a systemd unit name (e.g. "docker.service") or a path relative to the cgroup
+	// hierarchy root (e.g. "system.slice/nginx.service").
+	MonitoredCgroups []string
+	// Smoothing is indexed by the name of the smoothed metric, a metric absent from it is not
+	// smoothed
+	Smoothing map[string]SmoothingSettings
+	// StatsWindows are the lengths of the windows over which the statistics of the metrics can be
+	// requested
+	StatsWindows []time.Duration
+	// MemoryForecastAlpha and MemoryForecastBeta are the smoothing factors of the level and of the
+	// trend of the memory usage forecast
+	MemoryForecastAlpha float64
+	MemoryForecastBeta  float64
+	// AnomalyAlpha is the smoothing factor of the baselines of the anomaly detection, a value deviating
+	// from its baseline by more than AnomalyThreshold standard deviations after AnomalyWarmup values
+	// is anomalous. After AnomalyRebaselineAfter consecutive anomalous values, the baseline is rebuilt
+	// from them.
+	AnomalyAlpha           float64
+	AnomalyThreshold       float64
+	AnomalyWarmup          int
+	AnomalyRebaselineAfter int
+	// AlertRules are evaluated against every collected snapshot
+	AlertRules []AlertRule
+	// AlertWebhookURL receives the firing and resolved alerts, they are only listed by the API if it
+	// is empty. A failed delivery is attempted AlertWebhookAttempts times, the delay between the
+	// attempts starts at AlertWebhookRetryDelay and doubles after each of them.
+	AlertWebhookURL        string
+	AlertWebhookAttempts   int
+	AlertWebhookRetryDelay time.Duration
+	// AccountingDir is the directory the cumulative consumptions are saved to every
+	// AccountingSaveInterval, so that they survive the restarts. The consumptions older than
+	// AccountingRetention are dropped.
+	AccountingDir          string
+	AccountingSaveInterval time.Duration
+	AccountingRetention    time.Duration
+	// HistoryDir is the directory the history of the metrics is kept in, it isn't kept if it is
+	// empty. The values are kept HistoryRawRetention, then their means over HistoryResolution are
+	// kept until HistoryRetention.
+	HistoryDir          string
+	HistoryResolution   time.Duration
+	HistoryRawRetention time.Duration
+	HistoryRetention    time.Duration
+	// StatsDAddress is the UDP address of the StatsD agent the metrics are pushed to every
+	// StatsDInterval, they are not pushed if it is empty. StatsDDialect is either statsd or
+	// dogstatsd, the labels of the containers listed in StatsDLabels (all of them if it is empty)
+	// are sent as DogStatsD tags.
+	StatsDAddress  string
+	StatsDPrefix   string
+	StatsDDialect  string
+	StatsDLabels   []string
+	StatsDInterval time.Duration
 )
 
+// init loads the defaults, so that the packages can be used before the configuration of the process
+// is loaded by LoadEnvironment, e.g. by their tests
 func init() {
+	// The defaults are valid, it is checked by the tests
+	_ = Load(map[string]string{})
+}
+
+// LoadEnvironment loads the configuration of the process: its environment and the configuration
+// file it references. It returns a ValidationError listing all the invalid settings.
+func LoadEnvironment() error {
+	err := Load(environmentValues())
+	if err != nil {
+		return err
+	}
 	for k, v := range ENV {
-		if os.Getenv(k) != "" {
-			ENV[k] = os.Getenv(k)
-		} else {
+		if _, ok := environment[k]; !ok {
 			_ = os.Setenv(k, v)
 		}
 	}
+	return nil
+}
 
-	if ENV["DEBUG"] == "1" || ENV["DEBUG"] == "true" {
-		Debug = true
-	}
-
-	var err error
-
-	if cgroups.Mode() == cgroups.Unified {
-		IsUsingCgroupV2 = true
-	}
-
-	RefreshTime, err = time.ParseDuration(ENV["REFRESH_TIME"])
-	if err != nil {
-		panic(err)
-	}
+// Load replaces the whole configuration with the defaults, overridden by the configuration file,
+// overridden by the given environment. It is called with the environment of the process at startup,
+// the tests call it to run the daemon with a different configuration.
+func Load(env map[string]string) error {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
 
-	QueueLengthElementsNeeded, err = strconv.Atoi(ENV["QUEUE_LENGTH_ELEMENTS_NEEDED"])
+	values, c, err := configure(env)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	QueueLengthPointsPerSample, err = strconv.Atoi(ENV["QUEUE_LENGTH_POINTS_PER_SAMPLE"])
-	if err != nil {
-		panic(err)
+	environment = env
+	for k, v := range values {
+		ENV[k] = v
 	}
 
-	QueueLengthSamplingInterval, err = time.ParseDuration(ENV["QUEUE_LENGTH_SAMPLING_INTERVAL"])
-	if err != nil {
-		panic(err)
-	}
+	// The root of a cgroup v2 hierarchy contains the list of the available controllers, this file
+	// doesn't exist at the root of a v1 or hybrid hierarchy
+	_, err = os.Stat(filepath.Join(ENV["CGROUP_DIR"], "cgroup.controllers"))
+	IsUsingCgroupV2 = err == nil
 
+	current.Store(&c.settings)
+	Debug = c.debug
+	QueueLengthMonitoring = c.queueLengthMonitoring
+	MountInfoMonitoring = c.mountInfoMonitoring
+	QueueLengthSamplingInterval = c.queueLengthSamplingInterval
+	QueueLengthPointsPerSample = c.queueLengthPointsPerSample
+	QueueLengthElementsNeeded = c.queueLengthElementsNeeded
+	MonitoredCgroups = c.monitoredCgroups
+	Smoothing = c.smoothing
+	StatsWindows = c.statsWindows
+	MemoryForecastAlpha = c.memoryForecastAlpha
+	MemoryForecastBeta = c.memoryForecastBeta
+	AnomalyAlpha = c.anomalyAlpha
+	AnomalyThreshold = c.anomalyThreshold
+	AnomalyWarmup = c.anomalyWarmup
+	AnomalyRebaselineAfter = c.anomalyRebaselineAfter
+	AlertRules = c.alertRules
+	AlertWebhookURL = c.alertWebhookURL
+	AlertWebhookAttempts = c.alertWebhookAttempts
+	AlertWebhookRetryDelay = c.alertWebhookRetryDelay
+	AccountingDir = c.accountingDir
+	AccountingSaveInterval = c.accountingSaveInterval
+	AccountingRetention = c.accountingRetention
+	HistoryDir = c.historyDir
+	HistoryResolution = c.historyResolution
+	HistoryRawRetention = c.historyRawRetention
+	HistoryRetention = c.historyRetention
+	StatsDAddress = c.statsDAddress
+	StatsDPrefix = c.statsDPrefix
+	StatsDDialect = c.statsDDialect
+	StatsDLabels = c.statsDLabels
+	StatsDInterval = c.statsDInterval
+	return nil
 }
 
 func CgroupPath(cgroup string, id string) string {
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// readFile reads the configuration file at path, its errors are added to validation. The format is
+// guessed from the extension: YAML (.yml, .yaml) or JSON (.json). The file is a flat map whose keys
+// are the names of the settings, case insensitive, e.g.:
+//
+//	refresh_time: 10s
+//	disabled_collectors: [net, io]
+//
+// Lists are equivalent to comma-separated values.
+func readFile(validation *ValidationError, path string) map[string]string {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		validation.add("CONFIG_FILE", "read configuration file: %s", err)
+		return nil
+	}
+
+	var raw map[string]any
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yml", ".yaml":
+		err = yaml.Unmarshal(content, &raw)
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.UseNumber()
+		err = decoder.Decode(&raw)
+	default:
+		validation.add("CONFIG_FILE", "unsupported configuration file format '%s', expected .yml, .yaml or .json", filepath.Ext(path))
+		return nil
+	}
+	if err != nil {
+		validation.add("CONFIG_FILE", "parse configuration file %s: %s", path, err)
+		return nil
+	}
+
+	values := make(map[string]string, len(raw))
+	for key, value := range raw {
+		key = strings.ToUpper(key)
+		formatted, err := formatValue(value)
+		if err != nil {
+			validation.add(key, "%s", err)
+			continue
+		}
+		values[key] = formatted
+	}
+	return values
+}
+
+// formatValue formats a value of the configuration file as it would be written in the environment
+func formatValue(value any) (string, error) {
+	switch value := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return value, nil
+	case bool:
+		return strconv.FormatBool(value), nil
+	case int:
+		return strconv.Itoa(value), nil
+	case int64:
+		return strconv.FormatInt(value, 10), nil
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64), nil
+	case json.Number:
+		return value.String(), nil
+	case []any:
+		elements := make([]string, 0, len(value))
+		for _, element := range value {
+			formatted, err := formatValue(element)
+			if err != nil {
+				return "", err
+			}
+			if _, ok := element.([]any); ok {
+				return "", fmt.Errorf("nested lists are not supported")
+			}
+			elements = append(elements, formatted)
+		}
+		return strings.Join(elements, ","), nil
+	}
+	return "", fmt.Errorf("unsupported value of type %T", value)
+}
@@ -0,0 +1,465 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Settings are the settings which can be changed without restarting the daemon, they are reloaded
+// when the daemon receives SIGUSR1.
+type Settings struct {
+	RefreshTime              time.Duration
+	ContainersResyncInterval time.Duration
+	HTTPUsername             string
+	HTTPPassword             string
+	// MonitoredContainersLabels is the list of label selectors a container must match to be
+	// collected, all the containers are collected if it is empty
+	MonitoredContainersLabels []string
+	// DisabledCollectors is the list of the names of the collectors which are not run
+	DisabledCollectors []string
+	NetMonitoring      bool
+	IOMonitoring       bool
+}
+
+// reloadableSettings are the keys of the values parsed in Settings
+var reloadableSettings = []string{
+	"REFRESH_TIME", "CONTAINERS_RESYNC_INTERVAL", "HTTP_USERNAME", "HTTP_PASSWORD",
+	"MONITORED_CONTAINERS_LABELS", "DISABLED_COLLECTORS", "NET_MONITORING", "IO_MONITORING",
+}
+
+var (
+	current atomic.Pointer[Settings]
+	// environment contains the settings defined in the environment of the process, they take
+	// precedence over the configuration file
+	environment map[string]string
+	reloadMutex = &sync.Mutex{}
+)
+
+// Current returns the current value of the settings which can be reloaded
+func Current() Settings {
+	return *current.Load()
+}
+
+// ValidationError lists all the invalid settings of a configuration
+type ValidationError struct {
+	Errors []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration: " + strings.Join(e.Errors, ", ")
+}
+
+func (e *ValidationError) add(key string, format string, args ...any) {
+	e.Errors = append(e.Errors, key+": "+fmt.Sprintf(format, args...))
+}
+
+// SmoothingSettings configures the exponential smoothing of a metric: every PointsPerSample
+// collected values are averaged, the smoothed value is computed from the last ElementsNeeded
+// averages.
+type SmoothingSettings struct {
+	PointsPerSample int
+	ElementsNeeded  int
+}
+
+// AlertRule fires an alert for every target whose metric has been compared successfully to the
+// threshold for at least For
+type AlertRule struct {
+	Name   string
+	Metric string
+	// Comparison is one of >, >=, < and <=
+	Comparison string
+	Threshold  float64
+	For        time.Duration
+	// LabelSelectors restrict the rule to the containers matching all of them, the rule applies to
+	// the host and to the cgroups too if it is empty
+	LabelSelectors []string
+}
+
+// configuration is the typed value of all the settings
+type configuration struct {
+	settings                    Settings
+	debug                       bool
+	queueLengthMonitoring       bool
+	mountInfoMonitoring         bool
+	queueLengthSamplingInterval time.Duration
+	queueLengthPointsPerSample  int
+	queueLengthElementsNeeded   int
+	monitoredCgroups            []string
+	smoothing                   map[string]SmoothingSettings
+	statsWindows                []time.Duration
+	memoryForecastAlpha         float64
+	memoryForecastBeta          float64
+	anomalyAlpha                float64
+	anomalyThreshold            float64
+	anomalyWarmup               int
+	anomalyRebaselineAfter      int
+	alertRules                  []AlertRule
+	alertWebhookURL             string
+	alertWebhookAttempts        int
+	alertWebhookRetryDelay      time.Duration
+	accountingDir               string
+	accountingSaveInterval      time.Duration
+	accountingRetention         time.Duration
+	historyDir                  string
+	historyResolution           time.Duration
+	historyRawRetention         time.Duration
+	historyRetention            time.Duration
+	statsDAddress               string
+	statsDPrefix                string
+	statsDDialect               string
+	statsDLabels                []string
+	statsDInterval              time.Duration
+}
+
+// configure returns the raw and the typed values of the settings of the environment. The errors of
+// the configuration file and the invalid settings are all reported in the returned ValidationError.
+func configure(environment map[string]string) (map[string]string, configuration, error) {
+	validation := &ValidationError{}
+	values := load(validation, defaults, environment)
+	c := parse(validation, values)
+	if len(validation.Errors) > 0 {
+		return nil, configuration{}, validation
+	}
+	return values, c, nil
+}
+
+// load returns the raw values of the settings: the defaults, overridden by the configuration file,
+// overridden by the environment. The errors of the configuration file are added to validation.
+func load(validation *ValidationError, defaults map[string]string, environment map[string]string) map[string]string {
+	values := maps.Clone(defaults)
+	path := environment["CONFIG_FILE"]
+	if path == "" {
+		path = defaults["CONFIG_FILE"]
+	}
+	if path != "" {
+		for key, value := range readFile(validation, path) {
+			if _, ok := defaults[key]; !ok || key == "CONFIG_FILE" {
+				validation.add(key, "unknown setting in %s", path)
+				continue
+			}
+			values[key] = value
+		}
+	}
+	for key, value := range environment {
+		if _, ok := values[key]; ok {
+			values[key] = value
+		}
+	}
+	return values
+}
+
+// parse validates all the values, the invalid ones are added to validation
+func parse(validation *ValidationError, values map[string]string) configuration {
+	var c configuration
+
+	c.debug = parseBool(validation, values, "DEBUG")
+	c.settings.NetMonitoring = parseBool(validation, values, "NET_MONITORING")
+	c.settings.IOMonitoring = parseBool(validation, values, "IO_MONITORING")
+	c.queueLengthMonitoring = parseBool(validation, values, "QUEUE_LENGTH_MONITORING")
+	c.mountInfoMonitoring = parseBool(validation, values, "MOUNTINFO_MONITORING")
+
+	c.settings.RefreshTime = parseDuration(validation, values, "REFRESH_TIME")
+	c.settings.ContainersResyncInterval = parseDuration(validation, values, "CONTAINERS_RESYNC_INTERVAL")
+	c.queueLengthSamplingInterval = parseDuration(validation, values, "QUEUE_LENGTH_SAMPLING_INTERVAL")
+	c.queueLengthElementsNeeded = parsePositiveInt(validation, values, "QUEUE_LENGTH_ELEMENTS_NEEDED")
+	c.queueLengthPointsPerSample = parsePositiveInt(validation, values, "QUEUE_LENGTH_POINTS_PER_SAMPLE")
+
+	c.memoryForecastAlpha = parseFactor(validation, values, "MEMORY_FORECAST_ALPHA")
+	c.memoryForecastBeta = parseFactor(validation, values, "MEMORY_FORECAST_BETA")
+	c.anomalyAlpha = parseFactor(validation, values, "ANOMALY_ALPHA")
+	c.anomalyThreshold = parsePositiveFloat(validation, values, "ANOMALY_THRESHOLD")
+	c.anomalyWarmup = parsePositiveInt(validation, values, "ANOMALY_WARMUP")
+	c.anomalyRebaselineAfter = parsePositiveInt(validation, values, "ANOMALY_REBASELINE_AFTER")
+	c.alertWebhookAttempts = parsePositiveInt(validation, values, "ALERT_WEBHOOK_ATTEMPTS")
+	c.alertWebhookRetryDelay = parseDuration(validation, values, "ALERT_WEBHOOK_RETRY_DELAY")
+	c.accountingSaveInterval = parseDuration(validation, values, "ACCOUNTING_SAVE_INTERVAL")
+	c.accountingRetention = parseDuration(validation, values, "ACCOUNTING_RETENTION")
+	c.accountingDir = values["ACCOUNTING_DIR"]
+	if c.accountingDir == "" {
+		validation.add("ACCOUNTING_DIR", "the accounting must be saved to a directory")
+	}
+	c.historyDir = values["HISTORY_DIR"]
+	c.historyResolution = parseDuration(validation, values, "HISTORY_RESOLUTION")
+	c.historyRawRetention = parseDuration(validation, values, "HISTORY_RAW_RETENTION")
+	c.historyRetention = parseDuration(validation, values, "HISTORY_RETENTION")
+	if c.historyRawRetention > c.historyRetention {
+		validation.add("HISTORY_RAW_RETENTION", "'%s' must not be longer than HISTORY_RETENTION", values["HISTORY_RAW_RETENTION"])
+	}
+
+	port := parsePositiveInt(validation, values, "PORT")
+	if port > 65535 {
+		validation.add("PORT", "'%d' is not a valid port", port)
+	}
+	if values["PROC_MOUNTINFO_PID"] != "" {
+		parsePositiveInt(validation, values, "PROC_MOUNTINFO_PID")
+	}
+	if source := values["CGROUP_SOURCE"]; source != "docker" && source != "systemd" {
+		validation.add("CGROUP_SOURCE", "'%s' is neither 'docker' nor 'systemd'", source)
+	}
+
+	c.settings.HTTPUsername = values["HTTP_USERNAME"]
+	c.settings.HTTPPassword = values["HTTP_PASSWORD"]
+	if (c.settings.HTTPUsername == "") != (c.settings.HTTPPassword == "") {
+		validation.add("HTTP_USERNAME", "HTTP_USERNAME and HTTP_PASSWORD must be defined together")
+	}
+
+	c.monitoredCgroups = []string{}
+	for _, name := range parseList(values["MONITORED_CGROUPS"]) {
+		name = strings.Trim(name, "/")
+		if name != "" {
+			c.monitoredCgroups = append(c.monitoredCgroups, name)
+		}
+	}
+
+	c.settings.MonitoredContainersLabels = parseLabelSelectors(validation, "MONITORED_CONTAINERS_LABELS", parseList(values["MONITORED_CONTAINERS_LABELS"]))
+	c.settings.DisabledCollectors = parseList(values["DISABLED_COLLECTORS"])
+	c.smoothing = parseSmoothing(validation, values["SMOOTHING"])
+	c.statsWindows = []time.Duration{}
+	for _, element := range parseList(values["STATS_WINDOWS"]) {
+		window, err := time.ParseDuration(element)
+		if err != nil || window <= 0 {
+			validation.add("STATS_WINDOWS", "'%s' is not a positive duration", element)
+			continue
+		}
+		c.statsWindows = append(c.statsWindows, window)
+	}
+
+	c.alertRules = parseAlertRules(validation, values["ALERT_RULES"])
+	c.alertWebhookURL = values["ALERT_WEBHOOK_URL"]
+	if c.alertWebhookURL != "" {
+		webhookURL, err := url.Parse(c.alertWebhookURL)
+		if err != nil || (webhookURL.Scheme != "http" && webhookURL.Scheme != "https") || webhookURL.Host == "" {
+			validation.add("ALERT_WEBHOOK_URL", "'%s' is not an HTTP URL", c.alertWebhookURL)
+		}
+	}
+
+	c.statsDAddress = values["STATSD_ADDRESS"]
+	if c.statsDAddress != "" {
+		_, port, err := net.SplitHostPort(c.statsDAddress)
+		if err != nil || port == "" {
+			validation.add("STATSD_ADDRESS", "'%s' is not a host:port address", c.statsDAddress)
+		}
+	}
+	c.statsDPrefix = strings.Trim(values["STATSD_PREFIX"], ".")
+	if c.statsDPrefix == "" || strings.ContainsAny(c.statsDPrefix, ":|@#\n") {
+		validation.add("STATSD_PREFIX", "'%s' is not a valid metric name prefix", values["STATSD_PREFIX"])
+	}
+	c.statsDDialect = values["STATSD_DIALECT"]
+	if c.statsDDialect != "statsd" && c.statsDDialect != "dogstatsd" {
+		validation.add("STATSD_DIALECT", "'%s' is neither 'statsd' nor 'dogstatsd'", c.statsDDialect)
+	}
+	c.statsDLabels = parseList(values["STATSD_LABELS"])
+	c.statsDInterval = parseDuration(validation, values, "STATSD_INTERVAL")
+	return c
+}
+
+// parseBool accepts the values accepted by strconv.ParseBool, yes and no, case insensitive
+func parseBool(validation *ValidationError, values map[string]string, key string) bool {
+	value := strings.ToLower(strings.TrimSpace(values[key]))
+	switch value {
+	case "yes":
+		return true
+	case "no":
+		return false
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		validation.add(key, "'%s' is not a boolean", values[key])
+		return false
+	}
+	return b
+}
+
+func parseDuration(validation *ValidationError, values map[string]string, key string) time.Duration {
+	duration, err := time.ParseDuration(values[key])
+	if err != nil {
+		validation.add(key, "'%s' is not a duration", values[key])
+		return 0
+	}
+	if duration <= 0 {
+		validation.add(key, "'%s' must be positive", values[key])
+	}
+	return duration
+}
+
+func parsePositiveInt(validation *ValidationError, values map[string]string, key string) int {
+	value, err := strconv.Atoi(values[key])
+	if err != nil {
+		validation.add(key, "'%s' is not an integer", values[key])
+		return 0
+	}
+	if value <= 0 {
+		validation.add(key, "'%d' must be positive", value)
+	}
+	return value
+}
+
+func parsePositiveFloat(validation *ValidationError, values map[string]string, key string) float64 {
+	value, err := strconv.ParseFloat(values[key], 64)
+	if err != nil {
+		validation.add(key, "'%s' is not a number", values[key])
+		return 0
+	}
+	if value <= 0 {
+		validation.add(key, "'%s' must be positive", values[key])
+	}
+	return value
+}
+
+// parseFactor parses a smoothing factor, in ]0, 1]
+func parseFactor(validation *ValidationError, values map[string]string, key string) float64 {
+	value, err := strconv.ParseFloat(values[key], 64)
+	if err != nil {
+		validation.add(key, "'%s' is not a number", values[key])
+		return 0
+	}
+	if value <= 0 || value > 1 {
+		validation.add(key, "'%s' must be in ]0, 1]", values[key])
+	}
+	return value
+}
+
+// parseSmoothing parses a list of metric:points_per_sample:elements_needed, e.g. "cpu:1:6,net:3:10"
+func parseSmoothing(validation *ValidationError, value string) map[string]SmoothingSettings {
+	smoothing := map[string]SmoothingSettings{}
+	for _, element := range parseList(value) {
+		parts := strings.Split(element, ":")
+		if len(parts) != 3 || strings.TrimSpace(parts[0]) == "" {
+			validation.add("SMOOTHING", "'%s' is not metric:points_per_sample:elements_needed", element)
+			continue
+		}
+		pointsPerSample, err := strconv.Atoi(parts[1])
+		if err != nil || pointsPerSample <= 0 {
+			validation.add("SMOOTHING", "'%s' is not a positive number of points per sample", element)
+			continue
+		}
+		elementsNeeded, err := strconv.Atoi(parts[2])
+		if err != nil || elementsNeeded <= 0 {
+			validation.add("SMOOTHING", "'%s' is not a positive number of elements needed", element)
+			continue
+		}
+		smoothing[strings.TrimSpace(parts[0])] = SmoothingSettings{PointsPerSample: pointsPerSample, ElementsNeeded: elementsNeeded}
+	}
+	return smoothing
+}
+
+// parseAlertRules parses a list of name:metric<comparison><threshold>:for[:selector&selector...],
+// e.g. "memory_full:memory_percent>90:5m:app=web&env!=staging,busy_host:host_cpu>=0.95:1m"
+func parseAlertRules(validation *ValidationError, value string) []AlertRule {
+	rules := []AlertRule{}
+	names := map[string]bool{}
+	for _, element := range parseList(value) {
+		parts := strings.SplitN(element, ":", 4)
+		if len(parts) < 3 || strings.TrimSpace(parts[0]) == "" {
+			validation.add("ALERT_RULES", "'%s' is not name:metric<comparison><threshold>:for[:selectors]", element)
+			continue
+		}
+		rule := AlertRule{Name: strings.TrimSpace(parts[0]), LabelSelectors: []string{}}
+		if names[rule.Name] {
+			validation.add("ALERT_RULES", "duplicated rule name '%s'", rule.Name)
+			continue
+		}
+		names[rule.Name] = true
+
+		index := strings.IndexAny(parts[1], "<>")
+		if index <= 0 {
+			validation.add("ALERT_RULES", "'%s' is not metric<comparison><threshold>", parts[1])
+			continue
+		}
+		rule.Metric = strings.TrimSpace(parts[1][:index])
+		threshold := parts[1][index+1:]
+		rule.Comparison = parts[1][index : index+1]
+		if strings.HasPrefix(threshold, "=") {
+			rule.Comparison += "="
+			threshold = threshold[1:]
+		}
+		var err error
+		rule.Threshold, err = strconv.ParseFloat(strings.TrimSpace(threshold), 64)
+		if err != nil {
+			validation.add("ALERT_RULES", "'%s' is not a valid threshold", threshold)
+			continue
+		}
+		rule.For, err = time.ParseDuration(strings.TrimSpace(parts[2]))
+		if err != nil || rule.For < 0 {
+			validation.add("ALERT_RULES", "'%s' is not a duration", parts[2])
+			continue
+		}
+		if len(parts) == 4 {
+			rule.LabelSelectors = parseLabelSelectors(validation, "ALERT_RULES", strings.Split(parts[3], "&"))
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// parseLabelSelectors returns the label selectors having a label key, the other ones are reported
+// as invalid values of key. The syntax is the one of docker.ParseLabelSelector, which can't be
+// imported since the docker package depends on the configuration.
+func parseLabelSelectors(validation *ValidationError, key string, selectors []string) []string {
+	valid := []string{}
+	for _, selector := range selectors {
+		selector = strings.TrimSpace(selector)
+		labelKey, _, _ := strings.Cut(strings.TrimPrefix(selector, "!"), "=")
+		if strings.TrimSpace(strings.TrimSuffix(labelKey, "!")) == "" {
+			validation.add(key, "invalid label selector '%s': empty label key", selector)
+			continue
+		}
+		valid = append(valid, selector)
+	}
+	return valid
+}
+
+// parseList parses a comma-separated list, ignoring the empty elements
+func parseList(value string) []string {
+	list := []string{}
+	for _, element := range strings.Split(value, ",") {
+		element = strings.TrimSpace(element)
+		if element != "" {
+			list = append(list, element)
+		}
+	}
+	return list
+}
+
+// Reload reads the configuration file and the environment again and applies the settings which can
+// be changed without restarting the daemon. If the configuration is invalid, nothing is applied. It
+// returns the keys of the changed settings which are only applied after a restart.
+func Reload() ([]string, error) {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+
+	values, c, err := configure(environment)
+	if err != nil {
+		return nil, err
+	}
+
+	var restartRequired []string
+	for key, value := range values {
+		if ENV[key] != value && !slices.Contains(reloadableSettings, key) {
+			restartRequired = append(restartRequired, key)
+		}
+	}
+	slices.Sort(restartRequired)
+	current.Store(&c.settings)
+	return restartRequired, nil
+}
+
+// environmentValues returns the settings defined in the environment of the process
+func environmentValues() map[string]string {
+	values := map[string]string{}
+	for key := range ENV {
+		if value := os.Getenv(key); value != "" {
+			values[key] = value
+		}
+	}
+	return values
+}
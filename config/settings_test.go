@@ -0,0 +1,244 @@
+package config
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestReadFile(t *testing.T) {
+	expected := map[string]string{
+		"REFRESH_TIME":        "10s",
+		"DEBUG":               "true",
+		"PORT":                "4245",
+		"DISABLED_COLLECTORS": "net,io",
+		"HTTP_PASSWORD":       "p#ss",
+	}
+
+	examples := map[string]string{
+		"acadock.yml": `
+refresh_time: 10s
+debug: true
+port: 4245
+disabled_collectors: [net, io]
+http_password: "p#ss"
+`,
+		"acadock.json": `{"refresh_time": "10s", "debug": true, "port": 4245, "disabled_collectors": ["net", "io"], "HTTP_PASSWORD": "p#ss"}`,
+	}
+	for name, content := range examples {
+		t.Run(name, func(t *testing.T) {
+			validation := &ValidationError{}
+			values := readFile(validation, writeConfigFile(t, name, content))
+			require.Empty(t, validation.Errors)
+			assert.Equal(t, expected, values)
+		})
+	}
+
+	t.Run("unsupported format", func(t *testing.T) {
+		validation := &ValidationError{}
+		readFile(validation, writeConfigFile(t, "acadock.toml", "debug = true"))
+		assert.Equal(t, []string{"CONFIG_FILE: unsupported configuration file format '.toml', expected .yml, .yaml or .json"}, validation.Errors)
+	})
+
+	t.Run("nested lists", func(t *testing.T) {
+		validation := &ValidationError{}
+		values := readFile(validation, writeConfigFile(t, "acadock.yml", "debug: true\ndisabled_collectors: [[net]]\n"))
+		assert.Equal(t, map[string]string{"DEBUG": "true"}, values)
+		assert.Equal(t, []string{"DISABLED_COLLECTORS: nested lists are not supported"}, validation.Errors)
+	})
+}
+
+func TestLoad(t *testing.T) {
+	path := writeConfigFile(t, "acadock.yml", "refresh_time: 10s\nport: 4245\n")
+	validation := &ValidationError{}
+	values := load(validation, defaults, map[string]string{"CONFIG_FILE": path, "PORT": "4246", "UNKNOWN": "1"})
+	require.Empty(t, validation.Errors)
+	// The environment takes precedence over the configuration file
+	assert.Equal(t, "10s", values["REFRESH_TIME"])
+	assert.Equal(t, "4246", values["PORT"])
+	assert.Equal(t, defaults["CGROUP_DIR"], values["CGROUP_DIR"])
+	assert.NotContains(t, values, "UNKNOWN")
+
+	path = writeConfigFile(t, "acadock.yml", "refresh_tme: 10s\nconfig_file: other.yml\n")
+	validation = &ValidationError{}
+	load(validation, defaults, map[string]string{"CONFIG_FILE": path})
+	assert.Len(t, validation.Errors, 2)
+}
+
+func TestConfigure(t *testing.T) {
+	// The errors of the configuration file and of the settings are reported at once
+	path := writeConfigFile(t, "acadock.yml", "refresh_tme: 10s\n")
+	_, _, err := configure(map[string]string{"CONFIG_FILE": path, "PORT": "http"})
+	var validation *ValidationError
+	require.ErrorAs(t, err, &validation)
+	assert.ElementsMatch(t, []string{
+		"REFRESH_TME: unknown setting in " + path,
+		"PORT: 'http' is not an integer",
+	}, validation.Errors)
+
+	_, _, err = configure(map[string]string{"CONFIG_FILE": filepath.Join(t.TempDir(), "missing.yml"), "DEBUG": "maybe"})
+	require.ErrorAs(t, err, &validation)
+	require.Len(t, validation.Errors, 2)
+	assert.Contains(t, validation.Errors[0], "CONFIG_FILE: read configuration file")
+	assert.Equal(t, "DEBUG: 'maybe' is not a boolean", validation.Errors[1])
+}
+
+func TestParse(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		validation := &ValidationError{}
+		c := parse(validation, defaults)
+		require.Empty(t, validation.Errors)
+		assert.Equal(t, 20*time.Second, c.settings.RefreshTime)
+		assert.True(t, c.settings.NetMonitoring)
+		assert.Empty(t, c.settings.DisabledCollectors)
+		assert.Equal(t, SmoothingSettings{PointsPerSample: 1, ElementsNeeded: 6}, c.smoothing["cpu"])
+		assert.Equal(t, []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute}, c.statsWindows)
+		assert.Equal(t, 0.5, c.memoryForecastAlpha)
+		assert.Empty(t, c.alertRules)
+		assert.Empty(t, c.alertWebhookURL)
+		assert.Equal(t, "/var/lib/acadock-monitoring/accounting", c.accountingDir)
+		assert.Equal(t, 90*24*time.Hour, c.accountingRetention)
+		assert.Empty(t, c.historyDir)
+		assert.Equal(t, 5*time.Minute, c.historyResolution)
+		assert.Empty(t, c.statsDAddress)
+		assert.Equal(t, "acadock", c.statsDPrefix)
+		assert.Equal(t, "dogstatsd", c.statsDDialect)
+		assert.Empty(t, c.statsDLabels)
+	})
+
+	t.Run("all the errors are reported at once", func(t *testing.T) {
+		values := maps.Clone(defaults)
+		values["REFRESH_TIME"] = "20"
+		values["CONTAINERS_RESYNC_INTERVAL"] = "-1m"
+		values["DEBUG"] = "maybe"
+		values["PORT"] = "70000"
+		values["CGROUP_SOURCE"] = "cgroupfs"
+		values["HTTP_USERNAME"] = "user"
+		values["MONITORED_CONTAINERS_LABELS"] = "app=web,=value"
+		values["SMOOTHING"] = "cpu:1,net:0:6"
+		values["STATS_WINDOWS"] = "1m,5"
+		values["MEMORY_FORECAST_ALPHA"] = "1.5"
+		values["MEMORY_FORECAST_BETA"] = "low"
+		values["ANOMALY_THRESHOLD"] = "-3"
+		values["ANOMALY_REBASELINE_AFTER"] = "0"
+		values["ALERT_RULES"] = "full:memory_percent>90:5m,full:cpu>50:1m,busy:cpu=50:1m,slow:cpu>high:1m,late:cpu>1:soon,web:cpu>1:1m:=web"
+		values["ALERT_WEBHOOK_URL"] = "localhost:8080"
+		values["ALERT_WEBHOOK_ATTEMPTS"] = "0"
+		values["ACCOUNTING_DIR"] = ""
+		values["ACCOUNTING_RETENTION"] = "90d"
+		values["HISTORY_RAW_RETENTION"] = "240h"
+		values["STATSD_ADDRESS"] = "localhost"
+		values["STATSD_PREFIX"] = "acadock|"
+		values["STATSD_DIALECT"] = "graphite"
+
+		validation := &ValidationError{}
+		parse(validation, values)
+		assert.ElementsMatch(t, []string{
+			"DEBUG: 'maybe' is not a boolean",
+			"REFRESH_TIME: '20' is not a duration",
+			"CONTAINERS_RESYNC_INTERVAL: '-1m' must be positive",
+			"PORT: '70000' is not a valid port",
+			"CGROUP_SOURCE: 'cgroupfs' is neither 'docker' nor 'systemd'",
+			"HTTP_USERNAME: HTTP_USERNAME and HTTP_PASSWORD must be defined together",
+			"MONITORED_CONTAINERS_LABELS: invalid label selector '=value': empty label key",
+			"SMOOTHING: 'cpu:1' is not metric:points_per_sample:elements_needed",
+			"SMOOTHING: 'net:0:6' is not a positive number of points per sample",
+			"STATS_WINDOWS: '5' is not a positive duration",
+			"MEMORY_FORECAST_ALPHA: '1.5' must be in ]0, 1]",
+			"MEMORY_FORECAST_BETA: 'low' is not a number",
+			"ANOMALY_THRESHOLD: '-3' must be positive",
+			"ANOMALY_REBASELINE_AFTER: '0' must be positive",
+			"ALERT_RULES: duplicated rule name 'full'",
+			"ALERT_RULES: 'cpu=50' is not metric<comparison><threshold>",
+			"ALERT_RULES: 'high' is not a valid threshold",
+			"ALERT_RULES: 'soon' is not a duration",
+			"ALERT_RULES: invalid label selector '=web': empty label key",
+			"ALERT_WEBHOOK_URL: 'localhost:8080' is not an HTTP URL",
+			"ALERT_WEBHOOK_ATTEMPTS: '0' must be positive",
+			"ACCOUNTING_DIR: the accounting must be saved to a directory",
+			"ACCOUNTING_RETENTION: '90d' is not a duration",
+			"HISTORY_RAW_RETENTION: '240h' must not be longer than HISTORY_RETENTION",
+			"STATSD_ADDRESS: 'localhost' is not a host:port address",
+			"STATSD_PREFIX: 'acadock|' is not a valid metric name prefix",
+			"STATSD_DIALECT: 'graphite' is neither 'statsd' nor 'dogstatsd'",
+		}, validation.Errors)
+	})
+
+	t.Run("lists", func(t *testing.T) {
+		values := maps.Clone(defaults)
+		values["DISABLED_COLLECTORS"] = " net, ,io"
+		values["MONITORED_CGROUPS"] = "/system.slice/nginx.service/,docker.service"
+		values["SMOOTHING"] = "cpu:2:10, ,memory:1:3"
+		validation := &ValidationError{}
+		c := parse(validation, values)
+		require.Empty(t, validation.Errors)
+		assert.Equal(t, []string{"net", "io"}, c.settings.DisabledCollectors)
+		assert.Equal(t, []string{"system.slice/nginx.service", "docker.service"}, c.monitoredCgroups)
+		assert.Equal(t, map[string]SmoothingSettings{
+			"cpu":    {PointsPerSample: 2, ElementsNeeded: 10},
+			"memory": {PointsPerSample: 1, ElementsNeeded: 3},
+		}, c.smoothing)
+	})
+
+	t.Run("booleans", func(t *testing.T) {
+		values := maps.Clone(defaults)
+		values["DEBUG"] = "TRUE"
+		values["NET_MONITORING"] = "no"
+		values["IO_MONITORING"] = "F"
+		values["QUEUE_LENGTH_MONITORING"] = "Yes"
+		validation := &ValidationError{}
+		c := parse(validation, values)
+		require.Empty(t, validation.Errors)
+		assert.True(t, c.debug)
+		assert.False(t, c.settings.NetMonitoring)
+		assert.False(t, c.settings.IOMonitoring)
+		assert.True(t, c.queueLengthMonitoring)
+	})
+
+	t.Run("alert rules", func(t *testing.T) {
+		values := maps.Clone(defaults)
+		values["ALERT_RULES"] = "memory_full:memory_percent>90:5m:app=web&env!=staging, idle:cpu <= 0.5:0s"
+		validation := &ValidationError{}
+		c := parse(validation, values)
+		require.Empty(t, validation.Errors)
+		assert.Equal(t, []AlertRule{
+			{Name: "memory_full", Metric: "memory_percent", Comparison: ">", Threshold: 90, For: 5 * time.Minute, LabelSelectors: []string{"app=web", "env!=staging"}},
+			{Name: "idle", Metric: "cpu", Comparison: "<=", Threshold: 0.5, LabelSelectors: []string{}},
+		}, c.alertRules)
+	})
+}
+
+func TestReload(t *testing.T) {
+	previousEnvironment := environment
+	previousSettings := current.Load()
+	t.Cleanup(func() {
+		environment = previousEnvironment
+		current.Store(previousSettings)
+	})
+
+	path := writeConfigFile(t, "acadock.yml", "refresh_time: 5s\nhttp_username: user\nhttp_password: secret\ncgroup_dir: /host/cgroup\n")
+	environment = map[string]string{"CONFIG_FILE": path}
+	restartRequired, err := Reload()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"CGROUP_DIR", "CONFIG_FILE"}, restartRequired)
+	assert.Equal(t, 5*time.Second, Current().RefreshTime)
+	assert.Equal(t, "user", Current().HTTPUsername)
+
+	// An invalid configuration is not applied
+	require.NoError(t, os.WriteFile(path, []byte("refresh_time: 1s\nhttp_username: other\nport: http\n"), 0o600))
+	_, err = Reload()
+	assert.ErrorContains(t, err, "HTTP_USERNAME: HTTP_USERNAME and HTTP_PASSWORD must be defined together")
+	assert.ErrorContains(t, err, "PORT: 'http' is not an integer")
+	assert.Equal(t, 5*time.Second, Current().RefreshTime)
+}
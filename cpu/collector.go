@@ -0,0 +1,124 @@
+package cpu
+
+import (
+	"context"
+
+	"github.com/Scalingo/acadock-monitoring/v2/client"
+	"github.com/Scalingo/acadock-monitoring/v2/collector"
+	"github.com/Scalingo/acadock-monitoring/v2/procfs"
+	"github.com/Scalingo/go-utils/errors/v3"
+)
+
+const (
+	// CollectorName is the name of the collector of the cumulated CPU time of the targets
+	CollectorName = "cpu"
+	// HostCollectorName is the name of the collector of the host CPU stats
+	HostCollectorName = "host_cpu"
+	// LimitCollectorName is the name of the collector of the CPU quota and shares of the targets
+	LimitCollectorName = "cpu_limit"
+	// ThrottlingCollectorName is the name of the collector of the CFS throttling counters of the
+	// targets
+	ThrottlingCollectorName = "cpu_throttling"
+)
+
+var (
+	_ collector.Collector = Collector{}
+	_ collector.Collector = HostCollector{}
+	_ collector.Collector = LimitCollector{}
+	_ collector.Collector = ThrottlingCollector{}
+)
+
+// Collector collects the cumulated CPU time of the targets as a time.Duration
+type Collector struct{}
+
+func NewCollector() Collector {
+	return Collector{}
+}
+
+func (Collector) Name() string {
+	return CollectorName
+}
+
+func (Collector) Scope() collector.Scope {
+	return collector.ScopeContainer
+}
+
+func (Collector) Collect(ctx context.Context, target *collector.Target) (any, error) {
+	stats, err := target.CgroupStats(ctx)
+	if err != nil {
+		return nil, errors.Wrap(ctx, err, "get cgroup stats")
+	}
+	return stats.CPUUsage, nil
+}
+
+// LimitCollector collects the CPU quota and shares of the targets as a client.CPULimit
+type LimitCollector struct{}
+
+func NewLimitCollector() LimitCollector {
+	return LimitCollector{}
+}
+
+func (LimitCollector) Name() string {
+	return LimitCollectorName
+}
+
+func (LimitCollector) Scope() collector.Scope {
+	return collector.ScopeContainer
+}
+
+func (LimitCollector) Collect(ctx context.Context, target *collector.Target) (any, error) {
+	stats, err := target.CgroupStats(ctx)
+	if err != nil {
+		return nil, errors.Wrap(ctx, err, "get cgroup stats")
+	}
+	return client.CPULimit{Quota: stats.CPULimit.Quota, Shares: stats.CPULimit.Shares}, nil
+}
+
+// ThrottlingCollector collects the cumulated CFS throttling counters of the targets as a
+// cgroup.CPUThrottling
+type ThrottlingCollector struct{}
+
+func NewThrottlingCollector() ThrottlingCollector {
+	return ThrottlingCollector{}
+}
+
+func (ThrottlingCollector) Name() string {
+	return ThrottlingCollectorName
+}
+
+func (ThrottlingCollector) Scope() collector.Scope {
+	return collector.ScopeContainer
+}
+
+func (ThrottlingCollector) Collect(ctx context.Context, target *collector.Target) (any, error) {
+	stats, err := target.CgroupStats(ctx)
+	if err != nil {
+		return nil, errors.Wrap(ctx, err, "get cgroup stats")
+	}
+	return stats.CPUThrottling, nil
+}
+
+// HostCollector collects the stats of all the CPUs of the host as a procfs.SingleCPUStat
+type HostCollector struct {
+	cpuStatReader procfs.CPUStat
+}
+
+func NewHostCollector(cpuStatReader procfs.CPUStat) HostCollector {
+	return HostCollector{cpuStatReader: cpuStatReader}
+}
+
+func (HostCollector) Name() string {
+	return HostCollectorName
+}
+
+func (HostCollector) Scope() collector.Scope {
+	return collector.ScopeHost
+}
+
+func (c HostCollector) Collect(ctx context.Context, _ *collector.Target) (any, error) {
+	stats, err := c.cpuStatReader.Read(ctx)
+	if err != nil {
+		return nil, errors.Wrap(ctx, err, "read host CPU stats")
+	}
+	return stats.All(), nil
+}
@@ -1,112 +1,106 @@
 package cpu
 
 import (
-	"context"
-	"errors"
-	"sync"
 	"testing"
 	"time"
 
-	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/require"
 
-	"github.com/Scalingo/acadock-monitoring/v2/cgroup"
-	"github.com/Scalingo/acadock-monitoring/v2/cgroup/cgroupmock"
-	"github.com/Scalingo/acadock-monitoring/v2/config"
-	"github.com/Scalingo/acadock-monitoring/v2/docker"
-	"github.com/Scalingo/acadock-monitoring/v2/docker/dockermock"
+	"github.com/Scalingo/acadock-monitoring/v2/collector"
 	"github.com/Scalingo/acadock-monitoring/v2/procfs"
 )
 
-func TestCPUUsageMonitor_Start(t *testing.T) {
-	ctrl := gomock.NewController(t)
-
-	cgroupStatsReader := cgroupmock.NewMockStatsReader(ctrl)
-	cpuStatsReader := procfs.NewMockCPUStat(ctrl)
-	containerRepository := dockermock.NewMockContainerRepository(ctrl)
-	dockerID := "1"
-	config.RefreshTime = 100 * time.Millisecond
+type snapshots struct {
+	previous *collector.Snapshot
+	current  *collector.Snapshot
+}
 
-	// 10% usage
-	for i := 1; i < 10; i++ {
-		expectedCPUStats := procfs.CPUStats{
-			CPUs: map[string]procfs.SingleCPUStat{"cpu": {Name: "cpu", User: time.Duration(i * 10 * 10e6), IDLE: time.Duration(i * 90 * 10e6)}},
-		}
-		cpuStatsReader.EXPECT().Read(gomock.Any()).Return(expectedCPUStats, nil).MaxTimes(1)
+func (s snapshots) Snapshots() (*collector.Snapshot, *collector.Snapshot) {
+	return s.previous, s.current
+}
 
-		cgroupStats := cgroup.Stats{CPUUsage: time.Duration(i * 10 * 10e6)}
-		cgroupStatsReader.EXPECT().GetStats(gomock.Any(), dockerID).Return(cgroupStats, nil).MaxTimes(1)
+func snapshot(user, idle time.Duration, targets map[string]time.Duration) *collector.Snapshot {
+	samples := map[string]collector.Sample{}
+	for id, usage := range targets {
+		samples[id] = collector.Sample{CollectorName: usage}
 	}
+	return &collector.Snapshot{
+		Time:    time.Now(),
+		Host:    collector.Sample{HostCollectorName: procfs.SingleCPUStat{Name: "cpu", User: user, IDLE: idle}},
+		Targets: samples,
+	}
+}
+
+func TestCPUUsageMonitor_GetContainerUsage(t *testing.T) {
+	dockerID := "1"
+
+	t.Run("it computes the usage from the two last snapshots", func(t *testing.T) {
+		// 10% usage
+		monitor := NewCPUUsageMonitor(snapshots{
+			previous: snapshot(100*time.Millisecond, 900*time.Millisecond, map[string]time.Duration{dockerID: 100 * time.Millisecond}),
+			current:  snapshot(200*time.Millisecond, 1800*time.Millisecond, map[string]time.Duration{dockerID: 200 * time.Millisecond}),
+		})
+		// Override numCPU to have tests reliable whatever the environment
+		monitor.numCPU = 1
+
+		usage, err := monitor.GetContainerUsage(dockerID)
+		require.NoError(t, err)
+		require.Equal(t, 10, usage.UsageInPercents)
+	})
+
+	t.Run("it returns no usage before two snapshots have been collected", func(t *testing.T) {
+		monitor := NewCPUUsageMonitor(snapshots{
+			current: snapshot(200*time.Millisecond, 1800*time.Millisecond, map[string]time.Duration{dockerID: 200 * time.Millisecond}),
+		})
+
+		usage, err := monitor.GetContainerUsage(dockerID)
+		require.NoError(t, err)
+		require.Zero(t, usage)
+	})
+
+	t.Run("it returns no usage if the container was not part of the previous snapshot", func(t *testing.T) {
+		monitor := NewCPUUsageMonitor(snapshots{
+			previous: snapshot(100*time.Millisecond, 900*time.Millisecond, map[string]time.Duration{}),
+			current:  snapshot(200*time.Millisecond, 1800*time.Millisecond, map[string]time.Duration{dockerID: 200 * time.Millisecond}),
+		})
+
+		usage, err := monitor.GetContainerUsage(dockerID)
+		require.NoError(t, err)
+		require.Zero(t, usage)
+	})
+}
 
-	eventsChan := make(chan docker.ContainerEvent)
-	containerRepository.EXPECT().RegisterToContainersStream(gomock.Any()).Return(eventsChan)
-	go func() {
-		eventsChan <- docker.ContainerEvent{ContainerID: dockerID, Action: docker.ContainerActionStart}
-		time.Sleep(4 * config.RefreshTime)
-		eventsChan <- docker.ContainerEvent{ContainerID: dockerID, Action: docker.ContainerActionStop}
-		close(eventsChan)
-	}()
-
-	monitor := NewCPUUsageMonitor(containerRepository, cpuStatsReader, cgroupStatsReader)
-	// Override numCPU to have tests reliable whatever the environment
+func TestCPUUsageMonitor_GetCgroupUsage(t *testing.T) {
+	// 20% usage
+	monitor := NewCPUUsageMonitor(snapshots{
+		previous: snapshot(200*time.Millisecond, 800*time.Millisecond, map[string]time.Duration{"/system.slice/docker.service": 200 * time.Millisecond}),
+		current:  snapshot(400*time.Millisecond, 1600*time.Millisecond, map[string]time.Duration{"/system.slice/docker.service": 400 * time.Millisecond}),
+	})
 	monitor.numCPU = 1
 
-	ctx, cancel := context.WithCancel(t.Context())
-	wg := &sync.WaitGroup{}
-	wg.Add(1)
-	go func() {
-		monitor.Start(ctx)
-		wg.Done()
-	}()
-
-	// After 2 cycles it must have accurate CPU information
-	time.Sleep(2 * config.RefreshTime)
-	usage, err := monitor.GetContainerUsage(dockerID)
+	usage, err := monitor.GetCgroupUsage("docker.service")
 	require.NoError(t, err)
-	require.GreaterOrEqual(t, usage.UsageInPercents, 10)
-
-	// Check that the context does stop the Monitor
-	cancel()
-	wg.Wait()
+	require.Equal(t, 20, usage.UsageInPercents)
 }
 
-func TestCPUUsageMonitor_Start_Shutdown(t *testing.T) {
-	ctrl := gomock.NewController(t)
+func TestCPUUsageMonitor_GetHostUsage(t *testing.T) {
+	monitor := NewCPUUsageMonitor(snapshots{
+		previous: snapshot(100*time.Millisecond, 900*time.Millisecond, nil),
+		current:  snapshot(400*time.Millisecond, 1600*time.Millisecond, nil),
+	})
+	monitor.numCPU = 2
 
-	cgroupStatsReader := cgroupmock.NewMockStatsReader(ctrl)
-	cpuStatsReader := procfs.NewMockCPUStat(ctrl)
-	containerRepository := dockermock.NewMockContainerRepository(ctrl)
-	dockerID := "1"
-	config.RefreshTime = 100 * time.Millisecond
-
-	cpuStatsReader.EXPECT().Read(gomock.Any()).Return(procfs.CPUStats{}, nil).AnyTimes()
-	err := errors.New("cgroup error")
-	cgroupStatsReader.EXPECT().GetStats(gomock.Any(), dockerID).Return(cgroup.Stats{}, cgroup.NewStatsReaderError(err)).MaxTimes(1)
-
-	eventsChan := make(chan docker.ContainerEvent)
-	containerRepository.EXPECT().RegisterToContainersStream(gomock.Any()).Return(eventsChan)
-	go func() {
-		eventsChan <- docker.ContainerEvent{ContainerID: dockerID, Action: docker.ContainerActionStart}
-		close(eventsChan)
-	}()
-
-	monitor := NewCPUUsageMonitor(containerRepository, cpuStatsReader, cgroupStatsReader)
-
-	ctx, cancel := context.WithCancel(t.Context())
-	wg := &sync.WaitGroup{}
-	wg.Add(1)
-	go func() {
-		monitor.Start(ctx)
-		wg.Done()
-	}()
-
-	// After 2 cycles it must have accurate CPU information
-	time.Sleep(2 * config.RefreshTime)
-	usage, err := monitor.GetContainerUsage(dockerID)
+	usage, err := monitor.GetHostUsage()
 	require.NoError(t, err)
-	require.Zero(t, usage)
-
-	// Check that the context does stop the Monitor
-	cancel()
-	wg.Wait()
+	require.InDelta(t, 0.3, usage.Usage, 0.0001)
+	require.Equal(t, 2, usage.Amount)
+
+	// The number of CPUs of a replayed snapshot is the one of the recorded host
+	current := snapshot(400*time.Millisecond, 1600*time.Millisecond, nil)
+	current.NumCPU = 8
+	monitor.snapshots = snapshots{previous: snapshot(100*time.Millisecond, 900*time.Millisecond, nil), current: current}
+	usage, err = monitor.GetHostUsage()
+	require.NoError(t, err)
+	require.Equal(t, 8, usage.Amount)
+	require.Equal(t, 8, monitor.NumCPU())
 }
@@ -2,17 +2,35 @@ package docker
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	dockerevents "github.com/moby/moby/api/types/events"
 	dockerclient "github.com/moby/moby/client"
 
+	"github.com/sirupsen/logrus"
+
+	"github.com/Scalingo/acadock-monitoring/v2/config"
+	"github.com/Scalingo/acadock-monitoring/v2/metrics"
 	"github.com/Scalingo/go-utils/errors/v3"
 	"github.com/Scalingo/go-utils/logger"
 )
 
+var (
+	dockerReconnects = metrics.NewCounter("acadock_docker_reconnects_total", "Number of reconnections to the Docker events stream")
+	dockerEvents     = metrics.NewCounter("acadock_docker_events_total", "Number of containers events received from Docker, by action", "action")
+)
+
+var (
+	ErrInventoryNotSynced = fmt.Errorf("containers inventory not synchronized with docker yet")
+	ErrContainerNotFound  = fmt.Errorf("container not found")
+	ErrAmbiguousReference = fmt.Errorf("container reference matches several containers")
+)
+
 type ContainerEvent struct {
 	ContainerID string
 	Action      ContainerAction
@@ -25,89 +43,507 @@ const (
 	ContainerActionStop  = dockerevents.ActionStop
 )
 
+// Container is the metadata of a running container, as stored in the containers inventory
+type Container struct {
+	ID        string
+	Name      string
+	Labels    map[string]string
+	Image     string
+	StartedAt time.Time
+	State     ContainerState
+	// RestartCount is the number of times the container has been restarted by Docker
+	RestartCount int
+	// RestartPolicy is the policy according to which Docker restarts the container when it dies
+	RestartPolicy RestartPolicy
+}
+
 type ContainerRepository interface {
 	RegisterToContainersStream(ctx context.Context) <-chan ContainerEvent
+	// Containers returns the running containers from the in-memory inventory, without calling
+	// Docker
+	Containers(ctx context.Context) ([]Container, error)
+	// Container returns the container matching the given reference from the in-memory inventory.
+	// The reference is either a full ID, a container name or a unique ID prefix.
+	Container(ctx context.Context, ref string) (Container, error)
+	// Health returns the state of the connection with Docker
+	Health() Health
+}
+
+// Health is the state of the connection with Docker
+type Health struct {
+	// Connected is false if the last call to Docker failed
+	Connected bool
+	// Synced is true once the inventory has been synchronized with Docker
+	Synced bool
+	// LastEventAt is the time of the last event received from the events stream
+	LastEventAt time.Time
+	// LastSyncAt is the time of the last successful synchronization of the inventory
+	LastSyncAt  time.Time
+	LastError   error
+	LastErrorAt time.Time
 }
 
+// ContainerRepositoryImpl keeps an in-memory inventory of the running containers. It is kept up to
+// date with the Docker events stream and periodically resynchronized with the containers list, in
+// case some events have been lost (e.g. during a Docker restart).
 type ContainerRepositoryImpl struct {
-	registeredChans   []chan ContainerEvent
-	registrationMutex *sync.Mutex
+	client      *dockerclient.Client
+	subscribers *containerEventsPubSub
+
+	inventory      map[string]Container
+	inventoryMutex *sync.RWMutex
+	synced         chan struct{}
+	syncedOnce     *sync.Once
+
+	health      Health
+	healthMutex *sync.Mutex
+}
+
+// containerUpdate is a change of a single container, applied to the inventory and published to the
+// subscribers
+type containerUpdate struct {
+	action    ContainerAction
+	container Container
+	// exitCode is the exit code of a container which died
+	exitCode int
 }
 
-func NewContainerRepository() *ContainerRepositoryImpl {
-	return &ContainerRepositoryImpl{
-		registeredChans:   make([]chan ContainerEvent, 0),
-		registrationMutex: &sync.Mutex{},
+// inventorySync is the full list of running containers, replacing the inventory
+type inventorySync struct {
+	containers []Container
+	listedAt   time.Time
+}
+
+func NewContainerRepository(ctx context.Context) (*ContainerRepositoryImpl, error) {
+	client, err := Client(ctx)
+	if err != nil {
+		return nil, errors.Wrap(ctx, err, "get docker client")
 	}
+
+	r := &ContainerRepositoryImpl{
+		client:         client,
+		inventory:      make(map[string]Container),
+		inventoryMutex: &sync.RWMutex{},
+		synced:         make(chan struct{}),
+		syncedOnce:     &sync.Once{},
+		healthMutex:    &sync.Mutex{},
+	}
+	r.subscribers = newContainerEventsPubSub(r.synced, r.inventoryContainers)
+	return r, nil
 }
 
 func (r *ContainerRepositoryImpl) StartListeningToNewContainers(ctx context.Context) {
-	eventsChan := make(chan ContainerEvent)
-	go r.listenToDockerEvents(ctx, eventsChan)
+	updates := make(chan containerUpdate)
+	inspections := make(chan Container)
+	syncs := make(chan inventorySync)
+	go r.listenToDockerEvents(ctx, updates, inspections)
+	go r.resyncPeriodically(ctx, syncs)
 	go func() {
-		for c := range eventsChan {
-			r.registrationMutex.Lock()
-			for _, registeredChan := range r.registeredChans {
-				registeredChan <- c
+		defer r.client.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case update := <-updates:
+				r.applyUpdate(ctx, update)
+			case container := <-inspections:
+				r.applyInspection(container)
+			case listing := <-syncs:
+				r.applySync(listing)
 			}
-			r.registrationMutex.Unlock()
 		}
 	}()
 }
 
+// RegisterToContainersStream returns a channel receiving a start event for each running container,
+// then the start and stop events of the containers. The channel is closed when the context is
+// canceled. A subscriber too slow to keep up with the events doesn't slow down the others: it is
+// resynchronized with the inventory once it catches up.
 func (r *ContainerRepositoryImpl) RegisterToContainersStream(ctx context.Context) <-chan ContainerEvent {
+	return r.subscribers.Subscribe(ctx)
+}
+
+// Subscribers returns the number of channels registered to the containers stream
+func (r *ContainerRepositoryImpl) Subscribers() int {
+	return r.subscribers.Len()
+}
+
+func (r *ContainerRepositoryImpl) Containers(ctx context.Context) ([]Container, error) {
+	select {
+	case <-r.synced:
+	default:
+		return nil, ErrInventoryNotSynced
+	}
+
+	return r.inventoryContainers(), nil
+}
+
+func (r *ContainerRepositoryImpl) Container(ctx context.Context, ref string) (Container, error) {
+	select {
+	case <-r.synced:
+	default:
+		return Container{}, ErrInventoryNotSynced
+	}
+
+	r.inventoryMutex.RLock()
+	defer r.inventoryMutex.RUnlock()
+	return FindContainer(r.inventory, ref)
+}
+
+// FindContainer returns the container matching the reference among the containers indexed by ID.
+// The reference is either a full ID, a container name or a unique ID prefix.
+func FindContainer(containers map[string]Container, ref string) (Container, error) {
+	container, ok := containers[ref]
+	if ok {
+		return container, nil
+	}
+
+	ref = strings.TrimPrefix(ref, "/")
+	var matches []Container
+	for _, container := range containers {
+		if container.Name == ref {
+			return container, nil
+		}
+		if strings.HasPrefix(container.ID, ref) {
+			matches = append(matches, container)
+		}
+	}
+
+	if len(matches) == 0 || ref == "" {
+		return Container{}, ErrContainerNotFound
+	}
+	if len(matches) > 1 {
+		return Container{}, ErrAmbiguousReference
+	}
+	return matches[0], nil
+}
+
+func (r *ContainerRepositoryImpl) Health() Health {
+	r.healthMutex.Lock()
+	defer r.healthMutex.Unlock()
+
+	health := r.health
+	select {
+	case <-r.synced:
+		health.Synced = true
+	default:
+	}
+	return health
+}
+
+func (r *ContainerRepositoryImpl) updateHealth(update func(health *Health)) {
+	r.healthMutex.Lock()
+	defer r.healthMutex.Unlock()
+	update(&r.health)
+}
+
+func (r *ContainerRepositoryImpl) recordError(err error) {
+	r.updateHealth(func(health *Health) {
+		health.Connected = false
+		health.LastError = err
+		health.LastErrorAt = time.Now()
+	})
+}
+
+func (r *ContainerRepositoryImpl) inventoryContainers() []Container {
+	r.inventoryMutex.RLock()
+	defer r.inventoryMutex.RUnlock()
+
+	containers := make([]Container, 0, len(r.inventory))
+	for _, container := range r.inventory {
+		containers = append(containers, container)
+	}
+	return containers
+}
+
+func (r *ContainerRepositoryImpl) isInInventory(id string) (Container, bool) {
+	r.inventoryMutex.RLock()
+	defer r.inventoryMutex.RUnlock()
+
+	container, ok := r.inventory[id]
+	return container, ok
+}
+
+func (r *ContainerRepositoryImpl) applyUpdate(ctx context.Context, update containerUpdate) {
+	log := logger.Get(ctx).WithField("container_id", update.container.ID)
+
+	r.inventoryMutex.Lock()
+	container, known := r.inventory[update.container.ID]
+	state, valid := nextContainerState(container.State, update.action)
+	if !valid {
+		log.WithFields(logrus.Fields{"action": update.action, "state": container.State}).Info("Unexpected container action in this state")
+	}
+
+	switch update.action {
+	case ContainerActionStart, ContainerActionRestart:
+		if !update.container.StartedAt.IsZero() {
+			container.StartedAt = update.container.StartedAt
+		}
+	case ContainerActionRename:
+		container.Name = update.container.Name
+	case ContainerActionDie:
+		state = diedContainerState(state, container.RestartPolicy, update.exitCode)
+	case ContainerActionOOM:
+		log.Info("Container is out of memory")
+	}
+	container.ID = update.container.ID
+	container.State = state
+
+	monitored := isMonitoredState(state)
+	if monitored {
+		r.inventory[container.ID] = container
+	} else {
+		delete(r.inventory, container.ID)
+	}
+	r.inventoryMutex.Unlock()
+
+	// Subscribers are only notified when a container starts or stops being monitored, a container
+	// must not be started twice
+	if monitored && !known {
+		r.subscribers.Publish(ContainerEvent{ContainerID: container.ID, Action: ContainerActionStart})
+	} else if !monitored && known {
+		r.subscribers.Publish(ContainerEvent{ContainerID: container.ID, Action: ContainerActionStop})
+	}
+}
+
+// applyInspection fills the metadata of a started container once it has been inspected. The
+// container is ignored if it has stopped in the meantime, its state is kept as the events are more
+// recent than the inspection.
+func (r *ContainerRepositoryImpl) applyInspection(inspected Container) {
+	r.inventoryMutex.Lock()
+	defer r.inventoryMutex.Unlock()
+
+	container, ok := r.inventory[inspected.ID]
+	if !ok {
+		return
+	}
+	container.Name = inspected.Name
+	container.Labels = inspected.Labels
+	container.Image = inspected.Image
+	container.RestartCount = inspected.RestartCount
+	container.RestartPolicy = inspected.RestartPolicy
+	if !inspected.StartedAt.IsZero() {
+		container.StartedAt = inspected.StartedAt
+	}
+	r.inventory[container.ID] = container
+}
+
+func (r *ContainerRepositoryImpl) applySync(listing inventorySync) {
+	running := make(map[string]Container, len(listing.containers))
+	for _, container := range listing.containers {
+		running[container.ID] = container
+	}
+
+	r.inventoryMutex.Lock()
+	previous := r.inventory
+	for id, container := range previous {
+		listed, ok := running[id]
+		// A container started after the list has been requested is kept, its start event has been
+		// received in the meantime.
+		if !ok && container.StartedAt.After(listing.listedAt) {
+			running[id] = container
+		}
+		// The start time of a container which couldn't be inspected during the listing is kept
+		if ok && listed.StartedAt.IsZero() {
+			listed.StartedAt = container.StartedAt
+			listed.RestartCount = container.RestartCount
+			listed.RestartPolicy = container.RestartPolicy
+			running[id] = listed
+		}
+	}
+	r.inventory = running
+	r.inventoryMutex.Unlock()
+
+	for id := range running {
+		if _, ok := previous[id]; !ok {
+			r.subscribers.Publish(ContainerEvent{ContainerID: id, Action: ContainerActionStart})
+		}
+	}
+	for id := range previous {
+		if _, ok := running[id]; !ok {
+			r.subscribers.Publish(ContainerEvent{ContainerID: id, Action: ContainerActionStop})
+		}
+	}
+
+	r.syncedOnce.Do(func() { close(r.synced) })
+}
+
+func (r *ContainerRepositoryImpl) resyncPeriodically(ctx context.Context, syncs chan inventorySync) {
 	log := logger.Get(ctx)
-	registration := make(chan ContainerEvent, 1)
-	r.registrationMutex.Lock()
-	defer r.registrationMutex.Unlock()
-	r.registeredChans = append(r.registeredChans, registration)
-	go func(registration chan ContainerEvent) {
-		containers, err := ListContainers(ctx)
+
+	interval := config.Current().ContainersResyncInterval
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		// The interval may have been changed by a configuration reload
+		if resyncInterval := config.Current().ContainersResyncInterval; resyncInterval != interval {
+			interval = resyncInterval
+			tick.Reset(interval)
+		}
+
+		listedAt := time.Now()
+		containers, err := r.listContainers(ctx)
 		if err != nil {
-			log.WithError(err).Warn("register-chan fail to list containers")
+			log.WithError(err).Error("Fail to resynchronize containers inventory")
+			r.recordError(err)
+		} else {
+			r.updateHealth(func(health *Health) {
+				health.Connected = true
+				health.LastSyncAt = time.Now()
+			})
+			select {
+			case syncs <- inventorySync{containers: containers, listedAt: listedAt}:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
 			return
+		case <-tick.C:
 		}
-		for _, container := range containers {
-			registration <- ContainerEvent{
-				ContainerID: container.ID,
-				Action:      ContainerActionStart,
+	}
+}
+
+func (r *ContainerRepositoryImpl) listContainers(ctx context.Context) ([]Container, error) {
+	log := logger.Get(ctx)
+
+	list, err := r.client.ContainerList(ctx, dockerclient.ContainerListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(ctx, err, "list docker containers")
+	}
+
+	containers := make([]Container, 0, len(list.Items))
+	for _, summary := range list.Items {
+		container := Container{
+			ID:     summary.ID,
+			Labels: summary.Labels,
+			Image:  summary.Image,
+			State:  summary.State,
+		}
+		if len(summary.Names) > 0 {
+			container.Name = strings.TrimPrefix(summary.Names[0], "/")
+		}
+
+		// The start time is not part of the list, only the containers which have never been
+		// inspected successfully are inspected.
+		known, ok := r.isInInventory(summary.ID)
+		if ok && !known.StartedAt.IsZero() {
+			container.StartedAt = known.StartedAt
+			container.RestartCount = known.RestartCount
+			container.RestartPolicy = known.RestartPolicy
+		} else {
+			inspected, err := r.inspectContainer(ctx, summary.ID)
+			if err != nil {
+				log.WithError(err).WithField("container_id", summary.ID).Info("Fail to inspect container")
+			} else {
+				container.StartedAt = inspected.StartedAt
+				container.RestartCount = inspected.RestartCount
+				container.RestartPolicy = inspected.RestartPolicy
 			}
 		}
-	}(registration)
-	return registration
+		containers = append(containers, container)
+	}
+
+	return containers, nil
 }
 
-func (r *ContainerRepositoryImpl) listenToDockerEvents(ctx context.Context, events chan ContainerEvent) error {
-	log := logger.Get(ctx)
-	client, err := Client(ctx)
+func (r *ContainerRepositoryImpl) inspectContainer(ctx context.Context, id string) (Container, error) {
+	res, err := r.client.ContainerInspect(ctx, id, dockerclient.ContainerInspectOptions{})
+	if err != nil {
+		return Container{}, errors.Wrap(ctx, err, "inspect docker container")
+	}
+
+	container := Container{
+		ID:           res.Container.ID,
+		Name:         strings.TrimPrefix(res.Container.Name, "/"),
+		RestartCount: res.Container.RestartCount,
+	}
+	if res.Container.Config != nil {
+		container.Labels = res.Container.Config.Labels
+		container.Image = res.Container.Config.Image
+	}
+	if res.Container.HostConfig != nil {
+		container.RestartPolicy = res.Container.HostConfig.RestartPolicy.Name
+	}
+	if res.Container.State != nil {
+		container.State = res.Container.State.Status
+		container.StartedAt, _ = time.Parse(time.RFC3339Nano, res.Container.State.StartedAt)
+	}
+	return container, nil
+}
+
+// inspectStartedContainer fetches the metadata of a started container, out of the events stream so
+// that a slow inspection doesn't delay the following events
+func (r *ContainerRepositoryImpl) inspectStartedContainer(ctx context.Context, id string, inspections chan Container) {
+	container, err := r.inspectContainer(ctx, id)
 	if err != nil {
-		return errors.Wrap(ctx, err, "get docker client")
+		// The container is still part of the inventory, its metadata are filled during the next
+		// resynchronization.
+		logger.Get(ctx).WithError(err).WithField("container_id", id).Info("Fail to inspect started container")
+		return
 	}
-	defer client.Close()
+	select {
+	case inspections <- container:
+	case <-ctx.Done():
+	}
+}
 
-	filters := dockerclient.Filters{}.
-		Add("type", "container").
-		Add("event", string(ContainerActionStart)).
-		Add("event", string(ContainerActionStop))
+func (r *ContainerRepositoryImpl) listenToDockerEvents(ctx context.Context, updates chan containerUpdate, inspections chan Container) {
+	log := logger.Get(ctx)
+
+	filters := dockerclient.Filters{}.Add("type", "container")
+	for _, action := range containerLifecycleActions {
+		filters = filters.Add("event", string(action))
+	}
 
 	for {
-		eventsResult := client.Events(ctx, dockerclient.EventsListOptions{
+		eventsResult := r.client.Events(ctx, dockerclient.EventsListOptions{
 			Filters: filters,
 		})
-		if err != nil {
-			return errors.Wrap(ctx, err, "add event listener")
-		}
 
 		go func() {
 			for event := range eventsResult.Messages {
-				events <- ContainerEvent{
-					ContainerID: event.Actor.ID,
-					Action:      event.Action,
+				r.updateHealth(func(health *Health) {
+					health.Connected = true
+					health.LastEventAt = time.Now()
+				})
+				dockerEvents.Inc(string(event.Action))
+				update := containerUpdate{
+					action:    event.Action,
+					container: Container{ID: event.Actor.ID},
+				}
+				switch event.Action {
+				case ContainerActionStart, ContainerActionRestart:
+					// The start time is refined by the inspection of the container
+					if event.TimeNano != 0 {
+						update.container.StartedAt = time.Unix(0, event.TimeNano)
+					}
+				case ContainerActionDie:
+					update.exitCode, _ = strconv.Atoi(event.Actor.Attributes["exitCode"])
+				case ContainerActionRename:
+					update.container.Name = strings.TrimPrefix(event.Actor.Attributes["name"], "/")
+				}
+				select {
+				case updates <- update:
+				case <-ctx.Done():
+					return
+				}
+				if event.Action == ContainerActionStart || event.Action == ContainerActionRestart {
+					go r.inspectStartedContainer(ctx, event.Actor.ID, inspections)
 				}
 			}
 		}()
 
 		err := <-eventsResult.Err
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			r.recordError(err)
+			dockerReconnects.Inc()
+		}
 		if err == io.ErrUnexpectedEOF || err == io.EOF {
 			log.WithError(err).Info("Connection lost to docker, reconnecting immediately...")
 			// Not really immediately to prevent high CPU usage infinite loop during
@@ -0,0 +1,231 @@
+package docker
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestContainerRepository() *ContainerRepositoryImpl {
+	r := &ContainerRepositoryImpl{
+		inventory:      make(map[string]Container),
+		inventoryMutex: &sync.RWMutex{},
+		synced:         make(chan struct{}),
+		syncedOnce:     &sync.Once{},
+		healthMutex:    &sync.Mutex{},
+	}
+	r.subscribers = newContainerEventsPubSub(r.synced, r.inventoryContainers)
+	return r
+}
+
+// recordEvents registers a subscription which is never drained, the published events are
+// accumulated in its queue
+func recordEvents(repository *ContainerRepositoryImpl) *subscription {
+	sub := &subscription{
+		notify:     make(chan struct{}, 1),
+		mutex:      &sync.Mutex{},
+		bufferSize: 100,
+	}
+	repository.subscribers.subscribers = append(repository.subscribers.subscribers, sub)
+	return sub
+}
+
+func TestContainerRepository_Containers(t *testing.T) {
+	t.Run("it returns an error before the first synchronization", func(t *testing.T) {
+		repository := newTestContainerRepository()
+
+		_, err := repository.Containers(t.Context())
+		require.ErrorIs(t, err, ErrInventoryNotSynced)
+	})
+
+	t.Run("it returns the inventory once synchronized", func(t *testing.T) {
+		repository := newTestContainerRepository()
+		container := Container{ID: "1", Name: "web-1", Labels: map[string]string{"app": "web"}, State: "running"}
+		repository.applySync(inventorySync{containers: []Container{container}, listedAt: time.Now()})
+
+		containers, err := repository.Containers(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, []Container{container}, containers)
+	})
+}
+
+func TestContainerRepository_Container(t *testing.T) {
+	repository := newTestContainerRepository()
+	repository.applySync(inventorySync{containers: []Container{
+		{ID: "abc123", Name: "web-1"},
+		{ID: "abd456", Name: "worker-1"},
+	}, listedAt: time.Now()})
+
+	examples := map[string]struct {
+		ExpectedID  string
+		ExpectedErr error
+	}{
+		"abc123":   {ExpectedID: "abc123"},
+		"web-1":    {ExpectedID: "abc123"},
+		"/web-1":   {ExpectedID: "abc123"},
+		"abd":      {ExpectedID: "abd456"},
+		"ab":       {ExpectedErr: ErrAmbiguousReference},
+		"unknown":  {ExpectedErr: ErrContainerNotFound},
+		"worker-2": {ExpectedErr: ErrContainerNotFound},
+	}
+
+	for ref, example := range examples {
+		t.Run(ref, func(t *testing.T) {
+			container, err := repository.Container(t.Context(), ref)
+			if example.ExpectedErr != nil {
+				require.ErrorIs(t, err, example.ExpectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, example.ExpectedID, container.ID)
+		})
+	}
+}
+
+func TestContainerRepository_applyUpdate(t *testing.T) {
+	ctx := t.Context()
+	repository := newTestContainerRepository()
+	events := recordEvents(repository)
+
+	startedAt := time.Now()
+	repository.applyUpdate(ctx, containerUpdate{action: ContainerActionStart, container: Container{ID: "1", StartedAt: startedAt}})
+	repository.applyInspection(Container{ID: "1", Name: "web-1", State: ContainerStateExited})
+	// A second start of the same container must not be published
+	repository.applyUpdate(ctx, containerUpdate{action: ContainerActionStart, container: Container{ID: "1"}})
+	assert.Equal(t, "web-1", repository.inventory["1"].Name)
+	assert.Equal(t, startedAt, repository.inventory["1"].StartedAt)
+	assert.Equal(t, ContainerStateRunning, repository.inventory["1"].State)
+
+	repository.applyUpdate(ctx, containerUpdate{action: ContainerActionPause, container: Container{ID: "1"}})
+	assert.Equal(t, ContainerStatePaused, repository.inventory["1"].State)
+	repository.applyUpdate(ctx, containerUpdate{action: ContainerActionRename, container: Container{ID: "1", Name: "web-2"}})
+	assert.Equal(t, "web-2", repository.inventory["1"].Name)
+	repository.applyUpdate(ctx, containerUpdate{action: ContainerActionUnpause, container: Container{ID: "1"}})
+	assert.Equal(t, ContainerStateRunning, repository.inventory["1"].State)
+
+	// A die without stop event must stop the monitoring
+	repository.applyUpdate(ctx, containerUpdate{action: ContainerActionKill, container: Container{ID: "1"}})
+	repository.applyUpdate(ctx, containerUpdate{action: ContainerActionDie, container: Container{ID: "1"}})
+	// The stop event following the die is not published again
+	repository.applyUpdate(ctx, containerUpdate{action: ContainerActionStop, container: Container{ID: "1"}})
+	// The inspection of a stopped container is ignored
+	repository.applyInspection(Container{ID: "1"})
+	assert.NotContains(t, repository.inventory, "1")
+
+	repository.applyUpdate(ctx, containerUpdate{action: ContainerActionRestart, container: Container{ID: "1"}})
+	repository.applyInspection(Container{ID: "1", Name: "web-2", RestartCount: 1, RestartPolicy: "always"})
+	assert.Equal(t, 1, repository.inventory["1"].RestartCount)
+
+	// A container restarted by Docker after its death is still monitored
+	repository.applyUpdate(ctx, containerUpdate{action: ContainerActionDie, container: Container{ID: "1"}, exitCode: 1})
+	assert.Equal(t, ContainerStateRestarting, repository.inventory["1"].State)
+	repository.applyUpdate(ctx, containerUpdate{action: ContainerActionStart, container: Container{ID: "1"}})
+	assert.Equal(t, ContainerStateRunning, repository.inventory["1"].State)
+
+	assert.Equal(t, []ContainerEvent{
+		{ContainerID: "1", Action: ContainerActionStart},
+		{ContainerID: "1", Action: ContainerActionStop},
+		{ContainerID: "1", Action: ContainerActionStart},
+	}, events.queue)
+}
+
+func TestNextContainerState(t *testing.T) {
+	examples := []struct {
+		Name          string
+		State         ContainerState
+		Action        ContainerAction
+		ExpectedState ContainerState
+		ExpectedValid bool
+	}{
+		{Name: "start a new container", State: "", Action: ContainerActionStart, ExpectedState: ContainerStateRunning, ExpectedValid: true},
+		{Name: "pause a running container", State: ContainerStateRunning, Action: ContainerActionPause, ExpectedState: ContainerStatePaused, ExpectedValid: true},
+		{Name: "pause a paused container", State: ContainerStatePaused, Action: ContainerActionPause, ExpectedState: ContainerStatePaused, ExpectedValid: false},
+		{Name: "kill a running container", State: ContainerStateRunning, Action: ContainerActionKill, ExpectedState: ContainerStateRunning, ExpectedValid: true},
+		{Name: "oom of a running container", State: ContainerStateRunning, Action: ContainerActionOOM, ExpectedState: ContainerStateRunning, ExpectedValid: true},
+		{Name: "die of a paused container", State: ContainerStatePaused, Action: ContainerActionDie, ExpectedState: ContainerStateExited, ExpectedValid: true},
+		{Name: "restart an exited container", State: ContainerStateExited, Action: ContainerActionRestart, ExpectedState: ContainerStateRunning, ExpectedValid: true},
+	}
+
+	for _, example := range examples {
+		t.Run(example.Name, func(t *testing.T) {
+			state, valid := nextContainerState(example.State, example.Action)
+			assert.Equal(t, example.ExpectedState, state)
+			assert.Equal(t, example.ExpectedValid, valid)
+		})
+	}
+}
+
+func TestDiedContainerState(t *testing.T) {
+	examples := []struct {
+		Name          string
+		Policy        RestartPolicy
+		ExitCode      int
+		ExpectedState ContainerState
+	}{
+		{Name: "without restart policy", Policy: "", ExitCode: 1, ExpectedState: ContainerStateExited},
+		{Name: "restart disabled", Policy: "no", ExitCode: 1, ExpectedState: ContainerStateExited},
+		{Name: "always restarted", Policy: "always", ExitCode: 0, ExpectedState: ContainerStateRestarting},
+		{Name: "restarted unless stopped", Policy: "unless-stopped", ExitCode: 0, ExpectedState: ContainerStateRestarting},
+		{Name: "restarted on failure", Policy: "on-failure", ExitCode: 137, ExpectedState: ContainerStateRestarting},
+		{Name: "successful exit with restart on failure", Policy: "on-failure", ExitCode: 0, ExpectedState: ContainerStateExited},
+	}
+
+	for _, example := range examples {
+		t.Run(example.Name, func(t *testing.T) {
+			assert.Equal(t, example.ExpectedState, diedContainerState(ContainerStateExited, example.Policy, example.ExitCode))
+		})
+	}
+}
+
+func TestContainerRepository_applySync(t *testing.T) {
+	listedAt := time.Now()
+	repository := newTestContainerRepository()
+	repository.inventory = map[string]Container{
+		"stopped":      {ID: "stopped", StartedAt: listedAt.Add(-time.Hour)},
+		"running":      {ID: "running", StartedAt: listedAt.Add(-time.Hour)},
+		"uninspected":  {ID: "uninspected", StartedAt: listedAt.Add(-time.Hour)},
+		"just-started": {ID: "just-started", StartedAt: listedAt.Add(time.Second)},
+	}
+	events := recordEvents(repository)
+
+	repository.applySync(inventorySync{
+		containers: []Container{{ID: "running", Name: "renamed", StartedAt: listedAt.Add(-time.Minute)}, {ID: "uninspected"}, {ID: "new"}},
+		listedAt:   listedAt,
+	})
+
+	assert.ElementsMatch(t, []ContainerEvent{
+		{ContainerID: "new", Action: ContainerActionStart},
+		{ContainerID: "stopped", Action: ContainerActionStop},
+	}, events.queue)
+	assert.Len(t, repository.inventory, 4)
+	assert.Equal(t, "renamed", repository.inventory["running"].Name)
+	assert.Equal(t, listedAt.Add(-time.Minute), repository.inventory["running"].StartedAt)
+	// The start time is kept if the container couldn't be inspected during the listing
+	assert.Equal(t, listedAt.Add(-time.Hour), repository.inventory["uninspected"].StartedAt)
+	assert.Contains(t, repository.inventory, "just-started")
+}
+
+func TestContainerRepository_Health(t *testing.T) {
+	repository := newTestContainerRepository()
+	assert.Equal(t, Health{}, repository.Health())
+
+	repository.recordError(errors.New("connection refused"))
+	health := repository.Health()
+	assert.False(t, health.Connected)
+	assert.EqualError(t, health.LastError, "connection refused")
+	assert.False(t, health.LastErrorAt.IsZero())
+
+	repository.updateHealth(func(health *Health) {
+		health.Connected = true
+	})
+	repository.applySync(inventorySync{listedAt: time.Now()})
+	health = repository.Health()
+	assert.True(t, health.Connected)
+	assert.True(t, health.Synced)
+	// The last error is kept for diagnostics
+	assert.EqualError(t, health.LastError, "connection refused")
+}
@@ -0,0 +1,107 @@
+package docker
+
+import (
+	"slices"
+
+	dockercontainer "github.com/moby/moby/api/types/container"
+	dockerevents "github.com/moby/moby/api/types/events"
+)
+
+type ContainerState = dockercontainer.ContainerState
+
+type RestartPolicy = dockercontainer.RestartPolicyMode
+
+const (
+	ContainerStateCreated    = dockercontainer.StateCreated
+	ContainerStateRunning    = dockercontainer.StateRunning
+	ContainerStatePaused     = dockercontainer.StatePaused
+	ContainerStateRestarting = dockercontainer.StateRestarting
+	ContainerStateExited     = dockercontainer.StateExited
+	ContainerStateDead       = dockercontainer.StateDead
+)
+
+const (
+	ContainerActionRestart = dockerevents.ActionRestart
+	ContainerActionPause   = dockerevents.ActionPause
+	ContainerActionUnpause = dockerevents.ActionUnPause
+	ContainerActionDie     = dockerevents.ActionDie
+	ContainerActionKill    = dockerevents.ActionKill
+	ContainerActionOOM     = dockerevents.ActionOOM
+	ContainerActionRename  = dockerevents.ActionRename
+	ContainerActionDestroy = dockerevents.ActionDestroy
+)
+
+// containerLifecycleActions are the Docker events listened to keep the containers inventory up to
+// date
+var containerLifecycleActions = []ContainerAction{
+	ContainerActionStart, ContainerActionRestart, ContainerActionStop, ContainerActionPause,
+	ContainerActionUnpause, ContainerActionDie, ContainerActionKill, ContainerActionOOM,
+	ContainerActionRename, ContainerActionDestroy,
+}
+
+type containerTransition struct {
+	from []ContainerState
+	to   ContainerState
+}
+
+// containerTransitions is the state machine of a container. An empty list of origin states means
+// the action is valid from any state. Actions which are not part of this map (kill, oom, rename) do
+// not change the state of the container: a kill is only a signal and an oom is followed by a die
+// event if the container is stopped.
+var containerTransitions = map[ContainerAction]containerTransition{
+	ContainerActionStart: {
+		from: []ContainerState{"", ContainerStateCreated, ContainerStateExited, ContainerStateDead, ContainerStateRestarting},
+		to:   ContainerStateRunning,
+	},
+	ContainerActionRestart: {to: ContainerStateRunning},
+	ContainerActionPause: {
+		from: []ContainerState{ContainerStateRunning},
+		to:   ContainerStatePaused,
+	},
+	ContainerActionUnpause: {
+		from: []ContainerState{ContainerStatePaused},
+		to:   ContainerStateRunning,
+	},
+	ContainerActionDie: {
+		from: []ContainerState{ContainerStateRunning, ContainerStatePaused, ContainerStateRestarting},
+		to:   ContainerStateExited,
+	},
+	ContainerActionStop:    {to: ContainerStateExited},
+	ContainerActionDestroy: {to: ContainerStateDead},
+}
+
+// nextContainerState returns the state of a container after the given action. The returned boolean
+// is false if the action is not expected from the current state, Docker stays the source of truth
+// and the new state is applied anyway.
+func nextContainerState(state ContainerState, action ContainerAction) (ContainerState, bool) {
+	transition, ok := containerTransitions[action]
+	if !ok {
+		return state, true
+	}
+	if len(transition.from) == 0 {
+		return transition.to, true
+	}
+	return transition.to, slices.Contains(transition.from, state)
+}
+
+// diedContainerState returns the state of a container which died with the given exit code: Docker
+// restarts it according to its restart policy. A container stopped by the user receives a stop
+// event after the die event, and a container which has exhausted its retries is removed during the
+// next resynchronization.
+func diedContainerState(state ContainerState, policy RestartPolicy, exitCode int) ContainerState {
+	switch policy {
+	case dockercontainer.RestartPolicyAlways, dockercontainer.RestartPolicyUnlessStopped:
+		return ContainerStateRestarting
+	case dockercontainer.RestartPolicyOnFailure:
+		if exitCode != 0 {
+			return ContainerStateRestarting
+		}
+	}
+	return state
+}
+
+// isMonitoredState returns true if a container in this state is part of the inventory: containers
+// are monitored from their start to their death.
+func isMonitoredState(state ContainerState) bool {
+	return state == ContainerStateRunning || state == ContainerStatePaused || state == ContainerStateRestarting
+}
@@ -35,6 +35,50 @@ func (m *MockContainerRepository) EXPECT() *MockContainerRepositoryMockRecorder
 	return m.recorder
 }
 
+// Container mocks base method.
+func (m *MockContainerRepository) Container(arg0 context.Context, arg1 string) (docker.Container, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Container", arg0, arg1)
+	ret0, _ := ret[0].(docker.Container)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Container indicates an expected call of Container.
+func (mr *MockContainerRepositoryMockRecorder) Container(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Container", reflect.TypeOf((*MockContainerRepository)(nil).Container), arg0, arg1)
+}
+
+// Containers mocks base method.
+func (m *MockContainerRepository) Containers(arg0 context.Context) ([]docker.Container, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Containers", arg0)
+	ret0, _ := ret[0].([]docker.Container)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Containers indicates an expected call of Containers.
+func (mr *MockContainerRepositoryMockRecorder) Containers(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Containers", reflect.TypeOf((*MockContainerRepository)(nil).Containers), arg0)
+}
+
+// Health mocks base method.
+func (m *MockContainerRepository) Health() docker.Health {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Health")
+	ret0, _ := ret[0].(docker.Health)
+	return ret0
+}
+
+// Health indicates an expected call of Health.
+func (mr *MockContainerRepositoryMockRecorder) Health() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Health", reflect.TypeOf((*MockContainerRepository)(nil).Health))
+}
+
 // RegisterToContainersStream mocks base method.
 func (m *MockContainerRepository) RegisterToContainersStream(arg0 context.Context) <-chan docker.ContainerEvent {
 	m.ctrl.T.Helper()
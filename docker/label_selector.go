@@ -0,0 +1,87 @@
+package docker
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Scalingo/go-utils/errors/v3"
+)
+
+type labelOperator string
+
+const (
+	labelOperatorExists    labelOperator = "exists"
+	labelOperatorNotExists labelOperator = "!exists"
+	labelOperatorEqual     labelOperator = "="
+	labelOperatorNotEqual  labelOperator = "!="
+)
+
+// LabelSelector selects containers according to one of their labels. The supported syntaxes are:
+// - key: the label is defined
+// - !key: the label is not defined
+// - key=value: the label is defined with this value
+// - key!=value: the label is not defined or has another value
+type LabelSelector struct {
+	Key      string
+	Value    string
+	operator labelOperator
+}
+
+// LabelSelectors matches a container if all the selectors match
+type LabelSelectors []LabelSelector
+
+func ParseLabelSelector(ctx context.Context, selector string) (LabelSelector, error) {
+	selector = strings.TrimSpace(selector)
+
+	var result LabelSelector
+	if key, value, ok := strings.Cut(selector, "!="); ok {
+		result = LabelSelector{Key: key, Value: value, operator: labelOperatorNotEqual}
+	} else if key, value, ok := strings.Cut(selector, "="); ok {
+		result = LabelSelector{Key: key, Value: value, operator: labelOperatorEqual}
+	} else if key, ok := strings.CutPrefix(selector, "!"); ok {
+		result = LabelSelector{Key: key, operator: labelOperatorNotExists}
+	} else {
+		result = LabelSelector{Key: selector, operator: labelOperatorExists}
+	}
+
+	result.Key = strings.TrimSpace(result.Key)
+	if result.Key == "" {
+		return LabelSelector{}, errors.Errorf(ctx, "invalid label selector '%s': empty label key", selector)
+	}
+	return result, nil
+}
+
+func ParseLabelSelectors(ctx context.Context, selectors []string) (LabelSelectors, error) {
+	result := make(LabelSelectors, 0, len(selectors))
+	for _, selector := range selectors {
+		parsed, err := ParseLabelSelector(ctx, selector)
+		if err != nil {
+			return nil, errors.Wrap(ctx, err, "parse label selector")
+		}
+		result = append(result, parsed)
+	}
+	return result, nil
+}
+
+func (s LabelSelector) Matches(labels map[string]string) bool {
+	value, ok := labels[s.Key]
+	switch s.operator {
+	case labelOperatorNotExists:
+		return !ok
+	case labelOperatorEqual:
+		return ok && value == s.Value
+	case labelOperatorNotEqual:
+		return !ok || value != s.Value
+	default:
+		return ok
+	}
+}
+
+func (s LabelSelectors) Matches(labels map[string]string) bool {
+	for _, selector := range s {
+		if !selector.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,43 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLabelSelectors_Matches(t *testing.T) {
+	labels := map[string]string{"app": "web", "env": "production"}
+
+	examples := []struct {
+		Name      string
+		Selectors []string
+		Expected  bool
+	}{
+		{Name: "without selector", Selectors: []string{}, Expected: true},
+		{Name: "with an existing label", Selectors: []string{"app"}, Expected: true},
+		{Name: "with a missing label", Selectors: []string{"region"}, Expected: false},
+		{Name: "with a label which must not exist", Selectors: []string{"!region"}, Expected: true},
+		{Name: "with an equal value", Selectors: []string{"app=web"}, Expected: true},
+		{Name: "with another value", Selectors: []string{"app=worker"}, Expected: false},
+		{Name: "with a different value", Selectors: []string{"env!=staging"}, Expected: true},
+		{Name: "with a missing label which must be different", Selectors: []string{"region!=eu"}, Expected: true},
+		{Name: "with several selectors", Selectors: []string{"app=web", "env!=production"}, Expected: false},
+	}
+
+	for _, example := range examples {
+		t.Run(example.Name, func(t *testing.T) {
+			selectors, err := ParseLabelSelectors(t.Context(), example.Selectors)
+			require.NoError(t, err)
+			assert.Equal(t, example.Expected, selectors.Matches(labels))
+		})
+	}
+}
+
+func TestParseLabelSelector_Invalid(t *testing.T) {
+	for _, selector := range []string{"", "=web", "!=web", "!"} {
+		_, err := ParseLabelSelector(t.Context(), selector)
+		assert.Error(t, err, selector)
+	}
+}
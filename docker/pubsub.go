@@ -0,0 +1,187 @@
+package docker
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/Scalingo/acadock-monitoring/v2/metrics"
+)
+
+// defaultSubscriberBufferSize is the number of events queued for a subscriber before it is
+// considered overflowed
+const defaultSubscriberBufferSize = 1024
+
+var streamOverflows = metrics.NewCounter("acadock_containers_stream_overflows_total", "Number of times a subscriber of the containers stream has been too slow and resynchronized")
+
+// containerEventsPubSub fans out the containers events to the subscribers without ever blocking the
+// publisher: each subscriber has its own queue, drained by its own goroutine.
+//
+// When the queue of a subscriber is full, its pending events are dropped and the subscriber is
+// resynchronized: it receives the start and stop events needed to go from the containers it knows
+// to the running containers. New subscribers are resynchronized from scratch, which replays the
+// inventory as start events.
+type containerEventsPubSub struct {
+	// ready is closed once the running containers are known
+	ready      <-chan struct{}
+	running    func() []Container
+	bufferSize int
+
+	mutex       *sync.Mutex
+	subscribers []*subscription
+}
+
+type subscription struct {
+	out    chan ContainerEvent
+	notify chan struct{}
+
+	mutex        *sync.Mutex
+	queue        []ContainerEvent
+	needsResync  bool
+	bufferSize   int
+	onOverflowed func()
+}
+
+func newContainerEventsPubSub(ready <-chan struct{}, running func() []Container) *containerEventsPubSub {
+	return &containerEventsPubSub{
+		ready:      ready,
+		running:    running,
+		bufferSize: defaultSubscriberBufferSize,
+		mutex:      &sync.Mutex{},
+	}
+}
+
+// Subscribe returns a channel receiving the containers events until the context is canceled, the
+// channel is then closed.
+func (p *containerEventsPubSub) Subscribe(ctx context.Context) <-chan ContainerEvent {
+	sub := &subscription{
+		out:          make(chan ContainerEvent),
+		notify:       make(chan struct{}, 1),
+		mutex:        &sync.Mutex{},
+		needsResync:  true,
+		bufferSize:   p.bufferSize,
+		onOverflowed: func() { streamOverflows.Inc() },
+	}
+
+	p.mutex.Lock()
+	p.subscribers = append(p.subscribers, sub)
+	p.mutex.Unlock()
+
+	go func() {
+		defer p.unsubscribe(sub)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.ready:
+		}
+		sub.forward(ctx, p.running)
+	}()
+	return sub.out
+}
+
+// Publish queues the event for all the subscribers, it never blocks
+func (p *containerEventsPubSub) Publish(event ContainerEvent) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, sub := range p.subscribers {
+		sub.push(event)
+	}
+}
+
+// Len returns the number of subscribers
+func (p *containerEventsPubSub) Len() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return len(p.subscribers)
+}
+
+func (p *containerEventsPubSub) unsubscribe(sub *subscription) {
+	p.mutex.Lock()
+	p.subscribers = slices.DeleteFunc(p.subscribers, func(s *subscription) bool { return s == sub })
+	p.mutex.Unlock()
+	close(sub.out)
+}
+
+func (s *subscription) push(event ContainerEvent) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// The pending events are dropped anyway, the resynchronization will take this one into account
+	if s.needsResync {
+		return
+	}
+	if len(s.queue) >= s.bufferSize {
+		s.queue = nil
+		s.needsResync = true
+		s.onOverflowed()
+	} else {
+		s.queue = append(s.queue, event)
+	}
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// forward delivers the queued events to the subscriber until the context is canceled. It keeps
+// track of the containers started from the subscriber point of view so that a resynchronization
+// only sends the differences, and so that an event already covered by a resynchronization is not
+// delivered twice.
+func (s *subscription) forward(ctx context.Context, running func() []Container) {
+	started := map[string]bool{}
+	for {
+		s.mutex.Lock()
+		resync := s.needsResync
+		events := s.queue
+		s.queue = nil
+		s.needsResync = false
+		s.mutex.Unlock()
+
+		if resync {
+			events = resyncEvents(started, running())
+		}
+
+		for _, event := range events {
+			isStart := event.Action == ContainerActionStart
+			if started[event.ContainerID] == isStart {
+				continue
+			}
+			select {
+			case s.out <- event:
+			case <-ctx.Done():
+				return
+			}
+			if isStart {
+				started[event.ContainerID] = true
+			} else {
+				delete(started, event.ContainerID)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.notify:
+		}
+	}
+}
+
+// resyncEvents returns the events to go from the started containers to the running ones
+func resyncEvents(started map[string]bool, running []Container) []ContainerEvent {
+	events := make([]ContainerEvent, 0, len(running))
+	runningIDs := make(map[string]bool, len(running))
+	for _, container := range running {
+		runningIDs[container.ID] = true
+		if !started[container.ID] {
+			events = append(events, ContainerEvent{ContainerID: container.ID, Action: ContainerActionStart})
+		}
+	}
+	for id := range started {
+		if !runningIDs[id] {
+			events = append(events, ContainerEvent{ContainerID: id, Action: ContainerActionStop})
+		}
+	}
+	return events
+}
@@ -0,0 +1,195 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testInventory is the running containers of a test pub/sub, updated before publishing the events
+// like the containers repository does
+type testInventory struct {
+	mutex   *sync.Mutex
+	running map[string]bool
+	pubsub  *containerEventsPubSub
+}
+
+func newTestInventory(ready <-chan struct{}, bufferSize int) *testInventory {
+	inventory := &testInventory{mutex: &sync.Mutex{}, running: map[string]bool{}}
+	inventory.pubsub = newContainerEventsPubSub(ready, inventory.containers)
+	inventory.pubsub.bufferSize = bufferSize
+	return inventory
+}
+
+func (i *testInventory) containers() []Container {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	containers := []Container{}
+	for id := range i.running {
+		containers = append(containers, Container{ID: id})
+	}
+	return containers
+}
+
+func (i *testInventory) apply(event ContainerEvent) {
+	i.mutex.Lock()
+	if event.Action == ContainerActionStart {
+		i.running[event.ContainerID] = true
+	} else {
+		delete(i.running, event.ContainerID)
+	}
+	i.mutex.Unlock()
+	i.pubsub.Publish(event)
+}
+
+func (i *testInventory) runningIDs() map[string]bool {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	running := map[string]bool{}
+	for id := range i.running {
+		running[id] = true
+	}
+	return running
+}
+
+// consume applies the events received on the channel to a set of started containers until the
+// expected set is reached
+func consume(t *testing.T, events <-chan ContainerEvent, started map[string]bool, expected map[string]bool) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for !assert.ObjectsAreEqual(expected, started) {
+		select {
+		case event, ok := <-events:
+			require.True(t, ok, "channel closed")
+			if event.Action == ContainerActionStart {
+				require.False(t, started[event.ContainerID], "container %s started twice", event.ContainerID)
+				started[event.ContainerID] = true
+			} else {
+				require.True(t, started[event.ContainerID], "container %s stopped without being started", event.ContainerID)
+				delete(started, event.ContainerID)
+			}
+		case <-timeout:
+			require.Fail(t, "timeout waiting for the events", "started: %v, expected: %v", started, expected)
+		}
+	}
+}
+
+func TestContainerEventsPubSub_Subscribe(t *testing.T) {
+	ready := make(chan struct{})
+	inventory := newTestInventory(ready, 10)
+	inventory.apply(ContainerEvent{ContainerID: "1", Action: ContainerActionStart})
+	inventory.apply(ContainerEvent{ContainerID: "2", Action: ContainerActionStart})
+
+	events := inventory.pubsub.Subscribe(t.Context())
+	select {
+	case event := <-events:
+		t.Fatalf("no event must be received before the inventory is ready, got %v", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// The running containers are replayed, then the events are forwarded
+	close(ready)
+	started := map[string]bool{}
+	consume(t, events, started, map[string]bool{"1": true, "2": true})
+
+	inventory.apply(ContainerEvent{ContainerID: "1", Action: ContainerActionStop})
+	inventory.apply(ContainerEvent{ContainerID: "3", Action: ContainerActionStart})
+	consume(t, events, started, map[string]bool{"2": true, "3": true})
+}
+
+func TestContainerEventsPubSub_SlowSubscriber(t *testing.T) {
+	ready := make(chan struct{})
+	close(ready)
+	inventory := newTestInventory(ready, 5)
+	inventory.apply(ContainerEvent{ContainerID: "seed", Action: ContainerActionStart})
+
+	slow := inventory.pubsub.Subscribe(t.Context())
+	fast := inventory.pubsub.Subscribe(t.Context())
+	slowStarted := map[string]bool{}
+	consume(t, slow, slowStarted, map[string]bool{"seed": true})
+	fastStarted := map[string]bool{}
+	consume(t, fast, fastStarted, map[string]bool{"seed": true})
+
+	// The fast subscriber reads the events while they are published
+	fastEvents := make(chan ContainerEvent, 1000)
+	go func() {
+		for event := range fast {
+			fastEvents <- event
+		}
+		close(fastEvents)
+	}()
+
+	overflowsBefore := streamOverflows.Value()
+	published := make(chan struct{})
+	go func() {
+		defer close(published)
+		for i := range 100 {
+			id := fmt.Sprintf("%d", i%20)
+			action := ContainerActionStart
+			if i >= 20 && i%3 == 0 {
+				action = ContainerActionStop
+			}
+			if inventory.runningIDs()[id] == (action == ContainerActionStart) {
+				continue
+			}
+			inventory.apply(ContainerEvent{ContainerID: id, Action: action})
+		}
+	}()
+
+	// The publisher is never blocked by the slow subscriber which doesn't read anything yet
+	select {
+	case <-published:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the publisher is blocked by the slow subscriber")
+	}
+	consume(t, fastEvents, fastStarted, inventory.runningIDs())
+
+	// The slow subscriber overflowed and is resynchronized with the running containers
+	assert.Greater(t, streamOverflows.Value(), overflowsBefore)
+	consume(t, slow, slowStarted, inventory.runningIDs())
+
+	inventory.apply(ContainerEvent{ContainerID: "new", Action: ContainerActionStart})
+	expected := inventory.runningIDs()
+	consume(t, slow, slowStarted, expected)
+	consume(t, fastEvents, fastStarted, expected)
+}
+
+func TestContainerEventsPubSub_Unsubscribe(t *testing.T) {
+	ready := make(chan struct{})
+	close(ready)
+	inventory := newTestInventory(ready, 10)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	events := inventory.pubsub.Subscribe(ctx)
+	other := inventory.pubsub.Subscribe(t.Context())
+	assert.Equal(t, 2, inventory.pubsub.Len())
+
+	inventory.apply(ContainerEvent{ContainerID: "1", Action: ContainerActionStart})
+	// The subscriber is blocked on the delivery of the event when the context is canceled
+	cancel()
+
+	require.Eventually(t, func() bool {
+		return inventory.pubsub.Len() == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	for range events {
+	}
+
+	// The other subscribers are not affected
+	consume(t, other, map[string]bool{}, map[string]bool{"1": true})
+}
+
+func TestResyncEvents(t *testing.T) {
+	events := resyncEvents(
+		map[string]bool{"stopped": true, "running": true},
+		[]Container{{ID: "running"}, {ID: "new"}},
+	)
+	assert.ElementsMatch(t, []ContainerEvent{
+		{ContainerID: "new", Action: ContainerActionStart},
+		{ContainerID: "stopped", Action: ContainerActionStop},
+	}, events)
+}
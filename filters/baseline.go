@@ -0,0 +1,211 @@
+package filters
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// BaselineConfig configures the baseline of a metric. Alpha is the smoothing factor of the mean
+// and of the variance, in ]0, 1]. A value is anomalous if it deviates from the mean by more than
+// Threshold standard deviations and by more than MinDeviation, once Warmup values have been added.
+// After RebaselineAfter consecutive anomalous values, the baseline is rebuilt from them, never if it
+// is 0.
+type BaselineConfig struct {
+	Alpha           float64
+	Threshold       float64
+	Warmup          int
+	MinDeviation    float64
+	RebaselineAfter int
+}
+
+func (c BaselineConfig) validate() error {
+	if c.Alpha <= 0 || c.Alpha > 1 {
+		return fmt.Errorf("alpha should be in ]0, 1], current value: %v", c.Alpha)
+	}
+	if c.Threshold <= 0 {
+		return fmt.Errorf("threshold should be >0, current value: %v", c.Threshold)
+	}
+	if c.Warmup < 0 {
+		return fmt.Errorf("warmup should be >=0, current value: %v", c.Warmup)
+	}
+	if c.RebaselineAfter < 0 {
+		return fmt.Errorf("rebaseline after should be >=0, current value: %v", c.RebaselineAfter)
+	}
+	return nil
+}
+
+// Anomaly describes a metric deviating from its baseline
+type Anomaly struct {
+	// Since is the time of the first anomalous value
+	Since time.Time
+	// Value is the last anomalous value
+	Value float64
+	// Mean and StdDev are the baseline the value is compared to
+	Mean   float64
+	StdDev float64
+}
+
+// Baseline keeps the exponentially weighted moving mean and variance of a metric and detects the
+// values deviating from them. The anomalous values are not added to the baseline, so that a spike
+// doesn't become the new normal, unless they last for RebaselineAfter values: the level of the metric
+// has shifted and the baseline is rebuilt from them.
+type Baseline struct {
+	config BaselineConfig
+
+	mutex    *sync.Mutex
+	count    int
+	mean     float64
+	variance float64
+	anomaly  *Anomaly
+	// anomalous are the consecutive anomalous values
+	anomalous []float64
+}
+
+func NewBaseline(config BaselineConfig) (*Baseline, error) {
+	err := config.validate()
+	if err != nil {
+		return nil, err
+	}
+	return &Baseline{
+		config: config,
+		mutex:  &sync.Mutex{},
+	}, nil
+}
+
+// Add compares the value to the baseline, then adds it to the baseline if it isn't anomalous. It
+// returns whether the value is anomalous.
+func (b *Baseline) Add(at time.Time, value float64) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	stdDev := math.Sqrt(b.variance)
+	deviation := math.Abs(value - b.mean)
+	if b.count >= b.config.Warmup && b.count > 0 && deviation > b.config.Threshold*stdDev && deviation > b.config.MinDeviation {
+		b.anomalous = append(b.anomalous, value)
+		if b.config.RebaselineAfter == 0 || len(b.anomalous) < b.config.RebaselineAfter {
+			if b.anomaly == nil {
+				b.anomaly = &Anomaly{Since: at}
+			}
+			b.anomaly.Value = value
+			b.anomaly.Mean = b.mean
+			b.anomaly.StdDev = stdDev
+			return true
+		}
+
+		anomalous := b.anomalous
+		b.count, b.mean, b.variance = 0, 0, 0
+		for _, value := range anomalous {
+			b.add(value)
+		}
+		b.anomaly = nil
+		b.anomalous = nil
+		return false
+	}
+	b.anomaly = nil
+	b.anomalous = nil
+	b.add(value)
+	return false
+}
+
+// add updates the mean and the variance with the value. The mutex must be locked.
+func (b *Baseline) add(value float64) {
+	if b.count == 0 {
+		b.mean = value
+	} else {
+		diff := value - b.mean
+		increment := b.config.Alpha * diff
+		b.mean += increment
+		b.variance = (1 - b.config.Alpha) * (b.variance + diff*increment)
+	}
+	b.count++
+}
+
+// Clear ends the current anomaly, e.g. because the metric couldn't be computed: the next anomalous
+// value starts a new one
+func (b *Baseline) Clear() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.anomaly = nil
+	b.anomalous = nil
+}
+
+// Anomaly returns the current anomaly, and false if the last value isn't anomalous
+func (b *Baseline) Anomaly() (Anomaly, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.anomaly == nil {
+		return Anomaly{}, false
+	}
+	return *b.anomaly, true
+}
+
+// AnomalyDetector keeps a Baseline per target and per metric. The baselines of a target are created
+// when its first value is added and destroyed by Remove. The metrics absent from the configuration
+// are ignored.
+type AnomalyDetector struct {
+	configs   map[string]BaselineConfig
+	baselines targetsSeries[*Baseline]
+}
+
+// NewAnomalyDetector returns the detector configured by configs, indexed by metric
+func NewAnomalyDetector(configs map[string]BaselineConfig) (*AnomalyDetector, error) {
+	for metric, config := range configs {
+		err := config.validate()
+		if err != nil {
+			return nil, fmt.Errorf("invalid configuration of metric %s: %w", metric, err)
+		}
+	}
+	return &AnomalyDetector{
+		configs:   configs,
+		baselines: newTargetsSeries[*Baseline](),
+	}, nil
+}
+
+// Add compares the value of the metric of a target to its baseline and returns whether it is
+// anomalous
+func (d *AnomalyDetector) Add(target, metric string, at time.Time, value float64) bool {
+	config, ok := d.configs[metric]
+	if !ok {
+		return false
+	}
+	baseline := d.baselines.getOrCreate(target, metric, func() *Baseline {
+		// The configuration has been validated by NewAnomalyDetector
+		baseline, _ := NewBaseline(config)
+		return baseline
+	})
+	return baseline.Add(at, value)
+}
+
+// Anomalies returns the current anomalies, indexed by target then by metric
+func (d *AnomalyDetector) Anomalies() map[string]map[string]Anomaly {
+	anomalies := map[string]map[string]Anomaly{}
+	d.baselines.each(func(target, metric string, baseline *Baseline) {
+		anomaly, ok := baseline.Anomaly()
+		if !ok {
+			return
+		}
+		if anomalies[target] == nil {
+			anomalies[target] = map[string]Anomaly{}
+		}
+		anomalies[target][metric] = anomaly
+	})
+	return anomalies
+}
+
+// ClearAbsent ends the anomalies of the metrics of the targets absent from values, indexed by
+// target then by metric
+func (d *AnomalyDetector) ClearAbsent(values map[string]map[string]float64) {
+	d.baselines.each(func(target, metric string, baseline *Baseline) {
+		_, ok := values[target][metric]
+		if !ok {
+			baseline.Clear()
+		}
+	})
+}
+
+// Remove destroys the baselines of a target
+func (d *AnomalyDetector) Remove(target string) {
+	d.baselines.remove(target)
+}
@@ -0,0 +1,118 @@
+package filters
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBaseline(t *testing.T) {
+	_, err := NewBaseline(BaselineConfig{Alpha: 0.1, Threshold: 0})
+	assert.Error(t, err)
+
+	baseline, err := NewBaseline(BaselineConfig{Alpha: 0.2, Threshold: 3, Warmup: 5, MinDeviation: 1})
+	require.NoError(t, err)
+	start := time.Now()
+	at := func(i int) time.Time {
+		return start.Add(time.Duration(i) * time.Second)
+	}
+
+	// No value is anomalous during the warmup
+	assert.False(t, baseline.Add(at(0), 10))
+	assert.False(t, baseline.Add(at(1), 100))
+	for i := 2; i < 20; i++ {
+		assert.False(t, baseline.Add(at(i), float64(10+i%2)), "value %d", i)
+	}
+	_, ok := baseline.Anomaly()
+	assert.False(t, ok)
+
+	// A spike is anomalous until the values are back to the baseline, it doesn't change the baseline
+	assert.True(t, baseline.Add(at(20), 500))
+	assert.True(t, baseline.Add(at(21), 400))
+	anomaly, ok := baseline.Anomaly()
+	require.True(t, ok)
+	assert.Equal(t, at(20), anomaly.Since)
+	assert.Equal(t, 400.0, anomaly.Value)
+	assert.Greater(t, anomaly.StdDev, 0.0)
+	assert.InDelta(t, 10.5, anomaly.Mean, 5)
+	mean := anomaly.Mean
+
+	assert.False(t, baseline.Add(at(22), 10))
+	_, ok = baseline.Anomaly()
+	assert.False(t, ok)
+	assert.True(t, baseline.Add(at(23), 500))
+	anomaly, _ = baseline.Anomaly()
+	assert.Equal(t, at(23), anomaly.Since)
+	assert.InDelta(t, mean, anomaly.Mean, 1)
+}
+
+func TestBaseline_MinDeviation(t *testing.T) {
+	baseline, err := NewBaseline(BaselineConfig{Alpha: 0.2, Threshold: 3, MinDeviation: 5})
+	require.NoError(t, err)
+	start := time.Now()
+
+	// A flat baseline has no variance, only the deviations larger than MinDeviation are anomalous
+	for i := range 10 {
+		assert.False(t, baseline.Add(start.Add(time.Duration(i)*time.Second), 0))
+	}
+	assert.False(t, baseline.Add(start.Add(10*time.Second), 4))
+	assert.True(t, baseline.Add(start.Add(11*time.Second), 6))
+}
+
+func TestAnomalyDetector(t *testing.T) {
+	_, err := NewAnomalyDetector(map[string]BaselineConfig{"cpu": {}})
+	assert.Error(t, err)
+
+	detector, err := NewAnomalyDetector(map[string]BaselineConfig{"cpu": {Alpha: 0.5, Threshold: 3, MinDeviation: 1}})
+	require.NoError(t, err)
+	start := time.Now()
+	detector.Add("1", "cpu", start, 0)
+	detector.Add("2", "cpu", start, 0)
+	assert.False(t, detector.Add("1", "memory", start, 0))
+	assert.Empty(t, detector.Anomalies())
+
+	assert.True(t, detector.Add("1", "cpu", start.Add(time.Second), 100))
+	assert.False(t, detector.Add("2", "cpu", start.Add(time.Second), 0))
+	anomalies := detector.Anomalies()
+	require.Len(t, anomalies, 1)
+	assert.Equal(t, 100.0, anomalies["1"]["cpu"].Value)
+
+	// The anomaly ends once the metric is absent, the next anomalous value starts a new one
+	detector.ClearAbsent(map[string]map[string]float64{"2": {"cpu": 0}})
+	assert.Empty(t, detector.Anomalies())
+	assert.True(t, detector.Add("1", "cpu", start.Add(2*time.Second), 100))
+	assert.Equal(t, start.Add(2*time.Second), detector.Anomalies()["1"]["cpu"].Since)
+
+	detector.Remove("1")
+	assert.Empty(t, detector.Anomalies())
+}
+
+func TestBaseline_RebaselineAfter(t *testing.T) {
+	baseline, err := NewBaseline(BaselineConfig{Alpha: 0.2, Threshold: 3, Warmup: 5, MinDeviation: 1, RebaselineAfter: 3})
+	require.NoError(t, err)
+	start := time.Now()
+	at := func(i int) time.Time {
+		return start.Add(time.Duration(i) * time.Second)
+	}
+	for i := range 10 {
+		assert.False(t, baseline.Add(at(i), float64(10+i%2)))
+	}
+
+	// The level shifts to 100: the values are anomalous until the baseline is rebuilt from them
+	assert.True(t, baseline.Add(at(10), 100))
+	assert.True(t, baseline.Add(at(11), 101))
+	assert.False(t, baseline.Add(at(12), 100))
+	_, ok := baseline.Anomaly()
+	assert.False(t, ok)
+	// The rebuilt baseline warms up again
+	assert.False(t, baseline.Add(at(13), 101))
+	assert.False(t, baseline.Add(at(14), 100))
+
+	// The former level is now anomalous
+	assert.True(t, baseline.Add(at(15), 10))
+	anomaly, ok := baseline.Anomaly()
+	require.True(t, ok)
+	assert.InDelta(t, 100.5, anomaly.Mean, 1)
+}
@@ -3,7 +3,6 @@ package filters
 import (
 	"context"
 	"fmt"
-	"math"
 	"sync"
 	"time"
 
@@ -25,8 +24,7 @@ type ExponentialSmoothing struct {
 	queueLength     int
 	stopped         bool
 	stopMutex       *sync.Mutex
-	queueMutex      *sync.Mutex
-	queue           []float64
+	series          *Series
 	lastSampleTime  time.Time
 	lastAverageTime time.Time
 }
@@ -54,8 +52,6 @@ func NewExponentialSmoothing(from MetricsReader, opts ...ExponentialSmoothingOpt
 		queueLength:     6,
 		stopped:         false,
 		stopMutex:       &sync.Mutex{},
-		queueMutex:      &sync.Mutex{},
-		queue:           make([]float64, 0),
 		lastSampleTime:  time.Now(),
 		lastAverageTime: time.Now(),
 	}
@@ -76,6 +72,13 @@ func NewExponentialSmoothing(from MetricsReader, opts ...ExponentialSmoothingOpt
 
 	}
 
+	// The values are averaged over averageInterval by Start, each average is a sample of the series
+	series, err := NewSeries(SeriesConfig{PointsPerSample: 1, ElementsNeeded: result.queueLength})
+	if err != nil {
+		return nil, err
+	}
+	result.series = series
+
 	return &result, nil
 }
 
@@ -104,7 +107,7 @@ func (e *ExponentialSmoothing) Start(ctx context.Context) {
 			for _, v := range values {
 				result += v
 			}
-			e.appendToQueue(result / float64(len(values)))
+			e.series.Add(result / float64(len(values)))
 			values = make([]float64, 0, e.averageLength)
 			e.lastAverageTime = time.Now()
 		}
@@ -112,25 +115,7 @@ func (e *ExponentialSmoothing) Start(ctx context.Context) {
 }
 
 func (e *ExponentialSmoothing) Read(ctx context.Context) (float64, error) {
-	e.queueMutex.Lock()
-	values := make([]float64, len(e.queue))
-	copy(values, e.queue)
-	e.queueMutex.Unlock()
-	if len(values) < e.queueLength {
-		return 0.0, ErrNotEnoughMetrics
-	}
-
-	alpha := math.Exp(float64(-1 * len(values)))
-
-	return exponentialSmoothing(values, len(values)-1, alpha), nil
-}
-
-func exponentialSmoothing(values []float64, ptr int, alpha float64) float64 {
-	if ptr <= 0 {
-		return values[0]
-	}
-
-	return alpha*values[ptr] + ((1.0 - alpha) * exponentialSmoothing(values, ptr-1, alpha))
+	return e.series.Read()
 }
 
 func (e *ExponentialSmoothing) waitForNextSample() {
@@ -145,16 +130,6 @@ func (e *ExponentialSmoothing) waitForNextSample() {
 	e.lastSampleTime = time.Now()
 }
 
-func (e *ExponentialSmoothing) appendToQueue(value float64) {
-	e.queueMutex.Lock()
-	defer e.queueMutex.Unlock()
-
-	e.queue = append(e.queue, value)
-	if len(e.queue) > e.queueLength {
-		e.queue = e.queue[len(e.queue)-e.queueLength:]
-	}
-}
-
 func (e ExponentialSmoothing) isStopped() bool {
 	e.stopMutex.Lock()
 	defer e.stopMutex.Unlock()
@@ -0,0 +1,157 @@
+package filters
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// HoltConfig configures the double exponential smoothing of a metric: Alpha is the smoothing factor
+// of the level and Beta the one of the trend, both in ]0, 1]. The higher they are, the faster the
+// forecast follows the last values.
+type HoltConfig struct {
+	Alpha float64
+	Beta  float64
+}
+
+func (c HoltConfig) validate() error {
+	if c.Alpha <= 0 || c.Alpha > 1 {
+		return fmt.Errorf("alpha should be in ]0, 1], current value: %v", c.Alpha)
+	}
+	if c.Beta <= 0 || c.Beta > 1 {
+		return fmt.Errorf("beta should be in ]0, 1], current value: %v", c.Beta)
+	}
+	return nil
+}
+
+// Forecast is the state of a Holt series after its last value
+type Forecast struct {
+	// At is the time of the last value
+	At time.Time
+	// Level is the smoothed value at At
+	Level float64
+	// Trend is the smoothed growth of the value, per second
+	Trend float64
+}
+
+// TimeUntil returns the time from At after which the forecast value reaches threshold, and false
+// if it never does with the current trend
+func (f Forecast) TimeUntil(threshold float64) (time.Duration, bool) {
+	if f.Level >= threshold {
+		return 0, true
+	}
+	if f.Trend <= 0 {
+		return 0, false
+	}
+	seconds := (threshold - f.Level) / f.Trend
+	if seconds >= math.MaxInt64/float64(time.Second) {
+		return 0, false
+	}
+	return time.Duration(seconds * float64(time.Second)), true
+}
+
+// Holt forecasts a metric with a double exponential smoothing (Holt's linear trend method). The
+// values may be added at irregular intervals, the trend is a growth per second.
+type Holt struct {
+	config HoltConfig
+
+	mutex    *sync.Mutex
+	points   int
+	forecast Forecast
+}
+
+func NewHolt(config HoltConfig) (*Holt, error) {
+	err := config.validate()
+	if err != nil {
+		return nil, err
+	}
+	return &Holt{
+		config: config,
+		mutex:  &sync.Mutex{},
+	}, nil
+}
+
+// Add updates the level and the trend with the value of the metric at the given time. The values
+// must be added in chronological order, a value which isn't more recent than the previous one is
+// ignored.
+func (h *Holt) Add(at time.Time, value float64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.points == 0 {
+		h.forecast = Forecast{At: at, Level: value}
+		h.points++
+		return
+	}
+	elapsed := at.Sub(h.forecast.At).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	if h.points == 1 {
+		// The trend is initialized with the growth between the two first values
+		h.forecast = Forecast{At: at, Level: value, Trend: (value - h.forecast.Level) / elapsed}
+		h.points++
+		return
+	}
+
+	previous := h.forecast
+	level := h.config.Alpha*value + (1-h.config.Alpha)*(previous.Level+previous.Trend*elapsed)
+	trend := h.config.Beta*(level-previous.Level)/elapsed + (1-h.config.Beta)*previous.Trend
+	h.forecast = Forecast{At: at, Level: level, Trend: trend}
+	h.points++
+}
+
+// Forecast returns the level and the trend after the last value, or ErrNotEnoughMetrics until two
+// values have been added
+func (h *Holt) Forecast() (Forecast, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.points < 2 {
+		return Forecast{}, ErrNotEnoughMetrics
+	}
+	return h.forecast, nil
+}
+
+// ForecastMetrics keeps a Holt series per target and per metric. The series of a target are
+// created when its first value is added and destroyed by Remove.
+type ForecastMetrics struct {
+	config HoltConfig
+	series targetsSeries[*Holt]
+}
+
+func NewForecastMetrics(config HoltConfig) (*ForecastMetrics, error) {
+	err := config.validate()
+	if err != nil {
+		return nil, err
+	}
+	return &ForecastMetrics{
+		config: config,
+		series: newTargetsSeries[*Holt](),
+	}, nil
+}
+
+// Add updates the forecast of the metric of a target with its value at the given time
+func (m *ForecastMetrics) Add(target, metric string, at time.Time, value float64) {
+	series := m.series.getOrCreate(target, metric, func() *Holt {
+		// The configuration has been validated by NewForecastMetrics
+		series, _ := NewHolt(m.config)
+		return series
+	})
+	series.Add(at, value)
+}
+
+// Forecast returns the forecast of the metric of a target, or ErrNotEnoughMetrics if not enough
+// values have been added yet
+func (m *ForecastMetrics) Forecast(target, metric string) (Forecast, error) {
+	series, ok := m.series.get(target, metric)
+	if !ok {
+		return Forecast{}, ErrNotEnoughMetrics
+	}
+	return series.Forecast()
+}
+
+// Remove destroys the series of a target
+func (m *ForecastMetrics) Remove(target string) {
+	m.series.remove(target)
+}
@@ -0,0 +1,85 @@
+package filters
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHolt(t *testing.T) {
+	_, err := NewHolt(HoltConfig{Alpha: 0, Beta: 0.5})
+	assert.Error(t, err)
+	_, err = NewHolt(HoltConfig{Alpha: 0.5, Beta: 1.5})
+	assert.Error(t, err)
+
+	holt, err := NewHolt(HoltConfig{Alpha: 0.5, Beta: 0.5})
+	require.NoError(t, err)
+	start := time.Now()
+	holt.Add(start, 100)
+	_, err = holt.Forecast()
+	assert.ErrorIs(t, err, ErrNotEnoughMetrics)
+
+	// A linear growth of 10 per second is followed exactly, whatever the interval between the values
+	for i, seconds := range []int{10, 20, 25, 40} {
+		holt.Add(start.Add(time.Duration(seconds)*time.Second), float64(100+10*seconds))
+		forecast, err := holt.Forecast()
+		require.NoError(t, err, "value %d", i)
+		assert.InDelta(t, float64(100+10*seconds), forecast.Level, 0.0001)
+		assert.InDelta(t, 10, forecast.Trend, 0.0001)
+	}
+	// A value older than the last one is ignored
+	holt.Add(start, 0)
+	forecast, err := holt.Forecast()
+	require.NoError(t, err)
+	assert.Equal(t, start.Add(40*time.Second), forecast.At)
+
+	until, ok := forecast.TimeUntil(1000)
+	assert.True(t, ok)
+	assert.Equal(t, 50*time.Second, until.Round(time.Millisecond))
+
+	// The trend decreases as the metric stops growing
+	holt.Add(start.Add(50*time.Second), 500)
+	holt.Add(start.Add(60*time.Second), 500)
+	forecast, err = holt.Forecast()
+	require.NoError(t, err)
+	assert.Less(t, forecast.Trend, 10.0)
+}
+
+func TestForecast_TimeUntil(t *testing.T) {
+	until, ok := Forecast{Level: 10, Trend: 0}.TimeUntil(20)
+	assert.False(t, ok)
+	assert.Zero(t, until)
+
+	_, ok = Forecast{Level: 10, Trend: -1}.TimeUntil(20)
+	assert.False(t, ok)
+
+	until, ok = Forecast{Level: 30, Trend: -1}.TimeUntil(20)
+	assert.True(t, ok)
+	assert.Zero(t, until)
+
+	_, ok = Forecast{Level: 0, Trend: 1e-12}.TimeUntil(1e18)
+	assert.False(t, ok)
+}
+
+func TestForecastMetrics(t *testing.T) {
+	_, err := NewForecastMetrics(HoltConfig{})
+	assert.Error(t, err)
+
+	metrics, err := NewForecastMetrics(HoltConfig{Alpha: 0.5, Beta: 0.5})
+	require.NoError(t, err)
+	start := time.Now()
+	metrics.Add("1", "memory", start, 10)
+	metrics.Add("1", "memory", start.Add(time.Second), 20)
+
+	forecast, err := metrics.Forecast("1", "memory")
+	require.NoError(t, err)
+	assert.InDelta(t, 10, forecast.Trend, 0.0001)
+	_, err = metrics.Forecast("2", "memory")
+	assert.ErrorIs(t, err, ErrNotEnoughMetrics)
+
+	metrics.Remove("1")
+	_, err = metrics.Forecast("1", "memory")
+	assert.ErrorIs(t, err, ErrNotEnoughMetrics)
+}
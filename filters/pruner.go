@@ -0,0 +1,36 @@
+package filters
+
+import (
+	"context"
+
+	"github.com/Scalingo/acadock-monitoring/v2/docker"
+)
+
+// Remover is implemented by the filters keeping a state per target
+type Remover interface {
+	// Remove destroys the state of a target
+	Remove(target string)
+}
+
+// ContainersPruner destroys the state of the containers in every remover as they stop, with a
+// single subscription to the containers events
+type ContainersPruner struct {
+	containers docker.ContainerRepository
+	removers   []Remover
+}
+
+func NewContainersPruner(containers docker.ContainerRepository, removers ...Remover) ContainersPruner {
+	return ContainersPruner{containers: containers, removers: removers}
+}
+
+// Start removes the containers from the removers as they stop, until the context is canceled
+func (p ContainersPruner) Start(ctx context.Context) {
+	for event := range p.containers.RegisterToContainersStream(ctx) {
+		if event.Action != docker.ContainerActionStop {
+			continue
+		}
+		for _, remover := range p.removers {
+			remover.Remove(event.ContainerID)
+		}
+	}
+}
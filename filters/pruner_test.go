@@ -0,0 +1,34 @@
+package filters
+
+import (
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Scalingo/acadock-monitoring/v2/docker"
+	"github.com/Scalingo/acadock-monitoring/v2/docker/dockermock"
+)
+
+type removedTargets []string
+
+func (r *removedTargets) Remove(target string) {
+	*r = append(*r, target)
+}
+
+func TestContainersPruner(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	containers := dockermock.NewMockContainerRepository(ctrl)
+	events := make(chan docker.ContainerEvent, 3)
+	containers.EXPECT().RegisterToContainersStream(gomock.Any()).Return((<-chan docker.ContainerEvent)(events))
+
+	var first, second removedTargets
+	events <- docker.ContainerEvent{ContainerID: "1", Action: docker.ContainerActionStart}
+	events <- docker.ContainerEvent{ContainerID: "2", Action: docker.ContainerActionStop}
+	events <- docker.ContainerEvent{ContainerID: "1", Action: docker.ContainerActionStop}
+	close(events)
+	NewContainersPruner(containers, &first, &second).Start(t.Context())
+
+	assert.Equal(t, removedTargets{"2", "1"}, first)
+	assert.Equal(t, removedTargets{"2", "1"}, second)
+}
@@ -0,0 +1,95 @@
+package filters
+
+import (
+	"fmt"
+	"math"
+	"sync"
+)
+
+// SeriesConfig configures the smoothing of a metric: every PointsPerSample values are averaged into
+// a sample, the smoothed value is computed from the last ElementsNeeded samples.
+type SeriesConfig struct {
+	PointsPerSample int
+	ElementsNeeded  int
+}
+
+func (c SeriesConfig) validate() error {
+	if c.PointsPerSample <= 0 {
+		return fmt.Errorf("PointsPerSample should be >0, current value: %v", c.PointsPerSample)
+	}
+	if c.ElementsNeeded <= 0 {
+		return fmt.Errorf("ElementsNeeded should be >0, current value: %v", c.ElementsNeeded)
+	}
+	return nil
+}
+
+// Series exponentially smooths the values of a metric pushed at a regular interval, e.g. at every
+// collection. Contrary to ExponentialSmoothing, it doesn't read the metric by itself.
+type Series struct {
+	config SeriesConfig
+
+	mutex  *sync.Mutex
+	points []float64
+	queue  []float64
+}
+
+func NewSeries(config SeriesConfig) (*Series, error) {
+	err := config.validate()
+	if err != nil {
+		return nil, err
+	}
+	return &Series{
+		config: config,
+		mutex:  &sync.Mutex{},
+		points: make([]float64, 0, config.PointsPerSample),
+		queue:  make([]float64, 0, config.ElementsNeeded),
+	}, nil
+}
+
+// Add pushes a new value of the metric, a sample is added to the queue every PointsPerSample values
+func (s *Series) Add(value float64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.points = append(s.points, value)
+	if len(s.points) < s.config.PointsPerSample {
+		return
+	}
+	var sum float64
+	for _, point := range s.points {
+		sum += point
+	}
+	s.points = s.points[:0]
+	s.appendSample(sum / float64(s.config.PointsPerSample))
+}
+
+// Read returns the smoothed value, or ErrNotEnoughMetrics until ElementsNeeded samples have been
+// added
+func (s *Series) Read() (float64, error) {
+	s.mutex.Lock()
+	values := make([]float64, len(s.queue))
+	copy(values, s.queue)
+	s.mutex.Unlock()
+	if len(values) < s.config.ElementsNeeded {
+		return 0.0, ErrNotEnoughMetrics
+	}
+
+	alpha := math.Exp(float64(-1 * len(values)))
+
+	return exponentialSmoothing(values, len(values)-1, alpha), nil
+}
+
+func (s *Series) appendSample(sample float64) {
+	s.queue = append(s.queue, sample)
+	if len(s.queue) > s.config.ElementsNeeded {
+		s.queue = s.queue[len(s.queue)-s.config.ElementsNeeded:]
+	}
+}
+
+func exponentialSmoothing(values []float64, ptr int, alpha float64) float64 {
+	if ptr <= 0 {
+		return values[0]
+	}
+
+	return alpha*values[ptr] + ((1.0 - alpha) * exponentialSmoothing(values, ptr-1, alpha))
+}
@@ -0,0 +1,66 @@
+package filters
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeries(t *testing.T) {
+	_, err := NewSeries(SeriesConfig{PointsPerSample: 0, ElementsNeeded: 6})
+	assert.Error(t, err)
+
+	series, err := NewSeries(SeriesConfig{PointsPerSample: 2, ElementsNeeded: 2})
+	require.NoError(t, err)
+
+	// Every 2 values are averaged into a sample
+	series.Add(1)
+	series.Add(3)
+	series.Add(10)
+	_, err = series.Read()
+	assert.ErrorIs(t, err, ErrNotEnoughMetrics)
+
+	series.Add(20)
+	value, err := series.Read()
+	require.NoError(t, err)
+	alpha := 0.1353352832366127 // exp(-2)
+	assert.InDelta(t, alpha*15+(1-alpha)*2, value, 0.0001)
+
+	// Only the last ElementsNeeded samples are kept
+	series.Add(15)
+	series.Add(15)
+	value, err = series.Read()
+	require.NoError(t, err)
+	assert.InDelta(t, 15, value, 0.0001)
+}
+
+func TestSmoothedMetrics(t *testing.T) {
+	_, err := NewSmoothedMetrics(map[string]SeriesConfig{"cpu": {PointsPerSample: 1}})
+	assert.Error(t, err)
+
+	metrics, err := NewSmoothedMetrics(map[string]SeriesConfig{"cpu": {PointsPerSample: 1, ElementsNeeded: 1}})
+	require.NoError(t, err)
+	assert.True(t, metrics.IsSmoothed("cpu"))
+	assert.False(t, metrics.IsSmoothed("memory"))
+
+	metrics.Add("1", "cpu", 10)
+	metrics.Add("2", "cpu", 20)
+	// The metrics which are not configured are ignored
+	metrics.Add("3", "memory", 30)
+	assert.Equal(t, 2, metrics.Targets())
+
+	value, err := metrics.Read("1", "cpu")
+	require.NoError(t, err)
+	assert.InDelta(t, 10, value, 0.0001)
+	_, err = metrics.Read("3", "memory")
+	assert.ErrorIs(t, err, ErrNotEnoughMetrics)
+
+	metrics.Remove("1")
+	assert.Equal(t, 1, metrics.Targets())
+	_, err = metrics.Read("1", "cpu")
+	assert.ErrorIs(t, err, ErrNotEnoughMetrics)
+	value, err = metrics.Read("2", "cpu")
+	require.NoError(t, err)
+	assert.InDelta(t, 20, value, 0.0001)
+}
@@ -0,0 +1,68 @@
+package filters
+
+import (
+	"fmt"
+)
+
+// SmoothedMetrics keeps a Series per target and per metric. The series of a target are created when
+// its first value is added and destroyed by Remove. The metrics absent from the configuration are
+// not smoothed.
+type SmoothedMetrics struct {
+	configs map[string]SeriesConfig
+	series  targetsSeries[*Series]
+}
+
+// NewSmoothedMetrics returns the smoothed metrics configured by configs, indexed by metric
+func NewSmoothedMetrics(configs map[string]SeriesConfig) (*SmoothedMetrics, error) {
+	for metric, config := range configs {
+		err := config.validate()
+		if err != nil {
+			return nil, fmt.Errorf("invalid configuration of metric %s: %w", metric, err)
+		}
+	}
+	return &SmoothedMetrics{
+		configs: configs,
+		series:  newTargetsSeries[*Series](),
+	}, nil
+}
+
+// IsSmoothed returns whether the metric is configured to be smoothed
+func (m *SmoothedMetrics) IsSmoothed(metric string) bool {
+	_, ok := m.configs[metric]
+	return ok
+}
+
+// Add pushes a new value of the metric of a target
+func (m *SmoothedMetrics) Add(target, metric string, value float64) {
+	config, ok := m.configs[metric]
+	if !ok {
+		return
+	}
+
+	series := m.series.getOrCreate(target, metric, func() *Series {
+		// The configuration has been validated by NewSmoothedMetrics
+		series, _ := NewSeries(config)
+		return series
+	})
+	series.Add(value)
+}
+
+// Read returns the smoothed value of the metric of a target, or ErrNotEnoughMetrics if not enough
+// values have been added yet
+func (m *SmoothedMetrics) Read(target, metric string) (float64, error) {
+	series, ok := m.series.get(target, metric)
+	if !ok {
+		return 0.0, ErrNotEnoughMetrics
+	}
+	return series.Read()
+}
+
+// Remove destroys the series of a target
+func (m *SmoothedMetrics) Remove(target string) {
+	m.series.remove(target)
+}
+
+// Targets returns the number of targets having at least one series
+func (m *SmoothedMetrics) Targets() int {
+	return m.series.len()
+}
@@ -0,0 +1,68 @@
+package filters
+
+import (
+	"sync"
+)
+
+// targetsSeries keeps a series per target and per metric, the series of a target are created when
+// they are first used and destroyed all at once
+type targetsSeries[T any] struct {
+	mutex *sync.RWMutex
+	// series is indexed by target then by metric
+	series map[string]map[string]T
+}
+
+func newTargetsSeries[T any]() targetsSeries[T] {
+	return targetsSeries[T]{
+		mutex:  &sync.RWMutex{},
+		series: map[string]map[string]T{},
+	}
+}
+
+// getOrCreate returns the series of the metric of a target, it is created if it doesn't exist yet
+func (t targetsSeries[T]) getOrCreate(target, metric string, create func() T) T {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	targetSeries, ok := t.series[target]
+	if !ok {
+		targetSeries = map[string]T{}
+		t.series[target] = targetSeries
+	}
+	series, ok := targetSeries[metric]
+	if !ok {
+		series = create()
+		targetSeries[metric] = series
+	}
+	return series
+}
+
+func (t targetsSeries[T]) get(target, metric string) (T, bool) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	series, ok := t.series[target][metric]
+	return series, ok
+}
+
+func (t targetsSeries[T]) remove(target string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	delete(t.series, target)
+}
+
+func (t targetsSeries[T]) len() int {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return len(t.series)
+}
+
+// each calls f for every series, the series must not be created or removed by f
+func (t targetsSeries[T]) each(f func(target, metric string, series T)) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	for target, targetSeries := range t.series {
+		for metric, series := range targetSeries {
+			f(target, metric, series)
+		}
+	}
+}
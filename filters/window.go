@@ -0,0 +1,156 @@
+package filters
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// WindowStats are the statistics of the values of a metric over a time window
+type WindowStats struct {
+	// Count is the number of values in the window
+	Count int
+	Min   float64
+	Max   float64
+	Mean  float64
+	P50   float64
+	P90   float64
+	P99   float64
+}
+
+type windowPoint struct {
+	at    time.Time
+	value float64
+}
+
+// Window keeps the values of a metric added during the last retention period, to compute their
+// statistics over any window shorter than this period
+type Window struct {
+	retention time.Duration
+
+	mutex  *sync.Mutex
+	points []windowPoint
+}
+
+func NewWindow(retention time.Duration) *Window {
+	return &Window{
+		retention: retention,
+		mutex:     &sync.Mutex{},
+	}
+}
+
+// Add appends the value of the metric at the given time, the values older than the retention period
+// are dropped. The values must be added in chronological order.
+func (w *Window) Add(at time.Time, value float64) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.points = append(w.points, windowPoint{at: at, value: value})
+	expired := 0
+	for expired < len(w.points) && !w.points[expired].at.After(at.Add(-w.retention)) {
+		expired++
+	}
+	w.points = slices.Delete(w.points, 0, expired)
+}
+
+// Stats returns the statistics of the values added in the window of the given length ending at end,
+// or ErrNotEnoughMetrics if there is none
+func (w *Window) Stats(end time.Time, length time.Duration) (WindowStats, error) {
+	w.mutex.Lock()
+	values := make([]float64, 0, len(w.points))
+	for _, point := range w.points {
+		if point.at.After(end.Add(-length)) && !point.at.After(end) {
+			values = append(values, point.value)
+		}
+	}
+	w.mutex.Unlock()
+	if len(values) == 0 {
+		return WindowStats{}, ErrNotEnoughMetrics
+	}
+
+	slices.Sort(values)
+	var sum float64
+	for _, value := range values {
+		sum += value
+	}
+	return WindowStats{
+		Count: len(values),
+		Min:   values[0],
+		Max:   values[len(values)-1],
+		Mean:  sum / float64(len(values)),
+		P50:   percentile(values, 50),
+		P90:   percentile(values, 90),
+		P99:   percentile(values, 99),
+	}, nil
+}
+
+// percentile returns the nearest-rank percentile of sorted values
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank-1, 0)]
+}
+
+// WindowedMetrics keeps a Window per target and per metric. The windows of a target are created
+// when its first value is added and destroyed by Remove. The windows end at the time of the last
+// value added to any of them, so that the statistics are consistent whatever the clock of the values.
+type WindowedMetrics struct {
+	retention time.Duration
+	windows   targetsSeries[*Window]
+
+	lastMutex *sync.RWMutex
+	last      time.Time
+}
+
+// NewWindowedMetrics returns the windowed metrics keeping the values added during the last
+// retention period
+func NewWindowedMetrics(retention time.Duration) *WindowedMetrics {
+	return &WindowedMetrics{
+		retention: retention,
+		windows:   newTargetsSeries[*Window](),
+		lastMutex: &sync.RWMutex{},
+	}
+}
+
+// Add appends the value of the metric of a target at the given time
+func (m *WindowedMetrics) Add(target, metric string, at time.Time, value float64) {
+	window := m.windows.getOrCreate(target, metric, func() *Window {
+		return NewWindow(m.retention)
+	})
+	window.Add(at, value)
+
+	m.lastMutex.Lock()
+	if at.After(m.last) {
+		m.last = at
+	}
+	m.lastMutex.Unlock()
+}
+
+// Stats returns the statistics of the metric of a target over the last length, or
+// ErrNotEnoughMetrics if no value has been added during this period
+func (m *WindowedMetrics) Stats(target, metric string, length time.Duration) (WindowStats, error) {
+	return m.StatsBefore(target, metric, length, 0)
+}
+
+// StatsBefore returns the statistics of the metric of a target over the window of the given length
+// ending offset before the last value, e.g. the window preceding the last one if offset is length
+func (m *WindowedMetrics) StatsBefore(target, metric string, length, offset time.Duration) (WindowStats, error) {
+	window, ok := m.windows.get(target, metric)
+	if !ok {
+		return WindowStats{}, ErrNotEnoughMetrics
+	}
+	m.lastMutex.RLock()
+	end := m.last.Add(-offset)
+	m.lastMutex.RUnlock()
+	return window.Stats(end, length)
+}
+
+// Remove destroys the windows of a target
+func (m *WindowedMetrics) Remove(target string) {
+	m.windows.remove(target)
+}
+
+// Targets returns the number of targets having at least one window
+func (m *WindowedMetrics) Targets() int {
+	return m.windows.len()
+}
@@ -0,0 +1,78 @@
+package filters
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWindow(t *testing.T) {
+	start := time.Now()
+	window := NewWindow(time.Minute)
+	_, err := window.Stats(start, time.Minute)
+	assert.ErrorIs(t, err, ErrNotEnoughMetrics)
+
+	// One value every 10 seconds during 2 minutes: 0, 1, ..., 12
+	for i := range 13 {
+		window.Add(start.Add(time.Duration(i)*10*time.Second), float64(i))
+	}
+	end := start.Add(2 * time.Minute)
+
+	// The values older than the retention period have been dropped
+	stats, err := window.Stats(end, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, WindowStats{Count: 6, Min: 7, Max: 12, Mean: 9.5, P50: 9, P90: 12, P99: 12}, stats)
+
+	stats, err = window.Stats(end, 30*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, WindowStats{Count: 3, Min: 10, Max: 12, Mean: 11, P50: 11, P90: 12, P99: 12}, stats)
+
+	_, err = window.Stats(end.Add(time.Hour), time.Minute)
+	assert.ErrorIs(t, err, ErrNotEnoughMetrics)
+}
+
+func TestPercentile(t *testing.T) {
+	values := make([]float64, 100)
+	for i := range values {
+		values[i] = float64(i + 1)
+	}
+	assert.Equal(t, 50.0, percentile(values, 50))
+	assert.Equal(t, 90.0, percentile(values, 90))
+	assert.Equal(t, 99.0, percentile(values, 99))
+	assert.Equal(t, 1.0, percentile(values[:1], 99))
+}
+
+func TestWindowedMetrics(t *testing.T) {
+	start := time.Now()
+	metrics := NewWindowedMetrics(5 * time.Minute)
+	metrics.Add("1", "cpu", start, 10)
+	metrics.Add("1", "cpu", start.Add(time.Minute), 20)
+	metrics.Add("2", "cpu", start.Add(2*time.Minute), 30)
+	assert.Equal(t, 2, metrics.Targets())
+
+	// The windows end at the last value added to any target
+	stats, err := metrics.Stats("1", "cpu", 90*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.Count)
+	assert.Equal(t, 20.0, stats.Mean)
+	stats, err = metrics.Stats("1", "cpu", 5*time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 15.0, stats.Mean)
+	_, err = metrics.Stats("1", "memory", 5*time.Minute)
+	assert.ErrorIs(t, err, ErrNotEnoughMetrics)
+
+	// The window preceding the last one
+	stats, err = metrics.StatsBefore("1", "cpu", time.Minute, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.Count)
+	assert.Equal(t, 20.0, stats.Mean)
+	_, err = metrics.StatsBefore("1", "cpu", 30*time.Second, 3*time.Minute)
+	assert.ErrorIs(t, err, ErrNotEnoughMetrics)
+
+	metrics.Remove("1")
+	_, err = metrics.Stats("1", "cpu", 5*time.Minute)
+	assert.ErrorIs(t, err, ErrNotEnoughMetrics)
+	assert.Equal(t, 1, metrics.Targets())
+}
@@ -0,0 +1,73 @@
+// Package forecast forecasts the growth of the memory usage of the targets, to warn before they
+// reach their memory limit.
+package forecast
+
+import (
+	"context"
+
+	"github.com/Scalingo/acadock-monitoring/v2/client"
+	"github.com/Scalingo/acadock-monitoring/v2/collector"
+	"github.com/Scalingo/acadock-monitoring/v2/filters"
+	"github.com/Scalingo/acadock-monitoring/v2/resources"
+	"github.com/Scalingo/go-utils/errors/v3"
+)
+
+var _ collector.SnapshotListener = &Monitor{}
+
+// Monitor updates the forecast of the memory usage of the targets with every collected snapshot
+type Monitor struct {
+	metrics *filters.ForecastMetrics
+}
+
+// NewMonitor returns a monitor forecasting the memory usage with the smoothing factors of the level
+// (alpha) and of the trend (beta)
+func NewMonitor(ctx context.Context, alpha, beta float64) (*Monitor, error) {
+	metrics, err := filters.NewForecastMetrics(filters.HoltConfig{Alpha: alpha, Beta: beta})
+	if err != nil {
+		return nil, errors.Wrap(ctx, err, "create forecast metrics")
+	}
+	return &Monitor{metrics: metrics}, nil
+}
+
+// Remove destroys the forecasts of a target
+func (m *Monitor) Remove(target string) {
+	m.metrics.Remove(target)
+}
+
+func (m *Monitor) SnapshotCollected(ctx context.Context, previous *collector.Snapshot, current *collector.Snapshot, _ collector.Gauges) {
+	for id, sample := range current.Targets {
+		if memory, ok := collector.Value[client.MemoryUsage](sample, resources.MemoryCollectorName); ok {
+			m.metrics.Add(id, resources.MemoryCollectorName, current.Time, float64(memory.MemoryUsage))
+		}
+	}
+}
+
+// SecondsUntilMemoryLimit returns the forecast time between the last collection and the memory
+// usage of a target reaching limit, and false if it isn't expected to reach it
+func (m *Monitor) SecondsUntilMemoryLimit(id string, limit uint64) (int64, bool) {
+	if !resources.IsMemoryLimited(limit) {
+		return 0, false
+	}
+	forecast, err := m.metrics.Forecast(id, resources.MemoryCollectorName)
+	if err != nil {
+		return 0, false
+	}
+	until, ok := forecast.TimeUntil(float64(limit))
+	if !ok {
+		return 0, false
+	}
+	return int64(until.Seconds()), true
+}
+
+// AddMemoryForecast fills the growth rate and the time until the limit of the memory usage of a
+// target
+func (m *Monitor) AddMemoryForecast(id string, usage *client.MemoryUsage) {
+	forecast, err := m.metrics.Forecast(id, resources.MemoryCollectorName)
+	if err != nil {
+		return
+	}
+	usage.GrowthRate = &forecast.Trend
+	if seconds, ok := m.SecondsUntilMemoryLimit(id, usage.MemoryLimit); ok {
+		usage.SecondsUntilLimit = &seconds
+	}
+}
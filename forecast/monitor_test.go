@@ -0,0 +1,57 @@
+package forecast
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Scalingo/acadock-monitoring/v2/client"
+	"github.com/Scalingo/acadock-monitoring/v2/collector"
+	"github.com/Scalingo/acadock-monitoring/v2/collector/collectortest"
+	"github.com/Scalingo/acadock-monitoring/v2/resources"
+)
+
+func TestMonitor(t *testing.T) {
+	ctx := t.Context()
+
+	_, err := NewMonitor(ctx, 0, 0.5)
+	assert.Error(t, err)
+	monitor, err := NewMonitor(ctx, 0.5, 0.5)
+	require.NoError(t, err)
+
+	// The memory usage of the container 1 grows by 1MB every 10 seconds, the one of the container 2
+	// is stable
+	series := collectortest.Series{Start: time.Now(), Interval: 10 * time.Second, Targets: func(i int) map[string]collector.Sample {
+		return map[string]collector.Sample{
+			"1": {resources.MemoryCollectorName: client.MemoryUsage{MemoryUsage: uint64(i) * 1000000}},
+			"2": {resources.MemoryCollectorName: client.MemoryUsage{MemoryUsage: 1000000}},
+		}
+	}}
+	series.Notify(ctx, monitor, 5, nil)
+
+	usage := client.MemoryUsage{MemoryUsage: 4000000, MemoryLimit: 10000000}
+	monitor.AddMemoryForecast("1", &usage)
+	require.NotNil(t, usage.GrowthRate)
+	assert.InDelta(t, 100000, *usage.GrowthRate, 0.001)
+	require.NotNil(t, usage.SecondsUntilLimit)
+	assert.Equal(t, int64(60), *usage.SecondsUntilLimit)
+
+	usage = client.MemoryUsage{MemoryUsage: 1000000, MemoryLimit: 10000000}
+	monitor.AddMemoryForecast("2", &usage)
+	require.NotNil(t, usage.GrowthRate)
+	assert.Zero(t, *usage.GrowthRate)
+	assert.Nil(t, usage.SecondsUntilLimit)
+
+	// The memory of a container without limit can't reach it
+	_, ok := monitor.SecondsUntilMemoryLimit("1", 0)
+	assert.False(t, ok)
+	_, ok = monitor.SecondsUntilMemoryLimit("1", 9223372036854771712)
+	assert.False(t, ok)
+
+	monitor.Remove("1")
+	usage = client.MemoryUsage{MemoryLimit: 10000000}
+	monitor.AddMemoryForecast("1", &usage)
+	assert.Nil(t, usage.GrowthRate)
+}
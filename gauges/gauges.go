@@ -0,0 +1,147 @@
+// Package gauges computes the instantaneous values of the metrics of the host and of the targets
+// from the two last snapshots of the collector, so that they can be aggregated over time.
+package gauges
+
+import (
+	"github.com/Scalingo/acadock-monitoring/v2/cgroup"
+	"github.com/Scalingo/acadock-monitoring/v2/client"
+	"github.com/Scalingo/acadock-monitoring/v2/collector"
+	"github.com/Scalingo/acadock-monitoring/v2/cpu"
+	"github.com/Scalingo/acadock-monitoring/v2/net"
+	"github.com/Scalingo/acadock-monitoring/v2/resources"
+)
+
+// Names of the gauges
+const (
+	// HostCPU is the ratio of the host CPU time spent working
+	HostCPU = cpu.HostCollectorName
+	// CPU is the CPU usage of a target in percents
+	CPU = cpu.CollectorName
+	// CPUThrottled is the percentage of the CFS periods of a target during which it exhausted its
+	// CPU quota, it is absent if the target isn't limited
+	CPUThrottled = "cpu_throttled_percent"
+	Memory       = resources.MemoryCollectorName
+	IOReadBps    = resources.IOCollectorName + "_read_bps"
+	IOWriteBps   = resources.IOCollectorName + "_write_bps"
+	NetRxBps     = net.CollectorName + "_rx_bps"
+	NetTxBps     = net.CollectorName + "_tx_bps"
+)
+
+// HostTarget identifies the gauges of the host, it can't collide with a container ID or a cgroup
+// path
+const HostTarget = "host"
+
+// Values are indexed by target, then by gauge name. They are the gauges the scheduler passes to its
+// listeners.
+type Values = collector.Gauges
+
+// Compute returns the gauges of the host and of the targets of the current snapshot. A gauge which
+// can't be computed, e.g. because its collector failed or because it is computed from counters and
+// the target isn't part of the previous snapshot, is absent.
+func Compute(previous, current *collector.Snapshot) Values {
+	snapshots := snapshotPair{previous: previous, current: current}
+	cpuMonitor := cpu.NewCPUUsageMonitor(snapshots)
+	netMonitor := net.NewNetMonitor(snapshots)
+	values := Values{}
+
+	hostCollected := collected(previous.HostSample(), current.HostSample(), cpu.HostCollectorName)
+	if hostCollected {
+		usage, err := cpuMonitor.GetHostUsage()
+		if err == nil {
+			values[HostTarget] = map[string]float64{HostCPU: usage.Usage}
+		}
+	}
+
+	for id, currentSample := range current.Targets {
+		previousSample, _ := previous.Sample(id)
+		targetValues := map[string]float64{}
+
+		if hostCollected && collected(previousSample, currentSample, cpu.CollectorName) {
+			usage, err := cpuMonitor.GetContainerUsage(id)
+			if err == nil {
+				targetValues[CPU] = float64(usage.UsageInPercents)
+			}
+		}
+		if collected(previousSample, currentSample, cpu.ThrottlingCollectorName) {
+			throttled, ok := throttledPercent(previousSample, currentSample)
+			if ok {
+				targetValues[CPUThrottled] = throttled
+			}
+		}
+		if memory, ok := collector.Value[client.MemoryUsage](currentSample, resources.MemoryCollectorName); ok {
+			targetValues[Memory] = float64(memory.MemoryUsage)
+		}
+		if collected(previousSample, currentSample, resources.IOCollectorName) {
+			readBps, writeBps, ok := ioRates(previous, current, id)
+			if ok {
+				targetValues[IOReadBps] = readBps
+				targetValues[IOWriteBps] = writeBps
+			}
+		}
+		if collected(previousSample, currentSample, net.CollectorName) {
+			usage, err := netMonitor.GetUsage(id)
+			if err == nil {
+				targetValues[NetRxBps] = float64(usage.RxBps)
+				targetValues[NetTxBps] = float64(usage.TxBps)
+			}
+		}
+
+		if len(targetValues) > 0 {
+			values[id] = targetValues
+		}
+	}
+	return values
+}
+
+// ioRates returns the bytes read and written per second by a target between both snapshots, and
+// false if they can't be computed
+func ioRates(previous, current *collector.Snapshot, id string) (float64, float64, bool) {
+	previousSample, _ := previous.Sample(id)
+	currentSample, _ := current.Sample(id)
+	previousIO, _ := collector.Value[client.IOUsage](previousSample, resources.IOCollectorName)
+	currentIO, _ := collector.Value[client.IOUsage](currentSample, resources.IOCollectorName)
+	elapsed := current.Time.Sub(previous.Time).Seconds()
+	if elapsed <= 0 {
+		return 0, 0, false
+	}
+
+	previousRead, previousWrite := resources.IOBytes(previousIO)
+	currentRead, currentWrite := resources.IOBytes(currentIO)
+	// Counters are reset if the container has been restarted
+	if currentRead < previousRead || currentWrite < previousWrite {
+		return 0, 0, false
+	}
+	return float64(currentRead-previousRead) / elapsed, float64(currentWrite-previousWrite) / elapsed, true
+}
+
+// throttledPercent returns the percentage of the periods elapsed between both samples during which
+// the target was throttled, and false if no period elapsed
+func throttledPercent(previous, current collector.Sample) (float64, bool) {
+	previousThrottling, _ := collector.Value[cgroup.CPUThrottling](previous, cpu.ThrottlingCollectorName)
+	currentThrottling, _ := collector.Value[cgroup.CPUThrottling](current, cpu.ThrottlingCollectorName)
+	// Counters are reset if the container has been restarted
+	if currentThrottling.Periods <= previousThrottling.Periods || currentThrottling.ThrottledPeriods < previousThrottling.ThrottledPeriods {
+		return 0, false
+	}
+	periods := currentThrottling.Periods - previousThrottling.Periods
+	throttled := currentThrottling.ThrottledPeriods - previousThrottling.ThrottledPeriods
+	return float64(throttled) / float64(periods) * 100, true
+}
+
+// collected returns whether both samples contain a value of the collector, which is required to
+// compute a usage from counters
+func collected(previous, current collector.Sample, name string) bool {
+	_, inPrevious := previous[name]
+	_, inCurrent := current[name]
+	return inPrevious && inCurrent
+}
+
+// snapshotPair gives the snapshots notified to a listener to the usage monitors
+type snapshotPair struct {
+	previous *collector.Snapshot
+	current  *collector.Snapshot
+}
+
+func (s snapshotPair) Snapshots() (*collector.Snapshot, *collector.Snapshot) {
+	return s.previous, s.current
+}
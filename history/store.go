@@ -0,0 +1,467 @@
+// Package history keeps the gauges of the host and of the targets on disk, to query them after the
+// fact, even after a restart of the daemon.
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Scalingo/acadock-monitoring/v2/client"
+	"github.com/Scalingo/acadock-monitoring/v2/collector"
+	"github.com/Scalingo/acadock-monitoring/v2/gauges"
+	"github.com/Scalingo/go-utils/errors/v3"
+	"github.com/Scalingo/go-utils/logger"
+)
+
+var _ collector.SnapshotListener = &Store{}
+
+// segmentDuration is the period of time covered by a segment file
+const segmentDuration = time.Hour
+
+// compactionInterval is the interval between the downsampling and the expiration of the segments
+const compactionInterval = time.Minute
+
+// entriesQueueSize is the number of entries waiting to be written after which the new ones are
+// dropped, so that a slow disk doesn't block the collection
+const entriesQueueSize = 100
+
+// Directories of the segments in the directory of the store
+const (
+	rawDir         = "raw"
+	downsampledDir = "downsampled"
+)
+
+// entry is the value of the gauges at a given time, or their mean over the resolution starting at
+// this time in the downsampled segments
+type entry struct {
+	Time   time.Time     `json:"time"`
+	Values gauges.Values `json:"values"`
+}
+
+// Store appends the gauges of every collected snapshot to the raw segment of the hour. The segments
+// are sequences of gzip members, one per entry, containing the JSON encoded entry: appending an
+// entry doesn't rewrite the previous ones. The entry being written when the daemon is killed is
+// truncated when the store is created, so that the entries appended after the restart can be read. A
+// segment can be read with `zcat segment | jq`.
+//
+// Once older than the raw retention, a raw segment is replaced by a downsampled segment, containing
+// the mean of the gauges over every period of the resolution. The downsampled segments are deleted
+// once older than the retention.
+type Store struct {
+	dir          string
+	resolution   time.Duration
+	rawRetention time.Duration
+	retention    time.Duration
+
+	entries chan entry
+	// mutex prevents the segments from being read while they are written or replaced
+	mutex *sync.Mutex
+}
+
+// NewStore returns a store keeping its segments in dir, which is created if needed
+func NewStore(ctx context.Context, dir string, resolution, rawRetention, retention time.Duration) (*Store, error) {
+	for _, kind := range []string{rawDir, downsampledDir} {
+		err := os.MkdirAll(filepath.Join(dir, kind), 0o700)
+		if err != nil {
+			return nil, errors.Wrapf(ctx, err, "create %s segments directory", kind)
+		}
+	}
+	s := &Store{
+		dir:          dir,
+		resolution:   resolution,
+		rawRetention: rawRetention,
+		retention:    retention,
+		entries:      make(chan entry, entriesQueueSize),
+		mutex:        &sync.Mutex{},
+	}
+
+	starts, err := s.segments(ctx, rawDir)
+	if err != nil {
+		return nil, errors.Wrap(ctx, err, "list raw segments")
+	}
+	for _, start := range starts {
+		err := repairSegment(ctx, s.segmentPath(rawDir, start))
+		if err != nil {
+			return nil, errors.Wrapf(ctx, err, "repair raw segment of %s", start)
+		}
+	}
+	return s, nil
+}
+
+// Start writes the entries of the collected snapshots and downsamples and expires the segments
+// every minute, until the context is canceled
+func (s *Store) Start(ctx context.Context) {
+	log := logger.Get(ctx).WithField("dir", s.dir)
+
+	tick := time.NewTicker(compactionInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-s.entries:
+			err := s.append(ctx, e)
+			if err != nil {
+				log.WithError(err).Error("Fail to write history entry")
+			}
+		case <-tick.C:
+			err := s.compact(ctx, time.Now())
+			if err != nil {
+				log.WithError(err).Error("Fail to compact history segments")
+			}
+		}
+	}
+}
+
+func (s *Store) SnapshotCollected(ctx context.Context, previous *collector.Snapshot, current *collector.Snapshot, values collector.Gauges) {
+	if len(values) == 0 {
+		return
+	}
+	select {
+	case s.entries <- entry{Time: current.Time, Values: values}:
+	default:
+		logger.Get(ctx).Error("History entries queue is full, drop the entry")
+	}
+}
+
+func (s *Store) segmentPath(kind string, start time.Time) string {
+	return filepath.Join(s.dir, kind, strconv.FormatInt(start.Unix(), 10)+".gz")
+}
+
+// append adds the entry to the raw segment of its hour
+func (s *Store) append(ctx context.Context, e entry) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	file, err := os.OpenFile(s.segmentPath(rawDir, e.Time.Truncate(segmentDuration)), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return errors.Wrap(ctx, err, "open segment")
+	}
+	defer file.Close()
+
+	var member bytes.Buffer
+	writer := gzip.NewWriter(&member)
+	err = json.NewEncoder(writer).Encode(e)
+	if err != nil {
+		return errors.Wrap(ctx, err, "encode entry")
+	}
+	err = writer.Close()
+	if err != nil {
+		return errors.Wrap(ctx, err, "compress entry")
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return errors.Wrap(ctx, err, "stat segment")
+	}
+	_, err = file.Write(member.Bytes())
+	if err != nil {
+		// A partially written entry would prevent the entries appended after it from being read
+		truncateErr := file.Truncate(info.Size())
+		if truncateErr != nil {
+			logger.Get(ctx).WithError(truncateErr).Error("Fail to truncate partially written history entry")
+		}
+		return errors.Wrap(ctx, err, "write entry")
+	}
+	return file.Close()
+}
+
+// compact downsamples the raw segments older than the raw retention and deletes the segments older
+// than the retention. A segment which can't be read is skipped, so that it doesn't prevent the other
+// ones from being compacted, and deleted once older than the retention.
+func (s *Store) compact(ctx context.Context, now time.Time) error {
+	log := logger.Get(ctx)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	starts, err := s.segments(ctx, rawDir)
+	if err != nil {
+		return errors.Wrap(ctx, err, "list raw segments")
+	}
+	for _, start := range starts {
+		if start.Add(segmentDuration).After(now.Add(-s.rawRetention)) {
+			continue
+		}
+		path := s.segmentPath(rawDir, start)
+		if !start.Add(segmentDuration).After(now.Add(-s.retention)) {
+			err = os.Remove(path)
+			if err != nil {
+				return errors.Wrap(ctx, err, "remove raw segment")
+			}
+			continue
+		}
+		entries, err := readSegment(ctx, path)
+		if err != nil {
+			log.WithError(err).WithField("segment", path).Error("Fail to read raw history segment, skip it")
+			continue
+		}
+		err = s.writeSegment(ctx, s.segmentPath(downsampledDir, start), downsample(entries, s.resolution))
+		if err != nil {
+			return errors.Wrapf(ctx, err, "write downsampled segment of %s", path)
+		}
+		err = os.Remove(path)
+		if err != nil {
+			return errors.Wrap(ctx, err, "remove raw segment")
+		}
+	}
+
+	starts, err = s.segments(ctx, downsampledDir)
+	if err != nil {
+		return errors.Wrap(ctx, err, "list downsampled segments")
+	}
+	for _, start := range starts {
+		if start.Add(segmentDuration).After(now.Add(-s.retention)) {
+			continue
+		}
+		err = os.Remove(s.segmentPath(downsampledDir, start))
+		if err != nil {
+			return errors.Wrap(ctx, err, "remove downsampled segment")
+		}
+	}
+	return nil
+}
+
+// segments returns the start of the segments of a kind, sorted
+func (s *Store) segments(ctx context.Context, kind string) ([]time.Time, error) {
+	files, err := os.ReadDir(filepath.Join(s.dir, kind))
+	if err != nil {
+		return nil, errors.Wrap(ctx, err, "read segments directory")
+	}
+	var starts []time.Time
+	for _, file := range files {
+		seconds, err := strconv.ParseInt(strings.TrimSuffix(file.Name(), ".gz"), 10, 64)
+		if err != nil || !strings.HasSuffix(file.Name(), ".gz") {
+			// Temporary files of the downsampled segments being written
+			continue
+		}
+		starts = append(starts, time.Unix(seconds, 0))
+	}
+	slices.SortFunc(starts, time.Time.Compare)
+	return starts, nil
+}
+
+// writeSegment replaces the segment at path with the entries, the segment is only replaced once all
+// of them have been written
+func (s *Store) writeSegment(ctx context.Context, path string, entries []entry) error {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return errors.Wrap(ctx, err, "create temporary segment")
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	writer := gzip.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, e := range entries {
+		err = encoder.Encode(e)
+		if err != nil {
+			return errors.Wrap(ctx, err, "encode entry")
+		}
+	}
+	err = writer.Close()
+	if err != nil {
+		return errors.Wrap(ctx, err, "compress segment")
+	}
+	err = file.Close()
+	if err != nil {
+		return errors.Wrap(ctx, err, "close temporary segment")
+	}
+	err = os.Rename(file.Name(), path)
+	if err != nil {
+		return errors.Wrap(ctx, err, "replace segment")
+	}
+	return nil
+}
+
+// readSegment returns all the entries of a segment, it fails if one of its members is truncated or
+// corrupted
+func readSegment(ctx context.Context, path string) ([]entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(ctx, err, "open segment")
+	}
+	defer file.Close()
+
+	entries, _, err := decodeSegment(file)
+	if err != nil {
+		return nil, errors.Wrapf(ctx, err, "decode entry %d", len(entries))
+	}
+	return entries, nil
+}
+
+// repairSegment truncates a raw segment after its last complete member, the entry being written
+// when the daemon has been killed would otherwise prevent the entries appended after the restart
+// from being read
+func repairSegment(ctx context.Context, path string) error {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return errors.Wrap(ctx, err, "open segment")
+	}
+	defer file.Close()
+
+	entries, end, err := decodeSegment(file)
+	if err == nil {
+		return nil
+	}
+	logger.Get(ctx).WithError(err).WithField("segment", path).Infof("Truncate history segment after its %d complete entries", len(entries))
+	err = file.Truncate(end)
+	if err != nil {
+		return errors.Wrap(ctx, err, "truncate segment")
+	}
+	return file.Close()
+}
+
+// countingReader counts the bytes read. The gzip reader reads an io.ByteReader byte by byte, the
+// count is then the offset of the end of the last member it has read.
+type countingReader struct {
+	reader *bufio.Reader
+	count  int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.count += int64(n)
+	return n, err
+}
+
+func (r *countingReader) ReadByte() (byte, error) {
+	b, err := r.reader.ReadByte()
+	if err == nil {
+		r.count++
+	}
+	return b, err
+}
+
+// decodeSegment returns the entries of the complete members of a segment and the offset of the end
+// of the last of them. It stops at the first truncated or corrupted member and returns its error.
+func decodeSegment(segment io.Reader) ([]entry, int64, error) {
+	reader := &countingReader{reader: bufio.NewReader(segment)}
+	var entries []entry
+	var end int64
+	for {
+		member, err := gzip.NewReader(reader)
+		if err == io.EOF {
+			return entries, end, nil
+		}
+		if err != nil {
+			return entries, end, err
+		}
+		member.Multistream(false)
+
+		// The entries of a member are only kept once its checksum has been verified
+		var memberEntries []entry
+		decoder := json.NewDecoder(member)
+		for {
+			var e entry
+			err := decoder.Decode(&e)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return entries, end, err
+			}
+			memberEntries = append(memberEntries, e)
+		}
+		entries = append(entries, memberEntries...)
+		end = reader.count
+	}
+}
+
+// downsample returns the mean of the gauges of the entries over every period of the resolution,
+// sorted by time
+func downsample(entries []entry, resolution time.Duration) []entry {
+	type sum struct {
+		total float64
+		count int
+	}
+	sums := map[time.Time]map[string]map[string]*sum{}
+	for _, e := range entries {
+		start := e.Time.Truncate(resolution)
+		if sums[start] == nil {
+			sums[start] = map[string]map[string]*sum{}
+		}
+		for target, values := range e.Values {
+			if sums[start][target] == nil {
+				sums[start][target] = map[string]*sum{}
+			}
+			for gauge, value := range values {
+				if sums[start][target][gauge] == nil {
+					sums[start][target][gauge] = &sum{}
+				}
+				sums[start][target][gauge].total += value
+				sums[start][target][gauge].count++
+			}
+		}
+	}
+
+	downsampled := make([]entry, 0, len(sums))
+	for start, targets := range sums {
+		e := entry{Time: start, Values: gauges.Values{}}
+		for target, values := range targets {
+			e.Values[target] = map[string]float64{}
+			for gauge, sum := range values {
+				e.Values[target][gauge] = sum.total / float64(sum.count)
+			}
+		}
+		downsampled = append(downsampled, e)
+	}
+	slices.SortFunc(downsampled, func(a, b entry) int {
+		return a.Time.Compare(b.Time)
+	})
+	return downsampled
+}
+
+// History returns the values of the gauges of a target between from and to, indexed by gauge and
+// sorted by time. Only the gauges listed in names are returned, all of them if it is empty. The
+// values older than the raw retention are the means over the resolution.
+func (s *Store) History(ctx context.Context, target string, names []string, from, to time.Time) (map[string][]client.HistoryPoint, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// Only the existing segments are read, whatever the length of the period. A segment is either raw
+	// or downsampled.
+	paths := map[time.Time]string{}
+	for _, kind := range []string{downsampledDir, rawDir} {
+		starts, err := s.segments(ctx, kind)
+		if err != nil {
+			return nil, errors.Wrapf(ctx, err, "list %s segments", kind)
+		}
+		for _, start := range starts {
+			if start.Add(segmentDuration).After(from) && !start.After(to) {
+				paths[start] = s.segmentPath(kind, start)
+			}
+		}
+	}
+
+	history := map[string][]client.HistoryPoint{}
+	for _, start := range slices.SortedFunc(maps.Keys(paths), time.Time.Compare) {
+		path := paths[start]
+		entries, err := readSegment(ctx, path)
+		if err != nil {
+			return nil, errors.Wrapf(ctx, err, "read segment %s", path)
+		}
+		for _, e := range entries {
+			if e.Time.Before(from) || e.Time.After(to) {
+				continue
+			}
+			for gauge, value := range e.Values[target] {
+				if len(names) == 0 || slices.Contains(names, gauge) {
+					history[gauge] = append(history[gauge], client.HistoryPoint{Time: e.Time, Value: value})
+				}
+			}
+		}
+	}
+	return history, nil
+}
@@ -0,0 +1,131 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Scalingo/acadock-monitoring/v2/client"
+	"github.com/Scalingo/acadock-monitoring/v2/collector"
+	"github.com/Scalingo/acadock-monitoring/v2/gauges"
+	"github.com/Scalingo/acadock-monitoring/v2/resources"
+)
+
+func TestStore(t *testing.T) {
+	ctx := t.Context()
+	dir := t.TempDir()
+	store, err := NewStore(ctx, dir, 5*time.Minute, 30*time.Minute, 24*time.Hour)
+	require.NoError(t, err)
+
+	// The container uses 100 bytes of memory more every minute during 10 minutes
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	for i := range 10 {
+		current := &collector.Snapshot{
+			Time: start.Add(time.Duration(i) * time.Minute),
+			Targets: map[string]collector.Sample{
+				"1": {resources.MemoryCollectorName: client.MemoryUsage{MemoryUsage: uint64(100 * (i + 1))}},
+			},
+		}
+		store.SnapshotCollected(ctx, nil, current, gauges.Compute(nil, current))
+		require.NoError(t, store.append(ctx, <-store.entries))
+	}
+	// A snapshot without any gauge isn't kept
+	store.SnapshotCollected(ctx, nil, &collector.Snapshot{Time: start.Add(10 * time.Minute)}, gauges.Values{})
+	assert.Empty(t, store.entries)
+
+	history, err := store.History(ctx, "1", nil, start.Add(2*time.Minute), start.Add(4*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]client.HistoryPoint{gauges.Memory: {
+		{Time: start.Add(2 * time.Minute), Value: 300},
+		{Time: start.Add(3 * time.Minute), Value: 400},
+		{Time: start.Add(4 * time.Minute), Value: 500},
+	}}, history)
+	history, err = store.History(ctx, "1", []string{gauges.CPU}, start, start.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, history)
+
+	// The entry being written when the daemon has been killed is truncated on restart, the entries
+	// appended after the restart can be read
+	segment, err := os.OpenFile(store.segmentPath(rawDir, start), os.O_WRONLY|os.O_APPEND, 0o600)
+	require.NoError(t, err)
+	_, err = segment.Write([]byte{0x1f, 0x8b, 0x08})
+	require.NoError(t, err)
+	require.NoError(t, segment.Close())
+	store, err = NewStore(ctx, dir, 5*time.Minute, 30*time.Minute, 24*time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, store.append(ctx, entry{
+		Time:   start.Add(10 * time.Minute),
+		Values: gauges.Values{"1": {gauges.Memory: 1100}},
+	}))
+	history, err = store.History(ctx, "1", []string{gauges.Memory}, start, start.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Len(t, history[gauges.Memory], 11)
+
+	// A segment which can't be read doesn't prevent the other ones from being compacted
+	corrupted := store.segmentPath(rawDir, start.Add(time.Hour))
+	require.NoError(t, os.WriteFile(corrupted, []byte{0x1f, 0x8b, 0x08}, 0o600))
+
+	// The segments are only downsampled once older than the raw retention
+	require.NoError(t, store.compact(ctx, start.Add(80*time.Minute)))
+	assert.FileExists(t, store.segmentPath(rawDir, start))
+	require.NoError(t, store.compact(ctx, start.Add(150*time.Minute)))
+	assert.NoFileExists(t, store.segmentPath(rawDir, start))
+	assert.FileExists(t, corrupted)
+	history, err = store.History(ctx, "1", nil, start, start.Add(59*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]client.HistoryPoint{gauges.Memory: {
+		{Time: start, Value: 300},
+		{Time: start.Add(5 * time.Minute), Value: 800},
+		{Time: start.Add(10 * time.Minute), Value: 1100},
+	}}, history)
+	// Only the existing segments are read, however long the period is
+	longHistory, err := store.History(ctx, "1", nil, time.Time{}, start.Add(59*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, history, longHistory)
+
+	// The downsampled segments are deleted once older than the retention
+	require.NoError(t, store.compact(ctx, start.Add(26*time.Hour)))
+	assert.NoFileExists(t, store.segmentPath(downsampledDir, start))
+	assert.NoFileExists(t, corrupted)
+	history, err = store.History(ctx, "1", nil, start, start.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, history)
+
+	files, err := filepath.Glob(filepath.Join(dir, "*", "*"))
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestNewStore_Repair(t *testing.T) {
+	ctx := t.Context()
+	dir := t.TempDir()
+	store, err := NewStore(ctx, dir, 5*time.Minute, 30*time.Minute, 24*time.Hour)
+	require.NoError(t, err)
+
+	// An entry has been appended after a truncated one by a daemon which didn't repair its segments
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, store.append(ctx, entry{Time: start, Values: gauges.Values{"1": {gauges.Memory: 100}}}))
+	segment, err := os.OpenFile(store.segmentPath(rawDir, start), os.O_WRONLY|os.O_APPEND, 0o600)
+	require.NoError(t, err)
+	_, err = segment.Write([]byte{0x1f, 0x8b, 0x08, 0x00})
+	require.NoError(t, err)
+	require.NoError(t, segment.Close())
+	require.NoError(t, store.append(ctx, entry{Time: start.Add(time.Minute), Values: gauges.Values{"1": {gauges.Memory: 200}}}))
+	_, err = store.History(ctx, "1", nil, start, start.Add(time.Hour))
+	require.Error(t, err)
+
+	// The segment is truncated after its last complete entry
+	store, err = NewStore(ctx, dir, 5*time.Minute, 30*time.Minute, 24*time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, store.append(ctx, entry{Time: start.Add(2 * time.Minute), Values: gauges.Values{"1": {gauges.Memory: 300}}}))
+	history, err := store.History(ctx, "1", nil, start, start.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]client.HistoryPoint{gauges.Memory: {
+		{Time: start, Value: 100},
+		{Time: start.Add(2 * time.Minute), Value: 300},
+	}}, history)
+}
@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry_WriteTo(t *testing.T) {
+	registry := NewRegistry()
+	errors := registry.NewCounter("test_errors_total", "Errors by collector", "collector")
+	duration := registry.NewHistogram("test_duration_seconds", "Duration", []float64{0.1, 1}, "route")
+	registry.NewGaugeFunc("test_goroutines", "Goroutines", func() float64 { return 12 })
+
+	errors.Inc("net")
+	errors.Add(2, "cpu")
+	errors.Inc("cpu")
+	duration.Observe(0.05, "/status")
+	duration.Observe(0.5, "/status")
+	duration.Observe(3, "/status")
+	duration.Observe(0.2, `/quote"d`)
+
+	var output strings.Builder
+	n, err := registry.WriteTo(&output)
+	require.NoError(t, err)
+	assert.Equal(t, int64(output.Len()), n)
+	assert.Equal(t, `# HELP test_duration_seconds Duration
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{route="/quote\"d",le="0.1"} 0
+test_duration_seconds_bucket{route="/quote\"d",le="1"} 1
+test_duration_seconds_bucket{route="/quote\"d",le="+Inf"} 1
+test_duration_seconds_sum{route="/quote\"d"} 0.2
+test_duration_seconds_count{route="/quote\"d"} 1
+test_duration_seconds_bucket{route="/status",le="0.1"} 1
+test_duration_seconds_bucket{route="/status",le="1"} 2
+test_duration_seconds_bucket{route="/status",le="+Inf"} 3
+test_duration_seconds_sum{route="/status"} 3.55
+test_duration_seconds_count{route="/status"} 3
+# HELP test_errors_total Errors by collector
+# TYPE test_errors_total counter
+test_errors_total{collector="cpu"} 3
+test_errors_total{collector="net"} 1
+# HELP test_goroutines Goroutines
+# TYPE test_goroutines gauge
+test_goroutines 12
+`, output.String())
+
+	assert.Equal(t, float64(3), errors.Value("cpu"))
+	assert.Equal(t, uint64(3), duration.Count("/status"))
+}
+
+func TestRegistry_RegisterTwice(t *testing.T) {
+	registry := NewRegistry()
+	registry.NewCounter("test_total", "Test")
+	assert.Panics(t, func() {
+		registry.NewGaugeFunc("test_total", "Test", func() float64 { return 0 })
+	})
+}
+
+func TestCounter_WrongLabelValues(t *testing.T) {
+	registry := NewRegistry()
+	counter := registry.NewCounter("test_total", "Test", "collector")
+	assert.Panics(t, func() {
+		counter.Inc()
+	})
+}
@@ -0,0 +1,73 @@
+package net
+
+import (
+	"context"
+
+	"github.com/Scalingo/acadock-monitoring/v2/collector"
+	"github.com/Scalingo/acadock-monitoring/v2/procfs"
+	"github.com/Scalingo/go-netstat"
+	"github.com/Scalingo/go-utils/errors/v3"
+)
+
+// CollectorName is the name of the collector of the network interfaces counters of the containers
+const CollectorName = "net"
+
+var (
+	_ collector.Collector = &Collector{}
+	_ collector.Preparer  = &Collector{}
+)
+
+// NetInterfaces gives the host network interface of a container
+type NetInterfaces interface {
+	// Interface returns an empty string if the interface of the container is unknown
+	Interface(containerID string) string
+}
+
+// Collector collects the counters of the host network interface of the containers as a
+// netstat.NetworkStat. The network stats of the host are read once per iteration in Prepare.
+type Collector struct {
+	interfaces   NetInterfaces
+	readNetStats func(context.Context) (netstat.NetworkStats, error)
+	stats        map[string]netstat.NetworkStat
+}
+
+func NewCollector(interfaces NetInterfaces, netDev procfs.NetDev) *Collector {
+	return &Collector{
+		interfaces:   interfaces,
+		readNetStats: netDev.Read,
+		stats:        map[string]netstat.NetworkStat{},
+	}
+}
+
+func (c *Collector) Name() string {
+	return CollectorName
+}
+
+func (c *Collector) Scope() collector.Scope {
+	return collector.ScopeContainer
+}
+
+func (c *Collector) Prepare(ctx context.Context) error {
+	stats, err := c.readNetStats(ctx)
+	if err != nil {
+		c.stats = map[string]netstat.NetworkStat{}
+		return errors.Wrap(ctx, err, "get network stats")
+	}
+	c.stats = make(map[string]netstat.NetworkStat, len(stats))
+	for _, stat := range stats {
+		c.stats[stat.Interface] = stat
+	}
+	return nil
+}
+
+func (c *Collector) Collect(ctx context.Context, target *collector.Target) (any, error) {
+	// The network interface of the cgroups configured in MONITORED_CGROUPS is the one of the host
+	if target.ContainerID == "" {
+		return nil, nil
+	}
+	stat, ok := c.stats[c.interfaces.Interface(target.ContainerID)]
+	if !ok {
+		return nil, nil
+	}
+	return stat, nil
+}
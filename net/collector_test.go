@@ -0,0 +1,85 @@
+package net
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Scalingo/acadock-monitoring/v2/collector"
+	"github.com/Scalingo/acadock-monitoring/v2/procfs"
+	"github.com/Scalingo/go-netstat"
+)
+
+type interfaces map[string]string
+
+func (i interfaces) Interface(containerID string) string {
+	return i[containerID]
+}
+
+type snapshots struct {
+	previous *collector.Snapshot
+	current  *collector.Snapshot
+}
+
+func (s snapshots) Snapshots() (*collector.Snapshot, *collector.Snapshot) {
+	return s.previous, s.current
+}
+
+func TestCollector_Collect(t *testing.T) {
+	c := NewCollector(interfaces{"1": "veth1", "2": "veth2"}, procfs.NetDevReader{})
+	c.readNetStats = func(context.Context) (netstat.NetworkStats, error) {
+		return netstat.NetworkStats{{Interface: "veth1"}, {Interface: "eth0"}}, nil
+	}
+	require.NoError(t, c.Prepare(t.Context()))
+
+	value, err := c.Collect(t.Context(), collector.NewContainerTarget("1", nil))
+	require.NoError(t, err)
+	assert.Equal(t, netstat.NetworkStat{Interface: "veth1"}, value)
+
+	// The interface of the container disappeared
+	value, err = c.Collect(t.Context(), collector.NewContainerTarget("2", nil))
+	require.NoError(t, err)
+	assert.Nil(t, value)
+
+	value, err = c.Collect(t.Context(), collector.NewCgroupTarget("/system.slice/docker.service", nil))
+	require.NoError(t, err)
+	assert.Nil(t, value)
+}
+
+func TestNetMonitor_GetUsage(t *testing.T) {
+	now := time.Now()
+	stat := func(rx, tx uint64) collector.Sample {
+		s := netstat.NetworkStat{Interface: "veth1"}
+		s.Received.Bytes = rx
+		s.Transmit.Bytes = tx
+		return collector.Sample{CollectorName: s}
+	}
+
+	t.Run("it computes the rates from the elapsed time between the snapshots", func(t *testing.T) {
+		monitor := NewNetMonitor(snapshots{
+			previous: &collector.Snapshot{Time: now, Targets: map[string]collector.Sample{"1": stat(100, 1000)}},
+			current:  &collector.Snapshot{Time: now.Add(2 * time.Second), Targets: map[string]collector.Sample{"1": stat(300, 5000)}},
+		})
+
+		usage, err := monitor.GetUsage("1")
+		require.NoError(t, err)
+		assert.Equal(t, int64(100), usage.RxBps)
+		assert.Equal(t, int64(2000), usage.TxBps)
+		assert.Equal(t, uint64(300), usage.Received.Bytes)
+	})
+
+	t.Run("it ignores the counters reset", func(t *testing.T) {
+		monitor := NewNetMonitor(snapshots{
+			previous: &collector.Snapshot{Time: now, Targets: map[string]collector.Sample{"1": stat(100, 1000)}},
+			current:  &collector.Snapshot{Time: now.Add(time.Second), Targets: map[string]collector.Sample{"1": stat(10, 2000)}},
+		})
+
+		usage, err := monitor.GetUsage("1")
+		require.NoError(t, err)
+		assert.Zero(t, usage.RxBps)
+		assert.Equal(t, int64(1000), usage.TxBps)
+	})
+}
@@ -3,130 +3,122 @@ package net
 import (
 	"context"
 	"sync"
-	"time"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/Scalingo/acadock-monitoring/v2/client"
-	"github.com/Scalingo/acadock-monitoring/v2/config"
+	"github.com/Scalingo/acadock-monitoring/v2/collector"
 	"github.com/Scalingo/acadock-monitoring/v2/docker"
 	"github.com/Scalingo/go-netstat"
 	"github.com/Scalingo/go-utils/logger"
 )
 
-type Usage client.NetUsage
+var _ NetInterfaces = &Interfaces{}
 
-type NetMonitor struct {
-	containerRepository docker.ContainerRepository
-	netUsages           map[string]netstat.NetworkStat
-	previousNetUsages   map[string]netstat.NetworkStat
-	netUsagesMutex      *sync.Mutex
+type Usage client.NetUsage
 
+// Interfaces keeps track of the host network interface of every running container
+type Interfaces struct {
+	containerRepository  docker.ContainerRepository
 	containerIfaces      map[string]string
 	containerIfacesMutex *sync.Mutex
 }
 
-func NewNetMonitor(ctx context.Context, containerRepository docker.ContainerRepository) *NetMonitor {
-	monitor := &NetMonitor{
+func NewInterfaces(containerRepository docker.ContainerRepository) *Interfaces {
+	return &Interfaces{
 		containerRepository:  containerRepository,
-		netUsages:            map[string]netstat.NetworkStat{},
-		previousNetUsages:    map[string]netstat.NetworkStat{},
-		netUsagesMutex:       &sync.Mutex{},
 		containerIfaces:      map[string]string{},
 		containerIfacesMutex: &sync.Mutex{},
 	}
-	go monitor.listeningNewInterfaces(ctx)
-	return monitor
-}
-
-func (monitor *NetMonitor) Start() {
-	tick := time.NewTicker(config.RefreshTime)
-	defer tick.Stop()
-	for {
-		<-tick.C
-		stats, err := netstat.Stats()
-		if err != nil {
-			log.WithError(err).Info("Fail to get network stats")
-			continue
-		}
-		for _, stat := range stats {
-			monitor.containerIfacesMutex.Lock()
-			containerID := monitor.containerIfaces[stat.Interface]
-			monitor.containerIfacesMutex.Unlock()
-
-			if containerID == "" {
-				continue
-			}
-
-			monitor.netUsagesMutex.Lock()
-			monitor.previousNetUsages[containerID] = monitor.netUsages[containerID]
-			monitor.netUsages[containerID] = stat
-			monitor.netUsagesMutex.Unlock()
-		}
-	}
-	// unreachable code
 }
 
-func (monitor *NetMonitor) listeningNewInterfaces(ctx context.Context) {
-	containerEvents := monitor.containerRepository.RegisterToContainersStream(ctx)
+func (i *Interfaces) Start(ctx context.Context) {
+	containerEvents := i.containerRepository.RegisterToContainersStream(ctx)
 	for event := range containerEvents {
 		ctx, _ := logger.WithFieldToCtx(ctx, "container_id", event.ContainerID)
 		switch event.Action {
 		case docker.ContainerActionStart:
-			monitor.startMonitoringContainer(ctx, event.ContainerID)
+			i.startMonitoringContainer(ctx, event.ContainerID)
 		case docker.ContainerActionStop:
-			monitor.cleanMonitoringData(event.ContainerID)
+			i.cleanMonitoringData(event.ContainerID)
 		default:
 			log.WithField("action", event.Action).Info("Unknown container action")
 		}
 	}
 }
 
-func (monitor *NetMonitor) startMonitoringContainer(ctx context.Context, containerID string) {
+func (i *Interfaces) Interface(containerID string) string {
+	i.containerIfacesMutex.Lock()
+	defer i.containerIfacesMutex.Unlock()
+	return i.containerIfaces[containerID]
+}
+
+// Len returns the number of containers whose interface is known
+func (i *Interfaces) Len() int {
+	i.containerIfacesMutex.Lock()
+	defer i.containerIfacesMutex.Unlock()
+	return len(i.containerIfaces)
+}
+
+func (i *Interfaces) startMonitoringContainer(ctx context.Context, containerID string) {
 	iface, err := getContainerIface(ctx, containerID)
 	if err != nil {
 		log.WithError(err).Errorf("Fail to get network interface of '%v'", containerID)
 		return
 	}
-	monitor.containerIfacesMutex.Lock()
-	monitor.containerIfaces[iface] = containerID
-	monitor.containerIfacesMutex.Unlock()
+	i.containerIfacesMutex.Lock()
+	i.containerIfaces[containerID] = iface
+	i.containerIfacesMutex.Unlock()
 }
 
-func (monitor *NetMonitor) cleanMonitoringData(containerID string) {
-	monitor.containerIfacesMutex.Lock()
-	for iface, id := range monitor.containerIfaces {
-		if id == containerID {
-			delete(monitor.containerIfaces, iface)
-			break
-		}
-	}
-	monitor.containerIfacesMutex.Unlock()
+func (i *Interfaces) cleanMonitoringData(containerID string) {
+	i.containerIfacesMutex.Lock()
+	delete(i.containerIfaces, containerID)
+	i.containerIfacesMutex.Unlock()
 }
 
-func (monitor *NetMonitor) GetUsage(id string) (Usage, error) {
-	netUsages := monitor.netUsages
-	previousNetUsages := monitor.previousNetUsages
+// NetMonitor computes the network usage of the containers from the two last snapshots of the
+// collector
+type NetMonitor struct {
+	snapshots collector.SnapshotReader
+}
 
+func NewNetMonitor(snapshots collector.SnapshotReader) *NetMonitor {
+	return &NetMonitor{snapshots: snapshots}
+}
+
+func (monitor *NetMonitor) GetUsage(id string) (Usage, error) {
 	usage := Usage{}
 
 	// Actually for containers veth### are inversing Received, Transmit
 	// Transmit data are the data uploaded to the container, aka downloads by processes in the container
 	// Received is the opposit, what is uploaded by processes in the container
 
-	monitor.netUsagesMutex.Lock()
-	usage.NetworkStat = netUsages[id]
+	previous, current := monitor.snapshots.Snapshots()
+	currentSample, _ := current.Sample(id)
+	currentStat, ok := collector.Value[netstat.NetworkStat](currentSample, CollectorName)
+	if !ok {
+		return usage, nil
+	}
+	usage.NetworkStat = currentStat
 
-	previousRxBps := previousNetUsages[id].Received.Bytes
-	previousTxBps := previousNetUsages[id].Transmit.Bytes
-	if previousRxBps > 0 {
-		usage.RxBps = int64(float64(netUsages[id].Received.Bytes-previousRxBps) / config.RefreshTime.Seconds())
+	previousSample, _ := previous.Sample(id)
+	previousStat, ok := collector.Value[netstat.NetworkStat](previousSample, CollectorName)
+	if !ok {
+		return usage, nil
 	}
-	if previousTxBps > 0 {
-		usage.TxBps = int64(float64(netUsages[id].Transmit.Bytes-previousTxBps) / config.RefreshTime.Seconds())
+	elapsed := current.Time.Sub(previous.Time).Seconds()
+	if elapsed <= 0 {
+		return usage, nil
 	}
 
-	monitor.netUsagesMutex.Unlock()
+	// Counters are reset if the interface has been recreated
+	if currentStat.Received.Bytes >= previousStat.Received.Bytes {
+		usage.RxBps = int64(float64(currentStat.Received.Bytes-previousStat.Received.Bytes) / elapsed)
+	}
+	if currentStat.Transmit.Bytes >= previousStat.Transmit.Bytes {
+		usage.TxBps = int64(float64(currentStat.Transmit.Bytes-previousStat.Transmit.Bytes) / elapsed)
+	}
 
 	return usage, nil
 }
@@ -46,10 +46,10 @@ type CPUStatReader struct {
 	sysconf Sysconf
 }
 
-func NewCPUStatReader(ctx context.Context) CPUStatReader {
+func NewCPUStatReader(fs FS, sysconf Sysconf) CPUStatReader {
 	return CPUStatReader{
-		fs:      NewFileSystem(ctx),
-		sysconf: NewSysconf(),
+		fs:      fs,
+		sysconf: sysconf,
 	}
 }
 
@@ -67,7 +67,7 @@ func (c CPUStatReader) Read(ctx context.Context) (CPUStats, error) {
 	}
 
 	// Open the /proc/stat file
-	file, err := c.fs.Open("/proc/stat")
+	file, err := c.fs.Open("stat")
 	if err != nil {
 		return result, errors.Wrap(ctx, err, "open stat file")
 	}
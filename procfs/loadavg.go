@@ -27,16 +27,16 @@ type LoadAvgReader struct {
 	fs FS
 }
 
-func NewLoadAvgReader(ctx context.Context) LoadAvgReader {
+func NewLoadAvgReader(fs FS) LoadAvgReader {
 	return LoadAvgReader{
-		fs: NewFileSystem(ctx),
+		fs: fs,
 	}
 }
 
 func (l LoadAvgReader) Read(ctx context.Context) (LoadAverage, error) {
 	res := LoadAverage{}
 	// First open the file
-	file, err := l.fs.Open("/proc/loadavg")
+	file, err := l.fs.Open("loadavg")
 	if err != nil {
 		return res, errors.Wrap(ctx, err, "open loadavg file")
 	}
@@ -78,9 +78,9 @@ type MemInfoReader struct {
 	fs FS
 }
 
-func NewMemInfoReader(ctx context.Context) MemInfoReader {
+func NewMemInfoReader(fs FS) MemInfoReader {
 	return MemInfoReader{
-		fs: NewFileSystem(ctx),
+		fs: fs,
 	}
 }
 
@@ -88,7 +88,7 @@ func (m MemInfoReader) Read(ctx context.Context) (MemInfo, error) {
 	res := MemInfo{}
 
 	// Open our file
-	file, err := m.fs.Open("/proc/meminfo")
+	file, err := m.fs.Open("meminfo")
 	if err != nil {
 		return res, errors.Wrap(ctx, err, "open meminfo file")
 	}
@@ -21,6 +21,18 @@ type MountInfos interface {
 	DevicePath(major uint64, minor uint64) string
 }
 
+// NoMountInfos is used when the mountinfo monitoring is disabled: the block devices are only
+// identified by their major and minor numbers.
+type NoMountInfos struct{}
+
+func (NoMountInfos) Mountpoint(uint64, uint64) string {
+	return ""
+}
+
+func (NoMountInfos) DevicePath(uint64, uint64) string {
+	return ""
+}
+
 type MountInfoReader struct {
 	getMountInfos func() ([]*prometheusprocfs.MountInfo, error)
 	sysDevBlock   string
@@ -30,9 +42,18 @@ type MountInfoReader struct {
 	mutex      *sync.RWMutex
 	mountInfos map[string]string
 	devices    map[string]string
+	status     RefreshStatus
 }
 
-func NewMountInfoReader(ctx context.Context, procDir string, pid int) (*MountInfoReader, error) {
+// RefreshStatus describes the last refreshes of the mount infos
+type RefreshStatus struct {
+	// RefreshedAt is the time of the last successful refresh
+	RefreshedAt time.Time
+	LastError   error
+	LastErrorAt time.Time
+}
+
+func NewMountInfoReader(ctx context.Context, procDir string, sysDir string, pid int) (*MountInfoReader, error) {
 	procFS, err := prometheusprocfs.NewFS(procDir)
 	if err != nil {
 		return nil, errors.Wrap(ctx, err, "create procfs filesystem")
@@ -45,7 +66,7 @@ func NewMountInfoReader(ctx context.Context, procDir string, pid int) (*MountInf
 		getMountInfos: func() ([]*prometheusprocfs.MountInfo, error) {
 			return procFS.GetProcMounts(pid)
 		},
-		sysDevBlock: "/sys/dev/block",
+		sysDevBlock: filepath.Join(sysDir, "dev", "block"),
 		dev:         "/dev",
 		devMapper:   "/dev/mapper",
 		mutex:       &sync.RWMutex{},
@@ -79,6 +100,27 @@ func (r *MountInfoReader) Start(ctx context.Context) {
 }
 
 func (r *MountInfoReader) Refresh(ctx context.Context) error {
+	err := r.refresh(ctx)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if err != nil {
+		r.status.LastError = err
+		r.status.LastErrorAt = time.Now()
+		return err
+	}
+	r.status.RefreshedAt = time.Now()
+	return nil
+}
+
+func (r *MountInfoReader) RefreshStatus() RefreshStatus {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.status
+}
+
+func (r *MountInfoReader) refresh(ctx context.Context) error {
 	mountInfos, err := r.getMountInfos()
 	if err != nil {
 		return errors.Wrap(ctx, err, "get mount infos")
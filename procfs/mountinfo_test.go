@@ -102,6 +102,11 @@ func TestMountInfoReaderRefreshReturnsError(t *testing.T) {
 
 	err := reader.Refresh(t.Context())
 	require.ErrorIs(t, err, expectedErr)
+
+	status := reader.RefreshStatus()
+	require.ErrorIs(t, status.LastError, expectedErr)
+	require.False(t, status.LastErrorAt.IsZero())
+	require.True(t, status.RefreshedAt.IsZero())
 }
 
 func TestMountInfoReaderRefreshReturnsMapperPathError(t *testing.T) {
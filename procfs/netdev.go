@@ -0,0 +1,102 @@
+package procfs
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/Scalingo/go-netstat"
+	"github.com/Scalingo/go-utils/errors/v3"
+)
+
+var _ NetDev = NetDevReader{}
+
+type NetDev interface {
+	Read(ctx context.Context) (netstat.NetworkStats, error)
+}
+
+// NetDevReader reads the counters of the network interfaces from net/dev. It replaces
+// netstat.Stats which always reads /proc/net/dev.
+type NetDevReader struct {
+	fs FS
+}
+
+func NewNetDevReader(fs FS) NetDevReader {
+	return NetDevReader{
+		fs: fs,
+	}
+}
+
+func (n NetDevReader) Read(ctx context.Context) (netstat.NetworkStats, error) {
+	file, err := n.fs.Open("net/dev")
+	if err != nil {
+		return nil, errors.Wrap(ctx, err, "open net/dev file")
+	}
+	defer file.Close()
+
+	// The first two lines are the header:
+	// Inter-|   Receive                                                |  Transmit
+	//  face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+	reader := bufio.NewReader(file)
+	var stats netstat.NetworkStats
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, errors.Wrap(ctx, err, "read net/dev")
+		}
+		if lineNumber > 2 && strings.TrimSpace(line) != "" {
+			stat, parseErr := parseNetDevLine(ctx, line)
+			if parseErr != nil {
+				return nil, errors.Wrapf(ctx, parseErr, "parse net/dev line %d", lineNumber)
+			}
+			stats = append(stats, stat)
+		}
+		if err == io.EOF {
+			return stats, nil
+		}
+	}
+}
+
+// parseNetDevLine parses the line of an interface, e.g.:
+// eth0: 1620000 12000 1 2 0 0 0 30 820000 6000 0 3 0 0 0 0
+func parseNetDevLine(ctx context.Context, line string) (netstat.NetworkStat, error) {
+	iface, counters, ok := strings.Cut(line, ":")
+	if !ok {
+		return netstat.NetworkStat{}, errors.New(ctx, "missing interface name")
+	}
+	fields := strings.Fields(counters)
+	if len(fields) != 16 {
+		return netstat.NetworkStat{}, errors.Newf(ctx, "%d counters, expected 16", len(fields))
+	}
+	values := make([]uint64, len(fields))
+	for i, field := range fields {
+		value, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return netstat.NetworkStat{}, errors.Wrapf(ctx, err, "parse counter %d", i)
+		}
+		values[i] = value
+	}
+
+	stat := netstat.NetworkStat{Interface: strings.TrimSpace(iface)}
+	stat.Received.Bytes = values[0]
+	stat.Received.Packets = values[1]
+	stat.Received.Errs = values[2]
+	stat.Received.Drop = values[3]
+	stat.Received.Fifo = values[4]
+	stat.Received.Frame = values[5]
+	stat.Received.Compressed = values[6]
+	stat.Received.Multicast = values[7]
+	// The transmit columns are bytes, packets, errs, drop, fifo, colls, carrier and compressed,
+	// netstat maps them in the same order as the receive ones
+	stat.Transmit.Bytes = values[8]
+	stat.Transmit.Packets = values[9]
+	stat.Transmit.Errs = values[10]
+	stat.Transmit.Drop = values[11]
+	stat.Transmit.Fifo = values[12]
+	stat.Transmit.Frame = values[13]
+	stat.Transmit.Compressed = values[14]
+	stat.Transmit.Multicast = values[15]
+	return stat, nil
+}
@@ -0,0 +1,41 @@
+package procfs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetDevReader_Read(t *testing.T) {
+	reader := NetDevReader{fs: testFileSystem{file: "./fixtures/proc/net/dev"}}
+	stats, err := reader.Read(context.Background())
+	require.NoError(t, err)
+
+	require.Len(t, stats, 3)
+	assert.Equal(t, "lo", stats[0].Interface)
+	assert.Equal(t, "vethab12cd3", stats[2].Interface)
+
+	eth0 := stats[1]
+	assert.Equal(t, "eth0", eth0.Interface)
+	assert.Equal(t, uint64(1620000), eth0.Received.Bytes)
+	assert.Equal(t, uint64(12000), eth0.Received.Packets)
+	assert.Equal(t, uint64(1), eth0.Received.Errs)
+	assert.Equal(t, uint64(2), eth0.Received.Drop)
+	assert.Equal(t, uint64(30), eth0.Received.Multicast)
+	assert.Equal(t, uint64(820000), eth0.Transmit.Bytes)
+	assert.Equal(t, uint64(6000), eth0.Transmit.Packets)
+	assert.Equal(t, uint64(3), eth0.Transmit.Drop)
+}
+
+func TestFileSystem_Open(t *testing.T) {
+	// The files are opened relative to the procfs root
+	reader := NewNetDevReader(NewFileSystem(context.Background(), "./fixtures/proc"))
+	stats, err := reader.Read(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, stats, 3)
+
+	_, err = NewLoadAvgReader(NewFileSystem(context.Background(), "./fixtures")).Read(context.Background())
+	assert.ErrorContains(t, err, "open fixtures/loadavg")
+}
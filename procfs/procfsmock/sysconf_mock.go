@@ -47,3 +47,17 @@ func (mr *MockSysconfMockRecorder) ClockTick() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClockTick", reflect.TypeOf((*MockSysconf)(nil).ClockTick))
 }
+
+// NumCPU mocks base method.
+func (m *MockSysconf) NumCPU() int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NumCPU")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// NumCPU indicates an expected call of NumCPU.
+func (mr *MockSysconfMockRecorder) NumCPU() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NumCPU", reflect.TypeOf((*MockSysconf)(nil).NumCPU))
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"io"
 	"os"
+	"path/filepath"
+	"runtime"
 
 	"github.com/tklauser/go-sysconf"
 
@@ -14,8 +16,12 @@ import (
 
 var _ Sysconf = NewSysconf()
 
+// Sysconf describes the host, the values recorded in an archive are used when it is replayed on
+// another host
 type Sysconf interface {
 	ClockTick() (int64, error)
+	// NumCPU returns the number of CPUs usable by acadock
+	NumCPU() int
 }
 
 type SysconfReader struct{}
@@ -28,22 +34,30 @@ func (SysconfReader) ClockTick() (int64, error) {
 	return sysconf.Sysconf(sysconf.SC_CLK_TCK)
 }
 
+func (SysconfReader) NumCPU() int {
+	return runtime.NumCPU()
+}
+
 type FS interface {
 	Open(string) (io.ReadCloser, error)
 }
 
+// FileSystem opens the files relative to the root of a procfs mountpoint, e.g. /proc or
+// /host/proc when the procfs of the host is mounted in the acadock container.
 type FileSystem struct {
-	ctx context.Context
+	ctx  context.Context
+	root string
 }
 
-func NewFileSystem(ctx context.Context) FileSystem {
+func NewFileSystem(ctx context.Context, root string) FileSystem {
 	return FileSystem{
-		ctx: ctx,
+		ctx:  ctx,
+		root: root,
 	}
 }
 
 func (fs FileSystem) Open(filename string) (io.ReadCloser, error) {
-	file, err := os.Open(filename)
+	file, err := os.Open(filepath.Join(fs.root, filename))
 	if err != nil {
 		return nil, errors.Wrap(fs.ctx, err, "open file")
 	}
@@ -0,0 +1,104 @@
+// Package recording records the raw inputs of acadock on a host into an archive, and replays them
+// to serve the API offline from this archive.
+package recording
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+
+	"github.com/Scalingo/acadock-monitoring/v2/cgroup"
+	"github.com/Scalingo/acadock-monitoring/v2/docker"
+	"github.com/Scalingo/go-utils/errors/v3"
+)
+
+// Snapshot is the state of the inputs of acadock at a given time
+type Snapshot struct {
+	// Time is the time of the snapshot collected from these inputs
+	Time time.Time `json:"time"`
+	// NumCPU is the number of CPUs of the host
+	NumCPU int `json:"num_cpu"`
+	// ClockTick is the unit of the times of the stat file, in 1/ClockTick seconds
+	ClockTick int64 `json:"clock_tick"`
+	// Files is the content of the files read by acadock in PROC_DIR, indexed by their path relative
+	// to PROC_DIR
+	Files map[string]string `json:"files"`
+	// ContainerStats is indexed by container ID
+	ContainerStats map[string]cgroup.Stats `json:"container_stats"`
+	// CgroupStats is indexed by cgroup path, relative to the root of the cgroup hierarchy
+	CgroupStats map[string]cgroup.Stats `json:"cgroup_stats"`
+	// StatsErrors is the error returned when reading the stats of a container or a cgroup, indexed
+	// like ContainerStats and CgroupStats
+	StatsErrors map[string]string `json:"stats_errors,omitempty"`
+	// Containers is the containers inventory
+	Containers []docker.Container `json:"containers"`
+	// Interfaces is the host network interface of the containers, indexed by container ID
+	Interfaces map[string]string `json:"interfaces"`
+	// Events are the containers events received since the previous snapshot
+	Events []docker.ContainerEvent `json:"events"`
+}
+
+// The archive is a sequence of gzip members, one per snapshot, each containing the JSON encoded
+// snapshot. Appending a snapshot doesn't rewrite the previous ones and a daemon killed during a
+// write only loses the last one. The archive can be read with `zcat archive | jq`.
+
+// appendSnapshot appends the snapshot to the archive and returns the number of bytes written
+func appendSnapshot(ctx context.Context, path string, snapshot Snapshot) (int64, error) {
+	var member bytes.Buffer
+	writer := gzip.NewWriter(&member)
+	err := json.NewEncoder(writer).Encode(snapshot)
+	if err != nil {
+		return 0, errors.Wrap(ctx, err, "encode snapshot")
+	}
+	err = writer.Close()
+	if err != nil {
+		return 0, errors.Wrap(ctx, err, "compress snapshot")
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return 0, errors.Wrap(ctx, err, "open archive")
+	}
+	defer file.Close()
+
+	written, err := file.Write(member.Bytes())
+	if err != nil {
+		return int64(written), errors.Wrap(ctx, err, "write snapshot")
+	}
+	return int64(written), file.Close()
+}
+
+// ReadArchive returns all the snapshots of the archive. A truncated last snapshot is ignored.
+func ReadArchive(ctx context.Context, path string) ([]Snapshot, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(ctx, err, "open archive")
+	}
+	defer file.Close()
+
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, errors.Wrap(ctx, err, "read archive")
+	}
+	decoder := json.NewDecoder(reader)
+	var snapshots []Snapshot
+	for {
+		var snapshot Snapshot
+		err := decoder.Decode(&snapshot)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrapf(ctx, err, "decode snapshot %d", len(snapshots))
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	if len(snapshots) == 0 {
+		return nil, errors.Newf(ctx, "no snapshot in archive %s", path)
+	}
+	return snapshots, nil
+}
@@ -0,0 +1,235 @@
+package recording
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Scalingo/acadock-monitoring/v2/cgroup"
+	"github.com/Scalingo/acadock-monitoring/v2/docker"
+	"github.com/Scalingo/acadock-monitoring/v2/net"
+	"github.com/Scalingo/acadock-monitoring/v2/procfs"
+	"github.com/Scalingo/go-utils/errors/v3"
+	"github.com/Scalingo/go-utils/logger"
+)
+
+var (
+	_ procfs.FS                  = &Player{}
+	_ cgroup.StatsReader         = &Player{}
+	_ docker.ContainerRepository = &Player{}
+	_ net.NetInterfaces          = &Player{}
+	_ procfs.Sysconf             = &Player{}
+)
+
+// Player replays the snapshots of an archive one after the other. It replaces the readers of the
+// host files, the cgroups, Docker and the description of the host so that the API is served from
+// the archive.
+type Player struct {
+	ctx       context.Context
+	snapshots []Snapshot
+
+	mutex *sync.RWMutex
+	index int
+	// stepped is closed when the player moves to the next snapshot
+	stepped     chan struct{}
+	subscribers int
+}
+
+// NewPlayer reads the archive, the player starts at its first snapshot
+func NewPlayer(ctx context.Context, path string) (*Player, error) {
+	snapshots, err := ReadArchive(ctx, path)
+	if err != nil {
+		return nil, errors.Wrap(ctx, err, "read archive")
+	}
+	return &Player{
+		ctx:       ctx,
+		snapshots: snapshots,
+		mutex:     &sync.RWMutex{},
+		stepped:   make(chan struct{}),
+	}, nil
+}
+
+// Play calls collect for every snapshot of the archive with the time it has been recorded at. It
+// moves to the next snapshot after the interval between both recorded snapshots. The last snapshot
+// is kept once the end of the archive is reached.
+func (p *Player) Play(ctx context.Context, collect func(context.Context, time.Time)) {
+	log := logger.Get(ctx)
+	for {
+		p.mutex.RLock()
+		current := p.snapshots[p.index]
+		last := p.index+1 >= len(p.snapshots)
+		var interval time.Duration
+		if !last {
+			interval = p.snapshots[p.index+1].Time.Sub(current.Time)
+		}
+		p.mutex.RUnlock()
+
+		collect(ctx, current.Time)
+		if last {
+			log.WithField("snapshots", len(p.snapshots)).Info("End of the archive reached")
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+		p.Next()
+	}
+}
+
+// Next moves to the next snapshot, it returns false if the current snapshot is the last one
+func (p *Player) Next() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.index+1 >= len(p.snapshots) {
+		return false
+	}
+	p.index++
+	close(p.stepped)
+	p.stepped = make(chan struct{})
+	return true
+}
+
+// Snapshot returns the current snapshot
+func (p *Player) Snapshot() Snapshot {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.snapshots[p.index]
+}
+
+// Open returns the content of a file of PROC_DIR in the current snapshot
+func (p *Player) Open(name string) (io.ReadCloser, error) {
+	content, ok := p.Snapshot().Files[name]
+	if !ok {
+		return nil, errors.Wrapf(p.ctx, fs.ErrNotExist, "file %s not recorded", name)
+	}
+	return io.NopCloser(strings.NewReader(content)), nil
+}
+
+func (p *Player) GetStats(ctx context.Context, containerID string) (cgroup.Stats, error) {
+	snapshot := p.Snapshot()
+	return snapshot.stats(ctx, snapshot.ContainerStats, containerID)
+}
+
+func (p *Player) GetCgroupStats(ctx context.Context, path string) (cgroup.Stats, error) {
+	snapshot := p.Snapshot()
+	return snapshot.stats(ctx, snapshot.CgroupStats, path)
+}
+
+func (s Snapshot) stats(ctx context.Context, stats map[string]cgroup.Stats, key string) (cgroup.Stats, error) {
+	if recordErr, ok := s.StatsErrors[key]; ok {
+		return cgroup.Stats{}, cgroup.NewStatsReaderError(errors.Newf(ctx, "recorded error: %s", recordErr))
+	}
+	value, ok := stats[key]
+	if !ok {
+		return cgroup.Stats{}, cgroup.NewStatsReaderError(errors.Newf(ctx, "stats of %s not recorded", key))
+	}
+	return value, nil
+}
+
+// ClockTick returns the clock tick of the host the current snapshot has been recorded on
+func (p *Player) ClockTick() (int64, error) {
+	clockTick := p.Snapshot().ClockTick
+	if clockTick <= 0 {
+		return 0, errors.New(p.ctx, "clock tick not recorded")
+	}
+	return clockTick, nil
+}
+
+// NumCPU returns the number of CPUs of the host the current snapshot has been recorded on
+func (p *Player) NumCPU() int {
+	return p.Snapshot().NumCPU
+}
+
+func (p *Player) Interface(containerID string) string {
+	return p.Snapshot().Interfaces[containerID]
+}
+
+func (p *Player) Containers(ctx context.Context) ([]docker.Container, error) {
+	return p.Snapshot().Containers, nil
+}
+
+func (p *Player) Container(ctx context.Context, ref string) (docker.Container, error) {
+	containers := p.Snapshot().Containers
+	inventory := make(map[string]docker.Container, len(containers))
+	for _, container := range containers {
+		inventory[container.ID] = container
+	}
+	return docker.FindContainer(inventory, ref)
+}
+
+// Health reports a connection to Docker synchronized at the time of the current snapshot
+func (p *Player) Health() docker.Health {
+	snapshot := p.Snapshot()
+	return docker.Health{
+		Connected:  true,
+		Synced:     true,
+		LastSyncAt: snapshot.Time,
+	}
+}
+
+// RegisterToContainersStream returns a channel receiving a start event for each container of the
+// current snapshot, then the events recorded in the next snapshots as the player moves to them
+func (p *Player) RegisterToContainersStream(ctx context.Context) <-chan docker.ContainerEvent {
+	events := make(chan docker.ContainerEvent)
+
+	p.mutex.Lock()
+	p.subscribers++
+	index, stepped := p.index, p.stepped
+	p.mutex.Unlock()
+
+	go func() {
+		defer func() {
+			p.mutex.Lock()
+			p.subscribers--
+			p.mutex.Unlock()
+			close(events)
+		}()
+
+		var pending []docker.ContainerEvent
+		for _, container := range p.snapshots[index].Containers {
+			pending = append(pending, docker.ContainerEvent{ContainerID: container.ID, Action: docker.ContainerActionStart})
+		}
+		for {
+			for _, event := range pending {
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-stepped:
+			}
+			p.mutex.RLock()
+			current := p.index
+			stepped = p.stepped
+			p.mutex.RUnlock()
+			pending = nil
+			for index < current {
+				index++
+				pending = append(pending, p.snapshots[index].Events...)
+			}
+		}
+	}()
+	return events
+}
+
+// Subscribers returns the number of channels registered to the containers stream
+func (p *Player) Subscribers() int {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.subscribers
+}
+
+// Len returns the number of containers whose interface is known in the current snapshot
+func (p *Player) Len() int {
+	return len(p.Snapshot().Interfaces)
+}
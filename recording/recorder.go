@@ -0,0 +1,253 @@
+package recording
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"maps"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Scalingo/acadock-monitoring/v2/cgroup"
+	"github.com/Scalingo/acadock-monitoring/v2/collector"
+	"github.com/Scalingo/acadock-monitoring/v2/docker"
+	"github.com/Scalingo/acadock-monitoring/v2/net"
+	"github.com/Scalingo/acadock-monitoring/v2/procfs"
+	"github.com/Scalingo/go-utils/logger"
+)
+
+var _ collector.SnapshotListener = &Recorder{}
+
+// snapshotsQueueSize is the number of snapshots waiting to be written after which the new ones are
+// dropped, so that a slow disk doesn't block the collection
+const snapshotsQueueSize = 10
+
+// Recorder appends the inputs of every collection of the scheduler to an archive: the files of
+// PROC_DIR, the stats of the cgroups, the containers inventory and events, the network interfaces of
+// the containers and the number of CPUs and the clock tick of the host. The inputs are copied while
+// they are read through the readers returned by FS, StatsReader, Containers and Interfaces, the
+// archive contains exactly the inputs of the served metrics.
+//
+// The recording stops once the archive is larger than maxSize bytes or once it covers maxDuration,
+// none of them is enforced if it is zero.
+type Recorder struct {
+	path        string
+	sysconf     procfs.Sysconf
+	maxSize     int64
+	maxDuration time.Duration
+	// containers is the repository whose events are recorded, set by Containers
+	containers docker.ContainerRepository
+
+	mutex *sync.Mutex
+	// pending are the inputs read since the previous collection
+	pending Snapshot
+	// files is the last content read of the files, a file isn't necessarily read during every
+	// collection
+	files  map[string]string
+	events []docker.ContainerEvent
+
+	snapshots chan Snapshot
+}
+
+func NewRecorder(path string, sysconf procfs.Sysconf, maxSize int64, maxDuration time.Duration) *Recorder {
+	return &Recorder{
+		path:        path,
+		sysconf:     sysconf,
+		maxSize:     maxSize,
+		maxDuration: maxDuration,
+		mutex:       &sync.Mutex{},
+		pending:     newSnapshot(),
+		files:       map[string]string{},
+		snapshots:   make(chan Snapshot, snapshotsQueueSize),
+	}
+}
+
+func newSnapshot() Snapshot {
+	return Snapshot{
+		ContainerStats: map[string]cgroup.Stats{},
+		CgroupStats:    map[string]cgroup.Stats{},
+		StatsErrors:    map[string]string{},
+		Interfaces:     map[string]string{},
+	}
+}
+
+// Start records the containers events and writes the snapshots of the collections to the archive
+// until the context is canceled or one of the limits of the archive is reached
+func (r *Recorder) Start(ctx context.Context) {
+	log := logger.Get(ctx).WithField("archive", r.path)
+
+	if r.containers != nil {
+		go func() {
+			for event := range r.containers.RegisterToContainersStream(ctx) {
+				r.mutex.Lock()
+				r.events = append(r.events, event)
+				r.mutex.Unlock()
+			}
+		}()
+	}
+
+	// The archive may be appended to by several runs, its size includes the previous ones
+	var size int64
+	info, err := os.Stat(r.path)
+	if err == nil {
+		size = info.Size()
+	}
+	var start time.Time
+	for {
+		var snapshot Snapshot
+		select {
+		case <-ctx.Done():
+			log.Info("Recorder stopped - Context done")
+			return
+		case snapshot = <-r.snapshots:
+		}
+
+		if start.IsZero() {
+			start = snapshot.Time
+		}
+		if r.maxSize > 0 && size >= r.maxSize {
+			log.WithField("size", size).Info("Maximal archive size reached, recorder stopped")
+			return
+		}
+		if r.maxDuration > 0 && snapshot.Time.Sub(start) > r.maxDuration {
+			log.WithField("duration", r.maxDuration).Info("Maximal archive duration reached, recorder stopped")
+			return
+		}
+
+		written, err := appendSnapshot(ctx, r.path, snapshot)
+		if err != nil {
+			log.WithError(err).Error("Fail to record snapshot")
+		}
+		size += written
+	}
+}
+
+// SnapshotCollected queues the inputs read during the collection, stamped with the time of the
+// snapshot, to be written to the archive
+func (r *Recorder) SnapshotCollected(ctx context.Context, _ *collector.Snapshot, current *collector.Snapshot, _ collector.Gauges) {
+	log := logger.Get(ctx)
+
+	r.mutex.Lock()
+	snapshot := r.pending
+	snapshot.Files = maps.Clone(r.files)
+	snapshot.Events = r.events
+	r.pending = newSnapshot()
+	r.events = nil
+	r.mutex.Unlock()
+
+	snapshot.Time = current.Time
+	snapshot.NumCPU = current.NumCPU
+	clockTick, err := r.sysconf.ClockTick()
+	if err != nil {
+		log.WithError(err).Info("Fail to record the clock tick")
+	}
+	snapshot.ClockTick = clockTick
+
+	select {
+	case r.snapshots <- snapshot:
+	default:
+		log.Error("Recorded snapshots queue is full, drop the snapshot")
+	}
+}
+
+// FS returns fs, recording the content of the files read
+func (r *Recorder) FS(fs procfs.FS) procfs.FS {
+	return recordedFS{fs: fs, recorder: r}
+}
+
+// StatsReader returns reader, recording the stats and the errors read
+func (r *Recorder) StatsReader(reader cgroup.StatsReader) cgroup.StatsReader {
+	return recordedStatsReader{reader: reader, recorder: r}
+}
+
+// Containers returns containers, recording the inventory listed. The events of containers are
+// recorded once the recorder is started.
+func (r *Recorder) Containers(containers docker.ContainerRepository) docker.ContainerRepository {
+	r.containers = containers
+	return recordedContainers{ContainerRepository: containers, recorder: r}
+}
+
+// Interfaces returns interfaces, recording the network interfaces found
+func (r *Recorder) Interfaces(interfaces net.NetInterfaces) net.NetInterfaces {
+	return recordedInterfaces{interfaces: interfaces, recorder: r}
+}
+
+type recordedFS struct {
+	fs       procfs.FS
+	recorder *Recorder
+}
+
+func (f recordedFS) Open(name string) (io.ReadCloser, error) {
+	file, err := f.fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	f.recorder.mutex.Lock()
+	f.recorder.files[name] = string(content)
+	f.recorder.mutex.Unlock()
+	return io.NopCloser(bytes.NewReader(content)), nil
+}
+
+type recordedStatsReader struct {
+	reader   cgroup.StatsReader
+	recorder *Recorder
+}
+
+func (s recordedStatsReader) GetStats(ctx context.Context, containerID string) (cgroup.Stats, error) {
+	stats, err := s.reader.GetStats(ctx, containerID)
+	s.recorder.mutex.Lock()
+	defer s.recorder.mutex.Unlock()
+	s.recorder.pending.record(s.recorder.pending.ContainerStats, containerID, stats, err)
+	return stats, err
+}
+
+func (s recordedStatsReader) GetCgroupStats(ctx context.Context, path string) (cgroup.Stats, error) {
+	stats, err := s.reader.GetCgroupStats(ctx, path)
+	s.recorder.mutex.Lock()
+	defer s.recorder.mutex.Unlock()
+	s.recorder.pending.record(s.recorder.pending.CgroupStats, path, stats, err)
+	return stats, err
+}
+
+func (s Snapshot) record(stats map[string]cgroup.Stats, key string, value cgroup.Stats, err error) {
+	if err != nil {
+		s.StatsErrors[key] = err.Error()
+		return
+	}
+	stats[key] = value
+}
+
+type recordedContainers struct {
+	docker.ContainerRepository
+	recorder *Recorder
+}
+
+func (c recordedContainers) Containers(ctx context.Context) ([]docker.Container, error) {
+	containers, err := c.ContainerRepository.Containers(ctx)
+	c.recorder.mutex.Lock()
+	c.recorder.pending.Containers = containers
+	c.recorder.mutex.Unlock()
+	return containers, err
+}
+
+type recordedInterfaces struct {
+	interfaces net.NetInterfaces
+	recorder   *Recorder
+}
+
+func (i recordedInterfaces) Interface(containerID string) string {
+	iface := i.interfaces.Interface(containerID)
+	if iface != "" {
+		i.recorder.mutex.Lock()
+		i.recorder.pending.Interfaces[containerID] = iface
+		i.recorder.mutex.Unlock()
+	}
+	return iface
+}
@@ -0,0 +1,227 @@
+package recording
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Scalingo/acadock-monitoring/v2/cgroup"
+	"github.com/Scalingo/acadock-monitoring/v2/cgroup/cgroupmock"
+	"github.com/Scalingo/acadock-monitoring/v2/collector"
+	"github.com/Scalingo/acadock-monitoring/v2/docker"
+	"github.com/Scalingo/acadock-monitoring/v2/docker/dockermock"
+	"github.com/Scalingo/acadock-monitoring/v2/net"
+	"github.com/Scalingo/acadock-monitoring/v2/procfs"
+)
+
+type interfaces map[string]string
+
+func (i interfaces) Interface(containerID string) string {
+	return i[containerID]
+}
+
+func writeProcFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+}
+
+func nextEvent(t *testing.T, events <-chan docker.ContainerEvent) docker.ContainerEvent {
+	t.Helper()
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "timeout waiting for an event")
+		return docker.ContainerEvent{}
+	}
+}
+
+type sysconf struct {
+	clockTick int64
+	numCPU    int
+}
+
+func (s sysconf) ClockTick() (int64, error) {
+	return s.clockTick, nil
+}
+
+func (s sysconf) NumCPU() int {
+	return s.numCPU
+}
+
+// collect reads the inputs through the recorder as the scheduler does, then writes the snapshot of
+// the collection to the archive
+func collect(t *testing.T, recorder *Recorder, fs procfs.FS, statsReader cgroup.StatsReader, containers docker.ContainerRepository, interfaces net.NetInterfaces, at time.Time) {
+	ctx := t.Context()
+	for _, name := range []string{"stat", "meminfo", "loadavg", "net/dev"} {
+		file, err := fs.Open(name)
+		if err == nil {
+			file.Close()
+		}
+	}
+	list, err := containers.Containers(ctx)
+	require.NoError(t, err)
+	for _, container := range list {
+		_, _ = statsReader.GetStats(ctx, container.ID)
+		interfaces.Interface(container.ID)
+	}
+	_, _ = statsReader.GetCgroupStats(ctx, "/system.slice/docker.service")
+
+	recorder.SnapshotCollected(ctx, nil, &collector.Snapshot{Time: at, NumCPU: 4}, nil)
+	_, err = appendSnapshot(ctx, recorder.path, <-recorder.snapshots)
+	require.NoError(t, err)
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	ctx := t.Context()
+	ctrl := gomock.NewController(t)
+	procDir := t.TempDir()
+	archive := filepath.Join(t.TempDir(), "acadock.rec.gz")
+
+	statsReader := cgroupmock.NewMockStatsReader(ctrl)
+	containers := dockermock.NewMockContainerRepository(ctrl)
+	recorder := NewRecorder(archive, sysconf{clockTick: 50, numCPU: 4}, 0, 0)
+	recordedFS := recorder.FS(procfs.NewFileSystem(ctx, procDir))
+	recordedStatsReader := recorder.StatsReader(statsReader)
+	recordedContainers := recorder.Containers(containers)
+	recordedInterfaces := recorder.Interfaces(interfaces{"1": "veth1"})
+
+	// First snapshot: a single container, net/dev can't be read
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	writeProcFiles(t, procDir, map[string]string{"stat": "cpu  1 0 0 1 0 0 0 0 0 0\n", "meminfo": "MemTotal: 1 kB\n", "loadavg": "0.1 0.2 0.3 1/2 3\n"})
+	containers.EXPECT().Containers(gomock.Any()).Return([]docker.Container{{ID: "1", Name: "web-1"}}, nil)
+	statsReader.EXPECT().GetStats(gomock.Any(), "1").Return(cgroup.Stats{CPUUsage: time.Second}, nil)
+	statsReader.EXPECT().GetCgroupStats(gomock.Any(), "/system.slice/docker.service").Return(cgroup.Stats{}, cgroup.NewStatsReaderError(errors.New("no such cgroup")))
+	collect(t, recorder, recordedFS, recordedStatsReader, recordedContainers, recordedInterfaces, start)
+
+	// Second snapshot: a second container has been started, meminfo isn't read anymore
+	writeProcFiles(t, procDir, map[string]string{"stat": "cpu  2 0 0 2 0 0 0 0 0 0\n", "net/dev": "header\nheader\n"})
+	require.NoError(t, os.Remove(filepath.Join(procDir, "meminfo")))
+	recorder.events = []docker.ContainerEvent{{ContainerID: "2", Action: docker.ContainerActionStart}}
+	containers.EXPECT().Containers(gomock.Any()).Return([]docker.Container{{ID: "1", Name: "web-1"}, {ID: "2", Name: "worker-1"}}, nil)
+	statsReader.EXPECT().GetStats(gomock.Any(), "1").Return(cgroup.Stats{CPUUsage: 2 * time.Second}, nil)
+	statsReader.EXPECT().GetStats(gomock.Any(), "2").Return(cgroup.Stats{CPUUsage: time.Second}, nil)
+	statsReader.EXPECT().GetCgroupStats(gomock.Any(), "/system.slice/docker.service").Return(cgroup.Stats{MemoryUsage: 10}, nil)
+	collect(t, recorder, recordedFS, recordedStatsReader, recordedContainers, recordedInterfaces, start.Add(20*time.Second))
+
+	// A daemon killed during a write leaves a truncated snapshot at the end of the archive
+	file, err := os.OpenFile(archive, os.O_WRONLY|os.O_APPEND, 0o600)
+	require.NoError(t, err)
+	_, err = file.Write([]byte{0x1f, 0x8b, 0x08, 0x00})
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	player, err := NewPlayer(ctx, archive)
+	require.NoError(t, err)
+	events := player.RegisterToContainersStream(ctx)
+	assert.Equal(t, docker.ContainerEvent{ContainerID: "1", Action: docker.ContainerActionStart}, nextEvent(t, events))
+
+	// The stat file is read with the clock tick of the recorded host
+	stat, err := procfs.NewCPUStatReader(player, player).Read(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 20*time.Millisecond, stat.All().User)
+	assert.Equal(t, 4, player.NumCPU())
+	assert.Equal(t, start, player.Snapshot().Time)
+	_, err = player.Open("net/dev")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	stats, err := player.GetStats(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, time.Second, stats.CPUUsage)
+	_, err = player.GetCgroupStats(ctx, "/system.slice/docker.service")
+	assert.ErrorContains(t, err, "recorded error")
+	assert.ErrorAs(t, err, &cgroup.StatsReaderError{})
+	assert.Equal(t, "veth1", player.Interface("1"))
+	assert.True(t, player.Health().Synced)
+
+	require.True(t, player.Next())
+	assert.Equal(t, docker.ContainerEvent{ContainerID: "2", Action: docker.ContainerActionStart}, nextEvent(t, events))
+	file2, err := player.Open("stat")
+	require.NoError(t, err)
+	content, err := io.ReadAll(file2)
+	require.NoError(t, err)
+	assert.Equal(t, "cpu  2 0 0 2 0 0 0 0 0 0\n", string(content))
+	// The last content read of a file is kept
+	_, err = player.Open("meminfo")
+	require.NoError(t, err)
+	container, err := player.Container(ctx, "worker-1")
+	require.NoError(t, err)
+	assert.Equal(t, "2", container.ID)
+	stats, err = player.GetCgroupStats(ctx, "/system.slice/docker.service")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(10), stats.MemoryUsage)
+
+	// The last snapshot is kept at the end of the archive
+	assert.False(t, player.Next())
+	assert.Len(t, player.Snapshot().Containers, 2)
+}
+
+func TestPlayer_Play(t *testing.T) {
+	ctx := t.Context()
+	archive := filepath.Join(t.TempDir(), "acadock.rec.gz")
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	for i := range 3 {
+		_, err := appendSnapshot(ctx, archive, Snapshot{Time: start.Add(time.Duration(i) * 10 * time.Millisecond)})
+		require.NoError(t, err)
+	}
+
+	// The snapshots are collected with their recorded time
+	player, err := NewPlayer(ctx, archive)
+	require.NoError(t, err)
+	var collected []time.Time
+	player.Play(ctx, func(_ context.Context, at time.Time) {
+		collected = append(collected, at)
+	})
+	assert.Equal(t, []time.Time{start, start.Add(10 * time.Millisecond), start.Add(20 * time.Millisecond)}, collected)
+}
+
+func TestRecorder_Start(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	archive := filepath.Join(t.TempDir(), "acadock.rec.gz")
+	recorder := NewRecorder(archive, sysconf{clockTick: 100, numCPU: 1}, 0, time.Minute)
+	done := make(chan struct{})
+	go func() {
+		recorder.Start(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	// The recording stops once the archive covers the maximal duration
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	for i := range 4 {
+		recorder.SnapshotCollected(ctx, nil, &collector.Snapshot{Time: start.Add(time.Duration(i) * 30 * time.Second)}, nil)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "the recorder is never stopped")
+	}
+	snapshots, err := ReadArchive(ctx, archive)
+	require.NoError(t, err)
+	assert.Len(t, snapshots, 3)
+}
+
+func TestReadArchive(t *testing.T) {
+	ctx := context.Background()
+	_, err := ReadArchive(ctx, filepath.Join(t.TempDir(), "missing.rec.gz"))
+	assert.Error(t, err)
+
+	empty := filepath.Join(t.TempDir(), "empty.rec.gz")
+	require.NoError(t, os.WriteFile(empty, nil, 0o600))
+	_, err = ReadArchive(ctx, empty)
+	assert.Error(t, err)
+}
@@ -0,0 +1,66 @@
+package resources
+
+import (
+	"context"
+
+	"github.com/Scalingo/acadock-monitoring/v2/collector"
+	"github.com/Scalingo/go-utils/errors/v3"
+)
+
+const (
+	// MemoryCollectorName is the name of the collector of the memory and swap usage of the targets
+	MemoryCollectorName = "memory"
+	// IOCollectorName is the name of the collector of the block devices usage of the targets
+	IOCollectorName = "io"
+)
+
+var (
+	_ collector.Collector = MemoryCollector{}
+	_ collector.Collector = IOCollector{}
+)
+
+// MemoryCollector collects the memory usage of the targets as a client.MemoryUsage
+type MemoryCollector struct{}
+
+func NewMemoryCollector() MemoryCollector {
+	return MemoryCollector{}
+}
+
+func (MemoryCollector) Name() string {
+	return MemoryCollectorName
+}
+
+func (MemoryCollector) Scope() collector.Scope {
+	return collector.ScopeContainer
+}
+
+func (MemoryCollector) Collect(ctx context.Context, target *collector.Target) (any, error) {
+	stats, err := target.CgroupStats(ctx)
+	if err != nil {
+		return nil, errors.Wrap(ctx, err, "get cgroup stats")
+	}
+	return memoryUsageFromStats(stats), nil
+}
+
+// IOCollector collects the IO usage of the targets as a client.IOUsage
+type IOCollector struct{}
+
+func NewIOCollector() IOCollector {
+	return IOCollector{}
+}
+
+func (IOCollector) Name() string {
+	return IOCollectorName
+}
+
+func (IOCollector) Scope() collector.Scope {
+	return collector.ScopeContainer
+}
+
+func (IOCollector) Collect(ctx context.Context, target *collector.Target) (any, error) {
+	stats, err := target.CgroupStats(ctx)
+	if err != nil {
+		return nil, errors.Wrap(ctx, err, "get cgroup stats")
+	}
+	return ioUsageFromStats(stats), nil
+}
@@ -2,15 +2,40 @@ package resources
 
 import (
 	"context"
+	"fmt"
+	"math"
 
 	"github.com/Scalingo/acadock-monitoring/v2/cgroup"
 	"github.com/Scalingo/acadock-monitoring/v2/client"
+	"github.com/Scalingo/acadock-monitoring/v2/collector"
 
 	"github.com/Scalingo/go-utils/errors/v3"
 )
 
+var ErrNotCollected = fmt.Errorf("no metrics collected yet")
+
+// unlimitedMemory is the limit reported by cgroup v1 when the memory isn't limited: the largest
+// signed 64-bit integer rounded to the page size. cgroup v2 reports an even higher value.
+const unlimitedMemory = math.MaxInt64 &^ 4095
+
+// IsMemoryLimited returns whether a memory or swap limit reported by the cgroup is an actual limit
+func IsMemoryLimited(limit uint64) bool {
+	return limit > 0 && limit < unlimitedMemory
+}
+
+// IOBytes returns the bytes read and written on all the devices
+func IOBytes(usage client.IOUsage) (uint64, uint64) {
+	var read, write uint64
+	for _, device := range usage.Devices {
+		read += device.ReadBytes
+		write += device.WriteBytes
+	}
+	return read, write
+}
+
+// UsageGetter returns the memory and IO usages from the last snapshot of the collector
 type UsageGetter struct {
-	cgroupStatsReader cgroup.StatsReader
+	snapshots collector.SnapshotReader
 }
 
 type Usage struct {
@@ -18,40 +43,58 @@ type Usage struct {
 	IO     client.IOUsage
 }
 
-func NewUsageGetter(cgroupStatsReader cgroup.StatsReader) UsageGetter {
+func NewUsageGetter(snapshots collector.SnapshotReader) UsageGetter {
 	return UsageGetter{
-		cgroupStatsReader: cgroupStatsReader,
+		snapshots: snapshots,
 	}
 }
 
 func (g UsageGetter) GetMemoryUsage(ctx context.Context, id string) (client.MemoryUsage, error) {
-	stats, err := g.cgroupStatsReader.GetStats(ctx, id)
+	sample, err := g.getSample(ctx, id)
 	if err != nil {
-		return client.MemoryUsage{}, errors.Wrap(ctx, err, "get cgroup stats")
+		return client.MemoryUsage{}, errors.Wrap(ctx, err, "get target sample")
 	}
 
-	return memoryUsageFromStats(stats), nil
+	memory, _ := collector.Value[client.MemoryUsage](sample, MemoryCollectorName)
+	return memory, nil
 }
 
 func (g UsageGetter) GetUsage(ctx context.Context, id string) (Usage, error) {
-	stats, err := g.cgroupStatsReader.GetStats(ctx, id)
+	sample, err := g.getSample(ctx, id)
 	if err != nil {
-		return Usage{}, errors.Wrap(ctx, err, "get cgroup stats")
+		return Usage{}, errors.Wrap(ctx, err, "get target sample")
 	}
 
+	memory, _ := collector.Value[client.MemoryUsage](sample, MemoryCollectorName)
+	io, _ := collector.Value[client.IOUsage](sample, IOCollectorName)
 	return Usage{
-		Memory: memoryUsageFromStats(stats),
-		IO:     ioUsageFromStats(stats),
+		Memory: memory,
+		IO:     io,
 	}, nil
 }
 
+// GetCgroupUsage returns the memory and IO usage of a cgroup which is not managed by Docker.
+func (g UsageGetter) GetCgroupUsage(ctx context.Context, name string) (Usage, error) {
+	return g.GetUsage(ctx, cgroup.CgroupPath(name))
+}
+
 func (g UsageGetter) GetIOUsage(ctx context.Context, id string) (client.IOUsage, error) {
-	stats, err := g.cgroupStatsReader.GetStats(ctx, id)
+	sample, err := g.getSample(ctx, id)
 	if err != nil {
-		return client.IOUsage{}, errors.Wrap(ctx, err, "get cgroup stats")
+		return client.IOUsage{}, errors.Wrap(ctx, err, "get target sample")
 	}
 
-	return ioUsageFromStats(stats), nil
+	io, _ := collector.Value[client.IOUsage](sample, IOCollectorName)
+	return io, nil
+}
+
+func (g UsageGetter) getSample(ctx context.Context, id string) (collector.Sample, error) {
+	_, current := g.snapshots.Snapshots()
+	sample, ok := current.Sample(id)
+	if !ok {
+		return nil, errors.Wrapf(ctx, ErrNotCollected, "target '%s'", id)
+	}
+	return sample, nil
 }
 
 func memoryUsageFromStats(stats cgroup.Stats) client.MemoryUsage {
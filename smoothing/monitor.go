@@ -0,0 +1,111 @@
+// Package smoothing exponentially smooths the usages computed from the snapshots of the collector,
+// for the host and for every target.
+package smoothing
+
+import (
+	"context"
+	"math"
+	"slices"
+
+	"github.com/Scalingo/acadock-monitoring/v2/client"
+	"github.com/Scalingo/acadock-monitoring/v2/collector"
+	"github.com/Scalingo/acadock-monitoring/v2/config"
+	"github.com/Scalingo/acadock-monitoring/v2/cpu"
+	"github.com/Scalingo/acadock-monitoring/v2/filters"
+	"github.com/Scalingo/acadock-monitoring/v2/gauges"
+	"github.com/Scalingo/acadock-monitoring/v2/net"
+	"github.com/Scalingo/acadock-monitoring/v2/resources"
+	"github.com/Scalingo/go-utils/errors/v3"
+)
+
+var _ collector.SnapshotListener = &Monitor{}
+
+// Metrics are the names of the metrics which can be smoothed, they are the names of the collectors
+// they are computed from
+var Metrics = []string{cpu.HostCollectorName, cpu.CollectorName, resources.MemoryCollectorName, net.CollectorName}
+
+// gaugesOf returns the gauges smoothed for a metric
+func gaugesOf(metric string) []string {
+	if metric == net.CollectorName {
+		return []string{gauges.NetRxBps, gauges.NetTxBps}
+	}
+	return []string{metric}
+}
+
+// Monitor adds the usages of every collected snapshot to the smoothed metrics
+type Monitor struct {
+	metrics *filters.SmoothedMetrics
+}
+
+// NewMonitor returns a monitor smoothing the metrics configured in settings, indexed by metric
+func NewMonitor(ctx context.Context, settings map[string]config.SmoothingSettings) (*Monitor, error) {
+	configs := map[string]filters.SeriesConfig{}
+	for metric, setting := range settings {
+		if !slices.Contains(Metrics, metric) {
+			return nil, errors.Newf(ctx, "unknown smoothed metric '%s', available metrics: %v", metric, Metrics)
+		}
+		for _, gauge := range gaugesOf(metric) {
+			configs[gauge] = filters.SeriesConfig{PointsPerSample: setting.PointsPerSample, ElementsNeeded: setting.ElementsNeeded}
+		}
+	}
+	metrics, err := filters.NewSmoothedMetrics(configs)
+	if err != nil {
+		return nil, errors.Wrap(ctx, err, "create smoothed metrics")
+	}
+	return &Monitor{metrics: metrics}, nil
+}
+
+// Remove destroys the series of a target
+func (m *Monitor) Remove(target string) {
+	m.metrics.Remove(target)
+}
+
+// SnapshotCollected adds the gauges computed by the scheduler from the two last snapshots
+func (m *Monitor) SnapshotCollected(ctx context.Context, previous *collector.Snapshot, current *collector.Snapshot, values collector.Gauges) {
+	for target, targetValues := range values {
+		for gauge, value := range targetValues {
+			m.metrics.Add(target, gauge, value)
+		}
+	}
+}
+
+// HostCPU returns the smoothed usage of the host CPU, nil until enough snapshots have been collected
+func (m *Monitor) HostCPU() *float64 {
+	value, err := m.metrics.Read(gauges.HostTarget, gauges.HostCPU)
+	if err != nil {
+		return nil
+	}
+	return &value
+}
+
+// CPU returns the smoothed CPU usage in percents of a target
+func (m *Monitor) CPU(id string) *float64 {
+	value, err := m.metrics.Read(id, gauges.CPU)
+	if err != nil {
+		return nil
+	}
+	return &value
+}
+
+// Memory returns the smoothed memory usage of a target
+func (m *Monitor) Memory(id string) *uint64 {
+	value, err := m.metrics.Read(id, gauges.Memory)
+	if err != nil {
+		return nil
+	}
+	memory := uint64(math.Round(value))
+	return &memory
+}
+
+// Net returns the smoothed network rates of a target
+func (m *Monitor) Net(id string) *client.SmoothedNetUsage {
+	rx, err := m.metrics.Read(id, gauges.NetRxBps)
+	if err != nil {
+		return nil
+	}
+	tx, err := m.metrics.Read(id, gauges.NetTxBps)
+	if err != nil {
+		return nil
+	}
+	return &client.SmoothedNetUsage{RxBps: int64(math.Round(rx)), TxBps: int64(math.Round(tx))}
+}
@@ -0,0 +1,69 @@
+package smoothing
+
+import (
+	"math"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Scalingo/acadock-monitoring/v2/client"
+	"github.com/Scalingo/acadock-monitoring/v2/collector"
+	"github.com/Scalingo/acadock-monitoring/v2/collector/collectortest"
+	"github.com/Scalingo/acadock-monitoring/v2/config"
+	"github.com/Scalingo/acadock-monitoring/v2/cpu"
+	"github.com/Scalingo/acadock-monitoring/v2/net"
+	"github.com/Scalingo/acadock-monitoring/v2/resources"
+	"github.com/Scalingo/go-netstat"
+)
+
+func TestMonitor(t *testing.T) {
+	ctx := t.Context()
+
+	_, err := NewMonitor(ctx, map[string]config.SmoothingSettings{"disk": {PointsPerSample: 1, ElementsNeeded: 2}})
+	assert.ErrorContains(t, err, "unknown smoothed metric 'disk'")
+
+	settings := map[string]config.SmoothingSettings{}
+	for _, metric := range Metrics {
+		settings[metric] = config.SmoothingSettings{PointsPerSample: 1, ElementsNeeded: 2}
+	}
+	monitor, err := NewMonitor(ctx, settings)
+	require.NoError(t, err)
+
+	// The container 1 uses 1 second of CPU time per second, 100 bytes of memory more and receives 10
+	// bytes
+	series := collectortest.Series{Start: time.Now(), Interval: time.Second, Targets: func(i int) map[string]collector.Sample {
+		var stat netstat.NetworkStat
+		stat.Received.Bytes = uint64(10 * i)
+		return map[string]collector.Sample{"1": {
+			cpu.CollectorName:             time.Duration(i) * time.Second,
+			resources.MemoryCollectorName: client.MemoryUsage{MemoryUsage: uint64(100 * (i + 1))},
+			net.CollectorName:             stat,
+		}}
+	}}
+	series.Notify(ctx, monitor, 3, func(i int) {
+		if i == 1 {
+			// The usages computed from counters need two snapshots
+			assert.Nil(t, monitor.HostCPU())
+			assert.Nil(t, monitor.CPU("1"))
+			assert.Nil(t, monitor.Net("1"))
+			require.NotNil(t, monitor.Memory("1"))
+			alpha := math.Exp(-2)
+			assert.Equal(t, uint64(math.Round(alpha*200+(1-alpha)*100)), *monitor.Memory("1"))
+		}
+	})
+
+	require.NotNil(t, monitor.HostCPU())
+	assert.InDelta(t, 0.5, *monitor.HostCPU(), 0.0001)
+	require.NotNil(t, monitor.CPU("1"))
+	assert.InDelta(t, float64(50*runtime.NumCPU()), *monitor.CPU("1"), 0.0001)
+	assert.Equal(t, &client.SmoothedNetUsage{RxBps: 10}, monitor.Net("1"))
+	assert.Nil(t, monitor.CPU("2"))
+
+	monitor.Remove("1")
+	assert.Nil(t, monitor.CPU("1"))
+	assert.Nil(t, monitor.Memory("1"))
+	assert.NotNil(t, monitor.HostCPU())
+}
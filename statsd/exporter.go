@@ -0,0 +1,208 @@
+// Package statsd periodically pushes the metrics of the host and of the targets to a StatsD or a
+// DogStatsD agent.
+package statsd
+
+import (
+	"context"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Scalingo/acadock-monitoring/v2/collector"
+	"github.com/Scalingo/acadock-monitoring/v2/docker"
+	"github.com/Scalingo/acadock-monitoring/v2/gauges"
+	"github.com/Scalingo/go-utils/errors/v3"
+	"github.com/Scalingo/go-utils/logger"
+)
+
+// Dialects of the agents
+const (
+	// DialectStatsD doesn't support tags, the target is part of the metric name
+	DialectStatsD = "statsd"
+	// DialectDogStatsD identifies the target and sends the labels of the containers as tags
+	DialectDogStatsD = "dogstatsd"
+)
+
+// maxPacketSize is the size of the UDP payloads recommended by DogStatsD, so that they are not
+// fragmented on most networks
+const maxPacketSize = 1432
+
+// nameEscaper replaces the characters having a meaning in the StatsD protocol, or separating the
+// components of a metric name, in the parts of the metric names
+var nameEscaper = strings.NewReplacer(".", "_", ":", "_", "|", "_", "@", "_", "#", "_", "/", "_", " ", "_", "\n", "_")
+
+// tagEscaper replaces the characters having a meaning in the DogStatsD tags
+var tagEscaper = strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_")
+
+// Exporter sends the gauges computed from the two last snapshots as StatsD gauges: the host metrics
+// are named <prefix>.host.<gauge>, the ones of the containers and of the cgroups
+// <prefix>.container.<gauge> and <prefix>.cgroup.<gauge>. With the StatsD dialect, the name of the
+// container or the path of the cgroup is inserted before the gauge name.
+type Exporter struct {
+	containers docker.ContainerRepository
+	address    string
+	prefix     string
+	dialect    string
+	// labels are the labels of the containers sent as tags, all of them if it is empty
+	labels   []string
+	interval time.Duration
+
+	conn net.Conn
+
+	mutex *sync.Mutex
+	// values are the gauges of the last snapshot, nil until two snapshots have been collected
+	values gauges.Values
+}
+
+func NewExporter(containers docker.ContainerRepository, address, prefix, dialect string, labels []string, interval time.Duration) *Exporter {
+	return &Exporter{
+		mutex:      &sync.Mutex{},
+		containers: containers,
+		address:    address,
+		prefix:     prefix,
+		dialect:    dialect,
+		labels:     labels,
+		interval:   interval,
+	}
+}
+
+// Start pushes the metrics every interval until the context is canceled
+func (e *Exporter) Start(ctx context.Context) {
+	log := logger.Get(ctx).WithField("address", e.address)
+
+	tick := time.NewTicker(e.interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if e.conn != nil {
+				e.conn.Close()
+			}
+			return
+		case <-tick.C:
+		}
+		err := e.Push(ctx)
+		if err != nil {
+			log.WithError(err).Error("Fail to push metrics to StatsD")
+		}
+	}
+}
+
+// SnapshotCollected keeps the gauges computed by the scheduler until the next push
+func (e *Exporter) SnapshotCollected(ctx context.Context, previous *collector.Snapshot, current *collector.Snapshot, values collector.Gauges) {
+	if previous == nil {
+		return
+	}
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.values = values
+}
+
+// Push sends the gauges of the last snapshot, the lines are grouped in packets of at most
+// maxPacketSize bytes. The connection is closed if a packet can't be sent, the next push dials the
+// agent again.
+func (e *Exporter) Push(ctx context.Context) error {
+	e.mutex.Lock()
+	values := e.values
+	e.mutex.Unlock()
+	if values == nil {
+		return nil
+	}
+	if e.conn == nil {
+		conn, err := net.Dial("udp", e.address)
+		if err != nil {
+			return errors.Wrap(ctx, err, "dial StatsD agent")
+		}
+		e.conn = conn
+	}
+
+	containersByID := map[string]docker.Container{}
+	containers, err := e.containers.Containers(ctx)
+	if err != nil {
+		// The metrics of the containers are still pushed, without their name and labels
+		logger.Get(ctx).WithError(err).Info("Fail to list containers to push")
+	}
+	for _, container := range containers {
+		containersByID[container.ID] = container
+	}
+
+	var packet []byte
+	for _, line := range e.lines(values, containersByID) {
+		if len(packet) > 0 && len(packet)+1+len(line) > maxPacketSize {
+			err := e.send(ctx, packet)
+			if err != nil {
+				return err
+			}
+			packet = packet[:0]
+		}
+		if len(packet) > 0 {
+			packet = append(packet, '\n')
+		}
+		packet = append(packet, line...)
+	}
+	if len(packet) > 0 {
+		return e.send(ctx, packet)
+	}
+	return nil
+}
+
+// send writes a packet to the agent, the connection is closed if it fails
+func (e *Exporter) send(ctx context.Context, packet []byte) error {
+	_, err := e.conn.Write(packet)
+	if err != nil {
+		e.conn.Close()
+		e.conn = nil
+		return errors.Wrap(ctx, err, "send metrics")
+	}
+	return nil
+}
+
+// lines returns the StatsD lines of the gauges, sorted by target and by gauge
+func (e *Exporter) lines(values gauges.Values, containers map[string]docker.Container) []string {
+	var lines []string
+	for _, target := range slices.Sorted(maps.Keys(values)) {
+		container, isContainer := containers[target]
+		kind, name, tags := "cgroup", strings.Trim(target, "/"), []string{"cgroup:" + tagEscaper.Replace(target)}
+		if target == gauges.HostTarget {
+			kind, name, tags = "host", "", nil
+		} else if isContainer {
+			kind, name, tags = "container", container.Name, e.containerTags(container)
+		} else if !strings.Contains(target, "/") {
+			// A container collected before the inventory listed it
+			kind, name, tags = "container", target, []string{"container_id:" + target}
+		}
+
+		for _, gauge := range slices.Sorted(maps.Keys(values[target])) {
+			metric := gauge
+			if target == gauges.HostTarget && gauge == gauges.HostCPU {
+				metric = "cpu"
+			}
+			line := e.prefix + "." + kind + "."
+			if e.dialect == DialectStatsD && name != "" {
+				line += nameEscaper.Replace(name) + "."
+			}
+			line += metric + ":" + strconv.FormatFloat(values[target][gauge], 'f', -1, 64) + "|g"
+			if e.dialect == DialectDogStatsD && len(tags) > 0 {
+				line += "|#" + strings.Join(tags, ",")
+			}
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// containerTags returns the DogStatsD tags of a container: its ID, its name and its labels
+func (e *Exporter) containerTags(container docker.Container) []string {
+	tags := []string{"container_id:" + container.ID, "container_name:" + tagEscaper.Replace(container.Name)}
+	for _, key := range slices.Sorted(maps.Keys(container.Labels)) {
+		if len(e.labels) > 0 && !slices.Contains(e.labels, key) {
+			continue
+		}
+		tags = append(tags, tagEscaper.Replace(key)+":"+tagEscaper.Replace(container.Labels[key]))
+	}
+	return tags
+}
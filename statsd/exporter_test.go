@@ -0,0 +1,153 @@
+package statsd
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Scalingo/acadock-monitoring/v2/client"
+	"github.com/Scalingo/acadock-monitoring/v2/collector"
+	"github.com/Scalingo/acadock-monitoring/v2/cpu"
+	"github.com/Scalingo/acadock-monitoring/v2/docker"
+	"github.com/Scalingo/acadock-monitoring/v2/docker/dockermock"
+	"github.com/Scalingo/acadock-monitoring/v2/gauges"
+	"github.com/Scalingo/acadock-monitoring/v2/procfs"
+	"github.com/Scalingo/acadock-monitoring/v2/resources"
+)
+
+type snapshots struct {
+	previous *collector.Snapshot
+	current  *collector.Snapshot
+}
+
+// notify notifies the exporter of the snapshots as the scheduler does
+func (s snapshots) notify(t *testing.T, exporter *Exporter) {
+	if s.previous != nil {
+		exporter.SnapshotCollected(t.Context(), nil, s.previous, gauges.Compute(nil, s.previous))
+	}
+	exporter.SnapshotCollected(t.Context(), s.previous, s.current, gauges.Compute(s.previous, s.current))
+}
+
+// snapshot returns a snapshot of the host having worked user and idled idle, and of the targets
+// using the given memory
+func snapshot(at time.Time, user, idle time.Duration, memory map[string]uint64) *collector.Snapshot {
+	targets := map[string]collector.Sample{}
+	for id, usage := range memory {
+		targets[id] = collector.Sample{resources.MemoryCollectorName: client.MemoryUsage{MemoryUsage: usage}}
+	}
+	return &collector.Snapshot{
+		Time:    at,
+		Host:    collector.Sample{cpu.HostCollectorName: procfs.SingleCPUStat{Name: "cpu", User: user, IDLE: idle}},
+		Targets: targets,
+	}
+}
+
+// listen returns a local UDP listener and a function returning the next packet it received
+func listen(t *testing.T) (string, func() string) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	return listener.LocalAddr().String(), func() string {
+		buffer := make([]byte, 65536)
+		require.NoError(t, listener.SetReadDeadline(time.Now().Add(5*time.Second)))
+		n, _, err := listener.ReadFrom(buffer)
+		require.NoError(t, err)
+		return string(buffer[:n])
+	}
+}
+
+func TestExporter_Push(t *testing.T) {
+	ctx := t.Context()
+	ctrl := gomock.NewController(t)
+	containers := dockermock.NewMockContainerRepository(ctrl)
+	containers.EXPECT().Containers(gomock.Any()).Return([]docker.Container{
+		{ID: "1", Name: "web-1", Labels: map[string]string{"app": "web", "com.docker.compose.project": "demo"}},
+	}, nil).AnyTimes()
+
+	// The host works a quarter of the time, the container 2 isn't in the inventory yet
+	start := time.Now()
+	memory := map[string]uint64{"1": 100, "2": 200, "/system.slice/nginx.service": 300}
+	reader := snapshots{
+		previous: snapshot(start, time.Second, 3*time.Second, memory),
+		current:  snapshot(start.Add(time.Second), 2*time.Second, 6*time.Second, memory),
+	}
+
+	t.Run("dogstatsd", func(t *testing.T) {
+		address, receive := listen(t)
+		exporter := NewExporter(containers, address, "acadock", DialectDogStatsD, []string{"app"}, time.Second)
+		reader.notify(t, exporter)
+		require.NoError(t, exporter.Push(ctx))
+		assert.Equal(t, strings.Join([]string{
+			"acadock.cgroup.memory:300|g|#cgroup:/system.slice/nginx.service",
+			"acadock.container.memory:100|g|#container_id:1,container_name:web-1,app:web",
+			"acadock.container.memory:200|g|#container_id:2",
+			"acadock.host.cpu:0.25|g",
+		}, "\n"), receive())
+	})
+
+	t.Run("statsd", func(t *testing.T) {
+		address, receive := listen(t)
+		exporter := NewExporter(containers, address, "acadock", DialectStatsD, nil, time.Second)
+		reader.notify(t, exporter)
+		require.NoError(t, exporter.Push(ctx))
+		assert.Equal(t, strings.Join([]string{
+			"acadock.cgroup.system_slice_nginx_service.memory:300|g",
+			"acadock.container.web-1.memory:100|g",
+			"acadock.container.2.memory:200|g",
+			"acadock.host.cpu:0.25|g",
+		}, "\n"), receive())
+	})
+
+	t.Run("the lines are split in packets", func(t *testing.T) {
+		memory := map[string]uint64{}
+		for i := range 100 {
+			memory[strconv.Itoa(1000+i)] = uint64(i)
+		}
+		reader := snapshots{
+			previous: snapshot(start, time.Second, 3*time.Second, memory),
+			current:  snapshot(start.Add(time.Second), 2*time.Second, 6*time.Second, memory),
+		}
+		address, receive := listen(t)
+		exporter := NewExporter(containers, address, "acadock", DialectDogStatsD, nil, time.Second)
+		reader.notify(t, exporter)
+		require.NoError(t, exporter.Push(ctx))
+
+		lines := 0
+		for lines < 101 {
+			packet := receive()
+			assert.LessOrEqual(t, len(packet), maxPacketSize)
+			lines += len(strings.Split(packet, "\n"))
+		}
+		assert.Equal(t, 101, lines)
+	})
+
+	t.Run("the agent is dialed again after a failed push", func(t *testing.T) {
+		address, receive := listen(t)
+		exporter := NewExporter(containers, address, "acadock", DialectStatsD, nil, time.Second)
+		reader.notify(t, exporter)
+		require.NoError(t, exporter.Push(ctx))
+		receive()
+
+		require.NoError(t, exporter.conn.Close())
+		assert.ErrorContains(t, exporter.Push(ctx), "send metrics")
+		assert.Nil(t, exporter.conn)
+		require.NoError(t, exporter.Push(ctx))
+		assert.Contains(t, receive(), "acadock.host.cpu:0.25|g")
+	})
+
+	t.Run("nothing is pushed until two snapshots have been collected", func(t *testing.T) {
+		exporter := NewExporter(containers, "127.0.0.1:0", "acadock", DialectDogStatsD, nil, time.Second)
+		require.NoError(t, exporter.Push(ctx))
+		assert.Nil(t, exporter.conn)
+
+		snapshots{current: reader.current}.notify(t, exporter)
+		require.NoError(t, exporter.Push(ctx))
+		assert.Nil(t, exporter.conn)
+	})
+}
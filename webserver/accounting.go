@@ -0,0 +1,72 @@
+package webserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Scalingo/go-handlers"
+	"github.com/Scalingo/go-utils/errors/v3"
+	"github.com/Scalingo/go-utils/logger"
+)
+
+// defaultAccountingPeriod is the period of the accounting if from isn't requested
+const defaultAccountingPeriod = 24 * time.Hour
+
+// AccountingHandler returns the cumulative consumption of the containers and cgroups between the
+// RFC 3339 times ?from=&to=, the last 24 hours by default. The consumption of the containers is
+// aggregated by value of the label requested with ?group_by=.
+func (c Controller) AccountingHandler(res http.ResponseWriter, req *http.Request, _ map[string]string) error {
+	ctx := req.Context()
+	log := logger.Get(ctx)
+	query := req.URL.Query()
+
+	from, to, err := period(req, defaultAccountingPeriod)
+	if err != nil {
+		return err
+	}
+	selectors, err := labelSelectors(req)
+	if err != nil {
+		return errors.Wrap(ctx, err, "parse label selectors")
+	}
+
+	accounting := c.accounting.Accounting(from, to, selectors, query.Get("group_by"))
+	res.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(res).Encode(&accounting)
+	if err != nil {
+		log.WithError(err).Error("Fail to encode accounting payload")
+	}
+	return nil
+}
+
+// period parses the RFC 3339 times of the period requested with ?from=&to=. To defaults to now and
+// from to defaultLength before to.
+func period(req *http.Request, defaultLength time.Duration) (time.Time, time.Time, error) {
+	query := req.URL.Query()
+	badRequest := handlers.NewBadRequestErrors()
+	to := time.Now()
+	if value := query.Get("to"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			badRequest.Errors["to"] = []string{fmt.Sprintf("'%s' is not a RFC 3339 time", value)}
+		}
+		to = parsed
+	}
+	from := to.Add(-defaultLength)
+	if value := query.Get("from"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			badRequest.Errors["from"] = []string{fmt.Sprintf("'%s' is not a RFC 3339 time", value)}
+		}
+		from = parsed
+	}
+	if len(badRequest.Errors) > 0 {
+		return time.Time{}, time.Time{}, badRequest
+	}
+	if !from.Before(to) {
+		badRequest.Errors["from"] = []string{"from must be before to"}
+		return time.Time{}, time.Time{}, badRequest
+	}
+	return from, to, nil
+}
@@ -0,0 +1,21 @@
+package webserver
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Scalingo/go-utils/logger"
+)
+
+// AlertsHandler lists the pending and firing alerts
+func (c Controller) AlertsHandler(res http.ResponseWriter, req *http.Request, _ map[string]string) error {
+	log := logger.Get(req.Context())
+
+	alerts := c.alerts.Alerts()
+	res.WriteHeader(http.StatusOK)
+	err := json.NewEncoder(res).Encode(&alerts)
+	if err != nil {
+		log.WithError(err).Error("Fail to encode alerts payload")
+	}
+	return nil
+}
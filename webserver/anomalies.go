@@ -0,0 +1,71 @@
+package webserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/Scalingo/acadock-monitoring/v2/client"
+	"github.com/Scalingo/go-utils/errors/v3"
+	"github.com/Scalingo/go-utils/logger"
+)
+
+// AnomaliesHandler lists the containers whose CPU or network usage currently deviates from their
+// baseline, the oldest anomalies first
+func (c Controller) AnomaliesHandler(res http.ResponseWriter, req *http.Request, _ map[string]string) error {
+	ctx := req.Context()
+	log := logger.Get(ctx)
+
+	selectors, err := labelSelectors(req)
+	if err != nil {
+		return errors.Wrap(ctx, err, "parse label selectors")
+	}
+	containers, err := c.containers.Containers(ctx)
+	if err != nil {
+		return errors.Wrap(ctx, err, "list containers")
+	}
+
+	current := c.anomalies.Anomalies()
+	anomalies := client.Anomalies{}
+	for _, container := range containers {
+		metrics, ok := current[container.ID]
+		if !ok || !selectors.Matches(container.Labels) {
+			continue
+		}
+		anomaly := client.Anomaly{
+			ContainerID: container.ID,
+			Name:        container.Name,
+			Labels:      container.Labels,
+		}
+		for metric, metricAnomaly := range metrics {
+			anomaly.Metrics = append(anomaly.Metrics, client.MetricAnomaly{
+				Metric: metric,
+				Since:  metricAnomaly.Since,
+				Value:  metricAnomaly.Value,
+				Mean:   metricAnomaly.Mean,
+				StdDev: metricAnomaly.StdDev,
+			})
+			if anomaly.Since.IsZero() || metricAnomaly.Since.Before(anomaly.Since) {
+				anomaly.Since = metricAnomaly.Since
+			}
+		}
+		slices.SortFunc(anomaly.Metrics, func(a, b client.MetricAnomaly) int {
+			return strings.Compare(a.Metric, b.Metric)
+		})
+		anomalies = append(anomalies, anomaly)
+	}
+	slices.SortFunc(anomalies, func(a, b client.Anomaly) int {
+		if cmp := a.Since.Compare(b.Since); cmp != 0 {
+			return cmp
+		}
+		return strings.Compare(a.ContainerID, b.ContainerID)
+	})
+
+	res.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(res).Encode(&anomalies)
+	if err != nil {
+		log.WithError(err).Error("Fail to encode anomalies payload")
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package webserver
+
+import (
+	"net/http"
+
+	"github.com/Scalingo/acadock-monitoring/v2/config"
+	"github.com/Scalingo/go-handlers"
+)
+
+// AuthMiddleware requires the HTTP basic authentication if HTTP_USERNAME and HTTP_PASSWORD are
+// defined. The credentials are read for each request so that they can be changed by a
+// configuration reload.
+var AuthMiddleware = handlers.MiddlewareFunc(func(next handlers.HandlerFunc) handlers.HandlerFunc {
+	authenticated := handlers.AuthMiddleware(func(user, password string) bool {
+		settings := config.Current()
+		return user == settings.HTTPUsername && password == settings.HTTPPassword
+	})(next)
+
+	return func(res http.ResponseWriter, req *http.Request, params map[string]string) error {
+		if config.Current().HTTPUsername == "" {
+			return next(res, req, params)
+		}
+		return authenticated(res, req, params)
+	}
+})
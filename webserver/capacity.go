@@ -0,0 +1,121 @@
+package webserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/docker/go-units"
+
+	"github.com/Scalingo/acadock-monitoring/v2/client"
+	"github.com/Scalingo/acadock-monitoring/v2/resources"
+	"github.com/Scalingo/go-handlers"
+	"github.com/Scalingo/go-utils/errors/v3"
+	"github.com/Scalingo/go-utils/logger"
+)
+
+// HostCapacityHandler compares the memory, swap and CPU limits of the containers to the capacity of
+// the host and checks whether a container of the size requested with ?memory=512M&cpu=0.5 can be
+// placed without overcommitting the host
+func (c Controller) HostCapacityHandler(res http.ResponseWriter, req *http.Request, _ map[string]string) error {
+	ctx := req.Context()
+	log := logger.Get(ctx)
+	query := req.URL.Query()
+
+	badRequest := handlers.NewBadRequestErrors()
+	var requestedMemory, requestedCPU *float64
+	if value := query.Get("memory"); value != "" {
+		bytes, err := units.RAMInBytes(value)
+		if err != nil || bytes <= 0 {
+			badRequest.Errors["memory"] = []string{fmt.Sprintf("'%s' is not a positive size, e.g. 512M", value)}
+		} else {
+			memory := float64(bytes)
+			requestedMemory = &memory
+		}
+	}
+	if value := query.Get("cpu"); value != "" {
+		cpus, err := strconv.ParseFloat(value, 64)
+		if err != nil || cpus <= 0 {
+			badRequest.Errors["cpu"] = []string{fmt.Sprintf("'%s' is not a positive number of CPUs", value)}
+		} else {
+			requestedCPU = &cpus
+		}
+	}
+	if len(badRequest.Errors) > 0 {
+		return badRequest
+	}
+
+	hostMemory, err := c.procfsMemory.Read(ctx)
+	if err != nil {
+		return errors.Wrap(ctx, err, "get host memory usage")
+	}
+	containers, err := c.containers.Containers(ctx)
+	if err != nil {
+		return errors.Wrap(ctx, err, "list containers")
+	}
+
+	var capacity client.HostCapacity
+	capacity.Memory.Total = float64(hostMemory.MemTotal)
+	capacity.Swap.Total = float64(hostMemory.SwapTotal)
+	capacity.CPU.Total = float64(c.cpu.NumCPU())
+	for _, container := range containers {
+		ctx, log := logger.WithFieldToCtx(ctx, "container_id", container.ID)
+		usage, err := c.resources.GetMemoryUsage(ctx, container.ID)
+		if err != nil {
+			log.WithError(err).Infof("Fail to get memory usage")
+			continue
+		}
+		commit(&capacity.Memory, float64(usage.MemoryLimit), resources.IsMemoryLimited(usage.MemoryLimit))
+		commit(&capacity.Swap, float64(usage.SwapLimit), resources.IsMemoryLimited(usage.SwapLimit))
+		if limit, ok := c.cpu.GetContainerLimit(container.ID); ok {
+			commit(&capacity.CPU.ResourceCapacity, limit.Quota, limit.Quota > 0)
+			capacity.CPU.Shares += limit.Shares
+		}
+	}
+
+	memoryFits := fillCapacity(&capacity.Memory, requestedMemory)
+	fillCapacity(&capacity.Swap, nil)
+	cpuFits := fillCapacity(&capacity.CPU.ResourceCapacity, requestedCPU)
+	if capacity.CPU.Total > 0 {
+		capacity.CPU.SharesRatio = float64(capacity.CPU.Shares) / (1024 * capacity.CPU.Total)
+	}
+	if requestedMemory != nil || requestedCPU != nil {
+		fits := memoryFits && cpuFits
+		capacity.Fits = &fits
+	}
+
+	res.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(res).Encode(&capacity)
+	if err != nil {
+		log.WithError(err).Error("Fail to encode host capacity payload")
+	}
+	return nil
+}
+
+// commit adds the limit of a container to the committed capacity, or counts the container as
+// unlimited
+func commit(capacity *client.ResourceCapacity, limit float64, limited bool) {
+	if !limited {
+		capacity.Unlimited++
+		return
+	}
+	capacity.Committed += limit
+}
+
+// fillCapacity computes the overcommit ratio and the free capacity once the limits of all the
+// containers have been committed. It returns whether the requested size fits in the free capacity,
+// true if nothing is requested.
+func fillCapacity(capacity *client.ResourceCapacity, requested *float64) bool {
+	if capacity.Total > 0 {
+		capacity.OvercommitRatio = capacity.Committed / capacity.Total
+	}
+	capacity.Free = max(capacity.Total-capacity.Committed, 0)
+	if requested == nil {
+		return true
+	}
+	fits := *requested <= capacity.Free
+	capacity.Requested = requested
+	capacity.Fits = &fits
+	return fits
+}
@@ -0,0 +1,94 @@
+package webserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Scalingo/acadock-monitoring/v2/cgroup"
+	"github.com/Scalingo/acadock-monitoring/v2/client"
+	"github.com/Scalingo/acadock-monitoring/v2/resources"
+	"github.com/Scalingo/go-utils/errors/v3"
+	"github.com/Scalingo/go-utils/logger"
+)
+
+func (c Controller) CgroupUsageHandler(res http.ResponseWriter, req *http.Request, params map[string]string) error {
+	ctx := req.Context()
+	log := logger.Get(ctx)
+	name := strings.Trim(params["path"], "/")
+
+	if !slices.Contains(c.cgroups, name) {
+		res.WriteHeader(http.StatusNotFound)
+		return errors.Errorf(ctx, "cgroup '%s' is not monitored", name)
+	}
+	window, err := c.statsWindow(req)
+	if err != nil {
+		return errors.Wrap(ctx, err, "parse stats window")
+	}
+
+	usage, err := c.cgroupUsage(ctx, name, window)
+	if errors.Is(err, resources.ErrNotCollected) {
+		return writeNotCollected(ctx, res, err)
+	} else if err != nil {
+		return errors.Wrap(ctx, err, "get cgroup usage")
+	}
+
+	res.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(res).Encode(&usage)
+	if err != nil {
+		log.WithError(err).Error("Fail to encode cgroup usage payload")
+	}
+	return nil
+}
+
+func (c Controller) CgroupsUsageHandler(res http.ResponseWriter, req *http.Request, _ map[string]string) error {
+	ctx := req.Context()
+	log := logger.Get(ctx)
+	window, err := c.statsWindow(req)
+	if err != nil {
+		return errors.Wrap(ctx, err, "parse stats window")
+	}
+
+	usages := client.CgroupsUsage{}
+	for _, name := range c.cgroups {
+		usage, err := c.cgroupUsage(ctx, name, window)
+		if err != nil {
+			log.WithError(err).WithField("cgroup", name).Info("Fail to get cgroup usage")
+			continue
+		}
+		usages[name] = usage
+	}
+
+	res.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(res).Encode(&usages)
+	if err != nil {
+		log.WithError(err).Error("Fail to encode cgroups usage payload")
+	}
+	return nil
+}
+
+func (c Controller) cgroupUsage(ctx context.Context, name string, window time.Duration) (client.Usage, error) {
+	resourceUsage, err := c.resources.GetCgroupUsage(ctx, name)
+	if err != nil {
+		return client.Usage{}, errors.Wrap(ctx, err, "get cgroup resources usage")
+	}
+
+	cpuUsage, err := c.cpu.GetCgroupUsage(name)
+	if err != nil {
+		return client.Usage{}, errors.Wrap(ctx, err, "get cgroup cpu usage")
+	}
+
+	usage := client.Usage{
+		Cpu:    (*client.CpuUsage)(&cpuUsage),
+		Memory: &resourceUsage.Memory,
+		IO:     &resourceUsage.IO,
+	}
+	c.addSmoothed(cgroup.CgroupPath(name), &usage)
+	c.addForecast(cgroup.CgroupPath(name), &usage)
+	c.addWindow(cgroup.CgroupPath(name), window, &usage)
+	c.omitDisabled(&usage)
+	return usage, nil
+}
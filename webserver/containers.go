@@ -1,11 +1,23 @@
 package webserver
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"math"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Scalingo/acadock-monitoring/v2/client"
+	"github.com/Scalingo/acadock-monitoring/v2/config"
+	"github.com/Scalingo/acadock-monitoring/v2/cpu"
 	"github.com/Scalingo/acadock-monitoring/v2/docker"
+	"github.com/Scalingo/acadock-monitoring/v2/net"
+	"github.com/Scalingo/acadock-monitoring/v2/resources"
+	"github.com/Scalingo/go-handlers"
 	"github.com/Scalingo/go-utils/errors/v3"
 	"github.com/Scalingo/go-utils/logger"
 )
@@ -13,11 +25,24 @@ import (
 func (c Controller) ContainerUsageHandler(res http.ResponseWriter, req *http.Request, params map[string]string) error {
 	ctx := req.Context()
 	log := logger.Get(ctx)
-	id := params["id"]
-	usage := client.Usage{}
+	container, err := c.resolveContainer(res, req, params["ref"])
+	if err != nil {
+		return errors.Wrap(ctx, err, "resolve container")
+	}
+	window, err := c.statsWindow(req)
+	if err != nil {
+		return errors.Wrap(ctx, err, "parse stats window")
+	}
+	id := container.ID
+	usage := client.Usage{
+		State:        string(container.State),
+		RestartCount: container.RestartCount,
+	}
 
 	resourceUsage, err := c.resources.GetUsage(ctx, id)
-	if err != nil {
+	if errors.Is(err, resources.ErrNotCollected) {
+		return writeNotCollected(ctx, res, err)
+	} else if err != nil {
 		return errors.Wrap(ctx, err, "get container resources usage")
 	}
 	usage.Memory = &resourceUsage.Memory
@@ -34,6 +59,10 @@ func (c Controller) ContainerUsageHandler(res http.ResponseWriter, req *http.Req
 		return errors.Wrap(ctx, err, "get container network usage")
 	}
 	usage.Net = (*client.NetUsage)(&netUsage)
+	c.addSmoothed(id, &usage)
+	c.addForecast(id, &usage)
+	c.addWindow(id, window, &usage)
+	c.omitDisabled(&usage)
 
 	res.WriteHeader(200)
 	err = json.NewEncoder(res).Encode(&usage)
@@ -46,12 +75,28 @@ func (c Controller) ContainerUsageHandler(res http.ResponseWriter, req *http.Req
 func (c Controller) ContainerMemUsageHandler(res http.ResponseWriter, req *http.Request, params map[string]string) error {
 	ctx := req.Context()
 	log := logger.Get(ctx)
-	id := params["id"]
+	err := c.requireCollectors(res, req, resources.MemoryCollectorName)
+	if err != nil {
+		return err
+	}
+	container, err := c.resolveContainer(res, req, params["ref"])
+	if err != nil {
+		return errors.Wrap(ctx, err, "resolve container")
+	}
+	id := container.ID
 
 	containerMemoryUsage, err := c.resources.GetMemoryUsage(ctx, id)
-	if err != nil {
+	if errors.Is(err, resources.ErrNotCollected) {
+		return writeNotCollected(ctx, res, err)
+	} else if err != nil {
 		return errors.Wrap(ctx, err, "get container memory usage")
 	}
+	if c.smoothed != nil {
+		containerMemoryUsage.Smoothed = c.smoothed.Memory(id)
+	}
+	if c.forecast != nil {
+		c.forecast.AddMemoryForecast(id, &containerMemoryUsage)
+	}
 
 	res.WriteHeader(200)
 	err = json.NewEncoder(res).Encode(&containerMemoryUsage)
@@ -64,10 +109,20 @@ func (c Controller) ContainerMemUsageHandler(res http.ResponseWriter, req *http.
 func (c Controller) ContainerIOUsageHandler(res http.ResponseWriter, req *http.Request, params map[string]string) error {
 	ctx := req.Context()
 	log := logger.Get(ctx)
-	id := params["id"]
+	err := c.requireCollectors(res, req, resources.IOCollectorName)
+	if err != nil {
+		return err
+	}
+	container, err := c.resolveContainer(res, req, params["ref"])
+	if err != nil {
+		return errors.Wrap(ctx, err, "resolve container")
+	}
+	id := container.ID
 
 	containerIOUsage, err := c.resources.GetIOUsage(ctx, id)
-	if err != nil {
+	if errors.Is(err, resources.ErrNotCollected) {
+		return writeNotCollected(ctx, res, err)
+	} else if err != nil {
 		return errors.Wrap(ctx, err, "get container io usage")
 	}
 
@@ -82,12 +137,23 @@ func (c Controller) ContainerIOUsageHandler(res http.ResponseWriter, req *http.R
 func (c Controller) ContainerCPUUsageHandler(res http.ResponseWriter, req *http.Request, params map[string]string) error {
 	ctx := req.Context()
 	log := logger.Get(ctx)
-	id := params["id"]
+	err := c.requireCollectors(res, req, cpu.CollectorName, cpu.HostCollectorName)
+	if err != nil {
+		return err
+	}
+	container, err := c.resolveContainer(res, req, params["ref"])
+	if err != nil {
+		return errors.Wrap(ctx, err, "resolve container")
+	}
+	id := container.ID
 
 	containerCpuUsage, err := c.cpu.GetContainerUsage(id)
 	if err != nil {
 		return errors.Wrap(ctx, err, "get container cpu usage")
 	}
+	if c.smoothed != nil {
+		containerCpuUsage.Smoothed = c.smoothed.CPU(id)
+	}
 
 	res.WriteHeader(200)
 	err = json.NewEncoder(res).Encode(&containerCpuUsage)
@@ -100,12 +166,23 @@ func (c Controller) ContainerCPUUsageHandler(res http.ResponseWriter, req *http.
 func (c Controller) ContainerNetUsageHandler(res http.ResponseWriter, req *http.Request, params map[string]string) error {
 	ctx := req.Context()
 	log := logger.Get(ctx)
-	id := params["id"]
+	err := c.requireCollectors(res, req, net.CollectorName)
+	if err != nil {
+		return err
+	}
+	container, err := c.resolveContainer(res, req, params["ref"])
+	if err != nil {
+		return errors.Wrap(ctx, err, "resolve container")
+	}
+	id := container.ID
 
 	containerNet, err := c.net.GetUsage(id)
 	if err != nil {
 		return errors.Wrap(ctx, err, "get container network usage")
 	}
+	if c.smoothed != nil {
+		containerNet.Smoothed = c.smoothed.Net(id)
+	}
 
 	res.WriteHeader(200)
 	err = json.NewEncoder(res).Encode(&containerNet)
@@ -119,8 +196,16 @@ func (c Controller) ContainersUsageHandler(res http.ResponseWriter, req *http.Re
 	ctx := req.Context()
 	log := logger.Get(ctx)
 
-	usage := client.NewContainersUsage()
-	containers, err := docker.ListContainers(ctx)
+	selectors, err := labelSelectors(req)
+	if err != nil {
+		return errors.Wrap(ctx, err, "parse label selectors")
+	}
+	window, err := c.statsWindow(req)
+	if err != nil {
+		return errors.Wrap(ctx, err, "parse stats window")
+	}
+
+	usage, err := c.containersUsage(ctx, selectors, window)
 	if err != nil {
 		log.WithError(err).Error("Fail to list containers")
 
@@ -133,7 +218,27 @@ func (c Controller) ContainersUsageHandler(res http.ResponseWriter, req *http.Re
 		return nil
 	}
 
+	res.WriteHeader(200)
+	err = json.NewEncoder(res).Encode(&usage)
+	if err != nil {
+		log.WithError(err).Error("Fail to encode containers usage payload")
+	}
+	return nil
+}
+
+// containersUsage returns the usage of all the containers matching the label selectors, with their
+// statistics over window if it isn't zero. The containers whose usage can't be read are skipped.
+func (c Controller) containersUsage(ctx context.Context, selectors docker.LabelSelectors, window time.Duration) (client.ContainersUsage, error) {
+	usage := client.NewContainersUsage()
+	containers, err := c.containers.Containers(ctx)
+	if err != nil {
+		return nil, errors.Wrap(ctx, err, "list containers")
+	}
+
 	for _, container := range containers {
+		if !selectors.Matches(container.Labels) {
+			continue
+		}
 		ctx, log := logger.WithFieldToCtx(ctx, "container_id", container.ID)
 		cpuUsage, err := c.cpu.GetContainerUsage(container.ID)
 		if err != nil {
@@ -153,19 +258,100 @@ func (c Controller) ContainersUsageHandler(res http.ResponseWriter, req *http.Re
 			continue
 		}
 
-		usage[container.ID] = client.Usage{
-			Cpu:    (*client.CpuUsage)(&cpuUsage),
-			Memory: &resourceUsage.Memory,
-			IO:     &resourceUsage.IO,
-			Net:    (*client.NetUsage)(&netUsage),
-			Labels: container.Labels,
+		containerUsage := client.Usage{
+			Cpu:          (*client.CpuUsage)(&cpuUsage),
+			Memory:       &resourceUsage.Memory,
+			IO:           &resourceUsage.IO,
+			Net:          (*client.NetUsage)(&netUsage),
+			Labels:       container.Labels,
+			State:        string(container.State),
+			RestartCount: container.RestartCount,
 		}
+		c.addSmoothed(container.ID, &containerUsage)
+		c.addForecast(container.ID, &containerUsage)
+		c.addWindow(container.ID, window, &containerUsage)
+		c.omitDisabled(&containerUsage)
+		usage[container.ID] = containerUsage
 	}
 
-	res.WriteHeader(200)
-	err = json.NewEncoder(res).Encode(&usage)
+	return usage, nil
+}
+
+// resolveContainer finds the container matching the reference given in the URL: a full ID, a name
+// or a unique ID prefix. As long as the inventory is not synchronized with Docker, the reference is
+// considered to be a full ID.
+func (c Controller) resolveContainer(res http.ResponseWriter, req *http.Request, ref string) (docker.Container, error) {
+	ctx := req.Context()
+
+	container, err := c.containers.Container(ctx, ref)
+	if errors.Is(err, docker.ErrInventoryNotSynced) {
+		return docker.Container{ID: ref}, nil
+	} else if errors.Is(err, docker.ErrContainerNotFound) {
+		res.WriteHeader(http.StatusNotFound)
+		return docker.Container{}, errors.Wrapf(ctx, err, "find container '%s'", ref)
+	} else if errors.Is(err, docker.ErrAmbiguousReference) {
+		badRequest := handlers.NewBadRequestErrors()
+		badRequest.Errors["ref"] = []string{fmt.Sprintf("'%s' matches several containers", ref)}
+		return docker.Container{}, badRequest
+	} else if err != nil {
+		return docker.Container{}, errors.Wrapf(ctx, err, "find container '%s'", ref)
+	}
+	return container, nil
+}
+
+// writeNotCollected answers 503 to a request for a target which hasn't been collected yet, e.g. a
+// container started since the last collection, the client should retry after the next collection.
+// The error isn't returned as it isn't an internal error.
+func writeNotCollected(ctx context.Context, res http.ResponseWriter, err error) error {
+	log := logger.Get(ctx)
+
+	retryAfter := math.Ceil(config.Current().RefreshTime.Seconds())
+	res.Header().Set("Retry-After", strconv.Itoa(int(retryAfter)))
+	res.WriteHeader(http.StatusServiceUnavailable)
+	errs := map[string]string{"message": "the metrics haven't been collected yet", "error": err.Error()}
+	err = json.NewEncoder(res).Encode(&errs)
 	if err != nil {
-		log.WithError(err).Error("Fail to encode containers usage payload")
+		log.WithError(err).Error("Fail to encode not collected error payload")
 	}
 	return nil
 }
+
+// labelSelectors parses the label selectors of the request query, e.g. ?label=app=web&label=env!=staging
+func labelSelectors(req *http.Request) (docker.LabelSelectors, error) {
+	return queryLabelSelectors(req, "label")
+}
+
+// queryLabelSelectors parses the label selectors of a parameter of the request query
+func queryLabelSelectors(req *http.Request, param string) (docker.LabelSelectors, error) {
+	ctx := req.Context()
+
+	selectors, err := docker.ParseLabelSelectors(ctx, req.URL.Query()[param])
+	if err != nil {
+		badRequest := handlers.NewBadRequestErrors()
+		badRequest.Errors[param] = []string{err.Error()}
+		return nil, badRequest
+	}
+	return selectors, nil
+}
+
+// statsWindow parses the window of the statistics requested in the query, e.g. ?window=5m, it
+// returns zero if no window is requested
+func (c Controller) statsWindow(req *http.Request) (time.Duration, error) {
+	value := req.URL.Query().Get("window")
+	if value == "" {
+		return 0, nil
+	}
+	window, err := time.ParseDuration(value)
+	if err != nil || c.windows == nil || !slices.Contains(c.windows.Lengths(), window) {
+		var lengths []string
+		if c.windows != nil {
+			for _, length := range c.windows.Lengths() {
+				lengths = append(lengths, length.String())
+			}
+		}
+		badRequest := handlers.NewBadRequestErrors()
+		badRequest.Errors["window"] = []string{fmt.Sprintf("'%s' is not one of the configured windows: %s", value, strings.Join(lengths, ", "))}
+		return 0, badRequest
+	}
+	return window, nil
+}
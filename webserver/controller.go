@@ -1,28 +1,78 @@
 package webserver
 
 import (
+	"github.com/Scalingo/acadock-monitoring/v2/accounting"
+	"github.com/Scalingo/acadock-monitoring/v2/alerts"
+	"github.com/Scalingo/acadock-monitoring/v2/anomalies"
+	"github.com/Scalingo/acadock-monitoring/v2/collector"
 	"github.com/Scalingo/acadock-monitoring/v2/cpu"
+	"github.com/Scalingo/acadock-monitoring/v2/docker"
 	"github.com/Scalingo/acadock-monitoring/v2/filters"
+	"github.com/Scalingo/acadock-monitoring/v2/forecast"
+	"github.com/Scalingo/acadock-monitoring/v2/history"
 	"github.com/Scalingo/acadock-monitoring/v2/net"
 	"github.com/Scalingo/acadock-monitoring/v2/procfs"
 	"github.com/Scalingo/acadock-monitoring/v2/resources"
+	"github.com/Scalingo/acadock-monitoring/v2/smoothing"
+	"github.com/Scalingo/acadock-monitoring/v2/windows"
 )
 
 type Controller struct {
+	containers   docker.ContainerRepository
 	resources    resources.UsageGetter
 	cpu          *cpu.CPUUsageMonitor
 	net          *net.NetMonitor
-	queue        filters.MetricsReader
+	queue        filters.MetricsReader // nil if the queue length monitoring is disabled
+	smoothed     *smoothing.Monitor
+	windows      *windows.Monitor
+	forecast     *forecast.Monitor
+	anomalies    *anomalies.Monitor
+	alerts       *alerts.Engine
+	accounting   *accounting.Ledger
+	history      *history.Store // nil if the history isn't kept
 	procfsMemory procfs.MemInfoReader
+	cgroups      []string
+	collectors   *collector.Registry
+	diagnostics  Diagnostics
 }
 
-func NewController(resourceUsage resources.UsageGetter, cpu *cpu.CPUUsageMonitor, net *net.NetMonitor,
-	queue filters.MetricsReader, procfsMemory procfs.MemInfoReader) Controller {
+// ControllerDeps are the dependencies of the handlers of the controller
+type ControllerDeps struct {
+	Containers   docker.ContainerRepository
+	Resources    resources.UsageGetter
+	CPU          *cpu.CPUUsageMonitor
+	Net          *net.NetMonitor
+	Queue        filters.MetricsReader // nil if the queue length monitoring is disabled
+	Smoothed     *smoothing.Monitor
+	Windows      *windows.Monitor
+	Forecast     *forecast.Monitor
+	Anomalies    *anomalies.Monitor
+	Alerts       *alerts.Engine
+	Accounting   *accounting.Ledger
+	History      *history.Store // nil if the history isn't kept
+	ProcfsMemory procfs.MemInfoReader
+	Cgroups      []string
+	Collectors   *collector.Registry
+	Diagnostics  Diagnostics
+}
+
+func NewController(deps ControllerDeps) Controller {
 	return Controller{
-		resources:    resourceUsage,
-		cpu:          cpu,
-		net:          net,
-		queue:        queue,
-		procfsMemory: procfsMemory,
+		containers:   deps.Containers,
+		resources:    deps.Resources,
+		cpu:          deps.CPU,
+		net:          deps.Net,
+		queue:        deps.Queue,
+		smoothed:     deps.Smoothed,
+		windows:      deps.Windows,
+		forecast:     deps.Forecast,
+		anomalies:    deps.Anomalies,
+		alerts:       deps.Alerts,
+		accounting:   deps.Accounting,
+		history:      deps.History,
+		procfsMemory: deps.ProcfsMemory,
+		cgroups:      deps.Cgroups,
+		collectors:   deps.Collectors,
+		diagnostics:  deps.Diagnostics,
 	}
 }
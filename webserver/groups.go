@@ -0,0 +1,127 @@
+package webserver
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Scalingo/acadock-monitoring/v2/client"
+	"github.com/Scalingo/go-handlers"
+	"github.com/Scalingo/go-utils/errors/v3"
+	"github.com/Scalingo/go-utils/logger"
+)
+
+func (c Controller) GroupsUsageHandler(res http.ResponseWriter, req *http.Request, _ map[string]string) error {
+	ctx := req.Context()
+	log := logger.Get(ctx)
+
+	label := req.URL.Query().Get("by")
+	if label == "" {
+		badRequest := handlers.NewBadRequestErrors()
+		badRequest.Errors["by"] = []string{"label used to group the containers is mandatory"}
+		return badRequest
+	}
+
+	selectors, err := labelSelectors(req)
+	if err != nil {
+		return errors.Wrap(ctx, err, "parse label selectors")
+	}
+
+	usage, err := c.containersUsage(ctx, selectors, 0)
+	if err != nil {
+		return errors.Wrap(ctx, err, "get containers usage")
+	}
+
+	res.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(res).Encode(groupsUsage(usage, label))
+	if err != nil {
+		log.WithError(err).Error("Fail to encode groups usage payload")
+	}
+	return nil
+}
+
+// groupsUsage aggregates the usage of the containers by value of the given label. Containers
+// without this label are ignored.
+func groupsUsage(containersUsage client.ContainersUsage, label string) client.GroupsUsage {
+	groups := client.GroupsUsage{}
+	for id, usage := range containersUsage {
+		value, ok := usage.Labels[label]
+		if !ok {
+			continue
+		}
+
+		group, ok := groups[value]
+		if !ok {
+			group = client.GroupUsage{Members: client.NewContainersUsage()}
+		}
+		metrics := groupMetrics(usage)
+		group.Sum = sumGroupMetrics(group.Sum, metrics)
+		group.Max = maxGroupMetrics(group.Max, metrics)
+		group.Members[id] = usage
+		groups[value] = group
+	}
+	return groups
+}
+
+func groupMetrics(usage client.Usage) client.GroupMetrics {
+	var metrics client.GroupMetrics
+	if usage.Cpu != nil {
+		metrics.CPUUsageInPercents = usage.Cpu.UsageInPercents
+	}
+	if usage.Memory != nil {
+		metrics.MemoryUsage = usage.Memory.MemoryUsage
+		metrics.MemoryLimit = usage.Memory.MemoryLimit
+		metrics.SwapUsage = usage.Memory.SwapUsage
+		metrics.SwapLimit = usage.Memory.SwapLimit
+	}
+	if usage.IO != nil {
+		for _, device := range usage.IO.Devices {
+			metrics.IOReadBytes += device.ReadBytes
+			metrics.IOWriteBytes += device.WriteBytes
+			metrics.IOReadIOs += device.ReadIOs
+			metrics.IOWriteIOs += device.WriteIOs
+		}
+	}
+	if usage.Net != nil {
+		metrics.NetRxBytes = usage.Net.Received.Bytes
+		metrics.NetTxBytes = usage.Net.Transmit.Bytes
+		metrics.NetRxBps = usage.Net.RxBps
+		metrics.NetTxBps = usage.Net.TxBps
+	}
+	return metrics
+}
+
+func sumGroupMetrics(a, b client.GroupMetrics) client.GroupMetrics {
+	return client.GroupMetrics{
+		CPUUsageInPercents: a.CPUUsageInPercents + b.CPUUsageInPercents,
+		MemoryUsage:        a.MemoryUsage + b.MemoryUsage,
+		MemoryLimit:        a.MemoryLimit + b.MemoryLimit,
+		SwapUsage:          a.SwapUsage + b.SwapUsage,
+		SwapLimit:          a.SwapLimit + b.SwapLimit,
+		IOReadBytes:        a.IOReadBytes + b.IOReadBytes,
+		IOWriteBytes:       a.IOWriteBytes + b.IOWriteBytes,
+		IOReadIOs:          a.IOReadIOs + b.IOReadIOs,
+		IOWriteIOs:         a.IOWriteIOs + b.IOWriteIOs,
+		NetRxBytes:         a.NetRxBytes + b.NetRxBytes,
+		NetTxBytes:         a.NetTxBytes + b.NetTxBytes,
+		NetRxBps:           a.NetRxBps + b.NetRxBps,
+		NetTxBps:           a.NetTxBps + b.NetTxBps,
+	}
+}
+
+func maxGroupMetrics(a, b client.GroupMetrics) client.GroupMetrics {
+	return client.GroupMetrics{
+		CPUUsageInPercents: max(a.CPUUsageInPercents, b.CPUUsageInPercents),
+		MemoryUsage:        max(a.MemoryUsage, b.MemoryUsage),
+		MemoryLimit:        max(a.MemoryLimit, b.MemoryLimit),
+		SwapUsage:          max(a.SwapUsage, b.SwapUsage),
+		SwapLimit:          max(a.SwapLimit, b.SwapLimit),
+		IOReadBytes:        max(a.IOReadBytes, b.IOReadBytes),
+		IOWriteBytes:       max(a.IOWriteBytes, b.IOWriteBytes),
+		IOReadIOs:          max(a.IOReadIOs, b.IOReadIOs),
+		IOWriteIOs:         max(a.IOWriteIOs, b.IOWriteIOs),
+		NetRxBytes:         max(a.NetRxBytes, b.NetRxBytes),
+		NetTxBytes:         max(a.NetTxBytes, b.NetTxBytes),
+		NetRxBps:           max(a.NetRxBps, b.NetRxBps),
+		NetTxBps:           max(a.NetTxBps, b.NetTxBps),
+	}
+}
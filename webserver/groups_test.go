@@ -0,0 +1,57 @@
+package webserver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Scalingo/acadock-monitoring/v2/client"
+)
+
+func TestGroupsUsage(t *testing.T) {
+	web1 := client.Usage{
+		Cpu:    &client.CpuUsage{UsageInPercents: 10},
+		Memory: &client.MemoryUsage{MemoryUsage: 100, MemoryLimit: 512},
+		IO:     &client.IOUsage{Devices: []client.IODeviceUsage{{ReadBytes: 1, WriteBytes: 2}, {ReadBytes: 3, WriteBytes: 4}}},
+		Labels: map[string]string{"app": "web"},
+	}
+	web2 := client.Usage{
+		Cpu:    &client.CpuUsage{UsageInPercents: 30},
+		Memory: &client.MemoryUsage{MemoryUsage: 50, MemoryLimit: 512},
+		Net:    &client.NetUsage{RxBps: 10, TxBps: 20},
+		Labels: map[string]string{"app": "web"},
+	}
+	worker := client.Usage{
+		Cpu:    &client.CpuUsage{UsageInPercents: 5},
+		Labels: map[string]string{"app": "worker"},
+	}
+	withoutApp := client.Usage{
+		Cpu:    &client.CpuUsage{UsageInPercents: 99},
+		Labels: map[string]string{},
+	}
+
+	groups := groupsUsage(client.ContainersUsage{"1": web1, "2": web2, "3": worker, "4": withoutApp}, "app")
+
+	require.Len(t, groups, 2)
+	assert.Equal(t, client.GroupMetrics{
+		CPUUsageInPercents: 40,
+		MemoryUsage:        150,
+		MemoryLimit:        1024,
+		IOReadBytes:        4,
+		IOWriteBytes:       6,
+		NetRxBps:           10,
+		NetTxBps:           20,
+	}, groups["web"].Sum)
+	assert.Equal(t, client.GroupMetrics{
+		CPUUsageInPercents: 30,
+		MemoryUsage:        100,
+		MemoryLimit:        512,
+		IOReadBytes:        4,
+		IOWriteBytes:       6,
+		NetRxBps:           10,
+		NetTxBps:           20,
+	}, groups["web"].Max)
+	assert.Equal(t, client.ContainersUsage{"1": web1, "2": web2}, groups["web"].Members)
+	assert.Equal(t, 5, groups["worker"].Sum.CPUUsageInPercents)
+}
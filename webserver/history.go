@@ -0,0 +1,85 @@
+package webserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Scalingo/acadock-monitoring/v2/cgroup"
+	"github.com/Scalingo/acadock-monitoring/v2/client"
+	"github.com/Scalingo/acadock-monitoring/v2/docker"
+	"github.com/Scalingo/acadock-monitoring/v2/gauges"
+	"github.com/Scalingo/go-handlers"
+	"github.com/Scalingo/go-utils/errors/v3"
+	"github.com/Scalingo/go-utils/logger"
+)
+
+// defaultHistoryPeriod is the period of the history if from isn't requested
+const defaultHistoryPeriod = time.Hour
+
+// historyMetrics are the metrics kept in the history
+var historyMetrics = []string{
+	gauges.HostCPU, gauges.CPU, gauges.CPUThrottled, gauges.Memory, gauges.IOReadBps, gauges.IOWriteBps, gauges.NetRxBps, gauges.NetTxBps,
+}
+
+// HistoryHandler returns the history of the metrics of the target requested with ?target=, between
+// the RFC 3339 times ?from=&to=, the last hour by default. The metrics can be restricted with
+// ?metric=cpu&metric=memory. It returns 404 if the history isn't kept.
+func (c Controller) HistoryHandler(res http.ResponseWriter, req *http.Request, _ map[string]string) error {
+	ctx := req.Context()
+	log := logger.Get(ctx)
+	query := req.URL.Query()
+
+	if c.history == nil {
+		res.WriteHeader(http.StatusNotFound)
+		return errors.New(ctx, "the history is not kept, HISTORY_DIR is not configured")
+	}
+
+	badRequest := handlers.NewBadRequestErrors()
+	ref := query.Get("target")
+	if ref == "" {
+		badRequest.Errors["target"] = []string{"target is mandatory"}
+	}
+	for _, metric := range query["metric"] {
+		if !slices.Contains(historyMetrics, metric) {
+			badRequest.Errors["metric"] = append(badRequest.Errors["metric"], fmt.Sprintf("'%s' is not one of %s", metric, strings.Join(historyMetrics, ", ")))
+		}
+	}
+	if len(badRequest.Errors) > 0 {
+		return badRequest
+	}
+	from, to, err := period(req, defaultHistoryPeriod)
+	if err != nil {
+		return err
+	}
+
+	// The target is either the host, a monitored cgroup or a container. The container may have been
+	// stopped since, it can then only be referenced by its full ID.
+	target := ref
+	if name := strings.Trim(ref, "/"); slices.Contains(c.cgroups, name) {
+		target = cgroup.CgroupPath(name)
+	} else if ref != gauges.HostTarget {
+		container, err := c.containers.Container(ctx, ref)
+		if errors.Is(err, docker.ErrAmbiguousReference) {
+			badRequest.Errors["target"] = []string{fmt.Sprintf("'%s' matches several containers", ref)}
+			return badRequest
+		} else if err == nil {
+			target = container.ID
+		}
+	}
+
+	metrics, err := c.history.History(ctx, target, query["metric"], from, to)
+	if err != nil {
+		return errors.Wrapf(ctx, err, "get history of '%s'", target)
+	}
+	history := client.History{Target: target, From: from, To: to, Metrics: metrics}
+	res.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(res).Encode(&history)
+	if err != nil {
+		log.WithError(err).Error("Fail to encode history payload")
+	}
+	return nil
+}
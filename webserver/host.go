@@ -5,8 +5,9 @@ import (
 	"net/http"
 
 	"github.com/Scalingo/acadock-monitoring/v2/client"
-	"github.com/Scalingo/acadock-monitoring/v2/docker"
+	"github.com/Scalingo/acadock-monitoring/v2/cpu"
 	"github.com/Scalingo/acadock-monitoring/v2/filters"
+	"github.com/Scalingo/acadock-monitoring/v2/resources"
 	"github.com/Scalingo/go-utils/errors/v3"
 	"github.com/Scalingo/go-utils/logger"
 )
@@ -15,50 +16,87 @@ func (c Controller) HostResourcesHandler(res http.ResponseWriter, req *http.Requ
 	ctx := req.Context()
 	log := logger.Get(ctx)
 
-	cpu, err := c.cpu.GetHostUsage()
-	if err != nil {
-		return errors.Wrap(ctx, err, "get host cpu usage")
+	var disabled []string
+	if !c.collectors.IsEnabled(cpu.HostCollectorName) {
+		disabled = append(disabled, cpu.HostCollectorName)
+	}
+	if !c.collectors.IsEnabled(resources.MemoryCollectorName) {
+		disabled = append(disabled, resources.MemoryCollectorName)
 	}
 
-	queueLength, err := c.queue.Read(ctx)
-	if err != nil && err != filters.ErrNotEnoughMetrics {
-		return errors.Wrap(ctx, err, "get current queue length")
+	var result client.HostUsage
+	if c.collectors.IsEnabled(cpu.HostCollectorName) {
+		hostCPU, err := c.cpu.GetHostUsage()
+		if err != nil {
+			return errors.Wrap(ctx, err, "get host cpu usage")
+		}
+		if c.smoothed != nil {
+			hostCPU.Smoothed = c.smoothed.HostCPU()
+		}
+		result.CPU = &hostCPU
 	}
-	cpu.QueueLengthExponentiallySmoothed = queueLength
 
-	hostMemory, err := c.procfsMemory.Read(ctx)
-	if err != nil {
-		return errors.Wrap(ctx, err, "get host memory usage")
+	if c.queue != nil {
+		if result.CPU != nil {
+			queueLength, err := c.queue.Read(ctx)
+			if err != nil && err != filters.ErrNotEnoughMetrics {
+				return errors.Wrap(ctx, err, "get current queue length")
+			}
+			result.CPU.QueueLengthExponentiallySmoothed = queueLength
+		}
+	} else {
+		disabled = append(disabled, queueLengthSubsystem)
 	}
 
-	containers, err := docker.ListContainers(ctx)
-	if err != nil {
-		return errors.Wrap(ctx, err, "list docker containers")
+	if c.collectors.IsEnabled(resources.MemoryCollectorName) {
+		hostMemory, err := c.procfsMemory.Read(ctx)
+		if err != nil {
+			return errors.Wrap(ctx, err, "get host memory usage")
+		}
+		result.Memory = &client.HostMemoryUsage{
+			Free:  hostMemory.FreeBuffers() / 1024 / 1024,
+			Total: hostMemory.MemTotal / 1024 / 1024,
+			Swap:  hostMemory.SwapUsed() / 1024 / 1024,
+		}
 	}
 
-	labelFilter := req.URL.Query().Get("include_container_if_label")
+	containers, err := c.containers.Containers(ctx)
+	if err != nil {
+		return errors.Wrap(ctx, err, "list containers")
+	}
 
-	memory := client.HostMemoryUsage{
-		Free:  hostMemory.FreeBuffers() / 1024 / 1024,
-		Total: hostMemory.MemTotal / 1024 / 1024,
-		Swap:  hostMemory.SwapUsed() / 1024 / 1024,
+	selectors, err := labelSelectors(req)
+	if err != nil {
+		return errors.Wrap(ctx, err, "parse label selectors")
+	}
+	// Deprecated: include_container_if_label=key is equivalent to label=key
+	deprecatedSelectors, err := queryLabelSelectors(req, "include_container_if_label")
+	if err != nil {
+		return errors.Wrap(ctx, err, "parse label selectors")
 	}
+	selectors = append(selectors, deprecatedSelectors...)
 
 	for _, container := range containers {
 		ctx, log := logger.WithFieldToCtx(ctx, "container_id", container.ID)
-		if labelFilter != "" {
-			_, ok := container.Labels[labelFilter]
-			if !ok {
-				continue
-			}
+		if !selectors.Matches(container.Labels) {
+			continue
 		}
 
+		if result.CPU != nil {
+			if limit, ok := c.cpu.GetContainerLimit(container.ID); ok {
+				result.CPU.Committed += limit.Quota
+			}
+		}
+		if result.Memory == nil {
+			continue
+		}
 		usage, err := c.resources.GetMemoryUsage(ctx, container.ID)
 		if err != nil {
 			log.WithError(err).Infof("Fail to get memory usage")
 			continue
 		}
 
+		memory := result.Memory
 		memory.MemoryUsage += uint64(usage.MemoryUsage)
 		memory.MemoryCommitted += uint64(usage.MemoryLimit)
 		memory.MaxMemoryUsage += uint64(usage.MaxMemoryUsage)
@@ -66,11 +104,7 @@ func (c Controller) HostResourcesHandler(res http.ResponseWriter, req *http.Requ
 		memory.SwapUsage += uint64(usage.SwapUsage)
 		memory.MaxSwapUsage += uint64(usage.MaxSwapUsage)
 	}
-
-	result := client.HostUsage{
-		CPU:    cpu,
-		Memory: memory,
-	}
+	result.Disabled = disabled
 
 	res.WriteHeader(200)
 	err = json.NewEncoder(res).Encode(&result)
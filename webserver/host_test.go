@@ -0,0 +1,43 @@
+package webserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Scalingo/acadock-monitoring/v2/cpu"
+	"github.com/Scalingo/acadock-monitoring/v2/docker"
+	"github.com/Scalingo/acadock-monitoring/v2/docker/dockermock"
+	"github.com/Scalingo/acadock-monitoring/v2/resources"
+)
+
+func TestController_HostResourcesHandler(t *testing.T) {
+	newController := func(t *testing.T) Controller {
+		ctrl := gomock.NewController(t)
+		containers := dockermock.NewMockContainerRepository(ctrl)
+		containers.EXPECT().Containers(gomock.Any()).Return([]docker.Container{{ID: "1"}}, nil)
+		return Controller{
+			containers: containers,
+			collectors: newTestRegistry(cpu.HostCollectorName, resources.MemoryCollectorName),
+		}
+	}
+
+	t.Run("the blocks of the disabled collectors are omitted", func(t *testing.T) {
+		res := httptest.NewRecorder()
+		err := newController(t).HostResourcesHandler(res, httptest.NewRequest(http.MethodGet, "/host/usage", nil), nil)
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, res.Code)
+		assert.JSONEq(t, `{"disabled": ["host_cpu", "memory", "queue_length"]}`, res.Body.String())
+	})
+
+	t.Run("the deprecated label filter is parsed as a label selector", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/host/usage?include_container_if_label=!", nil)
+		err := newController(t).HostResourcesHandler(httptest.NewRecorder(), req, nil)
+		assert.ErrorContains(t, err, "empty label key")
+	})
+}
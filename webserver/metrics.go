@@ -0,0 +1,56 @@
+package webserver
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/urfave/negroni/v3"
+
+	"github.com/Scalingo/acadock-monitoring/v2/metrics"
+	"github.com/Scalingo/go-handlers"
+	"github.com/Scalingo/go-utils/logger"
+)
+
+var httpRequestDuration = metrics.NewHistogram(
+	"acadock_http_request_duration_seconds", "Duration of the HTTP requests by route and status code",
+	metrics.DefaultBuckets, "route", "code",
+)
+
+// MetricsMiddleware measures the latency of the requests. The route is the path template (e.g.
+// /containers/{ref}/usage) to keep the number of series bounded.
+var MetricsMiddleware = handlers.MiddlewareFunc(func(next handlers.HandlerFunc) handlers.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request, params map[string]string) error {
+		start := time.Now()
+		rw := negroni.NewResponseWriter(res)
+		err := next(rw, req, params)
+
+		route := "unknown"
+		if current := mux.CurrentRoute(req); current != nil {
+			template, templateErr := current.GetPathTemplate()
+			if templateErr == nil {
+				route = template
+			}
+		}
+		status := rw.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		httpRequestDuration.Observe(time.Since(start).Seconds(), route, strconv.Itoa(status))
+		return err
+	}
+})
+
+// MetricsHandler exposes the self-instrumentation metrics in the Prometheus text format
+func (c Controller) MetricsHandler(res http.ResponseWriter, req *http.Request, _ map[string]string) error {
+	log := logger.Get(req.Context())
+
+	res.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	res.WriteHeader(http.StatusOK)
+	_, err := metrics.Default.WriteTo(res)
+	if err != nil {
+		log.WithError(err).Error("Fail to write metrics")
+	}
+	return nil
+}
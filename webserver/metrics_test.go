@@ -0,0 +1,45 @@
+package webserver
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Scalingo/go-handlers"
+)
+
+func TestMetricsMiddleware(t *testing.T) {
+	router := handlers.NewRouter(logrus.New())
+	router.Use(MetricsMiddleware)
+	router.Use(handlers.ErrorMiddleware)
+	router.HandleFunc("/containers/{ref}/usage", func(res http.ResponseWriter, _ *http.Request, params map[string]string) error {
+		if params["ref"] == "unknown" {
+			res.WriteHeader(http.StatusNotFound)
+			return errors.New("not found")
+		}
+		res.WriteHeader(http.StatusOK)
+		return nil
+	})
+
+	okBefore := httpRequestDuration.Count("/containers/{ref}/usage", "200")
+	notFoundBefore := httpRequestDuration.Count("/containers/{ref}/usage", "404")
+	for _, ref := range []string{"web-1", "web-2", "unknown"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/containers/"+ref+"/usage", nil))
+	}
+
+	assert.Equal(t, okBefore+2, httpRequestDuration.Count("/containers/{ref}/usage", "200"))
+	assert.Equal(t, notFoundBefore+1, httpRequestDuration.Count("/containers/{ref}/usage", "404"))
+
+	res := httptest.NewRecorder()
+	err := Controller{}.MetricsHandler(res, httptest.NewRequest(http.MethodGet, "/metrics", nil), nil)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(res.Header().Get("Content-Type"), "text/plain"))
+	assert.Contains(t, res.Body.String(), `acadock_http_request_duration_seconds_count{route="/containers/{ref}/usage",code="404"}`)
+	assert.Contains(t, res.Body.String(), "acadock_goroutines ")
+}
@@ -0,0 +1,248 @@
+package webserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/Scalingo/acadock-monitoring/v2/cgroup"
+	"github.com/Scalingo/acadock-monitoring/v2/client"
+	"github.com/Scalingo/acadock-monitoring/v2/collector"
+	"github.com/Scalingo/acadock-monitoring/v2/config"
+	"github.com/Scalingo/acadock-monitoring/v2/cpu"
+	"github.com/Scalingo/acadock-monitoring/v2/net"
+	"github.com/Scalingo/acadock-monitoring/v2/procfs"
+	"github.com/Scalingo/acadock-monitoring/v2/resources"
+	"github.com/Scalingo/go-utils/errors/v3"
+	"github.com/Scalingo/go-utils/logger"
+)
+
+const (
+	// The queue length and mountinfo subsystems are not collectors of the registry, they run in
+	// their own loop but are reported in the status as host collectors.
+	queueLengthSubsystem = "queue_length"
+	mountInfoSubsystem   = "mountinfo"
+)
+
+// Diagnostics gives access to the internal state of the agent reported by /status, /health and
+// /ready
+type Diagnostics struct {
+	Version   string
+	StartedAt time.Time
+	Collector collector.StatusReader
+	// MountInfos is nil if the mountinfo monitoring is disabled
+	MountInfos MountInfosStatusReader
+}
+
+type MountInfosStatusReader interface {
+	RefreshStatus() procfs.RefreshStatus
+}
+
+type probeResponse struct {
+	OK      bool     `json:"ok"`
+	Reasons []string `json:"reasons,omitempty"`
+}
+
+// HealthHandler is the liveness probe: it fails if the collection loop is stuck
+func (c Controller) HealthHandler(res http.ResponseWriter, req *http.Request, _ map[string]string) error {
+	var reasons []string
+	lastCollectAt := c.diagnostics.Collector.Status().LastCollectAt
+	if lastCollectAt.IsZero() {
+		lastCollectAt = c.diagnostics.StartedAt
+	}
+	// A collection can take longer than the refresh time on a loaded host, the collector is
+	// considered stuck after a few missed iterations
+	if time.Since(lastCollectAt) > 3*config.Current().RefreshTime+30*time.Second {
+		reasons = append(reasons, "collector is stuck, last collection at "+lastCollectAt.Format(time.RFC3339))
+	}
+
+	return c.writeProbe(res, req, reasons)
+}
+
+// ReadyHandler is the readiness probe: it fails as long as the metrics can't be served
+func (c Controller) ReadyHandler(res http.ResponseWriter, req *http.Request, _ map[string]string) error {
+	return c.writeProbe(res, req, c.notReadyReasons())
+}
+
+func (c Controller) StatusHandler(res http.ResponseWriter, req *http.Request, _ map[string]string) error {
+	ctx := req.Context()
+	log := logger.Get(ctx)
+
+	collectorStatus := c.diagnostics.Collector.Status()
+	dockerHealth := c.containers.Health()
+	containers, err := c.containers.Containers(ctx)
+	if err != nil {
+		log.WithError(err).Debug("Fail to list containers")
+	}
+
+	status := client.Status{
+		Version:       c.diagnostics.Version,
+		StartedAt:     c.diagnostics.StartedAt,
+		UptimeSeconds: int64(time.Since(c.diagnostics.StartedAt).Seconds()),
+		Ready:         len(c.notReadyReasons()) == 0,
+		Docker: client.DockerStatus{
+			Connected:   dockerHealth.Connected,
+			Synced:      dockerHealth.Synced,
+			Containers:  len(containers),
+			LastEventAt: timePtr(dockerHealth.LastEventAt),
+			LastSyncAt:  timePtr(dockerHealth.LastSyncAt),
+			LastError:   errorMessage(dockerHealth.LastError),
+			LastErrorAt: timePtr(dockerHealth.LastErrorAt),
+		},
+		Cgroup: client.CgroupStatus{
+			Version: cgroup.Version(),
+			Driver:  cgroup.Driver(),
+		},
+		LastCollectAt: timePtr(collectorStatus.LastCollectAt),
+		Collectors:    c.collectorsStatus(collectorStatus),
+	}
+
+	res.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(res).Encode(&status)
+	if err != nil {
+		log.WithError(err).Error("Fail to encode status payload")
+	}
+	return nil
+}
+
+func (c Controller) notReadyReasons() []string {
+	var reasons []string
+	health := c.containers.Health()
+	if !health.Synced {
+		reasons = append(reasons, "containers inventory not synchronized with docker")
+	}
+	if !health.Connected {
+		reasons = append(reasons, "not connected to docker")
+	}
+	if c.diagnostics.Collector.Status().LastCollectAt.IsZero() {
+		reasons = append(reasons, "no metrics collected yet")
+	}
+	return reasons
+}
+
+func (c Controller) writeProbe(res http.ResponseWriter, req *http.Request, reasons []string) error {
+	log := logger.Get(req.Context())
+
+	status := http.StatusOK
+	if len(reasons) > 0 {
+		status = http.StatusServiceUnavailable
+	}
+	res.WriteHeader(status)
+	err := json.NewEncoder(res).Encode(&probeResponse{OK: len(reasons) == 0, Reasons: reasons})
+	if err != nil {
+		log.WithError(err).Error("Fail to encode probe payload")
+	}
+	return nil
+}
+
+func (c Controller) collectorsStatus(status collector.Status) []client.CollectorStatus {
+	statuses := []client.CollectorStatus{}
+	for _, registered := range c.collectors.All() {
+		collectorStatus := status.Collectors[registered.Name()]
+		statuses = append(statuses, client.CollectorStatus{
+			Name:             registered.Name(),
+			Scope:            string(registered.Scope()),
+			Enabled:          c.collectors.IsEnabled(registered.Name()),
+			MonitoredTargets: collectorStatus.Targets,
+			LastError:        errorMessage(collectorStatus.LastError),
+			LastErrorAt:      timePtr(collectorStatus.LastErrorAt),
+		})
+	}
+
+	statuses = append(statuses, client.CollectorStatus{
+		Name:    queueLengthSubsystem,
+		Scope:   string(collector.ScopeHost),
+		Enabled: c.queue != nil,
+	})
+	mountInfoStatus := client.CollectorStatus{
+		Name:    mountInfoSubsystem,
+		Scope:   string(collector.ScopeHost),
+		Enabled: c.diagnostics.MountInfos != nil,
+	}
+	if c.diagnostics.MountInfos != nil {
+		refreshStatus := c.diagnostics.MountInfos.RefreshStatus()
+		mountInfoStatus.LastError = errorMessage(refreshStatus.LastError)
+		mountInfoStatus.LastErrorAt = timePtr(refreshStatus.LastErrorAt)
+	}
+	return append(statuses, mountInfoStatus)
+}
+
+// requireCollectors writes a 404 and returns an error if one of the collectors is disabled
+func (c Controller) requireCollectors(res http.ResponseWriter, req *http.Request, names ...string) error {
+	for _, name := range names {
+		if !c.collectors.IsEnabled(name) {
+			res.WriteHeader(http.StatusNotFound)
+			return errors.Newf(req.Context(), "collector '%s' is disabled", name)
+		}
+	}
+	return nil
+}
+
+// omitDisabled removes from the usage the blocks filled by disabled collectors and lists these
+// collectors in Disabled, so that clients don't mistake them for zeros.
+func (c Controller) omitDisabled(usage *client.Usage) {
+	if usage.Cpu != nil && (!c.collectors.IsEnabled(cpu.CollectorName) || !c.collectors.IsEnabled(cpu.HostCollectorName)) {
+		usage.Cpu = nil
+		usage.Disabled = append(usage.Disabled, cpu.CollectorName)
+	}
+	if usage.Memory != nil && !c.collectors.IsEnabled(resources.MemoryCollectorName) {
+		usage.Memory = nil
+		usage.Disabled = append(usage.Disabled, resources.MemoryCollectorName)
+	}
+	if usage.IO != nil && !c.collectors.IsEnabled(resources.IOCollectorName) {
+		usage.IO = nil
+		usage.Disabled = append(usage.Disabled, resources.IOCollectorName)
+	}
+	if usage.Net != nil && !c.collectors.IsEnabled(net.CollectorName) {
+		usage.Net = nil
+		usage.Disabled = append(usage.Disabled, net.CollectorName)
+	}
+}
+
+// addSmoothed fills the smoothed values of the usage of a target, they are omitted until enough
+// snapshots have been collected
+func (c Controller) addSmoothed(id string, usage *client.Usage) {
+	if c.smoothed == nil {
+		return
+	}
+	if usage.Cpu != nil {
+		usage.Cpu.Smoothed = c.smoothed.CPU(id)
+	}
+	if usage.Memory != nil {
+		usage.Memory.Smoothed = c.smoothed.Memory(id)
+	}
+	if usage.Net != nil {
+		usage.Net.Smoothed = c.smoothed.Net(id)
+	}
+}
+
+// addForecast fills the forecast of the memory usage of a target
+func (c Controller) addForecast(id string, usage *client.Usage) {
+	if c.forecast == nil || usage.Memory == nil {
+		return
+	}
+	c.forecast.AddMemoryForecast(id, usage.Memory)
+}
+
+// addWindow fills the statistics of the usage of a target over the window, if one is requested
+func (c Controller) addWindow(id string, window time.Duration, usage *client.Usage) {
+	if window == 0 || c.windows == nil {
+		return
+	}
+	usage.Window = c.windows.Usage(id, window)
+}
+
+// timePtr returns nil for the zero time so that it is omitted from the payloads
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func errorMessage(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,173 @@
+package webserver
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Scalingo/acadock-monitoring/v2/client"
+	"github.com/Scalingo/acadock-monitoring/v2/collector"
+	"github.com/Scalingo/acadock-monitoring/v2/cpu"
+	"github.com/Scalingo/acadock-monitoring/v2/docker"
+	"github.com/Scalingo/acadock-monitoring/v2/docker/dockermock"
+	"github.com/Scalingo/acadock-monitoring/v2/net"
+	"github.com/Scalingo/acadock-monitoring/v2/procfs"
+	"github.com/Scalingo/acadock-monitoring/v2/resources"
+)
+
+func newTestRegistry(disabled ...string) *collector.Registry {
+	registry := collector.NewRegistry(disabled)
+	registry.Register(cpu.NewHostCollector(nil))
+	registry.Register(cpu.NewCollector())
+	registry.Register(resources.NewMemoryCollector())
+	registry.Register(resources.NewIOCollector())
+	registry.Register(net.NewCollector(nil, procfs.NetDevReader{}))
+	return registry
+}
+
+type collectorStatus collector.Status
+
+func (s collectorStatus) Status() collector.Status {
+	return collector.Status(s)
+}
+
+func TestController_StatusHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	containers := dockermock.NewMockContainerRepository(ctrl)
+	lastEventAt := time.Now().Add(-time.Minute)
+	containers.EXPECT().Health().Return(docker.Health{Connected: true, Synced: true, LastEventAt: lastEventAt}).AnyTimes()
+	containers.EXPECT().Containers(gomock.Any()).Return([]docker.Container{{ID: "1"}, {ID: "2"}}, nil)
+
+	controller := Controller{
+		containers: containers,
+		collectors: newTestRegistry(net.CollectorName),
+		diagnostics: Diagnostics{
+			Version:   "v2.2.0",
+			StartedAt: time.Now().Add(-time.Hour),
+			Collector: collectorStatus{
+				LastCollectAt: time.Now(),
+				Collectors: map[string]collector.CollectorStatus{
+					"cpu": {Targets: 2, LastError: errors.New("cgroup deleted"), LastErrorAt: time.Now()},
+				},
+			},
+		},
+	}
+
+	res := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/status", nil)
+	err := controller.StatusHandler(res, req, nil)
+	require.NoError(t, err)
+
+	var status client.Status
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&status))
+	assert.Equal(t, "v2.2.0", status.Version)
+	assert.InDelta(t, 3600, status.UptimeSeconds, 1)
+	assert.True(t, status.Ready)
+	assert.True(t, status.Docker.Connected)
+	assert.Equal(t, 2, status.Docker.Containers)
+	require.NotNil(t, status.Docker.LastEventAt)
+	assert.WithinDuration(t, lastEventAt, *status.Docker.LastEventAt, time.Millisecond)
+	assert.Contains(t, []string{"systemd", "cgroupfs"}, status.Cgroup.Driver)
+
+	collectors := map[string]client.CollectorStatus{}
+	for _, c := range status.Collectors {
+		collectors[c.Name] = c
+	}
+	assert.True(t, collectors["cpu"].Enabled)
+	assert.Equal(t, "container", collectors["cpu"].Scope)
+	assert.Equal(t, 2, collectors["cpu"].MonitoredTargets)
+	assert.Equal(t, "cgroup deleted", collectors["cpu"].LastError)
+	assert.Equal(t, "host", collectors["host_cpu"].Scope)
+	assert.False(t, collectors["net"].Enabled)
+	// The queue length and mountinfo are not monitored if the controller has no reader for them
+	assert.False(t, collectors["queue_length"].Enabled)
+	assert.False(t, collectors["mountinfo"].Enabled)
+}
+
+func TestController_ReadyHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	containers := dockermock.NewMockContainerRepository(ctrl)
+	containers.EXPECT().Health().Return(docker.Health{Connected: true})
+
+	controller := Controller{
+		containers:  containers,
+		diagnostics: Diagnostics{Collector: collectorStatus{}},
+	}
+
+	res := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/ready", nil)
+	err := controller.ReadyHandler(res, req, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusServiceUnavailable, res.Code)
+	assert.JSONEq(t, `{"ok": false, "reasons": ["containers inventory not synchronized with docker", "no metrics collected yet"]}`, res.Body.String())
+}
+
+func TestController_HealthHandler(t *testing.T) {
+	t.Run("it is healthy if the collector is running", func(t *testing.T) {
+		controller := Controller{diagnostics: Diagnostics{
+			StartedAt: time.Now().Add(-time.Hour),
+			Collector: collectorStatus{LastCollectAt: time.Now()},
+		}}
+
+		res := httptest.NewRecorder()
+		err := controller.HealthHandler(res, httptest.NewRequest(http.MethodGet, "/health", nil), nil)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, res.Code)
+	})
+
+	t.Run("it is unhealthy if the collector is stuck", func(t *testing.T) {
+		controller := Controller{diagnostics: Diagnostics{
+			StartedAt: time.Now().Add(-time.Hour),
+			Collector: collectorStatus{},
+		}}
+
+		res := httptest.NewRecorder()
+		err := controller.HealthHandler(res, httptest.NewRequest(http.MethodGet, "/health", nil), nil)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusServiceUnavailable, res.Code)
+	})
+}
+
+func TestController_omitDisabled(t *testing.T) {
+	controller := Controller{collectors: newTestRegistry(net.CollectorName, resources.IOCollectorName)}
+
+	usage := client.Usage{
+		Cpu:    &client.CpuUsage{UsageInPercents: 10},
+		Memory: &client.MemoryUsage{MemoryUsage: 10},
+		IO:     &client.IOUsage{},
+		Net:    &client.NetUsage{},
+	}
+	controller.omitDisabled(&usage)
+
+	assert.NotNil(t, usage.Cpu)
+	assert.NotNil(t, usage.Memory)
+	assert.Nil(t, usage.IO)
+	assert.Nil(t, usage.Net)
+	assert.Equal(t, []string{"io", "net"}, usage.Disabled)
+
+	payload, err := json.Marshal(usage)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"cpu": {"usage_in_percents": 10}, "memory": {"memory_usage": 10, "swap_usage": 0, "memory_limit": 0, "swap_limit": 0, "max_memory_usage": 0, "max_swap_usage": 0}, "disabled": ["io", "net"]}`, string(payload))
+}
+
+func TestController_requireCollectors(t *testing.T) {
+	controller := Controller{collectors: newTestRegistry(net.CollectorName)}
+
+	res := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/containers/1/net", nil)
+	err := controller.requireCollectors(res, req, net.CollectorName)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusNotFound, res.Code)
+
+	res = httptest.NewRecorder()
+	err = controller.requireCollectors(res, req, cpu.CollectorName, cpu.HostCollectorName)
+	require.NoError(t, err)
+}
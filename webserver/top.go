@@ -0,0 +1,184 @@
+package webserver
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Scalingo/acadock-monitoring/v2/client"
+	"github.com/Scalingo/acadock-monitoring/v2/gauges"
+	"github.com/Scalingo/go-handlers"
+	"github.com/Scalingo/go-utils/errors/v3"
+	"github.com/Scalingo/go-utils/logger"
+)
+
+// topResources are the gauges summed to compute the consumption of each resource ranked by
+// /host/top
+var topResources = map[string][]string{
+	"cpu":    {gauges.CPU},
+	"memory": {gauges.Memory},
+	"io":     {gauges.IOReadBps, gauges.IOWriteBps},
+	"net":    {gauges.NetRxBps, gauges.NetTxBps},
+}
+
+const defaultTopContainers = 10
+
+// HostTopHandler ranks the containers by their mean consumption of a resource over a window, to
+// find out who is responsible for a busy host
+func (c Controller) HostTopHandler(res http.ResponseWriter, req *http.Request, _ map[string]string) error {
+	ctx := req.Context()
+	log := logger.Get(ctx)
+	query := req.URL.Query()
+
+	badRequest := handlers.NewBadRequestErrors()
+	resource := query.Get("resource")
+	gaugeNames, ok := topResources[resource]
+	if !ok {
+		badRequest.Errors["resource"] = []string{fmt.Sprintf("'%s' is not one of cpu, memory, io and net", resource)}
+	}
+	n := defaultTopContainers
+	if value := query.Get("n"); value != "" {
+		var err error
+		n, err = strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			badRequest.Errors["n"] = []string{fmt.Sprintf("'%s' is not a positive integer", value)}
+		}
+	}
+	if len(badRequest.Errors) > 0 {
+		return badRequest
+	}
+
+	window, err := c.statsWindow(req)
+	if err != nil {
+		return err
+	}
+	if window == 0 {
+		if c.windows == nil || len(c.windows.Lengths()) == 0 {
+			badRequest.Errors["window"] = []string{"no window is configured in STATS_WINDOWS"}
+			return badRequest
+		}
+		window = slices.Min(c.windows.Lengths())
+	}
+	selectors, err := labelSelectors(req)
+	if err != nil {
+		return errors.Wrap(ctx, err, "parse label selectors")
+	}
+	containers, err := c.containers.Containers(ctx)
+	if err != nil {
+		return errors.Wrap(ctx, err, "list containers")
+	}
+
+	top := client.HostTop{
+		Resource:   resource,
+		Window:     window.String(),
+		Containers: []client.HostTopContainer{},
+	}
+	switch resource {
+	case "cpu":
+		hostCPU, err := c.cpu.GetHostUsage()
+		if err != nil {
+			return errors.Wrap(ctx, err, "get host cpu usage")
+		}
+		if hostCPU.Amount > 0 {
+			capacity := float64(100 * hostCPU.Amount)
+			top.Capacity = &capacity
+			// The host CPU gauge is the ratio of the capacity used
+			if mean, _ := c.windows.Means(gauges.HostTarget, gauges.HostCPU, window); mean != nil {
+				host := *mean * capacity
+				top.Host = &host
+			}
+		}
+	case "memory":
+		hostMemory, err := c.procfsMemory.Read(ctx)
+		if err != nil {
+			return errors.Wrap(ctx, err, "get host memory usage")
+		}
+		capacity := float64(hostMemory.MemTotal)
+		top.Capacity = &capacity
+		host := float64(hostMemory.MemUsed())
+		top.Host = &host
+	}
+
+	for _, container := range containers {
+		if !selectors.Matches(container.Labels) {
+			continue
+		}
+		value, previousValue, ok := c.topConsumption(container.ID, gaugeNames, window)
+		if !ok {
+			continue
+		}
+		entry := client.HostTopContainer{
+			ContainerID:   container.ID,
+			Name:          container.Name,
+			Labels:        container.Labels,
+			Value:         value,
+			PreviousValue: previousValue,
+		}
+		if top.Capacity != nil && *top.Capacity > 0 {
+			capacityPercent := value / *top.Capacity * 100
+			entry.CapacityPercent = &capacityPercent
+		}
+		if previousValue != nil && *previousValue > 0 {
+			change := (value - *previousValue) / *previousValue * 100
+			entry.Change = &change
+		}
+		top.Total += value
+		top.Containers = append(top.Containers, entry)
+	}
+
+	// The processes of the host outside of the containers also consume the CPU and the memory
+	consumption := top.Total
+	if top.Host != nil {
+		consumption = *top.Host
+	}
+	for i := range top.Containers {
+		if consumption > 0 {
+			top.Containers[i].Share = top.Containers[i].Value / consumption * 100
+		}
+	}
+	slices.SortFunc(top.Containers, func(a, b client.HostTopContainer) int {
+		if order := cmp.Compare(b.Value, a.Value); order != 0 {
+			return order
+		}
+		return strings.Compare(a.ContainerID, b.ContainerID)
+	})
+	if len(top.Containers) > n {
+		top.Containers = top.Containers[:n]
+	}
+
+	res.WriteHeader(http.StatusOK)
+	err = json.NewEncoder(res).Encode(&top)
+	if err != nil {
+		log.WithError(err).Error("Fail to encode host top payload")
+	}
+	return nil
+}
+
+// topConsumption sums the means of the gauges of a container over the window and over the window
+// preceding it. It returns false if the gauges haven't been collected during the window, the
+// previous consumption is nil if they haven't been collected during the preceding one.
+func (c Controller) topConsumption(id string, gaugeNames []string, window time.Duration) (float64, *float64, bool) {
+	var value, previousValue float64
+	previousCollected := true
+	for _, gauge := range gaugeNames {
+		mean, previousMean := c.windows.Means(id, gauge, window)
+		if mean == nil {
+			return 0, nil, false
+		}
+		value += *mean
+		if previousMean == nil {
+			previousCollected = false
+			continue
+		}
+		previousValue += *previousMean
+	}
+	if !previousCollected {
+		return value, nil, true
+	}
+	return value, &previousValue, true
+}
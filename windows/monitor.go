@@ -0,0 +1,91 @@
+// Package windows keeps the gauges of the targets over the windows configured in STATS_WINDOWS to
+// compute their statistics.
+package windows
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/Scalingo/acadock-monitoring/v2/client"
+	"github.com/Scalingo/acadock-monitoring/v2/collector"
+	"github.com/Scalingo/acadock-monitoring/v2/filters"
+	"github.com/Scalingo/acadock-monitoring/v2/gauges"
+)
+
+var _ collector.SnapshotListener = &Monitor{}
+
+// Monitor adds the gauges of every collected snapshot to the windowed metrics, at the time of the
+// snapshot
+type Monitor struct {
+	lengths []time.Duration
+	metrics *filters.WindowedMetrics
+}
+
+// NewMonitor returns a monitor keeping the gauges during twice the longest of the window lengths,
+// so that every window can be compared to the preceding one
+func NewMonitor(lengths []time.Duration) *Monitor {
+	var retention time.Duration
+	if len(lengths) > 0 {
+		retention = 2 * slices.Max(lengths)
+	}
+	return &Monitor{
+		lengths: lengths,
+		metrics: filters.NewWindowedMetrics(retention),
+	}
+}
+
+// Remove destroys the windows of a target
+func (m *Monitor) Remove(target string) {
+	m.metrics.Remove(target)
+}
+
+func (m *Monitor) SnapshotCollected(ctx context.Context, previous *collector.Snapshot, current *collector.Snapshot, values collector.Gauges) {
+	if len(m.lengths) == 0 {
+		return
+	}
+	for target, targetValues := range values {
+		for gauge, value := range targetValues {
+			m.metrics.Add(target, gauge, current.Time, value)
+		}
+	}
+}
+
+// Lengths returns the lengths of the windows which can be requested
+func (m *Monitor) Lengths() []time.Duration {
+	return m.lengths
+}
+
+// Usage returns the statistics of the gauges of a target over the window of the given length
+func (m *Monitor) Usage(id string, length time.Duration) *client.WindowUsage {
+	return &client.WindowUsage{
+		Length:     length.String(),
+		CPU:        m.stats(id, gauges.CPU, length),
+		Memory:     m.stats(id, gauges.Memory, length),
+		IOReadBps:  m.stats(id, gauges.IOReadBps, length),
+		IOWriteBps: m.stats(id, gauges.IOWriteBps, length),
+		NetRxBps:   m.stats(id, gauges.NetRxBps, length),
+		NetTxBps:   m.stats(id, gauges.NetTxBps, length),
+	}
+}
+
+// Means returns the mean of a gauge of a target over the window of the given length and over the
+// window preceding it, any of them is nil if the gauge hasn't been collected during the window
+func (m *Monitor) Means(id, gauge string, length time.Duration) (*float64, *float64) {
+	var current, previous *float64
+	if stats, err := m.metrics.Stats(id, gauge, length); err == nil {
+		current = &stats.Mean
+	}
+	if stats, err := m.metrics.StatsBefore(id, gauge, length, length); err == nil {
+		previous = &stats.Mean
+	}
+	return current, previous
+}
+
+func (m *Monitor) stats(id, gauge string, length time.Duration) *client.WindowStats {
+	stats, err := m.metrics.Stats(id, gauge, length)
+	if err != nil {
+		return nil
+	}
+	return (*client.WindowStats)(&stats)
+}
@@ -0,0 +1,67 @@
+package windows
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Scalingo/acadock-monitoring/v2/client"
+	"github.com/Scalingo/acadock-monitoring/v2/collector"
+	"github.com/Scalingo/acadock-monitoring/v2/collector/collectortest"
+	"github.com/Scalingo/acadock-monitoring/v2/gauges"
+	"github.com/Scalingo/acadock-monitoring/v2/resources"
+)
+
+func TestMonitor(t *testing.T) {
+	ctx := t.Context()
+	monitor := NewMonitor([]time.Duration{time.Minute, 5 * time.Minute})
+
+	// A snapshot every 30 seconds during 5 minutes, the container reads 30 bytes more each time and
+	// its memory usage grows by 10 bytes
+	series := collectortest.Series{Start: time.Now(), Interval: 30 * time.Second, Targets: func(i int) map[string]collector.Sample {
+		return map[string]collector.Sample{"1": {
+			resources.MemoryCollectorName: client.MemoryUsage{MemoryUsage: uint64(10 * i)},
+			resources.IOCollectorName: client.IOUsage{Devices: []client.IODeviceUsage{
+				{ReadBytes: uint64(20 * i)}, {ReadBytes: uint64(10 * i)},
+			}},
+		}}
+	}}
+	series.Notify(ctx, monitor, 11, nil)
+
+	usage := monitor.Usage("1", time.Minute)
+	assert.Equal(t, "1m0s", usage.Length)
+	require.NotNil(t, usage.Memory)
+	assert.Equal(t, client.WindowStats{Count: 2, Min: 90, Max: 100, Mean: 95, P50: 90, P90: 100, P99: 100}, *usage.Memory)
+	require.NotNil(t, usage.IOReadBps)
+	assert.Equal(t, 1.0, usage.IOReadBps.Mean)
+	assert.Equal(t, 0.0, usage.IOWriteBps.Max)
+	// The collectors of the CPU and network didn't collect anything
+	assert.Nil(t, usage.CPU)
+	assert.Nil(t, usage.NetRxBps)
+
+	usage = monitor.Usage("1", 5*time.Minute)
+	assert.Equal(t, 10, usage.Memory.Count)
+	assert.Equal(t, 10, usage.IOReadBps.Count)
+	assert.Equal(t, 10.0, usage.Memory.Min)
+
+	// The memory usage was 70 and 80 during the minute preceding the last one
+	mean, previousMean := monitor.Means("1", gauges.Memory, time.Minute)
+	require.NotNil(t, mean)
+	assert.Equal(t, 95.0, *mean)
+	require.NotNil(t, previousMean)
+	assert.Equal(t, 75.0, *previousMean)
+	// The gauges are kept twice as long as the longest window
+	mean, previousMean = monitor.Means("1", gauges.Memory, 5*time.Minute)
+	require.NotNil(t, mean)
+	assert.Equal(t, 55.0, *mean)
+	require.NotNil(t, previousMean)
+	assert.Equal(t, 0.0, *previousMean)
+	mean, previousMean = monitor.Means("1", gauges.CPU, time.Minute)
+	assert.Nil(t, mean)
+	assert.Nil(t, previousMean)
+
+	monitor.Remove("1")
+	assert.Nil(t, monitor.Usage("1", 5*time.Minute).Memory)
+}